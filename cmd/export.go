@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// exportCmd represents the export-crontab command
+var exportCmd = &cobra.Command{
+	Use:   "export-crontab path/to/schedule.yaml",
+	Short: "Turn a schedule into a crontab",
+	Long: `Turn a schedule into a crontab
+
+Writes the jobs that run on a cron as a crontab. What crontab can't express,
+such as retries or notifications, is left out and listed as warnings. Usage:
+'cheek export-crontab my_schedule.yaml | crontab -'
+`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := cheek.NewConfig()
+		if err := viper.Unmarshal(&c); err != nil {
+			return err
+		}
+
+		l := cheek.NewLogger(c.LogLevel)
+		crontab, warnings, err := cheek.ExportCrontab(l, c, args[0])
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", w)
+		}
+		_, err = fmt.Fprint(cmd.OutOrStdout(), crontab)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportCmd(t *testing.T) {
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(errOut)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetErr(nil)
+
+	rootCmd.SetArgs([]string{"export-crontab", "../testdata/jobs1.yaml"})
+	assert.NoError(t, rootCmd.Execute())
+	assert.Contains(t, out.String(), "# foo\n* * * * * date\n")
+	assert.Contains(t, errOut.String(), "warning: job 'bar' is left out, it doesn't run on a cron\n")
+}
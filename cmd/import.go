@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var importOutput string
+
+// importCmd represents the import-crontab command
+var importCmd = &cobra.Command{
+	Use:   "import-crontab [path/to/crontab]",
+	Short: "Turn a crontab into a schedule",
+	Long: `Turn a crontab into a schedule
+
+Reads the crontab from the given file, or from stdin when there is none or it
+is '-', and writes the jobs as a schedule. Lines that can't be imported are
+listed with their line number and make it exit with a non-zero code. Usage:
+'crontab -l | cheek import-crontab > my_schedule.yaml'
+`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in := cmd.InOrStdin()
+		if len(args) > 0 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		s, importErr := cheek.ImportCrontab(in)
+		b, err := yaml.Marshal(&s)
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = cmd.OutOrStdout()
+		if importOutput != "" {
+			f, err := os.Create(importOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		if _, err := out.Write(b); err != nil {
+			return err
+		}
+
+		if importErr != nil {
+			fmt.Fprintln(cmd.ErrOrStderr(), importErr)
+			return fmt.Errorf("not all lines of the crontab could be imported")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVarP(&importOutput, "output", "o", "", "Write the schedule to this file instead of stdout.")
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportCmd(t *testing.T) {
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(errOut)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetErr(nil)
+
+	rootCmd.SetIn(bytes.NewBufferString("# say hi\n@hourly echo hi\n"))
+	defer rootCmd.SetIn(nil)
+	rootCmd.SetArgs([]string{"import-crontab"})
+	assert.NoError(t, rootCmd.Execute())
+	assert.Equal(t, "jobs:\n    say_hi:\n        cron: '@hourly'\n        command:\n            - sh\n            - -c\n            - echo hi\n", out.String())
+
+	// the jobs that could be imported are written, the other lines get listed
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	rootCmd.SetArgs([]string{"import-crontab", "-o", fn, "../testdata/crontab"})
+	assert.ErrorContains(t, rootCmd.Execute(), "not all lines of the crontab could be imported")
+	assert.Contains(t, errOut.String(), "line 24: cron string '61 * * * *' not valid")
+	b, err := os.ReadFile(fn)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "nightly_backup_of_the_database:")
+
+	rootCmd.SetArgs([]string{"validate", fn})
+	assert.NoError(t, rootCmd.Execute())
+	importOutput = ""
+}
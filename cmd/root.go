@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	cheek "github.com/datarootsio/cheek/pkg"
 	"github.com/spf13/cobra"
@@ -10,8 +12,22 @@ import (
 )
 
 var (
-	httpPort string
-	homeDir  string
+	httpPort  string
+	bindAddr  string
+	tlsCert   string
+	tlsKey    string
+	homeDir   string
+	authToken string
+	storage   string
+	publicURL string
+	smtpHost  string
+	smtpPort  string
+	smtpUser  string
+	smtpFrom  string
+	smtpTLS   string
+
+	webhookTimeout time.Duration
+	webhookRetries int
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -29,6 +45,19 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&httpPort, "port", "8081", "port on which to open the http server for core to ui communication")
+	rootCmd.PersistentFlags().StringVar(&bindAddr, "bind-address", "0.0.0.0", "address on which to open the http server, e.g. 127.0.0.1 to only accept local connections")
+	rootCmd.PersistentFlags().StringVar(&tlsCert, "tls-cert", "", "certificate file to serve https with, needs --tls-key as well")
+	rootCmd.PersistentFlags().StringVar(&tlsKey, "tls-key", "", "key file that goes with --tls-cert")
+	rootCmd.PersistentFlags().StringVar(&authToken, "auth-token", "", "require this bearer token on all http endpoints except the health check")
+	rootCmd.PersistentFlags().StringVar(&storage, "storage", cheek.StorageJSONL, fmt.Sprintf("where to save the run history, one of %v|%v", cheek.StorageJSONL, cheek.StorageSQLite))
+	rootCmd.PersistentFlags().StringVar(&publicURL, "public-url", "", "url under which the http server can be reached, used to link to jobs from notifications")
+	rootCmd.PersistentFlags().StringVar(&smtpHost, "smtp-host", "", "smtp server to send email notifications through")
+	rootCmd.PersistentFlags().StringVar(&smtpPort, "smtp-port", "587", "port of the smtp server")
+	rootCmd.PersistentFlags().StringVar(&smtpUser, "smtp-username", "", "username to authenticate with at the smtp server, pass the password via CHEEK_SMTPPASSWORD")
+	rootCmd.PersistentFlags().StringVar(&smtpFrom, "smtp-from", "", "address to send email notifications from, defaults to the smtp username")
+	rootCmd.PersistentFlags().StringVar(&smtpTLS, "smtp-tls", cheek.SMTPTLSStartTLS, fmt.Sprintf("how to secure the connection to the smtp server, one of %v|%v|%v", cheek.SMTPTLSStartTLS, cheek.SMTPTLSImplicit, cheek.SMTPTLSNone))
+	rootCmd.PersistentFlags().DurationVar(&webhookTimeout, "webhook-timeout", 10*time.Second, "how long a single webhook call can take")
+	rootCmd.PersistentFlags().IntVar(&webhookRetries, "webhook-retries", 2, "how many times to retry a webhook call that failed")
 	rootCmd.PersistentFlags().StringVar(&homeDir, "homedir", cheek.CheekPath(), fmt.Sprintf("directory in which to save cheek's core & job logs, defaults to '%s'", cheek.CheekPath()))
 	cobra.OnInitialize(initConfig)
 }
@@ -58,6 +87,88 @@ func initConfig() {
 		fmt.Printf("error binding pflag %s", err)
 	}
 
+	if err := viper.BindPFlag("logFormat", runCmd.PersistentFlags().Lookup("log-format")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	// CHEEK_LOG_LEVEL and CHEEK_LOG_FORMAT work as well
+	for key, env := range map[string]string{"logLevel": "CHEEK_LOG_LEVEL", "logFormat": "CHEEK_LOG_FORMAT"} {
+		if err := viper.BindEnv(key, "CHEEK_"+strings.ToUpper(key), env); err != nil {
+			fmt.Printf("error binding env %s", err)
+		}
+	}
+
+	if err := viper.BindPFlag("metrics", runCmd.PersistentFlags().Lookup("metrics")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("accessLogLevel", runCmd.PersistentFlags().Lookup("access-log-level")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("accessLogHealth", runCmd.PersistentFlags().Lookup("access-log-health")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("authToken", rootCmd.PersistentFlags().Lookup("auth-token")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("storage", rootCmd.PersistentFlags().Lookup("storage")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("publicURL", rootCmd.PersistentFlags().Lookup("public-url")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("webhookTimeout", rootCmd.PersistentFlags().Lookup("webhook-timeout")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("webhookRetries", rootCmd.PersistentFlags().Lookup("webhook-retries")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	serverFlags := map[string]string{
+		"bindAddress": "bind-address",
+		"tlsCert":     "tls-cert",
+		"tlsKey":      "tls-key",
+	}
+	for key, flag := range serverFlags {
+		if err := viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			fmt.Printf("error binding pflag %s", err)
+		}
+	}
+
+	smtpFlags := map[string]string{
+		"smtpHost":     "smtp-host",
+		"smtpPort":     "smtp-port",
+		"smtpUsername": "smtp-username",
+		"smtpFrom":     "smtp-from",
+		"smtpTLS":      "smtp-tls",
+	}
+	for key, flag := range smtpFlags {
+		if err := viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			fmt.Printf("error binding pflag %s", err)
+		}
+	}
+
+	// the smtp password can only be passed via the environment
+	if err := viper.BindEnv("smtpPassword"); err != nil {
+		fmt.Printf("error binding env %s", err)
+	}
+
+	// same goes for the telegram bot token
+	if err := viper.BindEnv("telegramBotToken"); err != nil {
+		fmt.Printf("error binding env %s", err)
+	}
+
+	// and for the token to fetch a schedule from a url with
+	if err := viper.BindEnv("scheduleToken"); err != nil {
+		fmt.Printf("error binding env %s", err)
+	}
+
 	if err := viper.BindPFlag("homedir", rootCmd.PersistentFlags().Lookup("homedir")); err != nil {
 		fmt.Printf("error binding pflag %s", err)
 	}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -8,6 +9,20 @@ import (
 	"github.com/spf13/viper"
 )
 
+func TestMain(m *testing.M) {
+	// keep the logs of the tests out of the real home directory
+	dir, err := os.MkdirTemp("", "cheek-test-")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Setenv("CHEEK_HOME", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestEnvVar(t *testing.T) {
 	// check if this works how I assume it works
 	initConfig()
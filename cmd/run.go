@@ -11,16 +11,20 @@ import (
 )
 
 var (
-	pretty       bool
-	suppressLogs bool
-	logLevel     string
+	pretty          bool
+	suppressLogs    bool
+	logLevel        string
+	logFormat       string
+	metrics         bool
+	accessLogLevel  string
+	accessLogHealth bool
 )
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run path/to/schedule.yaml",
 	Short: "Schedule & run jobs",
-	Long:  "Schedule & run jobs",
+	Long:  "Schedule & run jobs, the schedule can be a file, a directory of yaml files or a glob",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		c := cheek.NewConfig()
@@ -28,7 +32,10 @@ var runCmd = &cobra.Command{
 			fmt.Println("cannot init configuration")
 			os.Exit(1)
 		}
-		l := cheek.NewLogger(logLevel, cheek.PrettyStdout())
+		l, err := newLogger(c)
+		if err != nil {
+			return err
+		}
 		return cheek.RunSchedule(l, c, args[0])
 	},
 }
@@ -37,5 +44,22 @@ func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.PersistentFlags().BoolVarP(&pretty, "pretty", "p", true, "Output pretty formatted logs to console.")
 	runCmd.PersistentFlags().BoolVarP(&suppressLogs, "suppress-logs", "s", false, "Do not output logs to stdout, only to file.")
+	runCmd.PersistentFlags().StringVar(&accessLogLevel, "access-log-level", "info", "level at which requests to the http server get logged")
+	runCmd.PersistentFlags().BoolVar(&accessLogHealth, "access-log-health", false, "Also log the requests to /healthz and /readyz.")
+	runCmd.PersistentFlags().BoolVar(&metrics, "metrics", false, "Expose Prometheus metrics on the /metrics endpoint of the http server.")
+	runCmd.PersistentFlags().StringVar(&logFormat, "log-format", "", fmt.Sprintf("Format of the logs on stdout, one of %v|%v, defaults to %v unless --pretty=false", cheek.LogFormatConsole, cheek.LogFormatJSON, cheek.LogFormatConsole))
 	runCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "l", "info", fmt.Sprintf("Set log level, can be one of %v|%v|%v|%v|%v|%v|%v (only applies to cheek specific logging)", zl.LevelTraceValue, zl.LevelDebugValue, zl.LevelInfoValue, zl.LevelWarnValue, zl.LevelErrorValue, zl.LevelFatalValue, zl.LevelPanicValue))
 }
+
+// newLogger sets up cheek's logger with the level and format of the config,
+// without --log-format, --pretty=false asks for JSON.
+func newLogger(c cheek.Config) (zl.Logger, error) {
+	if c.LogFormat == "" && !c.Pretty {
+		c.LogFormat = cheek.LogFormatJSON
+	}
+	w, err := cheek.StdoutLogWriter(c)
+	if err != nil {
+		return zl.Logger{}, err
+	}
+	return cheek.NewLogger(c.LogLevel, w), nil
+}
@@ -12,3 +12,16 @@ func TestRunCmd(t *testing.T) {
 	err := rootCmd.Execute()
 	assert.Contains(t, err.Error(), "no such file or directory")
 }
+
+func TestRunCmdInvalidSchedule(t *testing.T) {
+	rootCmd.SetArgs([]string{"run", "../testdata/invalid_trigger.yaml"})
+	err := rootCmd.Execute()
+	assert.Contains(t, err.Error(), "i_do_not_exist")
+}
+
+func TestRunCmdInvalidLogFormat(t *testing.T) {
+	t.Setenv("CHEEK_LOG_FORMAT", "logfmt")
+	rootCmd.SetArgs([]string{"run", "../testdata/not-exists.yaml"})
+	err := rootCmd.Execute()
+	assert.EqualError(t, err, "log format should be one of console|json, got 'logfmt'")
+}
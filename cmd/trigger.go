@@ -6,6 +6,8 @@ import (
 	"github.com/spf13/viper"
 )
 
+var triggerParams map[string]string
+
 // triggerCmd represents the trigger command
 var triggerCmd = &cobra.Command{
 	Use:   "trigger {schedule.yaml} {job_name}",
@@ -14,6 +16,8 @@ var triggerCmd = &cobra.Command{
 
 The name should be defined in your schedule specs. Usage:
 'cheek trigger my_schedule.yaml my_job'
+
+Parameters for the templates of the job can be passed with --param key=value.
 `,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -21,12 +25,16 @@ The name should be defined in your schedule specs. Usage:
 		if err := viper.Unmarshal(&c); err != nil {
 			return err
 		}
-		l := cheek.NewLogger(logLevel, cheek.PrettyStdout())
-		_, err := cheek.RunJob(l, c, args[0], args[1])
+		l, err := newLogger(c)
+		if err != nil {
+			return err
+		}
+		_, err = cheek.RunJob(l, c, args[0], args[1], triggerParams)
 		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(triggerCmd)
+	triggerCmd.Flags().StringToStringVar(&triggerParams, "param", map[string]string{}, "Parameter to render the job's templates with, as key=value, can be repeated.")
 }
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var validateJSON bool
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate path/to/schedule.yaml",
+	Short: "Check a schedule without running it",
+	Long: `Check a schedule without running it
+
+Reports all problems with the specs at once and exits with a non-zero code
+when there are any. Usage:
+'cheek validate my_schedule.yaml'
+`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := cheek.NewConfig()
+		if err := viper.Unmarshal(&c); err != nil {
+			return err
+		}
+
+		problems := cheek.ValidateFile(c, args[0])
+		out := cmd.OutOrStdout()
+		if validateJSON {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(cheek.ValidateResponse{Valid: len(problems) == 0, Problems: problems}); err != nil {
+				return err
+			}
+		} else {
+			for _, p := range problems {
+				job := p.Job
+				if job == "" {
+					job = "schedule"
+				}
+				fmt.Fprintf(out, "%s: %s\n", job, p.Message)
+			}
+		}
+
+		if len(problems) > 0 {
+			return fmt.Errorf("found %v problem(s) in '%s'", len(problems), args[0])
+		}
+		if !validateJSON {
+			fmt.Fprintf(out, "'%s' is valid\n", args[0])
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().BoolVar(&validateJSON, "json", false, "Output the problems as json.")
+}
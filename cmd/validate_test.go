@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCmd(t *testing.T) {
+	out := new(bytes.Buffer)
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	rootCmd.SetArgs([]string{"validate", "../testdata/jobs1.yaml"})
+	assert.NoError(t, rootCmd.Execute())
+	assert.Contains(t, out.String(), "is valid")
+
+	out.Reset()
+	rootCmd.SetArgs([]string{"validate", "../testdata/invalid_many.yaml"})
+	err := rootCmd.Execute()
+	assert.ErrorContains(t, err, "found 6 problem(s)")
+	assert.Contains(t, out.String(), "foo: cron string for job 'foo' not valid")
+	assert.Contains(t, out.String(), "schedule: trigger_job cycle detected")
+
+	out.Reset()
+	rootCmd.SetArgs([]string{"validate", "--json", "../testdata/invalid_trigger.yaml"})
+	assert.Error(t, rootCmd.Execute())
+	resp := cheek.ValidateResponse{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &resp))
+	assert.False(t, resp.Valid)
+	assert.Equal(t, []cheek.ValidationProblem{{Job: "foo", Message: "cannot find spec of job 'i_do_not_exist' that is referenced in job 'foo'"}}, resp.Problems)
+}
@@ -0,0 +1,106 @@
+package cheek
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cancelGracePeriod is how long a canceled run gets to exit after SIGTERM
+// before its process group gets killed.
+var cancelGracePeriod = 10 * time.Second
+
+// runningProcess is the command of a run in progress that can be canceled.
+type runningProcess struct {
+	cancel  context.CancelFunc
+	started time.Time
+	// the output of the run so far, for streaming
+	output *logBroadcast
+
+	mu       sync.Mutex
+	canceled bool
+	kill     *time.Timer
+	// the pids that got killed along with the process group
+	killedPids []int
+}
+
+// terminate stops the command of a run once its context is done. A run that
+// got canceled, or called off as a whole, is asked to stop with term before
+// getting killed, anything else (i.e. a timeout) gets killed right away.
+func (p *runningProcess) terminate(calledOff bool, term func() error, kill func() ([]int, error)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.canceled && !calledOff {
+		pids, err := kill()
+		p.killedPids = pids
+		return err
+	}
+
+	p.kill = time.AfterFunc(cancelGracePeriod, func() {
+		pids, _ := kill()
+		p.mu.Lock()
+		p.killedPids = pids
+		p.mu.Unlock()
+	})
+	return term()
+}
+
+// killed returns the pids that got killed when the run was terminated.
+func (p *runningProcess) killed() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.killedPids
+}
+
+// done stops the pending kill of a canceled run once its command exited and
+// tells whether the run got canceled.
+func (p *runningProcess) done() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.kill != nil {
+		p.kill.Stop()
+	}
+	return p.canceled
+}
+
+// track registers the command of a run of a job until the returned func gets called.
+func (s *Schedule) track(job string, p *runningProcess) func() {
+	if s == nil {
+		return func() {}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == nil {
+		s.running = map[string]map[*runningProcess]struct{}{}
+	}
+	if s.running[job] == nil {
+		s.running[job] = map[*runningProcess]struct{}{}
+	}
+	s.running[job][p] = struct{}{}
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.running[job], p)
+		if len(s.running[job]) == 0 {
+			delete(s.running, job)
+		}
+	}
+}
+
+// cancelRuns cancels all runs of a job that are in progress and returns how many there were.
+func (s *Schedule) cancelRuns(job string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for p := range s.running[job] {
+		p.mu.Lock()
+		p.canceled = true
+		p.mu.Unlock()
+		p.cancel()
+	}
+	return len(s.running[job])
+}
@@ -0,0 +1,132 @@
+package cheek
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelRun(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	j := &JobSpec{
+		Name:           "test_cancel",
+		Command:        []string{"sleep", "30"},
+		Retries:        2,
+		RetryDelay:     time.Millisecond,
+		OnError:        OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}},
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+		log:            s.log,
+	}
+	s.Jobs = map[string]*JobSpec{j.Name: j}
+	handler := setupMux(s)
+
+	cancel := func() int {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("POST", "/jobs/test_cancel/cancel", nil))
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusConflict, cancel())
+
+	done := make(chan JobRun)
+	go func() { done <- j.execCommandWithRetry(context.Background(), "test", nil) }()
+	assert.Eventually(t, func() bool { return cancel() == http.StatusAccepted }, 5*time.Second, 10*time.Millisecond)
+
+	// the run stops right away, without retries, and fires on_error
+	select {
+	case jr := <-done:
+		assert.Equal(t, StatusCanceled, jr.Status)
+		assert.Equal(t, RunStateCanceled, jr.State)
+		assert.Contains(t, jr.Log, "job canceled via the api")
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not get canceled")
+	}
+	assert.Equal(t, []string{RunStateCanceled}, rec.get("/error"))
+	assert.Equal(t, http.StatusConflict, cancel())
+
+	// unless asked not to
+	notify := false
+	j.NotifyOnCancel = &notify
+	go func() { done <- j.execCommandWithRetry(context.Background(), "test", nil) }()
+	assert.Eventually(t, func() bool { return s.cancelRuns(j.Name) == 1 }, 5*time.Second, 10*time.Millisecond)
+	<-done
+	assert.Len(t, rec.get("/error"), 1)
+}
+
+func TestCancelGracePeriod(t *testing.T) {
+	defer func(d time.Duration) { cancelGracePeriod = d }(cancelGracePeriod)
+	cancelGracePeriod = 200 * time.Millisecond
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local}
+	j := &JobSpec{
+		Name:           "test_cancel_grace",
+		Command:        []string{"sh", "-c", "trap '' TERM; sleep 30"},
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+		log:            NewLogger("debug", new(tsBuffer)),
+	}
+
+	done := make(chan JobRun)
+	go func() { done <- j.execCommandWithRetry(context.Background(), "test", nil) }()
+	assert.Eventually(t, func() bool { return s.cancelRuns(j.Name) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the command ignores SIGTERM, so it gets killed once the grace period passed
+	start := time.Now()
+	select {
+	case jr := <-done:
+		assert.Equal(t, RunStateCanceled, jr.State)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not get killed")
+	}
+}
+
+func TestCallOffRun(t *testing.T) {
+	defer func(d time.Duration) { cancelGracePeriod = d }(cancelGracePeriod)
+	cancelGracePeriod = 200 * time.Millisecond
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test_call_off",
+		Command:        []string{"sleep", "30"},
+		Retries:        2,
+		RetryDelay:     time.Hour,
+		globalSchedule: &Schedule{loc: time.Local},
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+		log:            NewLogger("debug", new(tsBuffer)),
+	}
+
+	// a run in progress gets canceled along with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	jr := j.execCommandWithRetry(ctx, "test", nil)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, StatusCanceled, jr.Status)
+	assert.Equal(t, RunStateCanceled, jr.State)
+	assert.Contains(t, jr.Log, "job canceled: context deadline exceeded")
+
+	// as does the wait for a retry
+	j.Command = []string{"false"}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	jr = j.execCommandWithRetry(ctx, "test", nil)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1, jr.Status)
+}
@@ -0,0 +1,139 @@
+package cheek
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Supported ways to pick up structured output from the output of a run.
+const (
+	// CaptureOutputLastJSONLine parses the last line of output that starts with {.
+	CaptureOutputLastJSONLine string = "last_json_line"
+	// CaptureOutputPrefixed parses and merges the lines that start with captureOutputPrefix.
+	CaptureOutputPrefixed string = "prefixed"
+)
+
+// captureOutputPrefix marks the lines that hold output with capture_output: prefixed.
+const captureOutputPrefix = "::cheek::"
+
+// maxCapturedLine is how long a line can get before it is no longer
+// considered for capturing output.
+const maxCapturedLine = 64 * 1024
+
+func (j *JobSpec) ValidateCaptureOutput() error {
+	switch j.CaptureOutput {
+	case "", CaptureOutputLastJSONLine, CaptureOutputPrefixed:
+		return nil
+	}
+	return fmt.Errorf("capture_output for job '%s' should be one of '%s' or '%s', got '%s'", j.Name, CaptureOutputLastJSONLine, CaptureOutputPrefixed, j.CaptureOutput)
+}
+
+// outputCapture picks up the lines of the output of a run that hold
+// structured output, it sees the output before it gets timestamped.
+type outputCapture struct {
+	mode string
+	// the line that is being written
+	line    bytes.Buffer
+	tooLong bool
+	// the lines that hold output
+	lines []string
+}
+
+// newOutputCapture returns where the output of a run goes to be captured, nil
+// when the job doesn't capture its output.
+func (j *JobSpec) newOutputCapture() *outputCapture {
+	if j.CaptureOutput == "" {
+		return nil
+	}
+	return &outputCapture{mode: j.CaptureOutput}
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			c.add(rest)
+			break
+		}
+		c.add(rest[:i])
+		c.endLine()
+		rest = rest[i+1:]
+	}
+	return len(p), nil
+}
+
+func (c *outputCapture) add(p []byte) {
+	if c.tooLong || c.line.Len()+len(p) > maxCapturedLine {
+		c.tooLong = true
+		c.line.Reset()
+		return
+	}
+	c.line.Write(p)
+}
+
+func (c *outputCapture) endLine() {
+	line := strings.TrimSpace(c.line.String())
+	tooLong := c.tooLong
+	c.line.Reset()
+	c.tooLong = false
+	if tooLong {
+		return
+	}
+
+	switch c.mode {
+	case CaptureOutputLastJSONLine:
+		if strings.HasPrefix(line, "{") {
+			c.lines = []string{line}
+		}
+	case CaptureOutputPrefixed:
+		if strings.HasPrefix(line, captureOutputPrefix) {
+			c.lines = append(c.lines, strings.TrimSpace(strings.TrimPrefix(line, captureOutputPrefix)))
+		}
+	}
+}
+
+// result parses the captured lines, later lines override the keys of earlier
+// ones. Lines that don't hold a JSON object are left out with a debug log.
+func (c *outputCapture) result(jr *JobRun) map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	// the output might not end with a newline
+	c.endLine()
+
+	var output map[string]interface{}
+	for _, line := range c.lines {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(maskSecrets(line, jr.secrets)), &fields); err != nil {
+			jr.jobRef.log.Debug().Str("job", jr.Name).Str("run_id", jr.ID).Err(err).Msg("ignoring output that is not a JSON object")
+			continue
+		}
+		if output == nil {
+			output = map[string]interface{}{}
+		}
+		for k, v := range fields {
+			output[k] = v
+		}
+	}
+	return output
+}
+
+// outputParams turns the captured output of a run into parameters, values
+// that are no strings become their JSON.
+func outputParams(output map[string]interface{}) map[string]string {
+	params := make(map[string]string, len(output))
+	for k, v := range output {
+		if s, ok := v.(string); ok {
+			params[k] = s
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		params[k] = string(b)
+	}
+	return params
+}
@@ -0,0 +1,77 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCaptureOutput(t *testing.T) {
+	assert.NoError(t, (&JobSpec{CaptureOutput: CaptureOutputLastJSONLine}).ValidateCaptureOutput())
+	assert.NoError(t, (&JobSpec{CaptureOutput: CaptureOutputPrefixed}).ValidateCaptureOutput())
+	assert.NoError(t, (&JobSpec{}).ValidateCaptureOutput())
+	assert.Error(t, (&JobSpec{CaptureOutput: "json"}).ValidateCaptureOutput())
+}
+
+func TestOutputCapture(t *testing.T) {
+	jr := &JobRun{jobRef: &JobSpec{}, secrets: []string{"hunter2"}}
+
+	c := &outputCapture{mode: CaptureOutputLastJSONLine}
+	// lines can arrive in several writes, the last one without a newline
+	for _, s := range []string{"starting\n{\"rows\": 1}\n", "{\"rows\": 2, \"tok", "en\": \"hunter2\"}\r\ndone\n", `{"rows": 3`} {
+		_, err := c.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	// the last line is malformed and ignored
+	assert.Nil(t, c.result(jr))
+
+	c = &outputCapture{mode: CaptureOutputLastJSONLine}
+	_, _ = c.Write([]byte("{\"rows\": 1}\n{\"rows\": 2, \"token\": \"hunter2\"}\ndone\n"))
+	assert.Equal(t, map[string]interface{}{"rows": 2.0, "token": "***"}, c.result(jr))
+
+	c = &outputCapture{mode: CaptureOutputPrefixed}
+	_, _ = c.Write([]byte("::cheek:: {\"rows\": 1, \"table\": \"a\"}\n{\"rows\": 5}\n::cheek::not json\n::cheek::{\"rows\": 2}"))
+	assert.Equal(t, map[string]interface{}{"rows": 2.0, "table": "a"}, c.result(jr))
+
+	// lines that are too long are skipped
+	c = &outputCapture{mode: CaptureOutputLastJSONLine}
+	_, _ = c.Write([]byte(`{"a": "`))
+	_, _ = c.Write(make([]byte, maxCapturedLine))
+	_, _ = c.Write([]byte("\"}\n"))
+	assert.Nil(t, c.result(jr))
+}
+
+func TestCaptureOutput(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:          "test",
+		Command:       []string{"sh", "-c", `echo working; echo '{"rows": 3, "table": "sales", "parts": [1, 2]}'`},
+		CaptureOutput: CaptureOutputLastJSONLine,
+		LogTimestamps: LogTimestampsRFC3339,
+		cfg:           cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, map[string]interface{}{"rows": 3.0, "table": "sales", "parts": []interface{}{1.0, 2.0}}, jr.Output)
+	b, err := json.Marshal(jr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"output":{"parts":[1,2],"rows":3,"table":"sales"}`)
+
+	// triggered jobs get the output as parameters
+	params, err := j.triggerParams(&jr, JobTrigger{Name: "next", Params: map[string]string{"summary": "{{ .rows }} rows of {{ .table }}"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"rows": "3", "table": "sales", "parts": "[1,2]", "summary": "3 rows of sales"}, params)
+
+	// output that is not JSON doesn't fail the run
+	j.Command = []string{"sh", "-c", "echo '{oops'"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Nil(t, jr.Output)
+}
@@ -0,0 +1,223 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adhocore/gronx"
+)
+
+// Supported ways to catch up on ticks that were missed while cheek was down.
+const (
+	CatchupPolicyLatest = "latest"
+	CatchupPolicyAll    = "all"
+)
+
+// maxCatchupRuns bounds how many missed ticks get run with the all policy.
+const maxCatchupRuns = 100
+
+// catchupMu guards the file with the last ticks of the jobs.
+var catchupMu sync.Mutex
+
+func catchupFile() string {
+	return path.Join(CheekPath(), "catchup.json")
+}
+
+func (j *JobSpec) ValidateCatchup() error {
+	switch j.CatchupPolicy {
+	case "", CatchupPolicyLatest, CatchupPolicyAll:
+	default:
+		return fmt.Errorf("catchup_policy for job '%s' should be one of '%s' or '%s', got '%s'", j.Name, CatchupPolicyLatest, CatchupPolicyAll, j.CatchupPolicy)
+	}
+	if j.Catchup && j.Cron == "" && len(j.At) == 0 {
+		return fmt.Errorf("catchup for job '%s' needs a cron or at", j.Name)
+	}
+	return nil
+}
+
+// loadTicks reads the last tick of each job that catches up on missed ticks.
+func loadTicks() (map[string]time.Time, error) {
+	ticks := map[string]time.Time{}
+	b, err := os.ReadFile(catchupFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return ticks, nil
+	}
+	if err != nil {
+		return ticks, err
+	}
+	if err := json.Unmarshal(b, &ticks); err != nil {
+		return map[string]time.Time{}, fmt.Errorf("cannot read '%s': %w", catchupFile(), err)
+	}
+	return ticks, nil
+}
+
+// recordTicks saves refTime as the last tick of the given jobs, unless they
+// have a later one already.
+func recordTicks(jobs []string, refTime time.Time) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	catchupMu.Lock()
+	defer catchupMu.Unlock()
+
+	ticks, err := loadTicks()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if last, ok := ticks[job]; !ok || refTime.After(last) {
+			ticks[job] = refTime
+		}
+	}
+	b, err := json.Marshal(ticks)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ensureDataDir(); err != nil {
+		return err
+	}
+	fp := catchupFile()
+	tmp, err := os.CreateTemp(path.Dir(fp), path.Base(fp)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fp)
+}
+
+// recordTick saves the tick a run was scheduled at as the last tick of its job
+// once the run succeeded, for jobs that catch up on missed ticks and one-shot
+// jobs. The tick of a run that failed or got interrupted is not saved, so that
+// it gets caught up on when cheek starts again.
+func (j *JobSpec) recordTick(jr *JobRun) {
+	if (!j.Catchup && len(j.At) == 0) || jr.ScheduledAt == nil || jr.retrying || !jr.succeeded() {
+		return
+	}
+	if err := recordTicks([]string{j.Name}, *jr.ScheduledAt); err != nil {
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("cannot record the last tick of the job")
+	}
+}
+
+// missedTicks lists the ticks of the job's cron, or its timestamps, after
+// last up to refTime.
+func (j *JobSpec) missedTicks(last, refTime time.Time) ([]time.Time, error) {
+	if j.loc != nil {
+		last = last.In(j.loc)
+	}
+
+	ticks := []time.Time{}
+	if len(j.At) > 0 {
+		for t := j.nextAt(last, false); !t.IsZero() && !t.After(refTime); t = j.nextAt(t, false) {
+			ticks = append(ticks, t)
+		}
+		if len(ticks) > maxCatchupRuns {
+			ticks = ticks[len(ticks)-maxCatchupRuns:]
+		}
+		return ticks, nil
+	}
+
+	for {
+		t, err := gronx.NextTickAfter(j.Cron, last, false)
+		if err != nil {
+			return ticks, err
+		}
+		if t.After(refTime) {
+			return ticks, nil
+		}
+		ticks = append(ticks, t)
+		if len(ticks) > maxCatchupRuns {
+			ticks = ticks[1:]
+		}
+		last = t
+	}
+}
+
+// catchup is a job along with the ticks it missed.
+type catchup struct {
+	job   *JobSpec
+	ticks []time.Time
+}
+
+// catchups determines the ticks the jobs that catch up missed since their
+// last recorded tick, depending on their catchup_policy the latest or all of
+// them. Jobs without a recorded tick start being tracked from refTime on,
+// except for one-shot jobs whose timestamps that passed never ran. The ticks
+// that get caught up on are recorded once their runs succeeded.
+func (s *Schedule) catchups(refTime time.Time) []catchup {
+	jobs := []*JobSpec{}
+	s.mu.RLock()
+	for _, j := range s.Jobs {
+		if j.Catchup && j.scheduled() {
+			jobs = append(jobs, j)
+		}
+	}
+	s.mu.RUnlock()
+	if len(jobs) == 0 {
+		return nil
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+
+	catchupMu.Lock()
+	ticks, err := loadTicks()
+	catchupMu.Unlock()
+	if err != nil {
+		s.log.Warn().Err(err).Msg("cannot read the last ticks of jobs that catch up, not catching up")
+	}
+
+	catchups := []catchup{}
+	untracked := []string{}
+	for _, j := range jobs {
+		last, ok := ticks[j.Name]
+		if !ok && len(j.At) == 0 {
+			untracked = append(untracked, j.Name)
+			continue
+		}
+
+		missed, err := j.missedTicks(last, refTime)
+		if err != nil {
+			s.log.Warn().Str("job", j.Name).Err(err).Msg("cannot determine missed ticks")
+			continue
+		}
+		if len(missed) == 0 {
+			continue
+		}
+		if j.CatchupPolicy != CatchupPolicyAll {
+			missed = missed[len(missed)-1:]
+		} else if len(missed) == maxCatchupRuns {
+			s.log.Warn().Str("job", j.Name).Msgf("catching up on the last %v missed ticks only", maxCatchupRuns)
+		}
+		catchups = append(catchups, catchup{job: j, ticks: missed})
+	}
+
+	if err := recordTicks(untracked, refTime); err != nil {
+		s.log.Warn().Err(err).Msg("cannot record the last ticks of jobs that catch up")
+	}
+	return catchups
+}
+
+// run runs the missed ticks of the job one after the other, until ctx is done.
+func (c catchup) run(ctx context.Context) {
+	for _, tick := range c.ticks {
+		if ctx.Err() != nil {
+			return
+		}
+		c.job.log.Info().Str("job", c.job.Name).Msgf("catching up on the run of %v", tick)
+		c.job.dispatch(ctx, runRequest{id: newRunID(), trigger: fmt.Sprintf("catchup[%s]", tick.Format(time.RFC3339)), params: map[string]string{}, scheduledAt: tick})
+	}
+}
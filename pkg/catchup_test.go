@@ -0,0 +1,91 @@
+package cheek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatchups(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{Jobs: map[string]*JobSpec{}, loc: time.UTC, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	for name, policy := range map[string]string{"latest": "", "all": CatchupPolicyAll, "new": ""} {
+		s.Jobs[name] = &JobSpec{Name: name, Cron: "0 2 * * *", Command: []string{"true"}, Catchup: true, CatchupPolicy: policy, loc: time.UTC, globalSchedule: s, inFlight: newRunTracker(), log: s.log, cfg: cfg}
+	}
+	s.Jobs["plain"] = &JobSpec{Name: "plain", Cron: "0 2 * * *", Command: []string{"true"}, loc: time.UTC}
+
+	// down from the 1st to the 4th, missing 3 nightly runs
+	down := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	assert.NoError(t, recordTicks([]string{"latest", "all", "plain-not-tracked"}, down))
+	refTime := time.Date(2024, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	catchups := s.catchups(refTime)
+	if assert.Len(t, catchups, 2) {
+		assert.Equal(t, "all", catchups[0].job.Name)
+		assert.Equal(t, []time.Time{
+			time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 3, 2, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 4, 2, 0, 0, 0, time.UTC),
+		}, catchups[0].ticks)
+		assert.Equal(t, "latest", catchups[1].job.Name)
+		assert.Equal(t, []time.Time{time.Date(2024, 1, 4, 2, 0, 0, 0, time.UTC)}, catchups[1].ticks)
+	}
+
+	// jobs that catch up are tracked from now on, others are not
+	ticks, err := loadTicks()
+	assert.NoError(t, err)
+	assert.True(t, ticks["new"].Equal(refTime))
+	assert.True(t, ticks["latest"].Equal(down))
+	assert.NotContains(t, ticks, "plain")
+
+	// the missed ticks run in order
+	catchups[0].run(context.Background())
+	jrs, _, err := s.history().runs("all", 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, jrs, 3) {
+		assert.Equal(t, "catchup[2024-01-04T02:00:00Z]", jrs[0].TriggeredBy)
+		assert.Equal(t, "catchup[2024-01-02T02:00:00Z]", jrs[2].TriggeredBy)
+		assert.True(t, jrs[2].ScheduledAt.Equal(time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)))
+	}
+
+	// a tick only counts once its run succeeded, until then a restart catches up on it again
+	s.Jobs["latest"].Command = []string{"false"}
+	catchups[1].run(context.Background())
+	ticks, _ = loadTicks()
+	assert.True(t, ticks["all"].Equal(time.Date(2024, 1, 4, 2, 0, 0, 0, time.UTC)))
+	assert.True(t, ticks["latest"].Equal(down))
+	catchups = s.catchups(refTime.Add(time.Hour))
+	if assert.Len(t, catchups, 1) {
+		assert.Equal(t, "latest", catchups[0].job.Name)
+	}
+	s.Jobs["latest"].Command = []string{"true"}
+	catchups[0].run(context.Background())
+	assert.Empty(t, s.catchups(refTime.Add(time.Hour)))
+
+	// ticks of runs that became due get recorded, an earlier one doesn't overwrite a later one
+	later := refTime.Add(24 * time.Hour)
+	for _, at := range []time.Time{later, refTime} {
+		s.Jobs["latest"].recordTick(&JobRun{ScheduledAt: &at, jobRef: s.Jobs["latest"]})
+		s.Jobs["plain"].recordTick(&JobRun{ScheduledAt: &at, jobRef: s.Jobs["plain"]})
+	}
+	ticks, _ = loadTicks()
+	assert.True(t, ticks["latest"].Equal(later))
+	assert.NotContains(t, ticks, "plain")
+
+	assert.Error(t, (&JobSpec{CatchupPolicy: "some"}).ValidateCatchup())
+	assert.Error(t, (&JobSpec{Catchup: true}).ValidateCatchup())
+	assert.NoError(t, (&JobSpec{Catchup: true, Cron: "* * * * *", CatchupPolicy: CatchupPolicyAll}).ValidateCatchup())
+}
+
+func TestMissedTicksAreBounded(t *testing.T) {
+	j := &JobSpec{Cron: "* * * * *"}
+	refTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ticks, err := j.missedTicks(refTime.Add(-24*time.Hour), refTime)
+	assert.NoError(t, err)
+	assert.Len(t, ticks, maxCatchupRuns)
+	assert.Equal(t, refTime, ticks[len(ticks)-1])
+}
@@ -0,0 +1,63 @@
+package cheek
+
+import (
+	"fmt"
+	"sort"
+)
+
+// parentRun is what a run passes along to the jobs it triggers.
+type parentRun struct {
+	job    string
+	params map[string]string
+	output map[string]interface{}
+}
+
+// asParent returns what the run passes along to the jobs it triggers.
+func (jr *JobRun) asParent() *parentRun {
+	return &parentRun{job: jr.Name, params: jr.Params, output: jr.Output}
+}
+
+// addTemplateData lets the templates of a triggered run refer to the run with
+// the given id that triggered it as .parent.
+func (p *parentRun) addTemplateData(data map[string]interface{}, runID string) {
+	if p == nil {
+		return
+	}
+	params := p.params
+	if params == nil {
+		params = map[string]string{}
+	}
+	output := p.output
+	if output == nil {
+		output = map[string]interface{}{}
+	}
+	data["parent"] = map[string]interface{}{"job": p.job, "run_id": runID, "params": params, "output": output}
+}
+
+// env describes the run with the given id that triggered a run to its
+// command, through CHEEK_PARENT_* environment variables. Values that are no
+// strings become their JSON.
+func (p *parentRun) env(runID string) []string {
+	if p == nil {
+		return nil
+	}
+
+	env := []string{"CHEEK_PARENT_JOB_NAME=" + p.job, "CHEEK_PARENT_RUN_ID=" + runID}
+	for _, vars := range []struct {
+		prefix string
+		values map[string]string
+	}{
+		{"CHEEK_PARENT_PARAM_", p.params},
+		{"CHEEK_PARENT_OUTPUT_", outputParams(p.output)},
+	} {
+		keys := make([]string, 0, len(vars.values))
+		for k := range vars.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			env = append(env, fmt.Sprintf("%s%s=%s", vars.prefix, paramEnvName(k), vars.values[k]))
+		}
+	}
+	return env
+}
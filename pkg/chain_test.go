@@ -0,0 +1,59 @@
+package cheek
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParentRun(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{Jobs: map[string]*JobSpec{
+		"extract": {Command: []string{"true"}, OnSuccess: OnEvent{TriggerJob: []JobTrigger{{Name: "load"}}}},
+		"load": {
+			Command: []string{"sh", "-c", `echo "{{ .parent.job }} {{ .parent.run_id }} {{ .parent.output.rows }} {{ .parent.params.day }}"; env | grep ^CHEEK_PARENT_ | sort`},
+			Env:     map[string]string{"CHEEK_PARENT_OUTPUT_ROWS": "mine"},
+		},
+	}, TZLocation: "UTC", cfg: cfg}
+	assert.NoError(t, s.initialize())
+
+	parent := &JobRun{
+		ID:     "p1",
+		Name:   "extract",
+		Params: map[string]string{"day": "mon"},
+		Output: map[string]interface{}{"rows": 3.0, "table-name": "sales", "parts": []interface{}{1.0, 2.0}},
+	}
+	s.Jobs["extract"].resolveTriggers(parent, s.Jobs["extract"].OnSuccess)
+	if !assert.Len(t, parent.triggers, 1) {
+		return
+	}
+	req := parent.triggers[0].req
+	assert.Equal(t, "p1", req.parentID)
+
+	jr := s.Jobs["load"].execAttempt(context.Background(), req, 0)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, []string{
+		"extract p1 3 mon",
+		"CHEEK_PARENT_JOB_NAME=extract",
+		"CHEEK_PARENT_OUTPUT_PARTS=[1,2]",
+		// the job's own env takes precedence
+		"CHEEK_PARENT_OUTPUT_ROWS=mine",
+		"CHEEK_PARENT_OUTPUT_TABLE_NAME=sales",
+		"CHEEK_PARENT_PARAM_DAY=mon",
+		"CHEEK_PARENT_RUN_ID=p1",
+	}, strings.Split(strings.TrimSpace(jr.Log), "\n"))
+
+	// runs that did not get triggered by a job have no parent
+	jr = s.Jobs["load"].execCommand(context.Background(), "manual", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	s.Jobs["load"].Command = []string{"sh", "-c", "env | grep ^CHEEK_PARENT_ || echo none"}
+	s.Jobs["load"].Env = nil
+	jr = s.Jobs["load"].execCommand(context.Background(), "manual", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, "none\n", jr.Log)
+}
@@ -0,0 +1,108 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ValidateCircuit checks the circuit breaker settings of a job.
+func (j *JobSpec) ValidateCircuit() error {
+	if j.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf("max_consecutive_failures for job '%s' cannot be negative", j.Name)
+	}
+	if j.AutoResumeAfter < 0 {
+		return fmt.Errorf("auto_resume_after for job '%s' cannot be negative", j.Name)
+	}
+	if j.AutoResumeAfter > 0 && j.MaxConsecutiveFailures == 0 {
+		return fmt.Errorf("auto_resume_after for job '%s' needs max_consecutive_failures", j.Name)
+	}
+	return nil
+}
+
+// trip opens the circuit of the job once max_consecutive_failures runs failed
+// in a row, at refTime. It tells whether the circuit just opened.
+func (h *jobHealth) trip(j *JobSpec, refTime time.Time) bool {
+	if h == nil || j.MaxConsecutiveFailures <= 0 {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load(j)
+	if h.failures < j.MaxConsecutiveFailures || !h.tripped.IsZero() {
+		return false
+	}
+	h.tripped = refTime
+	return true
+}
+
+// circuitOpenSince tells whether the circuit of the job is open and since when.
+func (h *jobHealth) circuitOpenSince(j *JobSpec) (time.Time, bool) {
+	if h == nil || j.MaxConsecutiveFailures <= 0 {
+		return time.Time{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load(j)
+	return h.tripped, !h.tripped.IsZero()
+}
+
+// closeCircuit lets the job run on its schedule again, it tells whether the
+// circuit was open. The next failure opens it again.
+func (h *jobHealth) closeCircuit() bool {
+	if h == nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	closed := !h.tripped.IsZero()
+	h.tripped = time.Time{}
+	return closed
+}
+
+// circuitOpen tells whether the job is kept from running on its schedule at
+// refTime because too many of its runs failed in a row. The circuit closes by
+// itself once auto_resume_after passed.
+func (s *Schedule) circuitOpen(j *JobSpec, refTime time.Time) bool {
+	since, open := j.health.circuitOpenSince(j)
+	if !open {
+		return false
+	}
+	if j.AutoResumeAfter > 0 && refTime.Sub(since) >= j.AutoResumeAfter {
+		if j.health.closeCircuit() {
+			s.log.Info().Str("job", j.Name).Msgf("Circuit closed after %v", j.AutoResumeAfter)
+		}
+		return false
+	}
+	return true
+}
+
+// reportCircuitOpen sends the notifications of on_error about a job of which
+// the circuit opened at refTime. Its triggers don't fire, they did so for the
+// run that failed.
+func (j *JobSpec) reportCircuitOpen(ctx context.Context, refTime time.Time) {
+	jr := &JobRun{
+		ID:          newRunID(),
+		Name:        j.Name,
+		TriggeredAt: refTime,
+		TriggeredBy: "circuit_breaker",
+		Status:      StatusCircuitOpen,
+		State:       RunStateCircuitOpen,
+		Log:         fmt.Sprintf("%v runs failed in a row, not running on the schedule until the job gets resumed", j.MaxConsecutiveFailures),
+		jobRef:      j,
+	}
+	if j.AutoResumeAfter > 0 {
+		jr.Log = fmt.Sprintf("%v runs failed in a row, not running on the schedule until %v", j.MaxConsecutiveFailures, refTime.Add(j.AutoResumeAfter).Format(time.RFC3339))
+	}
+	j.log.Warn().Str("job", j.Name).Int("max_consecutive_failures", j.MaxConsecutiveFailures).Msg(jr.Log)
+
+	event := j.mergedEvent(nil, eventOnError)
+	event.TriggerJob = nil
+	j.fireEvent(ctx, jr, event)
+}
@@ -0,0 +1,82 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCircuit(t *testing.T) {
+	assert.NoError(t, (&JobSpec{MaxConsecutiveFailures: 3, AutoResumeAfter: time.Hour}).ValidateCircuit())
+	assert.NoError(t, (&JobSpec{}).ValidateCircuit())
+
+	assert.Error(t, (&JobSpec{MaxConsecutiveFailures: -1}).ValidateCircuit())
+	assert.Error(t, (&JobSpec{MaxConsecutiveFailures: 3, AutoResumeAfter: -time.Hour}).ValidateCircuit())
+	assert.ErrorContains(t, (&JobSpec{AutoResumeAfter: time.Hour}).ValidateCircuit(), "needs max_consecutive_failures")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	refTime := time.Now()
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"flaky": {
+			Command:                []string{"false"},
+			Cron:                   "* * * * *",
+			MaxConsecutiveFailures: 2,
+			AutoResumeAfter:        time.Hour,
+			OnError:                OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}},
+		},
+	}, refTime)
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s.cfg = cfg
+	j := s.Jobs["flaky"]
+	j.cfg = cfg
+
+	// the circuit opens once, with a notification on top of the one of the run
+	for i := 0; i < 3; i++ {
+		j.execCommandWithRetry(context.Background(), "test", nil)
+	}
+	assert.Equal(t, []string{RunStateCompleted, RunStateCompleted, RunStateCircuitOpen, RunStateCompleted}, rec.get("/error"))
+
+	since, open := j.health.circuitOpenSince(j)
+	assert.True(t, open)
+	b, err := json.Marshal(j)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"circuit_open_since"`)
+
+	// the job doesn't run on its cron, until auto_resume_after passed
+	assert.Empty(t, s.dueJobs(refTime.Add(time.Minute)))
+	assert.Len(t, s.dueJobs(since.Add(time.Hour)), 1)
+	_, open = j.health.circuitOpenSince(j)
+	assert.False(t, open)
+
+	// the next failure opens it again, which survives a restart
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	j.health = newJobHealth()
+	_, open = j.health.circuitOpenSince(j)
+	assert.True(t, open)
+
+	// resuming the job closes it
+	resp := httptest.NewRecorder()
+	setupMux(s).ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/jobs/flaky/resume", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	_, open = j.health.circuitOpenSince(j)
+	assert.False(t, open)
+
+	// as does a successful run
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	j.Command = []string{"true"}
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	_, open = j.health.circuitOpenSince(j)
+	assert.False(t, open)
+	assert.Equal(t, 0, j.health.consecutiveFailures(j))
+}
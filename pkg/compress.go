@@ -0,0 +1,235 @@
+package cheek
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compressInterval is how often the logs get checked for ones to compress.
+const compressInterval = time.Hour
+
+// logFile is a log opened for reading, either the file itself or, when there
+// only is a gzipped version of it, the contents of that.
+type logFile struct {
+	io.Reader
+	io.ReaderAt
+	size  int64
+	close func() error
+}
+
+func (f *logFile) Close() error {
+	return f.close()
+}
+
+// openLog opens a log for reading, the gzipped version of it when the file
+// itself is not there. Gzipped logs are no longer written to and get read at
+// once.
+func openLog(fp string) (*logFile, error) {
+	f, err := os.Open(fp)
+	if err == nil {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &logFile{Reader: f, ReaderAt: f, size: info.Size(), close: f.Close}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	b, gzErr := readGzip(fp + ".gz")
+	if errors.Is(gzErr, os.ErrNotExist) {
+		// report the file that was asked for
+		return nil, err
+	}
+	if gzErr != nil {
+		return nil, gzErr
+	}
+	r := bytes.NewReader(b)
+	return &logFile{Reader: r, ReaderAt: r, size: r.Size(), close: func() error { return nil }}, nil
+}
+
+// readLog reads a log as a whole, from its gzipped version when the file itself is not there.
+func readLog(fp string) ([]byte, error) {
+	f, err := openLog(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func readGzip(fp string) ([]byte, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't read '%s': %w", fp, err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// writeAtomically writes a file by way of a temporary one that is synced to
+// disk before it replaces the file, so that a crash leaves either the old or
+// the new version.
+func writeAtomically(fp string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(path.Dir(fp), path.Base(fp)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fp)
+}
+
+// compressFile replaces a file with a gzipped version of it. The original is
+// only removed once the gzipped version is in place.
+func compressFile(fp string) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeAtomically(fp+".gz", func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		if _, err := io.Copy(zw, f); err != nil {
+			return err
+		}
+		return zw.Close()
+	}); err != nil {
+		return err
+	}
+	return os.Remove(fp)
+}
+
+// restoreLog brings back a log of which there only is a gzipped version, so
+// that it can be written to again.
+func restoreLog(fp string) error {
+	if _, err := os.Stat(fp); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	b, err := readGzip(fp + ".gz")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeAtomically(fp, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	}); err != nil {
+		return err
+	}
+	return os.Remove(fp + ".gz")
+}
+
+// compressLogs gzips the job logs and the log files of runs in dir that were
+// last written to before cutoff and returns how many it compressed. Each log
+// is compressed while holding the lock its writers take.
+func compressLogs(dir string, cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	compressed := 0
+	var errs []error
+	compress := func(fp string, lock *sync.Mutex) {
+		lock.Lock()
+		defer lock.Unlock()
+		// check again, the log might have been written to in the meantime
+		info, err := os.Stat(fp)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return
+		}
+		if err := compressFile(fp); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		compressed++
+	}
+	old := func(e os.DirEntry) bool {
+		info, err := e.Info()
+		return err == nil && info.ModTime().Before(cutoff)
+	}
+
+	for _, e := range entries {
+		fp := path.Join(dir, e.Name())
+		if !e.IsDir() {
+			if strings.HasSuffix(e.Name(), ".job.jsonl") && old(e) {
+				compress(fp, jobLogLock(fp))
+			}
+			continue
+		}
+
+		runLogs, err := os.ReadDir(fp)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, l := range runLogs {
+			if !l.IsDir() && strings.HasSuffix(l.Name(), ".log") && old(l) {
+				compress(path.Join(fp, l.Name()), jobLogLock(fp))
+			}
+		}
+	}
+	return compressed, errors.Join(errs...)
+}
+
+// compressLogsIfDue compresses the logs that were not written to for
+// compress_logs_after, at most once per compressInterval.
+func (s *Schedule) compressLogsIfDue(refTime time.Time) {
+	s.mu.Lock()
+	if s.compressing || s.CompressLogsAfter <= 0 || refTime.Sub(s.compressedAt) < compressInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.compressing = true
+	s.compressedAt = refTime
+	cutoff := refTime.Add(-s.CompressLogsAfter)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.compressing = false
+		s.mu.Unlock()
+	}()
+
+	n, err := compressLogs(CheekPath(), cutoff)
+	if err != nil {
+		s.log.Warn().Err(err).Msg("could not compress all logs")
+	}
+	if n > 0 {
+		s.log.Debug().Msgf("compressed %v logs", n)
+	}
+}
@@ -0,0 +1,113 @@
+package cheek
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressLogs(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	refTime := time.Now()
+	day := 24 * time.Hour
+	age := func(fp string, d time.Duration) {
+		if err := os.Chtimes(fp, refTime.Add(-d), refTime.Add(-d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestRuns(t, jobLogFile("old"), refTime.Add(-3*day), refTime.Add(-2*day))
+	age(jobLogFile("old"), 2*day)
+	writeTestRuns(t, jobLogFile("recent"), refTime)
+	assert.NoError(t, os.MkdirAll(runLogDir("old"), 0o755))
+	runLog := path.Join(runLogDir("old"), "abc.log")
+	assert.NoError(t, os.WriteFile(runLog, []byte("full log\n"), 0o644))
+	age(runLog, 2*day)
+
+	n, err := compressLogs(CheekPath(), refTime.Add(-day))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for _, fp := range []string{jobLogFile("old"), runLog} {
+		_, err := os.Stat(fp)
+		assert.True(t, os.IsNotExist(err), fp)
+		_, err = os.Stat(fp + ".gz")
+		assert.NoError(t, err, fp)
+	}
+	_, err = os.Stat(jobLogFile("recent"))
+	assert.NoError(t, err)
+
+	// compressed logs are read as if they were not
+	store := jsonlStore{log: zerolog.Nop()}
+	jrs, total, err := store.runs("old", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "1", jrs[0].Log)
+	jrs, err = readLastJobRuns(zerolog.Nop(), jobLogFile("old"), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", jrs[0].Log)
+	found, err := store.find("old", func(jr *JobRun) bool { return jr.Log == "0" })
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	jr := JobRun{LogFile: path.Join("old", "abc.log")}
+	assert.NoError(t, jr.loadLogFile())
+	assert.Equal(t, "full log\n", jr.Log)
+
+	// a new run brings the job log back to be appended to
+	assert.NoError(t, store.append(&JobRun{Name: "old", Log: "2", TriggeredAt: refTime}))
+	jrs, total, err = store.runs("old", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, "2", jrs[0].Log)
+	_, err = os.Stat(jobLogFile("old") + ".gz")
+	assert.True(t, os.IsNotExist(err))
+
+	// a log that got compressed but not yet removed is still the one that is read
+	writeTestRuns(t, jobLogFile("crashed"), refTime)
+	assert.NoError(t, compressFile(jobLogFile("crashed")))
+	writeTestRuns(t, jobLogFile("crashed"), refTime, refTime)
+	_, total, err = store.runs("crashed", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
+
+func TestCompressLogsIfDue(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	refTime := time.Now()
+	old := func(name string) string {
+		fp := jobLogFile(name)
+		writeTestRuns(t, fp, refTime)
+		if err := os.Chtimes(fp, refTime.Add(-2*time.Hour), refTime.Add(-2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+
+	// not set means never
+	s := &Schedule{log: zerolog.Nop()}
+	fp := old("a")
+	s.compressLogsIfDue(refTime)
+	_, err := os.Stat(fp)
+	assert.NoError(t, err)
+
+	s.CompressLogsAfter = time.Hour
+	s.compressLogsIfDue(refTime)
+	_, err = os.Stat(fp)
+	assert.True(t, os.IsNotExist(err))
+
+	// only once per interval
+	fp = old("b")
+	s.compressLogsIfDue(refTime.Add(time.Minute))
+	_, err = os.Stat(fp)
+	assert.NoError(t, err)
+	s.compressLogsIfDue(refTime.Add(compressInterval))
+	_, err = os.Stat(fp)
+	assert.True(t, os.IsNotExist(err))
+
+	s.CompressLogsAfter = -time.Hour
+	s.Jobs = map[string]*JobSpec{}
+	assert.Len(t, s.validate(), 1)
+}
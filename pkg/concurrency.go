@@ -0,0 +1,291 @@
+package cheek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policies on what to do when a job becomes due while it is still running.
+const (
+	ConcurrencyPolicySkip  string = "skip"
+	ConcurrencyPolicyQueue string = "queue"
+	ConcurrencyPolicyAllow string = "allow"
+)
+
+const defaultQueueDepth int = 1
+
+// errRunQueueFull is returned for a run that can't be queued because the
+// queue of its job is full.
+var errRunQueueFull = errors.New("run queue is full")
+
+// runTracker keeps count of the runs of a job that are in flight.
+// A nil tracker tracks nothing and never blocks a run.
+type runTracker struct {
+	mu      sync.Mutex
+	running int
+	// the queued runs in the order they came in, each gets its channel
+	// closed once it is its turn
+	waiting []chan struct{}
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{}
+}
+
+func (t *runTracker) begin() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running++
+}
+
+// tryBegin only registers a run when no other run is in flight or queued.
+func (t *runTracker) tryBegin() bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running > 0 || len(t.waiting) > 0 {
+		return false
+	}
+	t.running++
+	return true
+}
+
+// beginQueued waits for all runs in flight to finish before registering a new one,
+// queued runs get their turn first come, first served. It gives up right away
+// with errRunQueueFull when depth runs are already waiting, and with the error
+// of ctx when ctx is done before it was its turn.
+func (t *runTracker) beginQueued(ctx context.Context, depth int) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if t.running == 0 && len(t.waiting) == 0 {
+		t.running++
+		t.mu.Unlock()
+		return nil
+	}
+	if len(t.waiting) >= depth {
+		t.mu.Unlock()
+		return errRunQueueFull
+	}
+	turn := make(chan struct{})
+	t.waiting = append(t.waiting, turn)
+	t.mu.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	for i, c := range t.waiting {
+		if c == turn {
+			t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+			t.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	t.mu.Unlock()
+	// it got its turn in the meantime, pass it on
+	t.end()
+	return ctx.Err()
+}
+
+// active tells whether any run is in flight.
+func (t *runTracker) active() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.running > 0
+}
+
+func (t *runTracker) end() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running--
+	if t.running == 0 && len(t.waiting) > 0 {
+		t.running++
+		close(t.waiting[0])
+		t.waiting = t.waiting[1:]
+	}
+}
+
+func (j *JobSpec) concurrencyPolicy() string {
+	switch {
+	case j.ConcurrencyPolicy != "":
+		return j.ConcurrencyPolicy
+	case j.AllowConcurrent:
+		return ConcurrencyPolicyAllow
+	default:
+		return ConcurrencyPolicySkip
+	}
+}
+
+func (j *JobSpec) queueDepth() int {
+	if j.QueueDepth > 0 {
+		return j.QueueDepth
+	}
+	return defaultQueueDepth
+}
+
+func (j *JobSpec) ValidateConcurrencyPolicy() error {
+	switch j.ConcurrencyPolicy {
+	case "", ConcurrencyPolicySkip, ConcurrencyPolicyQueue, ConcurrencyPolicyAllow:
+	default:
+		return fmt.Errorf("concurrency_policy for job '%s' should be one of '%s', '%s' or '%s', got '%s'", j.Name, ConcurrencyPolicySkip, ConcurrencyPolicyQueue, ConcurrencyPolicyAllow, j.ConcurrencyPolicy)
+	}
+
+	if j.QueueDepth < 0 {
+		return fmt.Errorf("queue_depth for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
+
+// execScheduled runs a job that became due while respecting its concurrency policy.
+func (j *JobSpec) execScheduled(ctx context.Context, trigger string, parameters map[string]string) {
+	j.dispatch(ctx, runRequest{id: newRunID(), trigger: trigger, params: parameters})
+}
+
+// dispatch runs a job with its retries while respecting its concurrency policy
+// and the max concurrent jobs of the schedule. Every run goes through here, be it
+// one that became due, got triggered by another job or got requested via the api,
+// a webhook or RunJob. It returns the last attempt, or the run that got skipped.
+func (j *JobSpec) dispatch(ctx context.Context, req runRequest) JobRun {
+	var queuedFor time.Duration
+
+	switch j.concurrencyPolicy() {
+	case ConcurrencyPolicySkip:
+		if !j.inFlight.tryBegin() {
+			return j.skipRun(req, "skipped: previous run still in progress")
+		}
+	case ConcurrencyPolicyQueue:
+		dueAt := time.Now()
+		err := j.inFlight.beginQueued(ctx, j.queueDepth())
+		if errors.Is(err, errRunQueueFull) {
+			j.log.Warn().Str("job", j.Name).Str("trigger", req.trigger).Int("queue_depth", j.queueDepth()).Msg("run queue is full, dropping run")
+			return j.skippedRun(req, "dropped: run queue is full")
+		}
+		if err != nil {
+			return j.cancelQueuedRun(req, err)
+		}
+		queuedFor = time.Since(dueAt).Truncate(time.Millisecond)
+		if queuedFor > 0 {
+			j.log.Info().Str("job", j.Name).Str("trigger", req.trigger).Dur("queued_for", queuedFor).Msg("queued run can start")
+		}
+	default:
+		j.inFlight.begin()
+	}
+
+	slots, waited, err := j.globalSchedule.acquireSlot(ctx, j, req.trigger)
+	if err != nil {
+		j.inFlight.end()
+		return j.cancelQueuedRun(req, err)
+	}
+	queuedFor += waited
+	// release to the same slots, the schedule might have been reloaded in the meantime
+	release := releaseOnce(func() {
+		releaseSlot(slots)
+		j.inFlight.end()
+	})
+	defer release()
+
+	return j.retryCommand(ctx, req, queuedFor, release)
+}
+
+// releaseOnce makes sure that what a run holds on to only gets released once.
+func releaseOnce(release func()) func() {
+	var once sync.Once
+	return func() { once.Do(release) }
+}
+
+// acquireSlot blocks until the schedule allows for another run to execute,
+// it returns the slots it took one from and how long it had to wait. Runs that
+// wait get a slot in the order they came in. It gives up with the error of ctx
+// when ctx is done before a slot came free.
+func (s *Schedule) acquireSlot(ctx context.Context, j *JobSpec, trigger string) (chan struct{}, time.Duration, error) {
+	if s == nil {
+		return nil, 0, nil
+	}
+
+	s.mu.RLock()
+	slots, max := s.slots, s.MaxConcurrentJobs
+	s.mu.RUnlock()
+
+	if slots == nil {
+		return nil, 0, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return slots, 0, nil
+	default:
+	}
+
+	j.log.Info().Str("job", j.Name).Str("trigger", trigger).Int("max_concurrent_jobs", max).Msg("max concurrent jobs reached, run is queued")
+	queuedAt := time.Now()
+	// blocked senders on a channel are served first in, first out
+	select {
+	case slots <- struct{}{}:
+		return slots, time.Since(queuedAt).Truncate(time.Millisecond), nil
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+func releaseSlot(slots chan struct{}) {
+	if slots == nil {
+		return
+	}
+	<-slots
+}
+
+// skippedRun is a run that did not start for the given reason.
+func (j *JobSpec) skippedRun(req runRequest, reason string) JobRun {
+	return JobRun{
+		ID:               req.id,
+		GroupID:          req.id,
+		Name:             j.Name,
+		TriggeredAt:      j.now(),
+		TriggeredBy:      req.trigger,
+		TriggeredByRunID: req.parentID,
+		Params:           req.params,
+		Status:           StatusSkipped,
+		State:            RunStateSkipped,
+		TriggerDepth:     req.depth,
+		Log:              reason,
+		jobRef:           j,
+	}
+}
+
+// skipRun records a run that did not start for the given reason.
+func (j *JobSpec) skipRun(req runRequest, reason string) JobRun {
+	jr := j.skippedRun(req, reason)
+	j.log.Warn().Str("job", j.Name).Str("run_id", jr.ID).Str("trigger", req.trigger).Msg(jr.Log)
+	jr.logToDisk()
+	return jr
+}
+
+// cancelQueuedRun records a run that got called off while it was waiting for
+// its turn, e.g. because the scheduler is stopping.
+func (j *JobSpec) cancelQueuedRun(req runRequest, err error) JobRun {
+	jr := j.skippedRun(req, fmt.Sprintf("canceled while queued: %v", err))
+	jr.Status = StatusCanceled
+	jr.State = RunStateCanceled
+	j.log.Warn().Str("job", j.Name).Str("run_id", jr.ID).Str("trigger", req.trigger).Msg(jr.Log)
+	jr.logToDisk()
+	return jr
+}
@@ -0,0 +1,277 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipOverlappingRuns(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:     "test_overlap",
+		Command:  []string{"sleep", "1"},
+		inFlight: newRunTracker(),
+		cfg:      cfg,
+	}
+
+	go j.execScheduled(context.Background(), "cron", nil)
+	time.Sleep(200 * time.Millisecond)
+	j.execScheduled(context.Background(), "cron", nil)
+
+	j.loadRuns()
+	assert.Equal(t, StatusSkipped, j.Runs[0].Status)
+	assert.Contains(t, j.Runs[0].Log, "previous run still in progress")
+
+	// concurrent runs are allowed on request
+	j.AllowConcurrent = true
+	assert.False(t, j.inFlight.tryBegin())
+	j.execScheduled(context.Background(), "cron", nil)
+	j.loadRuns()
+	assert.Equal(t, 0, j.Runs[0].Status)
+}
+
+func TestQueueRuns(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:              "test_queue",
+		Command:           []string{"sleep", "0.5"},
+		ConcurrencyPolicy: ConcurrencyPolicyQueue,
+		inFlight:          newRunTracker(),
+		cfg:               cfg,
+	}
+	assert.NoError(t, j.ValidateConcurrencyPolicy())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.execScheduled(context.Background(), "cron", nil)
+		}()
+		time.Sleep(100 * time.Millisecond)
+	}
+	wg.Wait()
+
+	// with a queue depth of 1 the third run gets dropped
+	j.loadRuns()
+	assert.Equal(t, 0, j.Runs[0].Status)
+	assert.Greater(t, j.Runs[0].QueuedFor, 200*time.Millisecond)
+	assert.Equal(t, time.Duration(0), j.Runs[1].QueuedFor)
+	assert.False(t, j.inFlight.running > 0)
+
+	j.ConcurrencyPolicy = "whatever"
+	assert.Error(t, j.ValidateConcurrencyPolicy())
+}
+
+func TestQueuedRunsInOrder(t *testing.T) {
+	tr := newRunTracker()
+	assert.NoError(t, tr.beginQueued(context.Background(), 3))
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			assert.NoError(t, tr.beginQueued(context.Background(), 3))
+			order <- i
+			tr.end()
+		}(i)
+		assert.Eventually(t, func() bool {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			return len(tr.waiting) == i+1
+		}, 5*time.Second, time.Millisecond)
+	}
+	assert.ErrorIs(t, tr.beginQueued(context.Background(), 3), errRunQueueFull)
+	assert.False(t, tr.tryBegin())
+
+	tr.end()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, i, <-order)
+	}
+
+	// a queued run gives up once its context is done
+	assert.NoError(t, tr.beginQueued(context.Background(), 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tr.beginQueued(ctx, 1), context.DeadlineExceeded)
+	tr.end()
+	assert.False(t, tr.active())
+	assert.True(t, tr.tryBegin())
+}
+
+func TestQueuedRunsCanceled(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	s := Schedule{
+		Jobs:              map[string]*JobSpec{},
+		MaxConcurrentJobs: 1,
+		cfg:               cfg,
+	}
+	s.Jobs["test_canceled_queued"] = &JobSpec{Command: []string{"true"}, ConcurrencyPolicy: ConcurrencyPolicyQueue}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	j := s.Jobs["test_canceled_queued"]
+
+	// waiting for the previous run of the job
+	assert.True(t, j.inFlight.tryBegin())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	jr := j.dispatch(ctx, runRequest{id: newRunID(), trigger: "cron"})
+	assert.Equal(t, StatusCanceled, jr.Status)
+	assert.Equal(t, RunStateCanceled, jr.State)
+	assert.Contains(t, jr.Log, "canceled while queued")
+	j.inFlight.end()
+
+	// waiting for a slot of the schedule
+	s.slots <- struct{}{}
+	jr = j.dispatch(ctx, runRequest{id: newRunID(), trigger: "cron"})
+	assert.Equal(t, RunStateCanceled, jr.State)
+	assert.False(t, j.inFlight.active())
+	<-s.slots
+
+	j.loadRuns()
+	if assert.Len(t, j.Runs, 2) {
+		assert.Equal(t, StatusCanceled, j.Runs[0].Status)
+	}
+}
+
+func TestMaxConcurrentJobs(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	s := Schedule{
+		Jobs:              map[string]*JobSpec{},
+		MaxConcurrentJobs: 1,
+		cfg:               cfg,
+	}
+	for _, name := range []string{"test_slot_a", "test_slot_b"} {
+		s.Jobs[name] = &JobSpec{Command: []string{"sleep", "0.5"}}
+	}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for _, j := range s.Jobs {
+		wg.Add(1)
+		go func(j *JobSpec) {
+			defer wg.Done()
+			j.execScheduled(context.Background(), "cron", nil)
+		}(j)
+	}
+	wg.Wait()
+
+	// one of both had to wait for the other one to finish
+	var queuedFor time.Duration
+	for _, j := range s.Jobs {
+		j.loadRuns()
+		queuedFor += j.Runs[0].QueuedFor
+	}
+	assert.Greater(t, queuedFor, 300*time.Millisecond)
+
+	s.MaxConcurrentJobs = -1
+	assert.Error(t, s.initialize())
+}
+
+func TestTriggeredRunsDispatch(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	s := Schedule{
+		Jobs:              map[string]*JobSpec{},
+		MaxConcurrentJobs: 1,
+		cfg:               cfg,
+	}
+	s.Jobs["test_dispatch_parent"] = &JobSpec{
+		Command:   []string{"echo", "parent"},
+		OnSuccess: OnEvent{TriggerJob: []JobTrigger{{Name: "test_dispatch_child"}, {Name: "test_dispatch_busy"}}},
+	}
+	s.Jobs["test_dispatch_child"] = &JobSpec{Command: []string{"echo", "child"}}
+	s.Jobs["test_dispatch_busy"] = &JobSpec{Command: []string{"echo", "busy"}}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	parent, child, busy := s.Jobs["test_dispatch_parent"], s.Jobs["test_dispatch_child"], s.Jobs["test_dispatch_busy"]
+
+	// the parent makes room for the jobs it triggers, which respect their concurrency policy
+	assert.True(t, busy.inFlight.tryBegin())
+	done := make(chan struct{})
+	go func() {
+		parent.execScheduled(context.Background(), "cron", nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("triggered jobs did not get to run")
+	}
+	busy.inFlight.end()
+
+	parent.loadRuns()
+	child.loadRuns()
+	busy.loadRuns()
+	assert.Equal(t, 0, child.Runs[0].Status)
+	assert.Equal(t, "job[test_dispatch_parent]", child.Runs[0].TriggeredBy)
+	assert.Equal(t, parent.Runs[0].ID, child.Runs[0].TriggeredByRunID)
+	assert.Equal(t, 1, child.Runs[0].TriggerDepth)
+	assert.False(t, child.Runs[0].TriggeredAt.Before(parent.Runs[0].TriggeredAt.Add(parent.Runs[0].Duration)))
+
+	assert.Equal(t, StatusSkipped, busy.Runs[0].Status)
+	assert.Equal(t, parent.Runs[0].TriggeredRunIDs[1], busy.Runs[0].ID)
+	assert.Equal(t, parent.Runs[0].ID, busy.Runs[0].TriggeredByRunID)
+}
+
+func TestManualRunsDispatch(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := NewSchedule(zerolog.Nop(), cfg)
+	marker := filepath.Join(t.TempDir(), "failed_once")
+	assert.NoError(t, s.AddJob(&JobSpec{
+		Name:       "test_manual_dispatch",
+		Command:    []string{"sh", "-c", "[ -f " + marker + " ] || { touch " + marker + "; exit 1; }"},
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	}))
+	assert.NoError(t, s.prepare())
+	j := s.Jobs["test_manual_dispatch"]
+	handler := setupMux(s)
+
+	// manual runs respect the concurrency policy of the job
+	assert.True(t, j.inFlight.tryBegin())
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("POST", "/jobs/test_manual_dispatch/trigger", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var jr JobRun
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&jr))
+	assert.Equal(t, RunStateSkipped, jr.State)
+	_, err := s.RunJob(context.Background(), j.Name, nil)
+	assert.ErrorContains(t, err, "previous run still in progress")
+	j.inFlight.end()
+
+	// and get retried, via the api as well as via RunJob
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("POST", "/jobs/test_manual_dispatch/trigger", nil))
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&jr))
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, 1, jr.Attempt)
+
+	assert.NoError(t, os.Remove(marker))
+	jr, err = s.RunJob(context.Background(), j.Name, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, jr.Attempt)
+}
@@ -0,0 +1,134 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dockerCommand is the docker cli that runs the containers of jobs.
+var dockerCommand = "docker"
+
+// dockerRunFailed is the exit code of docker run when the container can't be
+// run, the command in the container can exit with it as well.
+const dockerRunFailed = 125
+
+// dockerStopTimeout is how long the removal of the container of a run that got killed may take.
+const dockerStopTimeout = 30 * time.Second
+
+// ContainerSpec describes the container a job runs its command in.
+type ContainerSpec struct {
+	Image      string            `yaml:"image" json:"image"`
+	Entrypoint string            `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	Volumes    []string          `yaml:"volumes,omitempty" json:"volumes,omitempty"`
+	Env        map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+}
+
+func (j *JobSpec) ValidateContainer() error {
+	if j.Container == nil {
+		return nil
+	}
+	if j.Container.Image == "" {
+		return fmt.Errorf("container of job '%s' needs an image", j.Name)
+	}
+	return nil
+}
+
+// containerName names the container of a run, it is unique per attempt.
+func containerName(jr *JobRun) string {
+	name := []byte(fmt.Sprintf("cheek-%s-%s", jr.Name, jr.ID))
+	for i, c := range name {
+		if !isEnvNameChar(c, false) && c != '.' && c != '-' {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// containerRunner executes the command of a job in a container with the docker cli.
+type containerRunner struct {
+	spec *ContainerSpec
+	job  *JobSpec
+	name string
+}
+
+// command runs the container in the foreground, so that the docker cli passes its
+// output and exit code on. The variables of the job are passed by name, the docker
+// cli takes their values from its own environment, to keep secrets out of its arguments.
+// The container is kept until the run is done, to be able to tell whether it started.
+func (r *containerRunner) command(command []string, env []string) []string {
+	args := []string{dockerCommand, "run", "--name", r.name}
+	if r.spec.Entrypoint != "" {
+		args = append(args, "--entrypoint", r.spec.Entrypoint)
+	}
+	for _, v := range r.spec.Volumes {
+		args = append(args, "--volume", v)
+	}
+
+	seen := map[string]bool{}
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		if !seen[k] {
+			seen[k] = true
+			args = append(args, "--env", k)
+		}
+	}
+	keys := make([]string, 0, len(r.spec.Env))
+	for k := range r.spec.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--env", fmt.Sprintf("%s=%s", k, r.spec.Env[k]))
+	}
+
+	if r.job.Stdin != "" || r.job.StdinFile != "" {
+		args = append(args, "--interactive")
+	}
+	if r.job.MemoryLimit > 0 {
+		args = append(args, "--memory", fmt.Sprint(r.job.MemoryLimit))
+	}
+
+	args = append(args, r.spec.Image)
+	return append(args, command...)
+}
+
+// failedToStart tells whether the docker cli could not run the container, as
+// opposed to the command in the container exiting with the same code.
+func (r *containerRunner) failedToStart(status int) bool {
+	return status == dockerRunFailed && !r.started()
+}
+
+// started tells whether the container of the run got created and started.
+func (r *containerRunner) started() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerStopTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, dockerCommand, "inspect", "--format", "{{.State.StartedAt}}", r.name).Output()
+	if err != nil {
+		return false
+	}
+	startedAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
+	// docker reports the zero time for containers that never started
+	return err == nil && startedAt.Year() > 1
+}
+
+// done removes the container once the run is over.
+func (r *containerRunner) done() error {
+	return r.stop()
+}
+
+// stop removes the container, killing the docker cli leaves it running.
+func (r *containerRunner) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerStopTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, dockerCommand, "rm", "--force", r.name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("can't remove container '%s': %w: %s", r.name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+//go:build !windows
+
+package cheek
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDocker stands in for the docker cli, it records its calls and runs
+// the command it got for the container with sh. Images other than alpine
+// can't be found.
+func fakeDocker(t *testing.T) string {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$@" >> ` + calls + `
+case "$1" in
+run)
+	name=$3
+	while [ "$1" != "alpine" ]; do
+		if [ $# -eq 1 ]; then
+			echo "Unable to find image" >&2
+			exit 125
+		fi
+		shift
+	done
+	shift
+	echo 2024-01-01T00:00:00.5Z > ` + dir + `/$name
+	exec sh -c "$*"
+	;;
+inspect)
+	cat ` + dir + `/$4 2>/dev/null || { echo "No such object: $4" >&2; exit 1; }
+	;;
+esac
+`
+	fn := filepath.Join(dir, "docker")
+	if err := os.WriteFile(fn, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	orig := dockerCommand
+	dockerCommand = fn
+	t.Cleanup(func() { dockerCommand = orig })
+	return calls
+}
+
+func TestContainerRunner(t *testing.T) {
+	calls := fakeDocker(t)
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:    "test container",
+		Command: []string{"echo $TEA; exit 3"},
+		Env:     map[string]string{"TEA": "green"},
+		Container: &ContainerSpec{
+			Image:      "alpine",
+			Entrypoint: "/bin/sh",
+			Volumes:    []string{"/data:/data:ro"},
+			Env:        map[string]string{"MILK": "oat"},
+		},
+		cfg: cfg,
+	}
+	assert.NoError(t, j.ValidateContainer())
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	// the exit code of the container becomes the status of the run
+	assert.Equal(t, 3, jr.Status)
+	assert.Equal(t, "green\n", jr.Log)
+
+	b, err := os.ReadFile(calls)
+	assert.NoError(t, err)
+	call := string(b)
+	assert.Contains(t, call, "run --name cheek-test_container-"+jr.ID+" --entrypoint /bin/sh --volume /data:/data:ro")
+	// values of the job's variables are not passed as arguments
+	assert.Contains(t, call, "--env TEA ")
+	assert.NotContains(t, call, "green")
+	assert.Contains(t, call, "--env MILK=oat alpine echo $TEA; exit 3")
+	assert.Contains(t, call, "--env CHEEK_JOB_NAME ")
+	// the container is removed once the run is done
+	assert.Contains(t, call, "rm --force cheek-test_container-"+jr.ID)
+}
+
+func TestContainerFailedToStart(t *testing.T) {
+	fakeDocker(t)
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	// a command in the container can exit with the code docker uses for its own failures
+	j := &JobSpec{Name: "test", Command: []string{"exit 125"}, Container: &ContainerSpec{Image: "alpine"}, cfg: cfg}
+	jr := j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, 125, jr.Status)
+	assert.Equal(t, RunStateCompleted, jr.State)
+
+	j.Container.Image = "missing"
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 125, jr.Status)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "Unable to find image")
+}
+
+func TestContainerTimeout(t *testing.T) {
+	calls := fakeDocker(t)
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:      "test",
+		Command:   []string{"sleep 5"},
+		Container: &ContainerSpec{Image: "alpine"},
+		Timeout:   200 * time.Millisecond,
+		cfg:       cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, StatusTimeout, jr.Status)
+
+	// the container gets removed, not just the docker cli killed
+	b, err := os.ReadFile(calls)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if assert.True(t, len(lines) > 1) {
+		assert.Equal(t, "rm --force cheek-test-"+jr.ID, lines[1])
+	}
+
+	j.Container.Image = ""
+	assert.Error(t, j.ValidateContainer())
+}
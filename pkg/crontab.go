@@ -0,0 +1,502 @@
+package cheek
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adhocore/gronx"
+	"github.com/rs/zerolog"
+)
+
+// crontabMacros are the @ schedules of crontabs, "" runs the job when cheek starts.
+var crontabMacros = map[string]string{
+	"@reboot":   "",
+	"@yearly":   "@yearly",
+	"@annually": "@yearly",
+	"@monthly":  "@monthly",
+	"@weekly":   "@weekly",
+	"@daily":    "@daily",
+	"@midnight": "@daily",
+	"@hourly":   "@hourly",
+}
+
+var (
+	crontabEnvLine = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(.*)$`)
+	jobNameInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// maxImportedName is how long the names made up for imported jobs can get.
+const maxImportedName = 64
+
+// CrontabLineError is a line of a crontab that could not be imported.
+type CrontabLineError struct {
+	Line   int
+	Reason string
+}
+
+func (e *CrontabLineError) Error() string {
+	return fmt.Sprintf("line %v: %s", e.Line, e.Reason)
+}
+
+// crontabImport holds what applies to the lines that follow in a crontab.
+type crontabImport struct {
+	env   map[string]string
+	shell string
+	tz    string
+	// the comment right above the current line
+	comment string
+	jobs    map[string]*JobSpec
+}
+
+// ImportCrontab turns the lines of a crontab into jobs. Their commands run
+// through a shell, like cron does. Comments right above a line name the job,
+// environment variables apply to the jobs below them. The lines that can't be
+// imported are left out and returned as CrontabLineErrors joined together,
+// next to the jobs that could be.
+func ImportCrontab(r io.Reader) (Schedule, error) {
+	imp := &crontabImport{env: map[string]string{}, jobs: map[string]*JobSpec{}}
+	var problems []error
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		if err := imp.line(n, scanner.Text()); err != nil {
+			problems = append(problems, &CrontabLineError{Line: n, Reason: err.Error()})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, err)
+	}
+
+	return Schedule{Jobs: imp.jobs}, errors.Join(problems...)
+}
+
+func (imp *crontabImport) line(n int, line string) error {
+	line = strings.TrimSpace(line)
+	comment := imp.comment
+	imp.comment = ""
+
+	switch {
+	case line == "":
+		return nil
+	case strings.HasPrefix(line, "#"):
+		imp.comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		return nil
+	}
+
+	if m := crontabEnvLine.FindStringSubmatch(line); m != nil {
+		return imp.setEnv(m[1], unquoteCrontabValue(m[2]))
+	}
+
+	var cron, command string
+	runOnStart := false
+	if strings.HasPrefix(line, "@") {
+		macro := strings.Fields(line)[0]
+		c, ok := crontabMacros[macro]
+		if !ok {
+			return fmt.Errorf("unknown schedule '%s'", macro)
+		}
+		cron, command, runOnStart = c, strings.TrimSpace(strings.TrimPrefix(line, macro)), c == ""
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			return fmt.Errorf("expected 5 time fields and a command, got '%s'", line)
+		}
+		cron = strings.Join(fields[:5], " ")
+		// keep the spacing of the command as it is
+		command = line
+		for _, f := range fields[:5] {
+			command = strings.TrimSpace(strings.TrimPrefix(command, f))
+		}
+		g := gronx.New()
+		if !g.IsValid(cron) {
+			return fmt.Errorf("cron string '%s' not valid", cron)
+		}
+	}
+
+	command, stdin := splitCrontabCommand(command)
+	if command == "" {
+		return fmt.Errorf("no command in '%s'", line)
+	}
+
+	j := &JobSpec{
+		Cron:       cron,
+		RunOnStart: runOnStart,
+		Command:    stringArray{imp.shell, "-c", command},
+		Stdin:      stdin,
+		TZLocation: imp.tz,
+	}
+	if j.Command[0] == "" {
+		j.Command[0] = "sh"
+	}
+	if len(imp.env) > 0 {
+		j.Env = make(map[string]string, len(imp.env))
+		for k, v := range imp.env {
+			j.Env[k] = v
+		}
+	}
+	imp.jobs[imp.jobName(n, comment, command)] = j
+	return nil
+}
+
+// setEnv applies an environment variable to the jobs that follow. Some of
+// them tell cron how to run the jobs instead.
+func (imp *crontabImport) setEnv(k, v string) error {
+	switch k {
+	case "SHELL":
+		imp.shell = v
+	case "CRON_TZ":
+		imp.tz = v
+	case "MAILTO", "MAILFROM":
+		return fmt.Errorf("%s is not supported, use the notifications of on_error instead", k)
+	default:
+		imp.env[k] = v
+	}
+	return nil
+}
+
+// jobName makes a name out of the comment above a line, or of the program it
+// runs, that is not yet taken.
+func (imp *crontabImport) jobName(n int, comment, command string) string {
+	name := importedJobName(comment)
+	if name == "" {
+		name = importedJobName(path.Base(strings.Fields(command)[0]))
+	}
+	if name == "" {
+		name = fmt.Sprintf("line_%v", n)
+	}
+	for i, base := 2, name; imp.jobs[name] != nil; i++ {
+		name = fmt.Sprintf("%s_%v", base, i)
+	}
+	return name
+}
+
+func importedJobName(s string) string {
+	name := strings.Trim(jobNameInvalid.ReplaceAllString(strings.ToLower(s), "_"), "_")
+	if len(name) > maxImportedName {
+		name = strings.TrimRight(name[:maxImportedName], "_")
+	}
+	return name
+}
+
+func unquoteCrontabValue(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// splitCrontabCommand splits a command at its first unescaped %, what comes
+// after goes to stdin with the other % as newlines. Escaped % lose their \.
+func splitCrontabCommand(command string) (string, string) {
+	var parts []string
+	b := strings.Builder{}
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == '%':
+			b.WriteByte('%')
+			i++
+		case command[i] == '%':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(command[i])
+		}
+	}
+	parts = append(parts, b.String())
+
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return strings.TrimSpace(parts[0]), strings.Join(parts[1:], "\n") + "\n"
+}
+
+// crontabSafeArg matches the arguments that don't need quoting in a crontab.
+var crontabSafeArg = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]+$`)
+
+// ExportCrontab writes the jobs of the schedule in the given file as a crontab, see Schedule.ToCrontab.
+func ExportCrontab(log zerolog.Logger, cfg Config, scheduleFn string) (string, []string, error) {
+	s, err := loadSchedule(log, cfg, scheduleFn)
+	if err != nil {
+		return "", nil, fmt.Errorf("error loading schedule: %w", err)
+	}
+	return s.ToCrontab()
+}
+
+// crontabExport holds what the lines written so far set for the lines that follow.
+type crontabExport struct {
+	b     strings.Builder
+	env   map[string]string
+	shell string
+	tz    string
+}
+
+// ToCrontab writes the jobs that run on a cron as the lines of a crontab, by
+// timezone and in the order of their names. The settings crontab can't express get left out,
+// they are returned as warnings, as are the jobs that can't be written at all.
+// Commands or variables that span multiple lines give an error.
+func (s *Schedule) ToCrontab() (string, []string, error) {
+	exp := &crontabExport{env: map[string]string{}}
+	var warnings []string
+	if lost := s.crontabLosses(); len(lost) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the schedule loses %s", joinAnd(lost)))
+	}
+
+	names := make([]string, 0, len(s.Jobs))
+	for name := range s.Jobs {
+		names = append(names, name)
+	}
+	// a timezone can't be unset once a line set it, so the jobs in the
+	// timezone of the schedule go first
+	tz := func(name string) string {
+		if s.Jobs[name].TZLocation != "" {
+			return s.Jobs[name].TZLocation
+		}
+		return s.TZLocation
+	}
+	sort.Slice(names, func(a, b int) bool {
+		if tz(names[a]) != tz(names[b]) {
+			return tz(names[a]) == s.TZLocation || (tz(names[b]) != s.TZLocation && tz(names[a]) < tz(names[b]))
+		}
+		return names[a] < names[b]
+	})
+	for _, name := range names {
+		jobWarnings, err := exp.job(name, s.Jobs[name], tz(name))
+		if err != nil {
+			return "", nil, err
+		}
+		warnings = append(warnings, jobWarnings...)
+	}
+	return exp.b.String(), warnings, nil
+}
+
+func (s *Schedule) crontabLosses() []string {
+	var lost []string
+	for _, e := range []struct {
+		key   string
+		event OnEvent
+	}{
+		{"on_success", s.OnSuccess},
+		{"on_error", s.OnError},
+		{"on_start", s.OnStart},
+		{"on_retries_exhausted", s.OnRetriesExhausted},
+		{"on_stale", s.OnStale},
+	} {
+		if !e.event.empty() {
+			lost = append(lost, e.key)
+		}
+	}
+	if len(s.Blackout) > 0 {
+		lost = append(lost, "blackout")
+	}
+	if s.MaxConcurrentJobs > 0 {
+		lost = append(lost, "max_concurrent_jobs")
+	}
+	return lost
+}
+
+// crontabLosses lists the settings of the job that crontab can't express.
+func (j *JobSpec) crontabLosses() []string {
+	var lost []string
+	if j.Retries > 0 {
+		lost = append(lost, "retries")
+	}
+	for _, e := range []struct {
+		key   string
+		event OnEvent
+	}{
+		{"on_success", j.OnSuccess},
+		{"on_error", j.OnError},
+		{"on_start", j.OnStart},
+		{"on_retries_exhausted", j.OnRetriesExhausted},
+		{"on_stale", j.OnStale},
+	} {
+		if !e.event.empty() {
+			lost = append(lost, e.key)
+		}
+	}
+
+	templated := strings.Contains(j.Stdin, "{{") || strings.Contains(j.WorkingDirectory, "{{")
+	for _, arg := range j.Command {
+		templated = templated || strings.Contains(arg, "{{")
+	}
+	if templated {
+		lost = append(lost, "params")
+	}
+
+	for _, setting := range []struct {
+		key string
+		set bool
+	}{
+		{"working_directory", j.WorkingDirectory != ""},
+		{"timeout", j.Timeout > 0},
+		{"env_file", len(j.EnvFile) > 0},
+		{"secrets", len(j.Secrets) > 0},
+		{"stdin_file", j.StdinFile != ""},
+		{"container", j.Container != nil},
+		{"ssh", j.SSH != nil},
+		{"window", j.Window != nil},
+		{"jitter", j.Jitter > 0},
+	} {
+		if setting.set {
+			lost = append(lost, setting.key)
+		}
+	}
+	return lost
+}
+
+// job writes the lines of a job, preceded by the variables that change for it.
+func (exp *crontabExport) job(name string, j *JobSpec, tz string) ([]string, error) {
+	var schedules []string
+	if j.RunOnStart {
+		schedules = append(schedules, "@reboot")
+	}
+	if j.Cron != "" {
+		if !crontabCron(j.Cron) {
+			return []string{fmt.Sprintf("job '%s' is left out, crontab can't express its cron string '%s'", name, j.Cron)}, nil
+		}
+		schedules = append(schedules, j.Cron)
+	}
+	if len(schedules) == 0 {
+		return []string{fmt.Sprintf("job '%s' is left out, it doesn't run on a cron", name)}, nil
+	}
+	if len(j.Command) == 0 {
+		return []string{fmt.Sprintf("job '%s' is left out, it has no command", name)}, nil
+	}
+
+	shell, command := crontabCommand(j.Command)
+	if strings.Contains(command, "\n") {
+		return nil, fmt.Errorf("command of job '%s' spans multiple lines, which a crontab can't hold", name)
+	}
+	command = strings.ReplaceAll(command, "%", `\%`)
+	if j.Stdin != "" {
+		stdin := strings.ReplaceAll(strings.TrimSuffix(j.Stdin, "\n"), "%", `\%`)
+		command += "%" + strings.ReplaceAll(stdin, "\n", "%")
+	}
+
+	var warnings []string
+	var lines []string
+	set := func(k, v string) error {
+		if strings.Contains(v, "\n") {
+			return fmt.Errorf("variable %s of job '%s' spans multiple lines, which a crontab can't hold", k, name)
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", k, crontabValue(v)))
+		return nil
+	}
+	if tz != exp.tz {
+		if err := set("CRON_TZ", tz); err != nil {
+			return nil, err
+		}
+		exp.tz = tz
+	}
+	if shell != exp.shell {
+		v := shell
+		if v == "" {
+			v = "/bin/sh"
+		}
+		if err := set("SHELL", v); err != nil {
+			return nil, err
+		}
+		exp.shell = shell
+	}
+
+	keys := make([]string, 0, len(j.Env))
+	for k := range j.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := exp.env[k]; ok && v == j.Env[k] {
+			continue
+		}
+		if err := set(k, j.Env[k]); err != nil {
+			return nil, err
+		}
+		exp.env[k] = j.Env[k]
+	}
+	var inherited []string
+	for k := range exp.env {
+		if _, ok := j.Env[k]; !ok {
+			inherited = append(inherited, k)
+		}
+	}
+	if len(inherited) > 0 {
+		sort.Strings(inherited)
+		warnings = append(warnings, fmt.Sprintf("job '%s' also gets %s from the lines above it", name, joinAnd(inherited)))
+	}
+
+	if lost := j.crontabLosses(); len(lost) > 0 {
+		warnings = append(warnings, fmt.Sprintf("job '%s' loses %s", name, joinAnd(lost)))
+	}
+
+	if exp.b.Len() > 0 {
+		exp.b.WriteString("\n")
+	}
+	for _, l := range lines {
+		exp.b.WriteString(l + "\n")
+	}
+	exp.b.WriteString("# " + name + "\n")
+	for _, s := range schedules {
+		if j.Disable {
+			exp.b.WriteString("# ")
+		}
+		exp.b.WriteString(s + " " + command + "\n")
+	}
+	return warnings, nil
+}
+
+// crontabCron tells whether crontab knows the cron string, without seconds
+// and with only the macros it has.
+func crontabCron(cron string) bool {
+	if strings.HasPrefix(cron, "@") {
+		_, ok := crontabMacros[cron]
+		return ok && cron != "@reboot"
+	}
+	return len(strings.Fields(cron)) == 5
+}
+
+// crontabCommand turns a command into the shell that runs it, "" for the
+// default one, and the line to run. Commands that already go through a shell
+// with -c are written as they are, others get quoted.
+func crontabCommand(command []string) (string, string) {
+	if len(command) == 3 && command[1] == "-c" {
+		switch path.Base(command[0]) {
+		case "sh":
+			return "", command[2]
+		case "bash", "dash", "ksh", "zsh":
+			return command[0], command[2]
+		}
+	}
+
+	args := make([]string, 0, len(command))
+	for _, arg := range command {
+		if crontabSafeArg.MatchString(arg) {
+			args = append(args, arg)
+		} else {
+			args = append(args, shellQuote(arg))
+		}
+	}
+	return "", strings.Join(args, " ")
+}
+
+// crontabValue quotes the value of a variable when cron would trim or unquote it.
+func crontabValue(v string) string {
+	if v == "" || strings.TrimSpace(v) != v || strings.ContainsAny(v[:1], `"'`) {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// joinAnd lists items as "a, b and c".
+func joinAnd(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
@@ -0,0 +1,189 @@
+package cheek
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestImportCrontab(t *testing.T) {
+	f, err := os.Open("../testdata/crontab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s, err := ImportCrontab(f)
+	// the lines that can't be imported are reported with their line number
+	var lineErr *CrontabLineError
+	if assert.True(t, errors.As(err, &lineErr)) {
+		assert.Equal(t, 7, lineErr.Line)
+	}
+	assert.Equal(t, []string{
+		"line 7: MAILTO is not supported, use the notifications of on_error instead",
+		"line 24: cron string '61 * * * *' not valid",
+		"line 25: unknown schedule '@every5m'",
+		"line 26: expected 5 time fields and a command, got '0 0 * *'",
+	}, strings.Split(err.Error(), "\n"))
+
+	env := map[string]string{"PATH": "/usr/local/bin:/usr/bin:/bin", "BACKUP_DIR": "/srv/backups"}
+	assert.Equal(t, map[string]*JobSpec{
+		"nightly_backup_of_the_database": {
+			Cron:    "30 2 * * *",
+			Command: []string{"/bin/bash", "-c", "/usr/local/bin/backup.sh --full >> /var/log/backup.log 2>&1"},
+			Env:     env,
+		},
+		"rotate_the_logs": {
+			Cron:    "@daily",
+			Command: []string{"/bin/bash", "-c", "/usr/sbin/logrotate /etc/logrotate.conf"},
+			Env:     env,
+		},
+		// without a comment right above, the job is named after its program
+		"logrotate": {
+			Cron:    "@weekly",
+			Command: []string{"/bin/bash", "-c", "/usr/sbin/logrotate /etc/logrotate.conf --force"},
+			Env:     env,
+		},
+		"curl": {
+			Cron:    "*/15 9-17 * * 1-5",
+			Command: []string{"/bin/bash", "-c", "curl -fsS https://example.com/ping > /dev/null"},
+			Env:     env,
+		},
+		"warmup": {
+			RunOnStart: true,
+			Command:    []string{"/bin/bash", "-c", "/opt/app/bin/warmup"},
+			Env:        env,
+		},
+		"mail": {
+			Cron:    "0 8 1 * *",
+			Command: []string{"/bin/bash", "-c", `mail -s "Monthly report" team@example.com`},
+			Stdin:   "Hi team,\n\nthe report is attached. It's 100% done.\n",
+			Env:     env,
+		},
+		"send_the_digest": {
+			Cron:       "0 7 * * mon-fri",
+			Command:    []string{"/bin/bash", "-c", "/opt/app/bin/digest"},
+			Env:        env,
+			TZLocation: "America/New_York",
+		},
+	}, s.Jobs)
+
+	// the imported jobs survive being written as yaml and loaded again
+	b, err := yaml.Marshal(&s)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "name:")
+	loaded, err := parseSpecs("crontab.yaml", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, s.Jobs, loaded.Jobs)
+	loaded.cfg = NewConfig()
+	assert.Empty(t, loaded.validate())
+}
+
+func TestImportCrontabNames(t *testing.T) {
+	s, err := ImportCrontab(strings.NewReader(`
+# run it
+* * * * * ./run.sh
+# RUN IT!
+@hourly	./run.sh
+# 
+@monthly ./.../
+* * * * * %only stdin
+`))
+	assert.EqualError(t, err, "line 8: no command in '* * * * * %only stdin'")
+	assert.Len(t, s.Jobs, 3)
+	assert.Equal(t, "@hourly", s.Jobs["run_it_2"].Cron)
+	assert.Equal(t, []string{"sh", "-c", "./run.sh"}, []string(s.Jobs["run_it_2"].Command))
+	assert.Equal(t, "@monthly", s.Jobs["line_7"].Cron)
+}
+
+func TestToCrontab(t *testing.T) {
+	f, err := os.Open("../testdata/crontab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	imported, _ := ImportCrontab(f)
+
+	crontab, warnings, err := imported.ToCrontab()
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, `SHELL=/bin/bash
+BACKUP_DIR=/srv/backups
+PATH=/usr/local/bin:/usr/bin:/bin
+# curl
+*/15 9-17 * * 1-5 curl -fsS https://example.com/ping > /dev/null
+
+# logrotate
+@weekly /usr/sbin/logrotate /etc/logrotate.conf --force
+
+# mail
+0 8 1 * * mail -s "Monthly report" team@example.com%Hi team,%%the report is attached. It's 100\% done.
+
+# nightly_backup_of_the_database
+30 2 * * * /usr/local/bin/backup.sh --full >> /var/log/backup.log 2>&1
+
+# rotate_the_logs
+@daily /usr/sbin/logrotate /etc/logrotate.conf
+
+# warmup
+@reboot /opt/app/bin/warmup
+
+CRON_TZ=America/New_York
+# send_the_digest
+0 7 * * mon-fri /opt/app/bin/digest
+`, crontab)
+
+	// importing the export gives back the same jobs
+	again, err := ImportCrontab(strings.NewReader(crontab))
+	assert.NoError(t, err)
+	assert.Equal(t, imported.Jobs, again.Jobs)
+}
+
+func TestToCrontabWarnings(t *testing.T) {
+	s := &Schedule{Jobs: map[string]*JobSpec{
+		"report": {
+			Cron:             "0 6 * * *",
+			Command:          []string{"python", "report.py", "--title", "it's {{ .day }}", "100%"},
+			Env:              map[string]string{"TITLE": " padded "},
+			Retries:          2,
+			WorkingDirectory: "/srv/reports",
+			OnError:          OnEvent{NotifyWebhook: []Webhook{{URL: "https://example.com"}}},
+			RunOnStart:       true,
+		},
+		"sync":      {Cron: "*/5 * * * *", Command: []string{"rsync", "-a", "src/", "dst/"}, Disable: true, TZLocation: "UTC"},
+		"seconds":   {Cron: "*/10 * * * * *", Command: []string{"true"}},
+		"triggered": {Command: []string{"true"}},
+		"z_last":    {Cron: "@5minutes", Command: []string{"true"}},
+	}, Blackout: []Blackout{{}}}
+
+	crontab, warnings, err := s.ToCrontab()
+	assert.NoError(t, err)
+	assert.Equal(t, `TITLE=" padded "
+# report
+@reboot python report.py --title 'it'\''s {{ .day }}' '100\%'
+0 6 * * * python report.py --title 'it'\''s {{ .day }}' '100\%'
+
+CRON_TZ=UTC
+# sync
+# */5 * * * * rsync -a src/ dst/
+`, crontab)
+	assert.Equal(t, []string{
+		"the schedule loses blackout",
+		"job 'report' loses retries, on_error, params and working_directory",
+		"job 'seconds' is left out, crontab can't express its cron string '*/10 * * * * *'",
+		"job 'triggered' is left out, it doesn't run on a cron",
+		"job 'z_last' is left out, crontab can't express its cron string '@5minutes'",
+		// jobs in another timezone come last
+		"job 'sync' also gets TITLE from the lines above it",
+	}, warnings)
+
+	s.Jobs["sync"].Command = []string{"sh", "-c", "echo a\necho b"}
+	_, _, err = s.ToCrontab()
+	assert.EqualError(t, err, "command of job 'sync' spans multiple lines, which a crontab can't hold")
+}
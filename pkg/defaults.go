@@ -0,0 +1,85 @@
+package cheek
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyDefaults merges the defaults block of a schedule document into each of
+// its jobs. Mappings (e.g. env or on_error) are merged key by key, for other
+// values (e.g. lists of webhooks) the one of the job replaces the default.
+func applyDefaults(doc *yaml.Node) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	root := doc.Content[0]
+
+	defaults := mappingValue(root, "defaults")
+	jobs := mappingValue(root, "jobs")
+	if defaults == nil || jobs == nil || jobs.Kind != yaml.MappingNode {
+		return nil
+	}
+	if defaults.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %v: defaults should be a mapping of job specs", defaults.Line)
+	}
+
+	for i := 1; i < len(jobs.Content); i += 2 {
+		jobs.Content[i] = mergeNodes(defaults, jobs.Content[i])
+	}
+	return nil
+}
+
+// scheduleSettings lists the schedule wide settings a schedule document sets.
+func scheduleSettings(doc *yaml.Node) []string {
+	settings := []string{}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return settings
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch key := root.Content[i].Value; key {
+		case "jobs", "defaults", "strict", "expand_env":
+		default:
+			settings = append(settings, key)
+		}
+	}
+	return settings
+}
+
+// mappingValue returns the value of key in a mapping node, nil when it is not set.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mergeNodes returns node extended with the keys of defaults it does not set itself.
+func mergeNodes(defaults *yaml.Node, node *yaml.Node) *yaml.Node {
+	// a job without any specs only gets the defaults
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: node.Line, Column: node.Column}
+	}
+	if defaults.Kind != yaml.MappingNode || node.Kind != yaml.MappingNode {
+		return node
+	}
+
+	merged := *node
+	merged.Content = append([]*yaml.Node{}, node.Content...)
+	for i := 0; i+1 < len(defaults.Content); i += 2 {
+		key, value := defaults.Content[i], defaults.Content[i+1]
+		if own := mappingValue(node, key.Value); own != nil {
+			for k := 1; k < len(merged.Content); k += 2 {
+				if merged.Content[k-1].Value == key.Value {
+					merged.Content[k] = mergeNodes(value, own)
+				}
+			}
+			continue
+		}
+		merged.Content = append(merged.Content, key, value)
+	}
+	return &merged
+}
@@ -0,0 +1,77 @@
+package cheek
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDefaults(t *testing.T) {
+	s, err := readSpecs("../testdata/defaults.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := s.Jobs["plain"]
+	assert.Equal(t, "/tmp", plain.WorkingDirectory)
+	assert.Equal(t, 2, plain.Retries)
+	assert.Equal(t, map[string]string{"STAGE": "prod", "LEVEL": "info"}, plain.Env)
+	assert.Equal(t, []SlackWebhook{{URL: "https://hooks.slack.com/services/default"}}, plain.OnError.NotifySlackWebhook)
+
+	// job level values win, mappings get merged and lists replaced
+	custom := s.Jobs["custom"]
+	assert.Equal(t, stringArray{"echo", "custom"}, custom.Command)
+	assert.Equal(t, 0, custom.Retries)
+	assert.Equal(t, map[string]string{"STAGE": "prod", "LEVEL": "debug"}, custom.Env)
+	assert.Equal(t, []SlackWebhook{{URL: "https://hooks.slack.com/services/custom"}}, custom.OnError.NotifySlackWebhook)
+	assert.Equal(t, []JobTrigger{{Name: "plain"}}, custom.OnError.TriggerJob)
+
+	// a job without specs gets just the defaults
+	assert.Equal(t, 2, s.Jobs["bare"].Retries)
+
+	// validation happens on the merged specs
+	s.log = NewLogger("debug", new(tsBuffer))
+	assert.NoError(t, s.initialize())
+
+	doc := yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("defaults: [retries]\njobs:\n  foo:\n    command: date\n"), &doc))
+	assert.ErrorContains(t, applyDefaults(&doc), "defaults should be a mapping")
+}
+
+func TestDefaultsMergeRules(t *testing.T) {
+	s, err := parseSpecs("schedule.yaml", []byte(`
+defaults:
+  retries: 2
+  working_directory: /tmp
+  env:
+    STAGE: prod
+  on_error:
+    notify_slack_webhook:
+      - https://hooks.slack.com/services/default
+jobs:
+  partial:
+    command: date
+    on_error:
+      trigger_job: [quiet]
+  quiet:
+    command: date
+    working_directory: ""
+    env: {}
+    on_error:
+      notify_slack_webhook: []
+`))
+	assert.NoError(t, err)
+
+	// a mapping that a job sets in part keeps the other keys of the default
+	partial := s.Jobs["partial"]
+	assert.Equal(t, []SlackWebhook{{URL: "https://hooks.slack.com/services/default"}}, partial.OnError.NotifySlackWebhook)
+	assert.Equal(t, []JobTrigger{{Name: "quiet"}}, partial.OnError.TriggerJob)
+	assert.Equal(t, 2, partial.Retries)
+
+	// an empty mapping still gets the defaults, an empty list or value replaces them
+	quiet := s.Jobs["quiet"]
+	assert.Equal(t, map[string]string{"STAGE": "prod"}, quiet.Env)
+	assert.Empty(t, quiet.OnError.NotifySlackWebhook)
+	assert.Empty(t, quiet.WorkingDirectory)
+}
@@ -0,0 +1,149 @@
+package cheek
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Supported ways to secure the connection to the SMTP server.
+const (
+	SMTPTLSStartTLS string = "starttls"
+	SMTPTLSImplicit string = "tls"
+	SMTPTLSNone     string = "none"
+)
+
+// emailLogLines is how many of the last lines of a run's log are included in an email.
+const emailLogLines = 20
+
+const smtpTimeout = 10 * time.Second
+
+// newEmail composes the message to notify about a run.
+func newEmail(from string, to []string, jr *JobRun) []byte {
+	subject := fmt.Sprintf("[cheek] %s succeeded", jr.Name)
+	if !jr.succeeded() {
+		subject = fmt.Sprintf("[cheek] %s FAILED (exitcode %v)", jr.Name, jr.Status)
+	}
+
+	lines := strings.Split(strings.TrimRight(jr.notifyLog(), "\n"), "\n")
+	if len(lines) > emailLogLines {
+		lines = lines[len(lines)-emailLogLines:]
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "Job: %s\r\n", jr.Name)
+	fmt.Fprintf(&b, "Triggered by: %s\r\n", jr.TriggeredBy)
+	fmt.Fprintf(&b, "Triggered at: %s\r\n", jr.TriggeredAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Status: %v\r\n", jr.Status)
+	fmt.Fprintf(&b, "Duration: %s\r\n", jr.Duration.Truncate(time.Millisecond))
+	fmt.Fprintf(&b, "\r\nLast %v lines of the log:\r\n\r\n", emailLogLines)
+	for _, line := range lines {
+		// a lone dot would end the message
+		if strings.HasPrefix(line, ".") {
+			line = "." + line
+		}
+		fmt.Fprintf(&b, "%s\r\n", line)
+	}
+
+	return b.Bytes()
+}
+
+// JobRunEmail notifies the given addresses about a run via the SMTP server in
+// the config, ctx bounds the whole conversation with the server.
+func JobRunEmail(ctx context.Context, cfg Config, jr *JobRun, to []string) error {
+	if cfg.SMTPHost == "" {
+		return errors.New("no smtp host configured")
+	}
+	from := cfg.SMTPFrom
+	if from == "" {
+		from = cfg.SMTPUsername
+	}
+
+	return sendMail(ctx, cfg, from, to, newEmail(from, to, jr))
+}
+
+func sendMail(ctx context.Context, cfg Config, from string, to []string, msg []byte) error {
+	port := cfg.SMTPPort
+	if port == "" {
+		port = "587"
+	}
+	addr := net.JoinHostPort(cfg.SMTPHost, port)
+	tlsConfig := &tls.Config{ServerName: cfg.SMTPHost}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	switch cfg.SMTPTLS {
+	case SMTPTLSImplicit:
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	case "", SMTPTLSStartTLS, SMTPTLSNone:
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	default:
+		return fmt.Errorf("smtp tls mode should be one of '%s', '%s' or '%s', got '%s'", SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone, cfg.SMTPTLS)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.SMTPTLS == "" || cfg.SMTPTLS == SMTPTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if cfg.SMTPUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,115 @@
+package cheek
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTP accepts a single mail on a plain connection and hands over its data.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan string, 1)
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var msg strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					data <- msg.String()
+					reply("250 OK")
+					continue
+				}
+				msg.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return l.Addr().String(), data
+}
+
+func TestNewEmail(t *testing.T) {
+	jr := &JobRun{
+		Name:        "backup",
+		TriggeredBy: "cron",
+		Status:      2,
+		Duration:    1500 * time.Millisecond,
+		Log:         strings.Repeat("line\n", 30) + ".hidden\nlast line\n",
+	}
+
+	msg := string(newEmail("cheek@example.com", []string{"ops@example.com"}, jr))
+	assert.Contains(t, msg, "Subject: [cheek] backup FAILED (exitcode 2)\r\n")
+	assert.Contains(t, msg, "To: ops@example.com\r\n")
+	assert.Contains(t, msg, "Triggered by: cron\r\n")
+	assert.Contains(t, msg, "Duration: 1.5s\r\n")
+	assert.Contains(t, msg, "\r\n..hidden\r\nlast line\r\n")
+	assert.Equal(t, emailLogLines, strings.Count(msg[strings.Index(msg, "log:"):], "\r\n")-2)
+
+	jr.Status = 0
+	msg = string(newEmail("cheek@example.com", []string{"ops@example.com"}, jr))
+	assert.Contains(t, msg, "Subject: [cheek] backup succeeded\r\n")
+}
+
+func TestJobRunEmail(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	cfg := Config{SMTPHost: host, SMTPPort: port, SMTPFrom: "cheek@example.com", SMTPTLS: SMTPTLSNone}
+	jr := &JobRun{Name: "backup", TriggeredBy: "cron", Log: "all good\n"}
+
+	err := JobRunEmail(context.Background(), cfg, jr, []string{"ops@example.com"})
+	assert.NoError(t, err)
+
+	select {
+	case msg := <-data:
+		assert.Contains(t, msg, "Subject: [cheek] backup succeeded")
+		assert.Contains(t, msg, "all good")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+
+	// plain servers are refused unless asked for explicitly
+	addr, _ = fakeSMTP(t)
+	host, port, _ = net.SplitHostPort(addr)
+	cfg = Config{SMTPHost: host, SMTPPort: port, SMTPFrom: "cheek@example.com"}
+	assert.Error(t, JobRunEmail(context.Background(), cfg, jr, []string{"ops@example.com"}))
+
+	assert.Error(t, JobRunEmail(context.Background(), Config{}, jr, []string{"ops@example.com"}))
+}
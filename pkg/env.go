@@ -0,0 +1,249 @@
+package cheek
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readEnvFile parses a file of KEY=VALUE lines into environment entries.
+// Blank lines and lines starting with # are ignored, an `export ` prefix and
+// quotes around the value are stripped.
+func readEnvFile(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env := []string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s:%v: expected KEY=VALUE", fn, n)
+		}
+
+		v = strings.TrimSpace(v)
+		if len(v) > 1 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return env, scanner.Err()
+}
+
+// specPath resolves a path in the job's specs, such as that of an env file,
+// relative paths are taken relative to the schedule file the job is defined in.
+func (j *JobSpec) specPath(fn string) string {
+	switch {
+	case filepath.IsAbs(fn):
+		return fn
+	case isURL(j.SourceFile):
+		return fn
+	case j.SourceFile != "":
+		return filepath.Join(filepath.Dir(j.SourceFile), fn)
+	case j.globalSchedule == nil || j.globalSchedule.fn == "":
+		return fn
+	}
+	return filepath.Join(filepath.Dir(j.globalSchedule.fn), fn)
+}
+
+// runEnv describes a run to its command, through CHEEK_* environment variables.
+func runEnv(jr *JobRun, attempt int) []string {
+	env := []string{
+		"CHEEK_JOB_NAME=" + jr.Name,
+		"CHEEK_TRIGGER=" + jr.TriggeredBy,
+		"CHEEK_TRIGGERED_AT=" + jr.TriggeredAt.Format(time.RFC3339),
+		fmt.Sprintf("CHEEK_RETRY_ATTEMPT=%v", attempt),
+	}
+
+	keys := make([]string, 0, len(jr.Params))
+	for k := range jr.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("CHEEK_PARAM_%s=%s", paramEnvName(k), jr.Params[k]))
+	}
+	return append(env, jr.parent.env(jr.TriggeredByRunID)...)
+}
+
+// paramEnvName turns the key of a parameter into the upper case name of an
+// environment variable, characters that can't be part of it become _.
+func paramEnvName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i := range b {
+		if !isEnvNameChar(b[i], false) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// environ returns the variables the job adds to the host's environment
+// together with the values of its secrets. The variables that describe the
+// run come first, variables from env files override those and are in turn
+// overridden by the job's env and secrets.
+func (j *JobSpec) environ(run []string) ([]string, []string, error) {
+	env := append([]string{}, run...)
+	for _, fn := range j.EnvFile {
+		vars, err := readEnvFile(j.specPath(fn))
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read env file: %w", err)
+		}
+		env = append(env, vars...)
+	}
+
+	for k, v := range j.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	secrets, err := j.loadSecrets()
+	if err != nil {
+		return nil, nil, err
+	}
+	values := []string{}
+	for k, v := range secrets {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+		values = append(values, v)
+	}
+	return env, values, nil
+}
+
+// isEnvNameChar tells whether c can be part of the name of an environment variable,
+// digits are only allowed after the first character.
+func isEnvNameChar(c byte, first bool) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (!first && '0' <= c && c <= '9')
+}
+
+// expandEnvEnabled tells whether a schedule document asks for environment
+// variables to be substituted in its values.
+func expandEnvEnabled(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false
+	}
+	v := mappingValue(doc.Content[0], "expand_env")
+	return v != nil && v.Kind == yaml.ScalarNode && v.Value == "true"
+}
+
+// expandSpecEnv substitutes the $VAR, ${VAR} and ${VAR:-default} references
+// in the values of a schedule document with values looked up in the
+// environment. Keys and comments are left alone. A reference to a variable that
+// is not set and has no default is an error, $$ stands for a literal $.
+func expandSpecEnv(doc *yaml.Node, lookup func(string) (string, bool)) error {
+	missing := []string{}
+	var expand func(n *yaml.Node) error
+	expand = func(n *yaml.Node) error {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, c := range n.Content {
+				if err := expand(c); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for i := 1; i < len(n.Content); i += 2 {
+				if err := expand(n.Content[i]); err != nil {
+					return err
+				}
+			}
+		case yaml.ScalarNode:
+			v, unset, err := expandEnvRefs(n.Value, lookup)
+			if err != nil {
+				return fmt.Errorf("line %v: %w", n.Line, err)
+			}
+			for _, name := range unset {
+				missing = append(missing, fmt.Sprintf("%s (line %v)", name, n.Line))
+			}
+			if v != n.Value {
+				n.Value = v
+				// let a plain value that now reads e.g. 5 decode as a number
+				if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+					n.Tag = ""
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := expand(doc); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variables referenced in the schedule are not set: %s, use $$ for a literal $", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// expandEnvRefs substitutes the $VAR, ${VAR} and ${VAR:-default} references
+// in s, it also returns the names of the variables that are not set and have no
+// default. A $ that doesn't start a reference is kept as is.
+func expandEnvRefs(s string, lookup func(string) (string, bool)) (string, []string, error) {
+	var b strings.Builder
+	missing := []string{}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		var name, def string
+		hasDefault := false
+		switch c := s[i+1]; {
+		case c == '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case c == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", nil, errors.New("unterminated ${")
+			}
+			name, def, hasDefault = strings.Cut(s[i+2:i+2+end], ":-")
+			i += 2 + end
+
+			if name == "" || !isEnvNameChar(name[0], true) || strings.IndexFunc(name, func(r rune) bool { return r > 127 || !isEnvNameChar(byte(r), false) }) >= 0 {
+				return "", nil, fmt.Errorf("'%s' is not a valid environment variable name", name)
+			}
+		case isEnvNameChar(c, true):
+			end := i + 2
+			for end < len(s) && isEnvNameChar(s[end], false) {
+				end++
+			}
+			name = s[i+1 : end]
+			i = end - 1
+		default:
+			b.WriteByte('$')
+			continue
+		}
+
+		v, ok := lookup(name)
+		switch {
+		case ok && (v != "" || !hasDefault):
+			b.WriteString(v)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			missing = append(missing, name)
+		}
+	}
+
+	return b.String(), missing, nil
+}
@@ -0,0 +1,156 @@
+package cheek
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	env, err := readEnvFile("../testdata/test.env")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"TEA=green", "COFFEE=black", "MILK=oat"}, env)
+
+	fn := path.Join(t.TempDir(), "broken.env")
+	if err := os.WriteFile(fn, []byte("TEA=green\nnope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = readEnvFile(fn)
+	assert.ErrorContains(t, err, "broken.env:2")
+}
+
+func TestJobWithEnvFile(t *testing.T) {
+	jobSpec := []byte(`
+command: env
+env_file: test.env
+env:
+  TEA: earl grey
+`)
+
+	j := JobSpec{}
+	if err := yaml.Unmarshal(jobSpec, &j); err != nil {
+		t.Fatal(err)
+	}
+	// env files are resolved relative to the schedule file
+	j.globalSchedule = &Schedule{fn: "../testdata/schedule.yaml", loc: time.Local}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Contains(t, jr.Log, "COFFEE=black")
+	assert.Contains(t, jr.Log, "TEA=earl grey")
+
+	// a missing env file fails the run
+	j.EnvFile = []string{"missing.env"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "missing.env")
+}
+
+func TestRunEnv(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test_run_env",
+		Command:        []string{"sh", "-c", "env; exit 1"},
+		Retries:        1,
+		RetryDelay:     time.Millisecond,
+		globalSchedule: &Schedule{loc: time.UTC},
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+	}
+
+	jr := j.execCommandWithRetry(context.Background(), "job[parent]", map[string]string{"date": "2023-01-01", "dry-run": "true"})
+	assert.Contains(t, jr.Log, "CHEEK_JOB_NAME=test_run_env\n")
+	assert.Contains(t, jr.Log, "CHEEK_TRIGGER=job[parent][retry=1]\n")
+	assert.Contains(t, jr.Log, "CHEEK_TRIGGERED_AT="+jr.TriggeredAt.Format(time.RFC3339)+"\n")
+	assert.Contains(t, jr.Log, "CHEEK_RETRY_ATTEMPT=1\n")
+	assert.Contains(t, jr.Log, "CHEEK_PARAM_DATE=2023-01-01\n")
+	assert.Contains(t, jr.Log, "CHEEK_PARAM_DRY_RUN=true\n")
+
+	// the job's own env takes precedence
+	j.Retries = 0
+	j.Env = map[string]string{"CHEEK_JOB_NAME": "mine"}
+	jr = j.execCommandWithRetry(context.Background(), "manual", nil)
+	assert.Contains(t, jr.Log, "CHEEK_JOB_NAME=mine\n")
+	assert.NotContains(t, jr.Log, "CHEEK_JOB_NAME=test_run_env")
+	assert.Contains(t, jr.Log, "CHEEK_TRIGGER=manual\n")
+	assert.Contains(t, jr.Log, "CHEEK_RETRY_ATTEMPT=0\n")
+}
+
+func TestExpandSpecEnv(t *testing.T) {
+	env := map[string]string{"DATA_DIR": "/data", "EMPTY": "", "API_URL": "https://api.example.com", "RETRIES": "3"}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	doc := yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`# refers to $NOT_SET and ${NOT_SET_EITHER}
+working_directory: ${DATA_DIR}/jobs
+retries: ${RETRIES}
+env:
+  API_URL: ${API_URL}
+  LEVEL: ${LEVEL:-info}
+  EMPTY: ${EMPTY:-fallback}
+  ${NOT_A_VALUE}: key
+  URL: $API_URL/v1
+  PRICE: $5 or $ or $
+command: sh -c 'echo $$HOME costs $$5 or $${HOME} {{ .x }}'
+`), &doc))
+	assert.NoError(t, expandSpecEnv(&doc, lookup))
+
+	var out struct {
+		WorkingDirectory string            `yaml:"working_directory"`
+		Retries          int               `yaml:"retries"`
+		Env              map[string]string `yaml:"env"`
+		Command          string            `yaml:"command"`
+	}
+	assert.NoError(t, doc.Decode(&out))
+	assert.Equal(t, "/data/jobs", out.WorkingDirectory)
+	assert.Equal(t, 3, out.Retries)
+	assert.Equal(t, map[string]string{"API_URL": "https://api.example.com", "LEVEL": "info", "EMPTY": "fallback", "${NOT_A_VALUE}": "key", "URL": "https://api.example.com/v1", "PRICE": "$5 or $ or $"}, out.Env)
+	assert.Equal(t, "sh -c 'echo $HOME costs $5 or ${HOME} {{ .x }}'", out.Command)
+
+	expandErr := func(specs string) error {
+		doc := yaml.Node{}
+		assert.NoError(t, yaml.Unmarshal([]byte(specs), &doc))
+		return expandSpecEnv(&doc, lookup)
+	}
+	assert.EqualError(t, expandErr("a: ${MISSING}\nb:\n  - $OTHER\n"), "environment variables referenced in the schedule are not set: MISSING (line 1), OTHER (line 3), use $$ for a literal $")
+	assert.ErrorContains(t, expandErr("a: ${DATA_DIR"), "unterminated")
+	assert.ErrorContains(t, expandErr("a: ${DATA-DIR}"), "not a valid environment variable name")
+}
+
+func TestReadSpecsExpandsEnv(t *testing.T) {
+	t.Setenv("CHEEK_TEST_WORKDIR", "/tmp")
+	fn := path.Join(t.TempDir(), "jobs.yaml")
+	specs := []byte("expand_env: true\njobs:\n  foo:\n    command:\n      - echo\n      - $$literal\n      - $${literal}\n      - $CHEEK_TEST_WORKDIR\n    working_directory: ${CHEEK_TEST_WORKDIR}\n")
+	if err := os.WriteFile(fn, specs, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := readSpecs(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp", s.Jobs["foo"].WorkingDirectory)
+	assert.Equal(t, stringArray{"echo", "$literal", "${literal}", "/tmp"}, s.Jobs["foo"].Command)
+
+	if err := os.WriteFile(fn, []byte("expand_env: true\njobs:\n  foo:\n    command: echo ${CHEEK_TEST_UNSET}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = readSpecs(fn)
+	assert.ErrorContains(t, err, "CHEEK_TEST_UNSET (line 4)")
+
+	// without expand_env the schedule is taken as is
+	if err := os.WriteFile(fn, []byte("jobs:\n  foo:\n    command: echo ${CHEEK_TEST_WORKDIR}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = readSpecs(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, stringArray{"echo", "${CHEEK_TEST_WORKDIR}"}, s.Jobs["foo"].Command)
+}
@@ -0,0 +1,178 @@
+package cheek
+
+import (
+	"context"
+	"sync"
+)
+
+// Events a job can hook into.
+const (
+	eventOnSuccess          string = "on_success"
+	eventOnError            string = "on_error"
+	eventOnStart            string = "on_start"
+	eventOnRetriesExhausted string = "on_retries_exhausted"
+	eventOnStale            string = "on_stale"
+)
+
+var eventKinds = []string{eventOnSuccess, eventOnError, eventOnStart, eventOnRetriesExhausted, eventOnStale}
+
+// event returns the job's specs of an event.
+func (j *JobSpec) event(kind string) OnEvent {
+	switch kind {
+	case eventOnSuccess:
+		return j.OnSuccess
+	case eventOnError:
+		return j.OnError
+	case eventOnStart:
+		return j.OnStart
+	case eventOnRetriesExhausted:
+		return j.OnRetriesExhausted
+	case eventOnStale:
+		return j.OnStale
+	}
+	return OnEvent{}
+}
+
+// event returns the schedule wide specs of an event.
+func (s *Schedule) event(kind string) OnEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch kind {
+	case eventOnSuccess:
+		return s.OnSuccess
+	case eventOnError:
+		return s.OnError
+	case eventOnStart:
+		return s.OnStart
+	case eventOnRetriesExhausted:
+		return s.OnRetriesExhausted
+	case eventOnStale:
+		return s.OnStale
+	}
+	return OnEvent{}
+}
+
+// mergedEvent combines the job's and the schedule's specs of the given events
+// for a run, the run is nil for events that do not depend on its outcome.
+func (j *JobSpec) mergedEvent(jr *JobRun, kinds ...string) OnEvent {
+	merged := OnEvent{}
+	for _, kind := range kinds {
+		events := []OnEvent{j.event(kind)}
+		if j.globalSchedule != nil {
+			events = append(events, j.globalSchedule.event(kind))
+		}
+
+		for _, e := range events {
+			e = e.forRun(jr)
+			merged.TriggerJob = append(merged.TriggerJob, e.TriggerJob...)
+			merged.NotifyWebhook = append(merged.NotifyWebhook, e.NotifyWebhook...)
+			merged.NotifySlackWebhook = append(merged.NotifySlackWebhook, e.NotifySlackWebhook...)
+			merged.NotifyDiscordWebhook = append(merged.NotifyDiscordWebhook, e.NotifyDiscordWebhook...)
+			merged.NotifyTeamsWebhook = append(merged.NotifyTeamsWebhook, e.NotifyTeamsWebhook...)
+			merged.NotifyEmail = append(merged.NotifyEmail, e.NotifyEmail...)
+			merged.NotifyTelegram = append(merged.NotifyTelegram, e.NotifyTelegram...)
+			merged.Notify = append(merged.Notify, e.Notify...)
+			merged.Async = merged.Async || e.Async
+		}
+	}
+	return merged
+}
+
+// empty tells whether an event has no actions.
+func (e OnEvent) empty() bool {
+	return len(e.TriggerJob)+len(e.NotifyWebhook)+len(e.NotifySlackWebhook)+len(e.NotifyDiscordWebhook)+len(e.NotifyTeamsWebhook)+len(e.NotifyEmail)+len(e.NotifyTelegram)+len(e.Notify) == 0
+}
+
+// eventFor returns what needs to happen after a run (attempt). Unless asked
+// for, on_error only fires once the last attempt failed. A canceled run fires
+// on_error, unless notify_on_cancel is off.
+func (j *JobSpec) eventFor(jr *JobRun) OnEvent {
+	switch {
+	case jr.succeeded():
+		return j.mergedEvent(jr, eventOnSuccess)
+	case jr.State == RunStateCanceled:
+		if !j.notifyOnCancel() {
+			return OnEvent{}
+		}
+		return j.mergedEvent(jr, eventOnError)
+	case !jr.retrying:
+		return j.mergedEvent(jr, eventOnError, eventOnRetriesExhausted)
+	case j.OnErrorEveryAttempt:
+		return j.mergedEvent(jr, eventOnError)
+	}
+	return OnEvent{}
+}
+
+// triggerJobs lists the jobs the job can trigger across all of its events.
+func (j *JobSpec) triggerJobs() []JobTrigger {
+	triggers := []JobTrigger{}
+	for _, kind := range eventKinds {
+		triggers = append(triggers, j.event(kind).TriggerJob...)
+	}
+	return triggers
+}
+
+// triggerJobs lists the jobs that get triggered by any job across all schedule wide events.
+func (s *Schedule) triggerJobs() []JobTrigger {
+	triggers := []JobTrigger{}
+	for _, kind := range eventKinds {
+		triggers = append(triggers, s.event(kind).TriggerJob...)
+	}
+	return triggers
+}
+
+// onStart launches the on_start event of a run in the background, the
+// returned WaitGroup is done once all of its actions are.
+func (j *JobSpec) onStart(ctx context.Context, req runRequest) *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	event := j.mergedEvent(nil, eventOnStart)
+	if event.empty() {
+		return &wg
+	}
+
+	jr := &JobRun{
+		ID:               req.id,
+		GroupID:          req.id,
+		Name:             j.Name,
+		TriggeredAt:      j.now(),
+		TriggeredBy:      req.trigger,
+		TriggeredByRunID: req.parentID,
+		Params:           req.params,
+		Status:           -1,
+		State:            RunStateRunning,
+		TriggerDepth:     req.depth,
+		jobRef:           j,
+	}
+	j.resolveTriggers(jr, event)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		j.fireEvent(ctx, jr, event)
+	}()
+	return &wg
+}
+
+// detach runs the actions of an async event in the background, the scheduler
+// waits for them a while when it stops.
+func (s *Schedule) detach(f func()) {
+	if s == nil {
+		go f()
+		return
+	}
+	s.detached.Add(1)
+	go func() {
+		defer s.detached.Done()
+		f()
+	}()
+}
+
+// waitDetached waits for the actions of async events that are in progress, for
+// as long as notifications and canceled runs can take at most.
+func (s *Schedule) waitDetached() {
+	if !waitTimeout(&s.detached, s.cfg.notifyDeadline()+cancelGracePeriod) {
+		s.log.Warn().Msg("actions of async events are taking too long, no longer waiting for them")
+	}
+}
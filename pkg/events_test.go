@@ -0,0 +1,257 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// eventRecorder is a webhook that records the states of the runs it receives per path.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func newEventRecorder(t *testing.T) (*eventRecorder, *httptest.Server) {
+	rec := &eventRecorder{events: map[string][]string{}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jr := JobRun{}
+		if err := json.NewDecoder(r.Body).Decode(&jr); err != nil {
+			t.Error(err)
+		}
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.events[r.URL.Path] = append(rec.events[r.URL.Path], jr.State)
+	}))
+	return rec, ts
+}
+
+func (rec *eventRecorder) get(path string) []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.events[path]
+}
+
+func TestRetryEvents(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:       "test_retry_events",
+		Command:    []string{"false"},
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+		OnStart:    OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/start"}}},
+		OnError:    OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}},
+		OnRetriesExhausted: OnEvent{
+			NotifyWebhook: []Webhook{{URL: ts.URL + "/exhausted"}},
+		},
+		globalSchedule: &Schedule{loc: time.Local},
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+	}
+
+	// by default on_error only fires after the last attempt
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, []string{RunStateRunning}, rec.get("/start"))
+	assert.Equal(t, []string{RunStateCompleted}, rec.get("/error"))
+	assert.Equal(t, []string{RunStateCompleted}, rec.get("/exhausted"))
+
+	// on request it fires after every attempt
+	j.OnErrorEveryAttempt = true
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Len(t, rec.get("/start"), 2)
+	assert.Len(t, rec.get("/error"), 4)
+	assert.Len(t, rec.get("/exhausted"), 2)
+}
+
+func TestNotifyOnStateChangeOnly(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test_state_change",
+		OnSuccess:      OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/success"}}, NotifyOnStateChangeOnly: true},
+		OnError:        OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}, NotifyOnStateChangeOnly: true},
+		globalSchedule: &Schedule{loc: time.Local},
+		inFlight:       newRunTracker(),
+		health:         newJobHealth(),
+		cfg:            cfg,
+	}
+	_ = os.Remove(jobLogFile(j.Name))
+
+	var jr JobRun
+	for _, command := range []string{"true", "true", "false", "false", "false", "true", "true"} {
+		j.Command = []string{command}
+		jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	}
+
+	// the first failure and the recovery get notified
+	assert.Len(t, rec.get("/error"), 1)
+	assert.Len(t, rec.get("/success"), 1)
+	assert.Equal(t, 0, jr.PreviousFailures)
+
+	// the count of failures survives restarts through the run history
+	j.health = newJobHealth()
+	j.Command = []string{"false"}
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	j.Command = []string{"true"}
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 1, jr.PreviousFailures)
+	assert.Len(t, rec.get("/error"), 2)
+	assert.Len(t, rec.get("/success"), 2)
+
+	j.health = newJobHealth()
+	j.Command = []string{"false"}
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	j.health = newJobHealth()
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	j.Command = []string{"true"}
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 2, jr.PreviousFailures)
+}
+
+func TestSuccessExitCodes(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:             "test_success_exit_codes",
+		Command:          []string{"sh", "-c", "exit 1"},
+		SuccessExitCodes: []int{0, 1},
+		Retries:          2,
+		RetryDelay:       time.Millisecond,
+		OnSuccess:        OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/success"}}},
+		OnError:          OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}},
+		globalSchedule:   &Schedule{loc: time.Local},
+		inFlight:         newRunTracker(),
+		health:           newJobHealth(),
+		cfg:              cfg,
+	}
+	assert.NoError(t, j.ValidateExitCodes())
+	_ = os.Remove(jobLogFile(j.Name))
+
+	// the raw exit code is kept, but the run counts as a success and is not retried
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 1, jr.Status)
+	assert.True(t, jr.Success)
+	assert.Equal(t, []string{RunStateCompleted}, rec.get("/success"))
+	assert.Empty(t, rec.get("/error"))
+
+	// exit codes that are not listed are failures, 0 included
+	j.Command = []string{"sh", "-c", "exit 0"}
+	j.SuccessExitCodes = []int{1}
+	j.Retries = 0
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 0, jr.Status)
+	assert.False(t, jr.Success)
+	assert.Len(t, rec.get("/error"), 1)
+
+	j.Command = []string{"sh", "-c", "exit 1"}
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.True(t, jr.Success)
+	assert.Equal(t, 1, jr.PreviousFailures)
+	assert.Len(t, rec.get("/success"), 2)
+
+	j.SuccessExitCodes = []int{256}
+	assert.Error(t, j.ValidateExitCodes())
+}
+
+func TestRetryOnExitCodes(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:             "test_retry_on_exit_codes",
+		Command:          []string{"sh", "-c", "echo attempt; exit 2"},
+		Retries:          2,
+		RetryDelay:       time.Millisecond,
+		RetryOnExitCodes: []int{75},
+		OnStart:          OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/start"}}},
+		OnError:          OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}},
+		globalSchedule:   &Schedule{loc: time.Local},
+		inFlight:         newRunTracker(),
+		cfg:              cfg,
+	}
+	assert.NoError(t, j.ValidateExitCodes())
+
+	// an exit code that is not listed goes straight to on_error
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 2, jr.Status)
+	assert.Equal(t, "test", jr.TriggeredBy)
+	assert.Contains(t, jr.Log, "not retrying: exit code 2 not retryable")
+	assert.Len(t, rec.get("/error"), 1)
+
+	// a listed one gets retried
+	j.Command = []string{"sh", "-c", "exit 75"}
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, "test[retry=2]", jr.TriggeredBy)
+	assert.NotContains(t, jr.Log, "not retrying")
+	assert.Len(t, rec.get("/error"), 2)
+
+	// without a list any failure gets retried
+	j.RetryOnExitCodes = nil
+	j.Command = []string{"sh", "-c", "exit 2"}
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, "test[retry=2]", jr.TriggeredBy)
+
+	j.RetryOnExitCodes = []int{-1}
+	assert.Error(t, j.ValidateExitCodes())
+}
+
+func TestAsyncEvents(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{Jobs: map[string]*JobSpec{}, cfg: cfg}
+	s.Jobs["test_async_parent"] = &JobSpec{
+		Command: []string{"echo", "parent"},
+		OnSuccess: OnEvent{
+			TriggerJob:    []JobTrigger{{Name: "test_async_child"}},
+			NotifyWebhook: []Webhook{{URL: ts.URL + "/success"}},
+		},
+	}
+	s.Jobs["test_async_child"] = &JobSpec{Command: []string{"sleep", "1"}}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	parent, child := s.Jobs["test_async_parent"], s.Jobs["test_async_child"]
+
+	// by default the run waits for the slow downstream job
+	start := time.Now()
+	parent.execCommandWithRetry(context.Background(), "test", nil)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Len(t, rec.get("/success"), 1)
+	child.loadRuns()
+	assert.Len(t, child.Runs, 1)
+
+	// unless its event is async
+	parent.OnSuccess.Async = true
+	start = time.Now()
+	parent.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Less(t, time.Since(start), 900*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(rec.get("/success")) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// the scheduler waits for what got detached
+	s.waitDetached()
+	child.loadRuns()
+	assert.Len(t, child.Runs, 2)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,322 @@
+package cheek
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// Defaults of the event sink.
+const (
+	defaultSinkBatchSize     = 100
+	defaultSinkFlushInterval = 10 * time.Second
+)
+
+// maxSinkBuffer is how many events are kept in memory, beyond that they go to the spool.
+const maxSinkBuffer = 1000
+
+// EventSink is an http endpoint every run of every job gets sent to, in
+// batches of JSON arrays.
+type EventSink struct {
+	URL string `yaml:"url" json:"url"`
+	// sent as the Authorization header, e.g. "Bearer <token>"
+	AuthHeader    string        `yaml:"auth_header,omitempty" json:"-"`
+	BatchSize     int           `yaml:"batch_size,omitempty" json:"batch_size,omitempty"`
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty" json:"flush_interval,omitempty"`
+}
+
+func (e *EventSink) validate() error {
+	if e == nil {
+		return nil
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url of event_sink should be an http(s) url, got '%s'", e.URL)
+	}
+	if e.BatchSize < 0 {
+		return fmt.Errorf("batch_size of event_sink cannot be negative")
+	}
+	if e.FlushInterval < 0 {
+		return fmt.Errorf("flush_interval of event_sink cannot be negative")
+	}
+	return nil
+}
+
+func (e EventSink) batchSize() int {
+	if e.BatchSize == 0 {
+		return defaultSinkBatchSize
+	}
+	return e.BatchSize
+}
+
+func (e EventSink) flushInterval() time.Duration {
+	if e.FlushInterval == 0 {
+		return defaultSinkFlushInterval
+	}
+	return e.FlushInterval
+}
+
+// sinkSpoolFile holds the events that could not be sent yet, they survive a restart.
+func sinkSpoolFile() string {
+	return path.Join(CheekPath(), "event_sink.spool.jsonl")
+}
+
+// sinkSendingFile holds the events of the spool that are being sent.
+func sinkSendingFile() string {
+	return path.Join(CheekPath(), "event_sink.sending.jsonl")
+}
+
+// eventSink buffers runs in memory for a sender to deliver in batches. Events
+// that don't fit in memory, could not be delivered or are still buffered when
+// the sender stops go to the spool, which gets delivered first.
+type eventSink struct {
+	mu      sync.Mutex
+	pending []json.RawMessage
+	// whether a sender delivers the events, without one they go to the spool
+	running bool
+	flush   chan struct{}
+}
+
+// eventSink returns the sink of the schedule, runs go to the spool until a sender runs.
+func (s *Schedule) eventSink() *eventSink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sink == nil {
+		s.sink = &eventSink{flush: make(chan struct{}, 1)}
+	}
+	return s.sink
+}
+
+// sendEvent hands a run to the event sink of the schedule, if it has one.
+// It never waits for the run to be delivered.
+func (s *Schedule) sendEvent(jr *JobRun) {
+	s.mu.RLock()
+	spec := s.EventSink
+	s.mu.RUnlock()
+	if spec == nil {
+		return
+	}
+
+	b, err := json.Marshal(jr)
+	if err != nil {
+		s.log.Warn().Str("job", jr.Name).Err(err).Msg("cannot encode run for the event sink")
+		return
+	}
+	if err := s.eventSink().enqueue(b, spec.batchSize()); err != nil {
+		s.log.Warn().Str("job", jr.Name).Err(err).Msg("cannot spool run for the event sink")
+	}
+}
+
+func (e *eventSink) enqueue(event json.RawMessage, batchSize int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending = append(e.pending, event)
+	if !e.running || len(e.pending) > maxSinkBuffer {
+		// keeps the events in order
+		spooled := e.pending
+		e.pending = nil
+		return spoolEvents(spooled)
+	}
+	if len(e.pending) >= batchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// spoolEvents appends events to the spool.
+func spoolEvents(events []json.RawMessage) error {
+	if len(events) == 0 {
+		return nil
+	}
+	fn := sinkSpoolFile()
+	lock := jobLogLock(fn)
+	lock.Lock()
+	defer lock.Unlock()
+
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, e := range events {
+		// errors stick with the writer and come out of Flush
+		_, _ = w.Write(e)
+		_ = w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	runMetrics.sinkEvents("spooled", len(events))
+	return f.Sync()
+}
+
+// runSink delivers the events of the schedule's sink until ctx is done, at
+// the flush interval or as soon as a batch is full. What is left in memory
+// then goes to the spool.
+func (s *Schedule) runSink(ctx context.Context) {
+	sink := s.eventSink()
+	sink.mu.Lock()
+	sink.running = true
+	sink.mu.Unlock()
+	defer func() {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		sink.running = false
+		if err := spoolEvents(sink.pending); err != nil {
+			s.log.Warn().Err(err).Msgf("cannot spool %v events for the event sink", len(sink.pending))
+		}
+		sink.pending = nil
+	}()
+
+	// start with what got spooled before
+	interval := time.Duration(0)
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-sink.flush:
+			timer.Stop()
+		}
+
+		s.mu.RLock()
+		spec := s.EventSink
+		s.mu.RUnlock()
+		interval = defaultSinkFlushInterval
+		if spec != nil {
+			interval = spec.flushInterval()
+			if err := sink.deliver(ctx, s.cfg, *spec); err != nil {
+				s.log.Warn().Err(err).Msg("cannot deliver events to the event sink, keeping them to try again")
+			}
+		}
+	}
+}
+
+// deliver sends the spooled events, and once those are all delivered the ones in memory.
+func (e *eventSink) deliver(ctx context.Context, cfg Config, spec EventSink) error {
+	for {
+		events, err := takeSpool()
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for len(events) > 0 {
+			n := spec.batchSize()
+			if n > len(events) {
+				n = len(events)
+			}
+			if err := postEvents(ctx, cfg, spec, events[:n]); err != nil {
+				return errors.Join(err, keepSending(events))
+			}
+			events = events[n:]
+		}
+		if err := os.Remove(sinkSendingFile()); err != nil {
+			return err
+		}
+	}
+
+	for {
+		e.mu.Lock()
+		n := spec.batchSize()
+		if n > len(e.pending) {
+			n = len(e.pending)
+		}
+		batch := e.pending[:n]
+		e.pending = e.pending[n:]
+		e.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := postEvents(ctx, cfg, spec, batch); err != nil {
+			e.mu.Lock()
+			spooled := make([]json.RawMessage, 0, len(batch)+len(e.pending))
+			spooled = append(append(spooled, batch...), e.pending...)
+			e.pending = nil
+			e.mu.Unlock()
+			return errors.Join(err, spoolEvents(spooled))
+		}
+	}
+}
+
+// takeSpool moves the spool aside to be sent, unless a previous attempt left
+// events to send, and returns its events.
+func takeSpool() ([]json.RawMessage, error) {
+	lock := jobLogLock(sinkSpoolFile())
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, err := os.Stat(sinkSendingFile()); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(sinkSpoolFile(), sinkSendingFile()); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := os.ReadFile(sinkSendingFile())
+	if err != nil {
+		return nil, err
+	}
+	events := []json.RawMessage{}
+	for _, line := range bytes.Split(b, []byte{'\n'}) {
+		// a line cut off by a crash is no event
+		if len(bytes.TrimSpace(line)) > 0 && json.Valid(line) {
+			events = append(events, line)
+		}
+	}
+	return events, nil
+}
+
+// keepSending replaces the events being sent with the ones that are left.
+func keepSending(events []json.RawMessage) error {
+	return writeAtomically(sinkSendingFile(), func(w io.Writer) error {
+		for _, e := range events {
+			if _, err := w.Write(e); err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte{'\n'}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// postEvents sends a batch of events as a JSON array.
+func postEvents(ctx context.Context, cfg Config, spec EventSink, events []json.RawMessage) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if spec.AuthHeader != "" {
+		header.Set("Authorization", spec.AuthHeader)
+	}
+	if _, err := deliverWebhook(ctx, cfg, "event_sink", http.MethodPost, spec.URL, header, body); err != nil {
+		return err
+	}
+	runMetrics.sinkEvents("delivered", len(events))
+	return nil
+}
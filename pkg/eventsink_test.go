@@ -0,0 +1,138 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sinkServer collects the batches of runs it receives, it fails while down is set.
+type sinkServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	down    bool
+	auth    string
+	batches [][]JobRun
+}
+
+func newSinkServer(t *testing.T) *sinkServer {
+	ss := &sinkServer{}
+	ss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		if ss.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		batch := []JobRun{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		ss.auth = r.Header.Get("Authorization")
+		ss.batches = append(ss.batches, batch)
+	}))
+	t.Cleanup(ss.Close)
+	return ss
+}
+
+// received lists the logs of the runs received so far, in order.
+func (ss *sinkServer) received() []string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	logs := []string{}
+	for _, b := range ss.batches {
+		for _, jr := range b {
+			logs = append(logs, strings.TrimSpace(jr.Log))
+		}
+	}
+	return logs
+}
+
+func newSinkSchedule(t *testing.T, url string) (*Schedule, *JobSpec) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.WebhookRetries = 0
+
+	s := &Schedule{
+		Jobs:      map[string]*JobSpec{"echo": {Command: []string{"sh", "-c", "echo {{ .n }}"}}},
+		EventSink: &EventSink{URL: url, AuthHeader: "Bearer secret", BatchSize: 2, FlushInterval: 20 * time.Millisecond},
+		cfg:       cfg,
+	}
+	assert.NoError(t, s.initialize())
+	return s, s.Jobs["echo"]
+}
+
+func TestEventSink(t *testing.T) {
+	ss := newSinkServer(t)
+	s, j := newSinkSchedule(t, ss.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.runSink(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		s.sink.mu.Lock()
+		defer s.sink.mu.Unlock()
+		return s.sink.running
+	}, time.Second, time.Millisecond)
+
+	for _, n := range []string{"1", "2", "3"} {
+		j.execCommandWithRetry(context.Background(), "test", map[string]string{"n": n})
+	}
+	assert.Eventually(t, func() bool { return len(ss.received()) == 3 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1", "2", "3"}, ss.received())
+	ss.mu.Lock()
+	assert.Equal(t, "Bearer secret", ss.auth)
+	for _, b := range ss.batches {
+		assert.LessOrEqual(t, len(b), 2)
+	}
+	ss.mu.Unlock()
+
+	// while the endpoint is down, runs get spooled and they survive a restart
+	ss.mu.Lock()
+	ss.down = true
+	ss.mu.Unlock()
+	j.execCommandWithRetry(context.Background(), "test", map[string]string{"n": "4"})
+	j.execCommandWithRetry(context.Background(), "test", map[string]string{"n": "5"})
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+	j.execCommandWithRetry(context.Background(), "test", map[string]string{"n": "6"})
+
+	b, err := os.ReadFile(sinkSendingFile())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(b), "\n"))
+	b, err = os.ReadFile(sinkSpoolFile())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+
+	ss.mu.Lock()
+	ss.down = false
+	ss.mu.Unlock()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go s.runSink(ctx)
+	assert.Eventually(t, func() bool { return len(ss.received()) == 6 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, ss.received())
+	for _, fn := range []string{sinkSendingFile(), sinkSpoolFile()} {
+		_, err := os.Stat(fn)
+		assert.True(t, os.IsNotExist(err), fn)
+	}
+}
+
+func TestValidateEventSink(t *testing.T) {
+	assert.NoError(t, (*EventSink)(nil).validate())
+	assert.NoError(t, (&EventSink{URL: "https://collector.example.com/runs"}).validate())
+	assert.Error(t, (&EventSink{URL: "collector.example.com"}).validate())
+	assert.Error(t, (&EventSink{URL: "https://collector.example.com", BatchSize: -1}).validate())
+	assert.Error(t, (&EventSink{URL: "https://collector.example.com", FlushInterval: -time.Second}).validate())
+}
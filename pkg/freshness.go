@@ -0,0 +1,88 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ValidateFreshness checks the freshness settings of a job.
+func (j *JobSpec) ValidateFreshness() error {
+	if j.MaxTimeSinceSuccess < 0 {
+		return fmt.Errorf("max_time_since_success for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
+
+// isStale tells whether the job has not succeeded within its max_time_since_success at refTime.
+func (j *JobSpec) isStale(refTime time.Time) bool {
+	if j.MaxTimeSinceSuccess <= 0 || j.Disable {
+		return false
+	}
+	if _, paused := j.globalSchedule.pausedSince(j.Name); paused {
+		return false
+	}
+	return refTime.Sub(j.health.lastSucceeded(j)) > j.MaxTimeSinceSuccess
+}
+
+// staleEvent returns what needs to happen when a job became stale, that is
+// on_stale or on_error for jobs that don't define any actions for on_stale.
+func (j *JobSpec) staleEvent() OnEvent {
+	if e := j.mergedEvent(nil, eventOnStale); !e.empty() {
+		return e
+	}
+	return j.mergedEvent(nil, eventOnError)
+}
+
+// reportStale fires the stale event of a job with a run that describes the breach.
+func (j *JobSpec) reportStale(ctx context.Context, refTime time.Time) {
+	jr := &JobRun{
+		ID:          newRunID(),
+		Name:        j.Name,
+		TriggeredAt: refTime,
+		TriggeredBy: "freshness_check",
+		Status:      StatusStale,
+		State:       RunStateStale,
+		Log:         fmt.Sprintf("no successful run since %v, max_time_since_success is %v", j.health.lastSucceeded(j).Format(time.RFC3339), j.MaxTimeSinceSuccess),
+		jobRef:      j,
+	}
+	j.log.Warn().Str("job", j.Name).Dur("max_time_since_success", j.MaxTimeSinceSuccess).Msg(jr.Log)
+
+	event := j.staleEvent()
+	j.resolveTriggers(jr, event)
+	j.fireEvent(ctx, jr, event)
+}
+
+// checkFreshness reports the jobs that became stale at refTime, a job gets
+// reported once until it succeeds again.
+func (s *Schedule) checkFreshness(ctx context.Context, refTime time.Time) {
+	for _, j := range s.jobList() {
+		if j.health.markStale(j.isStale(refTime)) {
+			go j.reportStale(ctx, refTime)
+		}
+	}
+}
+
+// staleJobs lists the names of the jobs that have not succeeded within their max_time_since_success.
+func (s *Schedule) staleJobs(refTime time.Time) []string {
+	stale := []string{}
+	for _, j := range s.jobList() {
+		if j.isStale(refTime) {
+			stale = append(stale, j.Name)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+func (s *Schedule) jobList() []*JobSpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*JobSpec, 0, len(s.Jobs))
+	for _, j := range s.Jobs {
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
@@ -0,0 +1,77 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreshness(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local, cfg: cfg}
+	health := newJobHealth()
+	health.loaded = true
+	health.lastSuccess = time.Now().Add(-2 * time.Hour)
+
+	stale := &JobSpec{
+		Name:                "stale",
+		Command:             []string{"true"},
+		MaxTimeSinceSuccess: time.Hour,
+		OnStale:             OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/stale"}}},
+		OnError:             OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/error"}}},
+		globalSchedule:      s,
+		health:              health,
+		cfg:                 cfg,
+	}
+	fresh := &JobSpec{
+		Name:                "fresh",
+		MaxTimeSinceSuccess: 3 * time.Hour,
+		globalSchedule:      s,
+		health:              &jobHealth{loaded: true, lastSuccess: health.lastSuccess},
+		cfg:                 cfg,
+	}
+	s.Jobs = map[string]*JobSpec{"stale": stale, "fresh": fresh}
+
+	now := time.Now()
+	assert.Equal(t, []string{"stale"}, s.staleJobs(now))
+
+	// a breach is reported once
+	s.checkFreshness(context.Background(), now)
+	s.checkFreshness(context.Background(), now.Add(time.Minute))
+	assert.Eventually(t, func() bool { return len(rec.get("/stale")) > 0 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{RunStateStale}, rec.get("/stale"))
+	assert.Empty(t, rec.get("/error"))
+
+	// a successful run resets it
+	stale.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Empty(t, s.staleJobs(time.Now()))
+	s.checkFreshness(context.Background(), time.Now())
+
+	// jobs without on_stale get on_error instead
+	stale.OnStale = OnEvent{}
+	s.checkFreshness(context.Background(), time.Now().Add(2*time.Hour))
+	assert.Eventually(t, func() bool { return len(rec.get("/error")) > 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, rec.get("/stale"), 1)
+
+	// stale jobs are reported by the health check
+	req := httptest.NewRequest(http.MethodGet, "/healthz/", nil)
+	w := httptest.NewRecorder()
+	stale.health.lastSuccess = time.Now().Add(-2 * time.Hour)
+	setupMux(s).ServeHTTP(w, req)
+	resp := Response{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "stale", resp.Status)
+	assert.Equal(t, []string{"stale"}, resp.StaleJobs)
+
+	assert.Error(t, (&JobSpec{Name: "x", MaxTimeSinceSuccess: -time.Second}).ValidateFreshness())
+}
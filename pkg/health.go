@@ -0,0 +1,211 @@
+package cheek
+
+import (
+	"sync"
+	"time"
+)
+
+// healthHistory is how many past runs are looked at to find out how many runs
+// failed in a row when cheek starts.
+const healthHistory = 100
+
+// jobHealth keeps track of how many runs of a job failed in a row and of
+// when it last succeeded. A nil jobHealth does not keep track of anything.
+type jobHealth struct {
+	mu          sync.Mutex
+	loaded      bool
+	failures    int
+	lastSuccess time.Time
+	// whether the job got reported as stale
+	stale bool
+	// since when the circuit of the job is open, zero when it is closed
+	tripped time.Time
+}
+
+// newJobHealth starts tracking a job, a job without successful runs counts
+// as succeeded when it starts being tracked.
+func newJobHealth() *jobHealth {
+	return &jobHealth{lastSuccess: time.Now()}
+}
+
+// load picks up the health of the job from its run history, on first use only.
+func (h *jobHealth) load(j *JobSpec) {
+	if h.loaded {
+		return
+	}
+	failures, lastSuccess, lastFailure := j.healthInHistory()
+	h.failures = failures
+	if !lastSuccess.IsZero() {
+		h.lastSuccess = lastSuccess
+	}
+	// the circuit stays open across restarts
+	if j.MaxConsecutiveFailures > 0 && failures >= j.MaxConsecutiveFailures {
+		h.tripped = lastFailure
+	}
+	h.loaded = true
+}
+
+// record registers the outcome of a run and returns how many runs failed in a
+// row before it. On first use the count is picked up from the run history.
+func (h *jobHealth) record(j *JobSpec, jr *JobRun) int {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load(j)
+
+	previous := h.failures
+	if j.successExitCode(jr.Status) {
+		h.failures = 0
+		h.lastSuccess = jr.TriggeredAt.Add(jr.Duration)
+		h.tripped = time.Time{}
+	} else {
+		h.failures++
+	}
+	return previous
+}
+
+// consecutiveFailures returns how many runs of the job failed in a row.
+func (h *jobHealth) consecutiveFailures(j *JobSpec) int {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load(j)
+	return h.failures
+}
+
+// lastSucceeded returns when the job last finished a successful run.
+func (h *jobHealth) lastSucceeded(j *JobSpec) time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load(j)
+	return h.lastSuccess
+}
+
+// markStale registers whether the job is stale and tells whether it just became so.
+func (h *jobHealth) markStale(stale bool) bool {
+	if h == nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	became := stale && !h.stale
+	h.stale = stale
+	return became
+}
+
+// healthInHistory counts the failed runs since the last successful one in the
+// job's history and returns when that one and the last failed one finished,
+// if any.
+func (j *JobSpec) healthInHistory() (int, time.Time, time.Time) {
+	jrs, _, err := j.history().runs(j.Name, 0, healthHistory)
+	if err != nil {
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("could not load job logs")
+		return 0, time.Time{}, time.Time{}
+	}
+
+	failures := 0
+	lastFailure := time.Time{}
+	for _, jr := range jrs {
+		if jr.Status == StatusSkipped {
+			continue
+		}
+		if j.successExitCode(jr.Status) {
+			return failures, jr.TriggeredAt.Add(jr.Duration), lastFailure
+		}
+		if failures == 0 {
+			lastFailure = jr.TriggeredAt.Add(jr.Duration)
+		}
+		failures++
+	}
+	return failures, time.Time{}, lastFailure
+}
+
+// stateChanged tells whether a run flipped the job from succeeding to failing or the other way around.
+func (jr *JobRun) stateChanged() bool {
+	if jr.succeeded() {
+		return jr.PreviousFailures > 0
+	}
+	return jr.PreviousFailures == 0
+}
+
+// forRun drops the notifications of an event that should not be sent for the run.
+func (e OnEvent) forRun(jr *JobRun) OnEvent {
+	if jr == nil || !e.NotifyOnStateChangeOnly || jr.stateChanged() {
+		return e
+	}
+	return OnEvent{TriggerJob: e.TriggerJob}
+}
+
+// tickTimeout is how long the scheduling loop can go without checking for due
+// jobs before the schedule counts as unhealthy. The loop wakes up at least
+// every maxSleep.
+var tickTimeout = maxSleep + 5*time.Second
+
+// scheduleHealth describes the state of the scheduler as reported by the health check.
+type scheduleHealth struct {
+	healthy          bool
+	lastTick         time.Time
+	dataDirWritable  bool
+	runningJobs      int
+	criticalFailures map[string]int
+}
+
+// health checks whether the scheduling loop keeps ticking and the data
+// directory can be written to. A schedule whose loop never started is only
+// judged on the latter.
+func (s *Schedule) health(refTime time.Time) scheduleHealth {
+	s.mu.RLock()
+	h := scheduleHealth{lastTick: s.lastTick}
+	loopStarted := s.loopStarted
+	s.mu.RUnlock()
+
+	_, err := ensureDataDir()
+	h.dataDirWritable = err == nil
+	h.healthy = h.dataDirWritable
+
+	if !loopStarted.IsZero() {
+		since := loopStarted
+		if h.lastTick.After(since) {
+			since = h.lastTick
+		}
+		if refTime.Sub(since) > tickTimeout {
+			h.healthy = false
+		}
+	}
+
+	for _, j := range s.jobList() {
+		if j.inFlight.active() {
+			h.runningJobs++
+		}
+		if j.Critical {
+			if h.criticalFailures == nil {
+				h.criticalFailures = map[string]int{}
+			}
+			h.criticalFailures[j.Name] = j.health.consecutiveFailures(j)
+		}
+	}
+	return h
+}
+
+// ready tells whether the schedule got loaded and its loop checked for due
+// jobs at least once.
+func (s *Schedule) ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initialized && !s.loopStarted.IsZero() && !s.lastTick.IsZero()
+}
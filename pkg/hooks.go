@@ -0,0 +1,218 @@
+package cheek
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSignatureHeader = "X-Hub-Signature-256"
+	defaultMaxPayloadSize  = 1 << 20
+)
+
+// WebhookTrigger lets another service run a job by sending a request to
+// /hooks/{name} that is signed with a shared secret.
+type WebhookTrigger struct {
+	// name under which the hook is reachable, defaults to the name of the job
+	Name   string `yaml:"name,omitempty" json:"name,omitempty"`
+	Secret Secret `yaml:"secret" json:"secret"`
+	// header that holds the hex encoded HMAC-SHA256 of the payload, optionally prefixed with sha256=
+	SignatureHeader string `yaml:"signature_header,omitempty" json:"signature_header,omitempty"`
+	// params of the run, taken from the JSON payload by their dot separated path
+	Params         map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+	MaxPayloadSize int               `yaml:"max_payload_size,omitempty" json:"max_payload_size,omitempty"`
+}
+
+func (j *JobSpec) ValidateWebhookTrigger() error {
+	wt := j.WebhookTrigger
+	if wt == nil {
+		return nil
+	}
+	if (wt.Secret.Env == "") == (wt.Secret.File == "") {
+		return fmt.Errorf("secret of webhook_trigger of job '%s' should either set env or file", j.Name)
+	}
+	if strings.Contains(wt.Name, "/") {
+		return fmt.Errorf("webhook_trigger name of job '%s' cannot contain '/'", j.Name)
+	}
+	if wt.MaxPayloadSize < 0 {
+		return fmt.Errorf("max_payload_size of webhook_trigger of job '%s' cannot be negative", j.Name)
+	}
+	for param, path := range wt.Params {
+		if path == "" {
+			return fmt.Errorf("param '%s' of webhook_trigger of job '%s' needs a path", param, j.Name)
+		}
+	}
+	return nil
+}
+
+// hookName is the name under which the webhook trigger of a job is reachable.
+func (j *JobSpec) hookName() string {
+	if j.WebhookTrigger != nil && j.WebhookTrigger.Name != "" {
+		return j.WebhookTrigger.Name
+	}
+	return j.Name
+}
+
+func (wt *WebhookTrigger) signatureHeader() string {
+	if wt.SignatureHeader != "" {
+		return wt.SignatureHeader
+	}
+	return defaultSignatureHeader
+}
+
+func (wt *WebhookTrigger) maxPayloadSize() int {
+	if wt.MaxPayloadSize > 0 {
+		return wt.MaxPayloadSize
+	}
+	return defaultMaxPayloadSize
+}
+
+// verify checks that the signature is the HMAC-SHA256 of the payload.
+func (wt *WebhookTrigger) verify(secret string, payload []byte, signature string) bool {
+	given, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(given) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(given, mac.Sum(nil))
+}
+
+// params picks the params of the run from the JSON payload, paths that are
+// not in the payload are left out.
+func (wt *WebhookTrigger) params(payload []byte) (map[string]string, error) {
+	params := map[string]string{}
+	if len(wt.Params) == 0 {
+		return params, nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+	for param, path := range wt.Params {
+		if v, ok := lookupPath(doc, path); ok {
+			params[param] = v
+		}
+	}
+	return params, nil
+}
+
+// lookupPath follows a dot separated path through a decoded JSON document,
+// numbers select elements of arrays. Values that are not a string come back
+// as JSON.
+func lookupPath(doc interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return "", false
+			}
+			doc = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			doc = v[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := doc.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+}
+
+// hookJob returns the job whose webhook trigger goes by name.
+func (s *Schedule) hookJob(name string) (*JobSpec, bool) {
+	for _, j := range s.jobList() {
+		if j.WebhookTrigger != nil && j.hookName() == name {
+			return j, true
+		}
+	}
+	return nil, false
+}
+
+// hooks runs a job for a request to its webhook trigger, once the signature of
+// the payload checks out. The run is started in the background, senders of
+// webhooks tend to give up when an answer takes long.
+func hooks(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/hooks/")
+		job, ok := s.hookJob(name)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, Response{Status: "error: can't find hook", Type: "webhook"})
+			return
+		}
+		wt := job.WebhookTrigger
+
+		limit := wt.maxPayloadSize()
+		if r.ContentLength > int64(limit) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, Response{Job: job.Name, Status: "error: payload too large", Type: "webhook"})
+			return
+		}
+		payload, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Job: job.Name, Status: fmt.Sprintf("error: can't read payload: %v", err), Type: "webhook"})
+			return
+		}
+		if len(payload) > limit {
+			writeJSON(w, http.StatusRequestEntityTooLarge, Response{Job: job.Name, Status: "error: payload too large", Type: "webhook"})
+			return
+		}
+
+		secret, err := wt.Secret.load(job, "webhook_trigger")
+		if err != nil {
+			job.log.Error().Str("job", job.Name).Err(err).Msg("cannot verify webhook")
+			writeJSON(w, http.StatusInternalServerError, Response{Job: job.Name, Status: "error: can't verify payload", Type: "webhook"})
+			return
+		}
+		if !wt.verify(secret, payload, r.Header.Get(wt.signatureHeader())) {
+			writeJSON(w, http.StatusUnauthorized, Response{Job: job.Name, Status: "error: invalid signature", Type: "webhook"})
+			return
+		}
+
+		if job.Disable {
+			writeJSON(w, http.StatusConflict, Response{Job: job.Name, Status: fmt.Sprintf("error: %v", job.errDisabled()), Type: "webhook"})
+			return
+		}
+		params, err := wt.params(payload)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Job: job.Name, Status: fmt.Sprintf("error: %v", err), Type: "webhook"})
+			return
+		}
+
+		trigger := fmt.Sprintf("webhook[%s]", name)
+		runID, ok := admitRequest(w, job, trigger, params, "webhook")
+		if !ok {
+			return
+		}
+		go job.dispatch(s.runContext(), runRequest{id: runID, trigger: trigger, params: params})
+		writeJSON(w, http.StatusAccepted, Response{Job: job.Name, Status: "accepted", Type: "webhook", RunID: runID})
+	}
+}
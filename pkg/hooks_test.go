@@ -0,0 +1,123 @@
+package cheek
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookTrigger(t *testing.T) {
+	t.Setenv("CHEEK_TEST_HOOK_SECRET", "s3cret")
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.AuthToken = "token"
+	s := &Schedule{Jobs: map[string]*JobSpec{}, loc: time.Local, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	job := &JobSpec{
+		Name:    "deploy",
+		Command: []string{"echo", "{{ .ref }} {{ .repo }} {{ .commits }}"},
+		WebhookTrigger: &WebhookTrigger{
+			Name:           "github",
+			Secret:         Secret{Env: "CHEEK_TEST_HOOK_SECRET"},
+			Params:         map[string]string{"ref": "ref", "repo": "repository.full_name", "commits": "commits.0.id", "missing": "nope.nope"},
+			MaxPayloadSize: 200,
+		},
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		log:            s.log,
+		cfg:            cfg,
+	}
+	s.Jobs["deploy"] = job
+	handler := setupMux(s)
+
+	post := func(path, payload, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		if signature != "" {
+			req.Header.Set("X-Hub-Signature-256", signature)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	payload := `{"ref": "refs/heads/main", "repository": {"full_name": "acme/app"}, "commits": [{"id": 42}]}`
+
+	// signed requests get through without the auth token
+	w := post("/hooks/github", payload, sign("s3cret", payload))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	resp := Response{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "accepted", resp.Status)
+
+	var jr JobRun
+	assert.Eventually(t, func() bool {
+		jrs, _, err := s.history().runs("deploy", 0, 10)
+		if err != nil || len(jrs) == 0 {
+			return false
+		}
+		jr = jrs[0]
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, resp.RunID, jr.ID)
+	assert.Equal(t, "webhook[github]", jr.TriggeredBy)
+	assert.Equal(t, map[string]string{"ref": "refs/heads/main", "repo": "acme/app", "commits": "42"}, jr.Params)
+
+	// unverifiable payloads are rejected
+	assert.Equal(t, http.StatusUnauthorized, post("/hooks/github", payload, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/hooks/github", payload, sign("wrong", payload)).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/hooks/github", payload+" ", sign("s3cret", payload)).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/hooks/github", payload, "sha256=zz").Code)
+
+	// as are oversized ones, even when signed
+	big := `{"ref": "` + strings.Repeat("a", 300) + `"}`
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/hooks/github", big, sign("s3cret", big)).Code)
+
+	// payloads that are not json cannot fill in the params
+	assert.Equal(t, http.StatusBadRequest, post("/hooks/github", "nope", sign("s3cret", "nope")).Code)
+
+	assert.Equal(t, http.StatusNotFound, post("/hooks/deploy", payload, sign("s3cret", payload)).Code)
+	req := httptest.NewRequest(http.MethodGet, "/hooks/github", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	// none of the rejected requests started a run
+	jrs, _, err := s.history().runs("deploy", 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, jrs, 1)
+}
+
+func TestValidateWebhookTrigger(t *testing.T) {
+	j := &JobSpec{Name: "x", WebhookTrigger: &WebhookTrigger{}}
+	assert.EqualError(t, j.ValidateWebhookTrigger(), "secret of webhook_trigger of job 'x' should either set env or file")
+	j.WebhookTrigger.Secret.Env = "SECRET"
+	assert.NoError(t, j.ValidateWebhookTrigger())
+	j.WebhookTrigger.Name = "a/b"
+	assert.Error(t, j.ValidateWebhookTrigger())
+	j.WebhookTrigger.Name = ""
+	j.WebhookTrigger.Params = map[string]string{"p": ""}
+	assert.EqualError(t, j.ValidateWebhookTrigger(), "param 'p' of webhook_trigger of job 'x' needs a path")
+
+	s := &Schedule{Jobs: map[string]*JobSpec{
+		"a": {Command: []string{"true"}, WebhookTrigger: &WebhookTrigger{Name: "hook", Secret: Secret{Env: "SECRET"}}},
+		"b": {Command: []string{"true"}, WebhookTrigger: &WebhookTrigger{Name: "hook", Secret: Secret{Env: "SECRET"}}},
+	}}
+	problems := s.validate()
+	if assert.Len(t, problems, 2) {
+		assert.Equal(t, "webhook_trigger name 'hook' of job 'a' is already used by job 'b'", problems[0].Message)
+	}
+}
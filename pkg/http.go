@@ -1,22 +1,97 @@
 package cheek
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
 )
 
 type Response struct {
 	Job    string `json:"jobs,omitempty"`
 	Status string `json:"status,omitempty"`
 	Type   string `json:"type,omitempty"`
+	RunID  string `json:"run_id,omitempty"`
+	// jobs that did not succeed within their max_time_since_success
+	StaleJobs []string `json:"stale_jobs,omitempty"`
+	// jobs that got paused via the api, keyed by name
+	PausedJobs  map[string]time.Time `json:"paused_jobs,omitempty"`
+	PausedSince *time.Time           `json:"paused_since,omitempty"`
+}
+
+// HealthResponse is what the health check reports on the scheduler, next to
+// the stale and paused jobs.
+type HealthResponse struct {
+	Response
+	LastTick        *time.Time `json:"last_tick,omitempty"`
+	DataDirWritable bool       `json:"data_dir_writable"`
+	RunningJobs     int        `json:"running_jobs"`
+	// failures in a row of the jobs flagged as critical, keyed by name
+	CriticalFailures map[string]int `json:"critical_failures,omitempty"`
+}
+
+// RunsResponse holds a page of a job's run history.
+type RunsResponse struct {
+	Runs   []JobRun `json:"runs"`
+	Total  int      `json:"total"`
+	Offset int      `json:"offset"`
+	Limit  int      `json:"limit"`
+}
+
+// RunResponse is a single run, together with all attempts of the run it is part of.
+type RunResponse struct {
+	JobRun
+	Attempts []RunAttempt `json:"attempts"`
+}
+
+// RunAttempt sums up an attempt of a run.
+type RunAttempt struct {
+	ID          string    `json:"id"`
+	Attempt     int       `json:"attempt"`
+	Status      int       `json:"status"`
+	State       string    `json:"state,omitempty"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// max length of logs when requesting truncated logs
+const truncatedLogLength int = 1000
+
+// ValidateResponse lists the problems found in the specs posted to /validate.
+type ValidateResponse struct {
+	Valid    bool                `json:"valid"`
+	Problems []ValidationProblem `json:"problems"`
+}
+
+// max size of the specs that can be posted to /validate
+const maxValidateBody int64 = 1 << 20
+
+// NextRunsResponse lists the upcoming runs of a job.
+type NextRunsResponse struct {
+	Job      string        `json:"job"`
+	Cron     string        `json:"cron,omitempty"`
+	Interval time.Duration `json:"interval,omitempty"`
+	NextRuns []time.Time   `json:"next_runs"`
+}
+
+// TriggerRequest is the optional body to pass along when triggering a job.
+type TriggerRequest struct {
+	Params map[string]string `json:"params"`
 }
 
 //go:embed public
@@ -31,50 +106,178 @@ func fsys() fs.FS {
 	return fsys
 }
 
-func setupMux(s *Schedule) *http.ServeMux {
+func setupMux(s *Schedule) http.Handler {
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/healthz/", func(w http.ResponseWriter, r *http.Request) {
-		status := Response{Status: "ok"}
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(status); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-	})
+	mux.HandleFunc("/healthz/", healthz(s))
+	mux.HandleFunc("/readyz", readyz(s))
+	mux.HandleFunc("/openapi.json", openAPI)
 
 	mux.HandleFunc("/schedule/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(s); err != nil {
+		if err := json.NewEncoder(w).Encode(s.snapshot()); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
 
 	mux.HandleFunc("/trigger/", trigger(s))
+	mux.HandleFunc("/jobs/", jobs(s))
+	mux.HandleFunc("/hooks/", hooks(s))
+	mux.HandleFunc("/validate", validate(s))
+	mux.HandleFunc("/simulate", simulate(s))
+
+	if s.cfg.Metrics {
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			s.mu.RLock()
+			jobsLoaded := len(s.Jobs)
+			s.mu.RUnlock()
+
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			if err := runMetrics.write(w, jobsLoaded, time.Now()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		})
+	}
 	mux.HandleFunc("/", ui(s))
+	mux.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
+	mux.HandleFunc("/ui/", dashboard)
 
 	fs := http.FileServer(http.FS(fsys()))
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 
-	return mux
+	if s.cfg.AuthToken != "" {
+		return withMiddleware(s, requireToken(s.cfg.AuthToken, mux))
+	}
+
+	return withMiddleware(s, mux)
 
 }
 
-func server(s *Schedule) {
-	var httpAddr string = fmt.Sprintf(":%s", s.cfg.Port)
+// server starts serving the http api of a schedule in the background, over TLS
+// when a certificate and key are configured. The returned channel passes on
+// the error the server stopped with, unless it got shut down.
+func server(s *Schedule) (*http.Server, <-chan error, error) {
+	if s.cfg.AccessLogLevel != "" {
+		if _, err := zerolog.ParseLevel(s.cfg.AccessLogLevel); err != nil {
+			return nil, nil, fmt.Errorf("cannot start http server: invalid access log level '%s'", s.cfg.AccessLogLevel)
+		}
+	}
 
-	mux := setupMux(s)
+	var tlsConfig *tls.Config
+	switch {
+	case s.cfg.TLSCert == "" && s.cfg.TLSKey == "":
+	case s.cfg.TLSCert == "" || s.cfg.TLSKey == "":
+		return nil, nil, errors.New("cannot start http server: tls needs both a certificate and a key")
+	default:
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLSCert, s.cfg.TLSKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot start http server: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
 
-	s.log.Info().Msgf("Starting HTTP server on %v", httpAddr)
-	s.log.Fatal().Err(http.ListenAndServe(httpAddr, mux))
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.cfg.BindAddress, s.cfg.Port))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot start http server: %w", err)
+	}
+	srv := &http.Server{Addr: ln.Addr().String(), Handler: setupMux(s), TLSConfig: tlsConfig}
+
+	scheme := "HTTP"
+	if tlsConfig != nil {
+		scheme = "HTTPS"
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	s.log.Info().Msgf("Starting %s server on %v", scheme, srv.Addr)
 
+	failed := make(chan error, 1)
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+	return srv, failed, nil
+}
+
+// how long requests in progress get to complete when the http server shuts down
+var shutdownTimeout = 5 * time.Second
+
+// shutdownServer stops the http server, after giving requests in progress the
+// time to complete.
+func shutdownServer(s *Schedule, srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		s.log.Warn().Err(err).Msg("http server did not shut down in time, closing it")
+		srv.Close()
+	}
+}
+
+// healthz reports the stale and paused jobs and whether the scheduler is
+// healthy, answering with 503 when it is not.
+func healthz(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		h := s.health(now)
+
+		status := HealthResponse{Response: Response{Status: "ok"}, DataDirWritable: h.dataDirWritable, RunningJobs: h.runningJobs, CriticalFailures: h.criticalFailures}
+		if stale := s.staleJobs(now); len(stale) > 0 {
+			status.Response = Response{Status: "stale", StaleJobs: stale}
+		}
+		if paused := s.pausedJobs(); len(paused) > 0 {
+			status.PausedJobs = paused
+		}
+		if !h.lastTick.IsZero() {
+			status.LastTick = &h.lastTick
+		}
+
+		code := http.StatusOK
+		if !h.healthy {
+			status.Status = "unhealthy"
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	}
+}
+
+// readyz tells whether the schedule got loaded and the scheduler checked for
+// due jobs once, answering with 503 until then.
+func readyz(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready() {
+			writeJSON(w, http.StatusServiceUnavailable, Response{Status: "not ready"})
+			return
+		}
+		writeJSON(w, http.StatusOK, Response{Status: "ready"})
+	}
+}
+
+// requireToken only lets through requests that carry the bearer token,
+// the health and readiness checks stay accessible without it, as do the
+// webhook triggers which check the signature of their payload instead.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/healthz") || r.URL.Path == "/readyz" || strings.HasPrefix(r.URL.Path, "/hooks/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
 func trigger(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		jobId := strings.TrimPrefix(r.URL.Path, "/trigger/")
-		job, ok := s.Jobs[jobId]
+		job, ok := s.job(jobId)
 
 		if !ok {
 			status := Response{Job: jobId, Status: "error: can't find job to trigger", Type: "trigger"}
@@ -85,8 +288,16 @@ func trigger(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+		if job.Disable {
+			writeJSON(w, http.StatusConflict, Response{Job: jobId, Status: fmt.Sprintf("error: %v", job.errDisabled()), Type: "trigger"})
+			return
+		}
 
-		job.execCommandWithRetry("ui") // trigger
+		runID, ok := admitRequest(w, job, "ui", map[string]string{}, "trigger")
+		if !ok {
+			return
+		}
+		job.dispatch(s.runContext(), runRequest{id: runID, trigger: "ui", params: map[string]string{}})
 
 		status := Response{Job: jobId, Status: "ok", Type: "trigger"}
 		w.Header().Set("Content-Type", "application/json")
@@ -96,30 +307,512 @@ func trigger(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// validate checks the specs of a schedule posted as yaml without loading them.
+func validate(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxValidateBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var problems []ValidationProblem
+		specs, err := parseSpecs("request body", body)
+		if err != nil {
+			problems = []ValidationProblem{{Message: err.Error()}}
+		} else {
+			problems = validateSchedule(s.cfg, specs)
+		}
+
+		if len(problems) > 0 {
+			writeJSON(w, http.StatusUnprocessableEntity, ValidateResponse{Problems: problems})
+			return
+		}
+		writeJSON(w, http.StatusOK, ValidateResponse{Valid: true, Problems: problems})
+	}
+}
+
+// simulate lists the runs of the schedule between ?from= and ?to=, given as
+// RFC 3339 times. The window defaults to the next 24 hours.
+func simulate(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		from := time.Now()
+		if v := q.Get("from"); v != "" {
+			var err error
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "from should be an RFC 3339 time (e.g. 2006-01-02T15:04:05Z)", http.StatusBadRequest)
+				return
+			}
+		}
+		to := from.Add(24 * time.Hour)
+		if v := q.Get("to"); v != "" {
+			var err error
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "to should be an RFC 3339 time (e.g. 2006-01-02T15:04:05Z)", http.StatusBadRequest)
+				return
+			}
+		}
+
+		sim, err := s.Simulate(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, sim)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// jobs serves the API routes under /jobs/{name}/.
+func jobs(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobId, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+		job, ok := s.job(jobId)
+		if !ok {
+			// runs of jobs that got dropped from the schedule stay in the history
+			if id, sub, ok := runRoute(action); ok && sub == "rerun" {
+				if _, found, err := findRun(s.history(), jobId, id); err == nil && found {
+					writeJSON(w, http.StatusGone, Response{Job: jobId, Status: "error: job is no longer in the schedule", Type: sub, RunID: id})
+					return
+				}
+			}
+			writeJSON(w, http.StatusNotFound, Response{Job: jobId, Status: "error: can't find job", Type: action})
+			return
+		}
+
+		switch action {
+		case "trigger":
+			triggerJob(w, r, s, job)
+		case "runs":
+			listRuns(w, r, job)
+		case "next":
+			nextRuns(w, r, job)
+		case "stats":
+			jobStats(w, r, job)
+		case "runs/current/logs":
+			streamLogs(w, r, s, job)
+		case "pause", "resume":
+			pauseJob(w, r, s, job, action)
+		case "cancel":
+			cancelJob(w, r, s, job)
+		default:
+			id, sub, ok := runRoute(action)
+			switch {
+			case ok && sub == "":
+				runDetail(w, r, job, id)
+			case ok && sub == "rerun":
+				rerunJob(w, r, s, job, id)
+			default:
+				http.NotFound(w, r)
+			}
+		}
+	}
+}
+
+// runRoute splits the actions under /jobs/{name}/runs/{id}/ into the id of the
+// run and what to do with it, ok is false for other actions.
+func runRoute(action string) (id string, sub string, ok bool) {
+	rest := strings.TrimPrefix(action, "runs/")
+	if rest == action {
+		return "", "", false
+	}
+	id, sub, _ = strings.Cut(rest, "/")
+	return id, sub, id != ""
+}
+
+// pauseJob pauses or resumes the cron of a job, depending on action.
+func pauseJob(w http.ResponseWriter, r *http.Request, s *Schedule, job *JobSpec, action string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if action == "resume" {
+		if s.resume(job.Name) {
+			s.log.Info().Str("job", job.Name).Msg("Job resumed")
+		}
+		if job.health.closeCircuit() {
+			s.log.Info().Str("job", job.Name).Msg("Circuit closed")
+		}
+		writeJSON(w, http.StatusOK, Response{Job: job.Name, Status: "ok", Type: action})
+		return
+	}
+
+	since := s.pause(job.Name, time.Now())
+	s.log.Info().Str("job", job.Name).Msgf("Job paused since %v", since)
+	writeJSON(w, http.StatusOK, Response{Job: job.Name, Status: "ok", Type: action, PausedSince: &since})
+}
+
+// jobStats sums up the run history of a job.
+func jobStats(w http.ResponseWriter, r *http.Request, job *JobSpec) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	st, err := job.stats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// nextRuns lists the upcoming runs of a job, ?count= of them (defaults to 5).
+func nextRuns(w http.ResponseWriter, r *http.Request, job *JobSpec) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count := 5
+	if v := r.URL.Query().Get("count"); v != "" {
+		var err error
+		if count, err = strconv.Atoi(v); err != nil || count < 1 || count > maxNextRuns {
+			http.Error(w, fmt.Sprintf("count should be a number between 1 and %v", maxNextRuns), http.StatusBadRequest)
+			return
+		}
+	}
+
+	runs, err := job.nextRuns(time.Now(), count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, NextRunsResponse{Job: job.Name, Cron: job.Cron, Interval: job.Interval, NextRuns: runs})
+}
+
+// streamLogs streams the output of the job's current run as it gets written.
+// Without a run in progress it answers with 404, or with ?last=true with the
+// log of the last run.
+func streamLogs(w http.ResponseWriter, r *http.Request, s *Schedule, job *JobSpec) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	output, ok := s.currentOutput(job.Name)
+	if !ok {
+		if last, _ := strconv.ParseBool(r.URL.Query().Get("last")); !last {
+			writeJSON(w, http.StatusNotFound, Response{Job: job.Name, Status: "error: job is not running", Type: "logs"})
+			return
+		}
+
+		runs, _, err := job.history().runs(job.Name, 0, 1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(runs) == 0 {
+			writeJSON(w, http.StatusNotFound, Response{Job: job.Name, Status: "error: job has not run yet", Type: "logs"})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, runs[0].Log)
+		return
+	}
+
+	history, sub := output.subscribe()
+	defer output.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	write := func(p []byte) bool {
+		if _, err := w.Write(p); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	if !write(history) {
+		return
+	}
+	for {
+		select {
+		case chunk, ok := <-sub.chunks:
+			if !ok {
+				if output.hasLagged(sub) {
+					write([]byte("\n[cheek: stopped streaming as the client could not keep up]\n"))
+				}
+				return
+			}
+			if !write(chunk) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// cancelJob cancels the runs of a job that are in progress, the runs get
+// finalized in the background once their command exited.
+func cancelJob(w http.ResponseWriter, r *http.Request, s *Schedule, job *JobSpec) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.cancelRuns(job.Name) == 0 {
+		writeJSON(w, http.StatusConflict, Response{Job: job.Name, Status: "error: job is not running", Type: "cancel"})
+		return
+	}
+	s.log.Info().Str("job", job.Name).Msg("Job canceled")
+	writeJSON(w, http.StatusAccepted, Response{Job: job.Name, Status: "canceling", Type: "cancel"})
+}
+
+// triggerJob runs a job as a manual trigger, either waiting for the run to
+// complete or, with ?async=true, returning as soon as it got launched.
+func triggerJob(w http.ResponseWriter, r *http.Request, s *Schedule, job *JobSpec) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if job.Disable {
+		writeJSON(w, http.StatusConflict, Response{Job: job.Name, Status: fmt.Sprintf("error: %v", job.errDisabled()), Type: "trigger"})
+		return
+	}
+
+	req := TriggerRequest{}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeJSON(w, http.StatusBadRequest, Response{Job: job.Name, Status: fmt.Sprintf("error: can't decode request body: %v", err), Type: "trigger"})
+			return
+		}
+	}
+	if req.Params == nil {
+		req.Params = map[string]string{}
+	}
+
+	launchRun(w, r, s, job, "manual", req.Params, "trigger")
+}
+
+// rerunJob runs a job again with the parameters of one of its previous runs.
+func rerunJob(w http.ResponseWriter, r *http.Request, s *Schedule, job *JobSpec, id string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if job.Disable {
+		writeJSON(w, http.StatusConflict, Response{Job: job.Name, Status: fmt.Sprintf("error: %v", job.errDisabled()), Type: "rerun"})
+		return
+	}
+
+	prev, found, err := findRun(job.history(), job.Name, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, Response{Job: job.Name, Status: "error: can't find run", Type: "rerun", RunID: id})
+		return
+	}
+	if prev.Params == nil {
+		prev.Params = map[string]string{}
+	}
+
+	launchRun(w, r, s, job, fmt.Sprintf("rerun[%s]", id), prev.Params, "rerun")
+}
+
+// launchRun runs a job on request, either waiting for the run to complete or,
+// with ?async=true, returning as soon as it got launched.
+func launchRun(w http.ResponseWriter, r *http.Request, s *Schedule, job *JobSpec, trigger string, params map[string]string, kind string) {
+	async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+	runID, ok := admitRequest(w, job, trigger, params, kind)
+	if !ok {
+		return
+	}
+
+	if async {
+		go job.dispatch(s.runContext(), runRequest{id: runID, trigger: trigger, params: params})
+		writeJSON(w, http.StatusAccepted, Response{Job: job.Name, Status: "accepted", Type: kind, RunID: runID})
+		return
+	}
+
+	jr := job.dispatch(s.runContext(), runRequest{id: runID, trigger: trigger, params: params})
+	writeJSON(w, http.StatusOK, jr)
+}
+
+// runDetail returns a run of a job with its complete log, along with the
+// attempts of the run it is part of.
+func runDetail(w http.ResponseWriter, r *http.Request, job *JobSpec, id string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jr, found, err := findRun(job.history(), job.Name, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, Response{Job: job.Name, Status: "error: can't find run", Type: "run", RunID: id})
+		return
+	}
+	jr.Success = job.successExitCode(jr.Status)
+
+	// runs logged before attempts got their own id make up a group of their own
+	group := []JobRun{jr}
+	if jr.GroupID != "" {
+		if group, err = job.history().find(job.Name, func(g *JobRun) bool { return g.GroupID == jr.GroupID }); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := RunResponse{JobRun: jr, Attempts: []RunAttempt{}}
+	for _, a := range group {
+		resp.Attempts = append(resp.Attempts, RunAttempt{ID: a.ID, Attempt: a.Attempt, Status: a.Status, State: a.State, TriggeredAt: a.TriggeredAt})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// truncateLog cuts a log to at most n bytes without splitting a character.
+func truncateLog(log string, n int) string {
+	if len(log) <= n {
+		return log
+	}
+	for n > 0 && !utf8.RuneStart(log[n]) {
+		n--
+	}
+	return log[:n] + "..."
+}
+
+// listRuns pages through the run history of a job, newest first.
+// Supports ?limit=50&offset=0&log=full|truncate|none.
+func listRuns(w http.ResponseWriter, r *http.Request, job *JobSpec) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset := 50, 0
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			http.Error(w, "limit should be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			http.Error(w, "offset should be zero or a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	logMode := q.Get("log")
+	switch logMode {
+	case "", "full", "truncate", "none":
+	default:
+		http.Error(w, "log should be one of full, truncate or none", http.StatusBadRequest)
+		return
+	}
+
+	runs, total, err := job.history().runs(job.Name, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range runs {
+		runs[i].Success = job.successExitCode(runs[i].Status)
+		switch logMode {
+		case "none":
+			runs[i].Log = ""
+		case "truncate":
+			runs[i].Log = truncateLog(runs[i].Log, truncatedLogLength)
+		}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSON(w, http.StatusOK, RunsResponse{Runs: runs, Total: total, Offset: offset, Limit: limit})
+}
+
+// dashboard serves the page of the dashboard, which gets its data from the json api.
+func dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+	page, err := fs.ReadFile(fsys(), "ui/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(page)
+}
+
 func ui(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// get jobid from url
 		var jobId string
-		var job *JobSpec
-		var ok bool
-		job = &JobSpec{}
+		var job JobSpec
+		var stats JobStats
 
 		if strings.HasPrefix(r.URL.Path, "/job/") {
 			jobId = strings.TrimPrefix(r.URL.Path, "/job/")
-			job, ok = s.Jobs[jobId]
+			j, ok := s.job(jobId)
 			if !ok {
 				http.Error(w, fmt.Errorf("job %s not found", jobId).Error(), http.StatusNotFound)
 				return
 			} else {
+				// work on a copy, the scheduling loop moves the next tick of the job along
+				job = j.copy()
 				job.loadRuns()
+				var err error
+				if stats, err = job.stats(); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
 			}
 		}
 
 		// get job ids
+		specs := s.jobMap()
 		jobNames := make([]string, 0)
-		for k := range s.Jobs {
+		for k := range specs {
 			jobNames = append(jobNames, k)
 		}
 		sort.Strings(jobNames)
@@ -139,19 +832,22 @@ func ui(s *Schedule) func(w http.ResponseWriter, r *http.Request) {
 		}
 
 		data := struct {
-			SelectedJobName string
-			JobNames        []string
-			JobSpecs        map[string]*JobSpec
-			SelectedJobSpec JobSpec
-		}{SelectedJobName: jobId, JobNames: jobNames, SelectedJobSpec: *job}
+			SelectedJobName  string
+			JobNames         []string
+			JobSpecs         map[string]*JobSpec
+			SelectedJobSpec  JobSpec
+			SelectedJobStats JobStats
+		}{SelectedJobName: jobId, JobNames: jobNames, SelectedJobSpec: job, SelectedJobStats: stats}
 
 		if jobId == "" {
 			// pass along all job specs only when in overview
 			// takes a lot of I/O
-			for _, j := range s.Jobs {
-				j.loadRuns()
+			data.JobSpecs = make(map[string]*JobSpec, len(specs))
+			for name, j := range specs {
+				c := j.copy()
+				c.loadRuns()
+				data.JobSpecs[name] = &c
 			}
-			data.JobSpecs = s.Jobs
 		}
 
 		err = tmpl.Execute(w, data)
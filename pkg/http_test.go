@@ -1,12 +1,28 @@
 package cheek
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMux(t *testing.T) {
@@ -25,6 +41,14 @@ func TestMux(t *testing.T) {
 		cfg:        NewConfig(),
 	}
 
+	s3 := Schedule{
+		Jobs:       map[string]*JobSpec{},
+		TZLocation: "Europe/Amsterdam",
+		log:        zerolog.Logger{},
+		cfg:        NewConfig(),
+	}
+	s3.cfg.Metrics = true
+
 	j := &JobSpec{
 		Cron:    "MooIAmACow",
 		Name:    "bertha",
@@ -32,6 +56,11 @@ func TestMux(t *testing.T) {
 		cfg:     NewConfig(),
 	}
 	s2.Jobs[j.Name] = j
+	s2.Jobs["greeter"] = &JobSpec{
+		Name:    "greeter",
+		Command: []string{"echo", "hello {{ .name }}"},
+		cfg:     NewConfig(),
+	}
 
 	type args struct {
 		req *http.Request
@@ -104,6 +133,111 @@ func TestMux(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "\"status\":\"ok\",\"type\":\"trigger\"",
 		},
+		{
+			schedule: &s1,
+			name:     "/jobs/{name}/trigger must return 404 for unknown jobs",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("POST", "/jobs/does_not_exist/trigger", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusNotFound,
+			wantBody: "error:",
+		},
+		{
+			schedule: &s2,
+			name:     "/jobs/{name}/trigger must return 405 on GET",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/jobs/greeter/trigger", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusMethodNotAllowed,
+			wantBody: "",
+		},
+		{
+			schedule: &s2,
+			name:     "/jobs/{name}/trigger must return the run",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("POST", "/jobs/greeter/trigger", strings.NewReader(`{"params": {"name": "cheek"}}`))
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: "\"log\":\"hello cheek\\n\"",
+		},
+		{
+			schedule: &s2,
+			name:     "/jobs/{name}/trigger?async=true must return 202",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("POST", "/jobs/greeter/trigger?async=true", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusAccepted,
+			wantBody: "\"run_id\":",
+		},
+		{
+			schedule: &s2,
+			name:     "/jobs/{name}/runs must return a page of runs",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/jobs/greeter/runs?limit=1&log=none", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: "\"offset\":0,\"limit\":1",
+		},
+		{
+			schedule: &s2,
+			name:     "/jobs/{name}/runs must return 400 on invalid limit",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/jobs/greeter/runs?limit=moo", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusBadRequest,
+			wantBody: "limit",
+		},
+		{
+			schedule: &s3,
+			name:     "/metrics must return 200 when enabled",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/metrics", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: "cheek_jobs_loaded 0",
+		},
 		{
 			schedule: &s1,
 			name:     "/ must return 200 with html content",
@@ -119,6 +253,81 @@ func TestMux(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "<a class=\"brand text-primary\" href=\"/\">cheek</a>",
 		},
+		{
+			schedule: &s1,
+			name:     "/validate must return 200 for valid specs",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("POST", "/validate", strings.NewReader("jobs:\n  foo:\n    command: date\n    cron: '* * * * *'\n"))
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: `"valid":true`,
+		},
+		{
+			schedule: &s1,
+			name:     "/validate must return 422 listing the problems of invalid specs",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("POST", "/validate", strings.NewReader("jobs:\n  foo:\n    command: date\n    cron: '* * * *'\n"))
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `{"job":"foo","message":"cron string for job 'foo' not valid"}`,
+		},
+		{
+			schedule: &s1,
+			name:     "/validate must only accept posts",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/validate", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusMethodNotAllowed,
+			wantBody: "",
+		},
+		{
+			schedule: &s1,
+			name:     "/ui/ must return 200 with the dashboard",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/ui/", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: `<script type="text/javascript" src="/static/ui/ui.js" defer></script>`,
+		},
+		{
+			schedule: &s1,
+			name:     "/static/ui/ui.js must return 200 with the dashboard script",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/static/ui/ui.js", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: "const renderOverview",
+		},
 		{
 			schedule: &s1,
 			name:     "/jobs/not-exist must return 404",
@@ -155,3 +364,262 @@ func TestMux(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthToken(t *testing.T) {
+	s := Schedule{
+		Jobs: map[string]*JobSpec{},
+		log:  zerolog.Logger{},
+		cfg:  NewConfig(),
+	}
+	s.cfg.AuthToken = "secret"
+	handler := setupMux(&s)
+
+	for _, tt := range []struct {
+		path     string
+		header   string
+		wantCode int
+	}{
+		{path: "/healthz/", wantCode: http.StatusOK},
+		{path: "/schedule/", wantCode: http.StatusUnauthorized},
+		{path: "/schedule/", header: "Bearer nope", wantCode: http.StatusUnauthorized},
+		{path: "/schedule/", header: "secret", wantCode: http.StatusUnauthorized},
+		{path: "/schedule/", header: "Bearer secret", wantCode: http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatalf("fail to create request: %s", err.Error())
+		}
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Result().StatusCode != tt.wantCode {
+			t.Fatalf("%s with '%s': the status code should be [%d] but received [%d]", tt.path, tt.header, tt.wantCode, resp.Result().StatusCode)
+		}
+	}
+}
+
+func TestRunDetail(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local, log: zerolog.Nop(), cfg: cfg}
+	j := &JobSpec{
+		Name:           "test_run_detail",
+		Command:        []string{"sh", "-c", "echo attempt $CHEEK_RETRY_ATTEMPT; false"},
+		Retries:        1,
+		RetryDelay:     time.Millisecond,
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+		log:            s.log,
+	}
+	s.Jobs = map[string]*JobSpec{j.Name: j}
+	handler := setupMux(s)
+
+	// the retry gets an id of its own and is grouped with the first attempt
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 1, jr.Attempt)
+	assert.NotEqual(t, jr.GroupID, jr.ID)
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/test_run_detail/runs/"+jr.ID, nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var detail RunResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&detail))
+	assert.Equal(t, jr.ID, detail.ID)
+	assert.Contains(t, detail.Log, "attempt 1")
+	if assert.Len(t, detail.Attempts, 2) {
+		assert.Equal(t, RunAttempt{ID: jr.GroupID, Attempt: 0, Status: 1, State: RunStateCompleted, TriggeredAt: detail.Attempts[0].TriggeredAt}, detail.Attempts[0])
+		assert.Equal(t, jr.ID, detail.Attempts[1].ID)
+		assert.Equal(t, 1, detail.Attempts[1].Attempt)
+	}
+
+	// the first attempt goes by the id of the run as a whole
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/test_run_detail/runs/"+jr.GroupID, nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "attempt 0")
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/test_run_detail/runs/nope", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestRerun(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local, log: zerolog.Nop(), cfg: cfg}
+	j := &JobSpec{
+		Name:           "test_rerun",
+		Command:        []string{"echo", "hello {{ .name }}"},
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+		log:            s.log,
+	}
+	s.Jobs = map[string]*JobSpec{j.Name: j}
+	handler := setupMux(s)
+
+	rerun := func(id string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("POST", "/jobs/test_rerun/runs/"+id+"/rerun", nil))
+		return resp
+	}
+
+	prev := j.execCommandWithRetry(context.Background(), "test", map[string]string{"name": "bertha"})
+
+	// the run gets the params of the previous one
+	resp := rerun(prev.ID)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var jr JobRun
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&jr))
+	assert.NotEqual(t, prev.ID, jr.ID)
+	assert.Equal(t, "rerun["+prev.ID+"]", jr.TriggeredBy)
+	assert.Equal(t, map[string]string{"name": "bertha"}, jr.Params)
+	assert.Equal(t, "hello bertha\n", jr.Log)
+
+	assert.Equal(t, http.StatusNotFound, rerun("nope").Code)
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/test_rerun/runs/"+prev.ID+"/rerun", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	// the job is gone, its runs are not
+	s.Jobs = map[string]*JobSpec{}
+	assert.Equal(t, http.StatusGone, rerun(prev.ID).Code)
+	assert.Equal(t, http.StatusNotFound, rerun("nope").Code)
+}
+
+func TestServerTLS(t *testing.T) {
+	// a self-signed certificate for the server
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cheek"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFn, keyFn := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFn, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFn, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	cfg := NewConfig()
+	cfg.BindAddress = "127.0.0.1"
+	cfg.Port = "0"
+	cfg.TLSCert = certFn
+	cfg.TLSKey = keyFn
+	s := &Schedule{Jobs: map[string]*JobSpec{}, log: zerolog.Nop(), cfg: cfg}
+
+	srv, _, err := server(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdownServer(s, srv)
+	assert.True(t, strings.HasPrefix(srv.Addr, "127.0.0.1:"))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + srv.Addr + "/healthz/")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// plain http is refused
+	resp, err = http.Get("http://" + srv.Addr + "/healthz/")
+	if err == nil {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	s.cfg.TLSKey = ""
+	_, _, err = server(s)
+	assert.EqualError(t, err, "cannot start http server: tls needs both a certificate and a key")
+
+	s.cfg.TLSCert, s.cfg.BindAddress = "", "256.0.0.1"
+	_, _, err = server(s)
+	assert.Error(t, err)
+}
+
+func TestHealthzReportsScheduler(t *testing.T) {
+	critical := &JobSpec{Name: "critical", Command: []string{"false"}, Critical: true, inFlight: newRunTracker(), health: &jobHealth{loaded: true, failures: 3}}
+	other := &JobSpec{Name: "other", Command: []string{"true"}, inFlight: newRunTracker()}
+	s := &Schedule{Jobs: map[string]*JobSpec{"critical": critical, "other": other}, log: zerolog.Logger{}, cfg: NewConfig()}
+	handler := setupMux(s)
+
+	get := func(path string) (int, HealthResponse) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		resp := HealthResponse{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return w.Code, resp
+	}
+
+	// a schedule without a running loop is healthy, but not ready
+	other.inFlight.begin()
+	code, resp := get("/healthz/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+	assert.True(t, resp.DataDirWritable)
+	assert.Equal(t, 1, resp.RunningJobs)
+	assert.Equal(t, map[string]int{"critical": 3}, resp.CriticalFailures)
+	assert.Nil(t, resp.LastTick)
+	other.inFlight.end()
+
+	code, resp = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", resp.Status)
+
+	// a loop that keeps ticking is healthy and ready
+	s.initialized = true
+	s.loopStarted = time.Now().Add(-time.Hour)
+	s.lastTick = time.Now()
+	code, resp = get("/healthz/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, resp.RunningJobs)
+	if assert.NotNil(t, resp.LastTick) {
+		assert.WithinDuration(t, s.lastTick, *resp.LastTick, time.Second)
+	}
+	code, resp = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", resp.Status)
+
+	// a loop that stopped ticking is not
+	s.lastTick = time.Now().Add(-time.Minute)
+	code, resp = get("/healthz/")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unhealthy", resp.Status)
+
+	// neither is one that cannot write its data
+	s.lastTick = time.Now()
+	t.Setenv("CHEEK_HOME", filepath.Join(t.TempDir(), "file", "dir"))
+	assert.NoError(t, os.WriteFile(filepath.Dir(os.Getenv("CHEEK_HOME")), nil, 0o600))
+	code, resp = get("/healthz/")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, resp.DataDirWritable)
+}
+
+func TestTruncateLog(t *testing.T) {
+	assert.Equal(t, "short", truncateLog("short", 10))
+	assert.Equal(t, "abcd...", truncateLog("abcdefgh", 4))
+	// a character is not split in two
+	truncated := truncateLog("aaé€", 4)
+	assert.Equal(t, "aaé...", truncated)
+	assert.True(t, utf8.ValidString(truncated))
+	assert.Equal(t, "aa...", truncateLog("aaé€", 3))
+}
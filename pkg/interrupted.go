@@ -0,0 +1,213 @@
+package cheek
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunStateInterrupted is the state of a run that was still in progress when
+// cheek went down, it gets recorded when cheek starts again.
+const RunStateInterrupted string = "interrupted"
+
+// StatusInterrupted is the status of a run that was cut off by cheek going down.
+const StatusInterrupted int = -7
+
+// partialLogSyncInterval is how often the output of a run in progress gets
+// synced to disk, writes in between survive cheek crashing but not the box.
+const partialLogSyncInterval = time.Second
+
+// partialLogExt is the extension of the files that hold the output of runs in progress.
+const partialLogExt = ".partial"
+
+// partialLogs holds the files of the runs this process has in progress.
+var partialLogs sync.Map
+
+// partialLogOwner is the cheek process that runs a run in progress, the run
+// is only interrupted once that is gone.
+type partialLogOwner struct {
+	PID int `json:"pid"`
+	// tells the process apart from a later one that got the same pid, empty
+	// where that can't be determined
+	Started string `json:"started,omitempty"`
+}
+
+// running tells whether the process that owns the run is still around, a
+// process that got the pid after it doesn't count.
+func (o partialLogOwner) running() bool {
+	if o.PID == os.Getpid() || !processAlive(o.PID) {
+		return false
+	}
+	if o.Started == "" {
+		return true
+	}
+	started := processStartID(o.PID)
+	return started == "" || started == o.Started
+}
+
+// partialLogHeader is the first line of the file of a run in progress.
+type partialLogHeader struct {
+	partialLogOwner
+	Run JobRun `json:"run"`
+}
+
+// partialLog keeps the output of a run in progress on disk as it comes in, so
+// that it doesn't get lost when cheek goes down mid-run.
+type partialLog struct {
+	fn     string
+	f      *os.File
+	synced time.Time
+}
+
+// newPartialLog starts the file that holds the output of the run in progress,
+// its first line describes the run.
+func newPartialLog(jr *JobRun) (*partialLog, error) {
+	if err := os.MkdirAll(runLogDir(jr.Name), 0o755); err != nil {
+		return nil, err
+	}
+	fn := path.Join(runLogDir(jr.Name), jr.ID+partialLogExt)
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(partialLogHeader{partialLogOwner: partialLogOwner{PID: os.Getpid(), Started: processStartID(os.Getpid())}, Run: *jr})
+	if err == nil {
+		_, err = f.Write(append(b, '\n'))
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(fn)
+		return nil, err
+	}
+	partialLogs.Store(fn, struct{}{})
+	return &partialLog{fn: fn, f: f, synced: time.Now()}, nil
+}
+
+func (p *partialLog) Write(b []byte) (int, error) {
+	n, err := p.f.Write(b)
+	if err != nil {
+		return n, err
+	}
+	if time.Since(p.synced) >= partialLogSyncInterval {
+		p.synced = time.Now()
+		return n, p.f.Sync()
+	}
+	return n, nil
+}
+
+// Close closes the file, it stays around until the run got recorded.
+func (p *partialLog) Close() error {
+	return p.f.Close()
+}
+
+// remove removes the file once the run got recorded.
+func (p *partialLog) remove() error {
+	if p == nil {
+		return nil
+	}
+	defer partialLogs.Delete(p.fn)
+	if err := os.Remove(p.fn); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// startPartialLog has the output of the run go to disk as it comes in, the
+// output gets there the way it ends up in the log of the run. The file gets
+// started with started, what is known about the run before it starts.
+func (j *JobSpec) startPartialLog(jr *JobRun, started *JobRun, output *logBroadcast) func() {
+	p, err := newPartialLog(started)
+	if err != nil {
+		j.log.Warn().Str("job", j.Name).Str("run_id", jr.ID).Err(err).Msg("cannot write the output of the run to disk as it comes in")
+		return func() {}
+	}
+	jr.partial = p
+	output.checkpointTo(p)
+	return func() {
+		if err := p.Close(); err != nil {
+			j.log.Debug().Str("job", j.Name).Str("run_id", jr.ID).Err(err).Msg("cannot close the output of the run")
+		}
+	}
+}
+
+// readPartialLog returns the run a file of a run in progress describes, with
+// the output that got written to it, and the process that runs it.
+func readPartialLog(fn string) (JobRun, partialLogOwner, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return JobRun{}, partialLogOwner{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return JobRun{}, partialLogOwner{}, fmt.Errorf("no run described in '%s': %w", fn, err)
+	}
+	header := partialLogHeader{}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return JobRun{}, partialLogOwner{}, fmt.Errorf("no run described in '%s': %w", fn, err)
+	}
+	output, err := io.ReadAll(r)
+	if err != nil {
+		return JobRun{}, partialLogOwner{}, err
+	}
+
+	jr := header.Run
+	jr.Log = string(output)
+	jr.Status = StatusInterrupted
+	jr.State = RunStateInterrupted
+	jr.Success = false
+	// the last output is as close as it gets to when it ended
+	if fi, err := f.Stat(); err == nil && fi.ModTime().After(jr.TriggeredAt) {
+		jr.Duration = fi.ModTime().Sub(jr.TriggeredAt)
+	}
+	return jr, header.partialLogOwner, nil
+}
+
+// recordInterruptedRuns records the runs that were in progress when cheek went
+// down as interrupted, with the output they got to write. Runs of other cheek
+// processes that are still around are left alone.
+func (s *Schedule) recordInterruptedRuns() {
+	files, err := filepath.Glob(path.Join(CheekPath(), "*", "*"+partialLogExt))
+	if err != nil {
+		s.log.Warn().Err(err).Msg("cannot look for interrupted runs")
+		return
+	}
+	sort.Strings(files)
+
+	for _, fn := range files {
+		if _, ok := partialLogs.Load(fn); ok {
+			continue
+		}
+		jr, owner, err := readPartialLog(fn)
+		if err != nil {
+			s.log.Warn().Err(err).Msg("cannot read interrupted run")
+			continue
+		}
+		if owner.running() {
+			continue
+		}
+
+		s.log.Warn().Str("job", jr.Name).Str("run_id", jr.ID).Msg("run got interrupted by cheek going down, recording it")
+		if j, ok := s.job(jr.Name); ok {
+			jr.jobRef = j
+			jr.logToDisk()
+		} else if err := s.history().append(&jr); err != nil {
+			s.log.Warn().Str("job", jr.Name).Err(err).Msg("cannot record interrupted run")
+			continue
+		}
+		if err := os.Remove(fn); err != nil {
+			s.log.Warn().Str("job", jr.Name).Err(err).Msg("cannot remove the output of interrupted run")
+		}
+	}
+}
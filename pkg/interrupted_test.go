@@ -0,0 +1,146 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// partialLogFiles lists the files of the runs of a job that are in progress.
+func partialLogFiles(t *testing.T, job string) []string {
+	files, err := filepath.Glob(path.Join(runLogDir(job), "*"+partialLogExt))
+	assert.NoError(t, err)
+	return files
+}
+
+func TestPartialLog(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	t.Setenv("CHEEK_TEST_TOKEN", "s3cr3t-t0ken")
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test_partial_log",
+		Command:        []string{"sh", "-c", "echo one $TOKEN and then some; touch \"$CHEEK_HOME/wrote\"; sleep 1; echo two"},
+		Secrets:        map[string]Secret{"TOKEN": {Env: "CHEEK_TEST_TOKEN"}},
+		globalSchedule: &Schedule{loc: time.Local},
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+	}
+	assert.NoError(t, j.ValidateSecrets())
+
+	done := make(chan JobRun)
+	go func() { done <- j.execCommandWithRetry(context.Background(), "test", map[string]string{"day": "mon"}) }()
+
+	// the output is on disk while the run is in progress, with its secrets masked
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path.Join(CheekPath(), "wrote"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	var files []string
+	assert.Eventually(t, func() bool {
+		files = partialLogFiles(t, j.Name)
+		if len(files) != 1 {
+			return false
+		}
+		jr, _, err := readPartialLog(files[0])
+		// what could be the start of a secret is held back until more output comes in
+		return err == nil && strings.HasPrefix(jr.Log, "one *** and") && !strings.Contains(jr.Log, "s3cr")
+	}, 5*time.Second, 10*time.Millisecond)
+	jr, owner, err := readPartialLog(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, partialLogOwner{PID: os.Getpid(), Started: processStartID(os.Getpid())}, owner)
+	assert.Equal(t, "test", jr.TriggeredBy)
+	assert.Equal(t, map[string]string{"day": "mon"}, jr.Params)
+	assert.Equal(t, jr.ID, jr.GroupID)
+
+	// once the run got recorded, the file is gone
+	finished := <-done
+	assert.Equal(t, "one *** and then some\ntwo\n", finished.Log)
+	assert.Empty(t, partialLogFiles(t, j.Name))
+}
+
+func TestRecordInterruptedRuns(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{Jobs: map[string]*JobSpec{
+		"backup": {Command: []string{"true"}, LogMode: LogModeFile},
+	}, TZLocation: "UTC", cfg: cfg}
+	assert.NoError(t, s.initialize())
+
+	// partial logs as cheek going down leaves them behind
+	crash := func(jr JobRun, output string) string {
+		p, err := newPartialLog(&jr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.Write([]byte(output))
+		assert.NoError(t, err)
+		assert.NoError(t, p.Close())
+		partialLogs.Delete(p.fn)
+		return p.fn
+	}
+	started := time.Now().Add(-time.Minute)
+	crash(JobRun{ID: "r1", GroupID: "r0", Attempt: 1, Name: "backup", TriggeredAt: started, TriggeredBy: "cron[retry=1]"}, "copying\nhalfway\n")
+	crash(JobRun{ID: "r2", Name: "removed_job", TriggeredAt: started, TriggeredBy: "cron"}, "")
+
+	// runs of another cheek that is still around are left alone
+	ownedBy := func(fn string, owner partialLogOwner) {
+		b, err := os.ReadFile(fn)
+		assert.NoError(t, err)
+		line, output, _ := strings.Cut(string(b), "\n")
+		header := partialLogHeader{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &header))
+		header.partialLogOwner = owner
+		b, err = json.Marshal(header)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(fn, append(b, "\n"+output...), 0o644))
+	}
+	fn := crash(JobRun{ID: "r3", Name: "backup", TriggeredAt: started}, "")
+	ownedBy(fn, partialLogOwner{PID: os.Getppid(), Started: processStartID(os.Getppid())})
+	// unless their pid got taken by another process in the meantime
+	recycled := processStartID(os.Getppid()) != ""
+	if recycled {
+		ownedBy(crash(JobRun{ID: "r4", Name: "backup", TriggeredAt: started}, ""), partialLogOwner{PID: os.Getppid(), Started: "another-boot/1"})
+	}
+
+	s.recordInterruptedRuns()
+
+	runs, err := s.history().lastRuns("backup", 10)
+	assert.NoError(t, err)
+	if recycled {
+		if assert.Len(t, runs, 2) {
+			assert.Equal(t, "r4", runs[0].ID)
+			runs = runs[1:]
+		}
+	}
+	if assert.Len(t, runs, 1) {
+		jr := runs[0]
+		assert.Equal(t, "r1", jr.ID)
+		assert.Equal(t, "r0", jr.GroupID)
+		assert.Equal(t, 1, jr.Attempt)
+		assert.Equal(t, RunStateInterrupted, jr.State)
+		assert.Equal(t, StatusInterrupted, jr.Status)
+		assert.False(t, jr.Success)
+		assert.GreaterOrEqual(t, jr.Duration, time.Minute-time.Second)
+		// the job keeps its logs in files of their own
+		assert.Equal(t, "backup/r1.log", jr.LogFile)
+		assert.NoError(t, jr.loadLogFile())
+		assert.Equal(t, "copying\nhalfway\n", jr.Log)
+	}
+	runs, err = s.history().lastRuns("removed_job", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, RunStateInterrupted, runs[0].State)
+	}
+
+	assert.Equal(t, []string{fn}, partialLogFiles(t, "backup"))
+	assert.Empty(t, partialLogFiles(t, "removed_job"))
+}
@@ -0,0 +1,73 @@
+package cheek
+
+import (
+	"fmt"
+	"time"
+)
+
+// Supported moments the interval of a job counts from.
+const (
+	IntervalFromStart  = "start"
+	IntervalFromFinish = "finish"
+)
+
+// minInterval is the shortest interval a job can run on.
+const minInterval = time.Second
+
+func (j *JobSpec) ValidateInterval() error {
+	if j.Interval < 0 {
+		return fmt.Errorf("interval for job '%s' cannot be negative", j.Name)
+	}
+	if j.Interval > 0 && j.Interval < minInterval {
+		return fmt.Errorf("interval for job '%s' should be at least %v, got %v", j.Name, minInterval, j.Interval)
+	}
+	switch j.IntervalFrom {
+	case "", IntervalFromStart, IntervalFromFinish:
+	default:
+		return fmt.Errorf("interval_from for job '%s' should be one of '%s' or '%s', got '%s'", j.Name, IntervalFromStart, IntervalFromFinish, j.IntervalFrom)
+	}
+	if j.IntervalFrom != "" && j.Interval == 0 {
+		return fmt.Errorf("interval_from for job '%s' needs an interval", j.Name)
+	}
+	return nil
+}
+
+// nextInterval returns the tick of an interval job after refTime. It keeps to
+// the rhythm of the previous tick, a job that fell behind (e.g. on a suspended
+// machine) or whose tick lies too far ahead (the clock went back) starts over
+// from refTime.
+func (j *JobSpec) nextInterval(refTime time.Time) time.Time {
+	next := j.nextTick.Add(j.Interval)
+	if j.nextTick.IsZero() || !next.After(refTime) || next.Sub(refTime) > j.Interval {
+		return refTime.Add(j.Interval)
+	}
+	return next
+}
+
+// waitsForFinish tells whether the job runs an interval after its last run
+// finished and that run is still going, it has no next tick until then.
+func (j *JobSpec) waitsForFinish() bool {
+	return j.Interval > 0 && j.IntervalFrom == IntervalFromFinish && j.nextTick.IsZero()
+}
+
+// intervalFinished starts the interval of a job that counts from the end of
+// its runs, now that its run finished at refTime.
+func (s *Schedule) intervalFinished(j *JobSpec, refTime time.Time) {
+	if j.IntervalFrom != IntervalFromFinish {
+		return
+	}
+
+	s.mu.Lock()
+	// the specs of the job might have been reloaded in the meantime
+	if cur, ok := s.Jobs[j.Name]; ok && cur.waitsForFinish() {
+		cur.nextTick = refTime.Add(cur.Interval)
+	}
+	wake := s.wake
+	s.mu.Unlock()
+
+	// the scheduling loop might be asleep for longer than the interval
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,91 @@
+package cheek
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateInterval(t *testing.T) {
+	assert.NoError(t, (&JobSpec{Interval: 90 * time.Second}).ValidateInterval())
+	assert.NoError(t, (&JobSpec{Interval: time.Minute, IntervalFrom: IntervalFromFinish}).ValidateInterval())
+	assert.NoError(t, (&JobSpec{}).ValidateInterval())
+
+	assert.Error(t, (&JobSpec{Interval: -time.Second}).ValidateInterval())
+	assert.Error(t, (&JobSpec{Interval: time.Millisecond}).ValidateInterval())
+	assert.ErrorContains(t, (&JobSpec{Interval: time.Minute, Cron: "* * * * *"}).ValidateAt(), "only one of")
+	assert.Error(t, (&JobSpec{Interval: time.Minute, IntervalFrom: "end"}).ValidateInterval())
+	assert.Error(t, (&JobSpec{IntervalFrom: IntervalFromStart}).ValidateInterval())
+}
+
+func TestDueJobsInterval(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Interval: 90 * time.Second},
+	}, refTime)
+	j := s.Jobs["foo"]
+	assert.Equal(t, refTime.Add(90*time.Second), j.nextTick)
+	assert.Equal(t, maxSleep, s.untilNextTick(refTime))
+	assert.Equal(t, 10*time.Second, s.untilNextTick(refTime.Add(80*time.Second)))
+
+	// waking up late doesn't make the ticks drift
+	assert.Len(t, s.dueJobs(refTime.Add(90*time.Second+20*time.Millisecond)), 1)
+	assert.Equal(t, refTime.Add(180*time.Second), j.nextTick)
+
+	// missed ticks result in a single run, the interval starts over from there
+	late := refTime.Add(time.Hour)
+	assert.Len(t, s.dueJobs(late), 1)
+	assert.Empty(t, s.dueJobs(late))
+	assert.Equal(t, late.Add(90*time.Second), j.nextTick)
+
+	runs, err := j.nextRuns(late, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{late.Add(90 * time.Second), late.Add(180 * time.Second), late.Add(270 * time.Second)}, runs)
+}
+
+func TestDueJobsIntervalFromFinish(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Interval: time.Minute, IntervalFrom: IntervalFromFinish},
+	}, refTime)
+	s.wake = make(chan struct{}, 1)
+	j := s.Jobs["foo"]
+
+	assert.Len(t, s.dueJobs(refTime.Add(time.Minute)), 1)
+	// no next tick while the run is in progress
+	assert.True(t, j.waitsForFinish())
+	assert.Equal(t, maxSleep, s.untilNextTick(refTime.Add(time.Minute)))
+	assert.Empty(t, s.dueJobs(refTime.Add(time.Hour)))
+
+	s.intervalFinished(j, refTime.Add(100*time.Second))
+	assert.Equal(t, refTime.Add(160*time.Second), j.nextTick)
+	// the scheduling loop gets woken up to pick up the tick
+	assert.Len(t, s.wake, 1)
+}
+
+func TestIntervalSpecs(t *testing.T) {
+	s, err := parseSpecs("schedule.yaml", []byte(`
+jobs:
+  poll:
+    command: date
+    interval: 90s
+  both:
+    command: date
+    cron: "* * * * *"
+    interval: 7m
+`))
+	assert.NoError(t, err)
+	s.log = NewLogger("debug", new(tsBuffer))
+	assert.Equal(t, 90*time.Second, s.Jobs["poll"].Interval)
+	problems := s.validate()
+	if assert.Len(t, problems, 1) {
+		assert.Equal(t, "both", problems[0].Job)
+	}
+
+	from := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	delete(s.Jobs, "both")
+	sim, err := s.Simulate(from, from.Add(5*time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, sim.Firings, 3)
+}
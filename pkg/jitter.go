@@ -0,0 +1,79 @@
+package cheek
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"os"
+	"time"
+)
+
+// jitterRand picks a random delay in [0, n), overridden in tests. It doesn't
+// use a seeded generator, which would give all hosts the same delays.
+var jitterRand = func(n int64) int64 {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0
+	}
+	return v.Int64()
+}
+
+// hostname identifies the host for stable jitter, overridden in tests.
+var hostname = os.Hostname
+
+func (j *JobSpec) ValidateJitter() error {
+	if j.Jitter < 0 {
+		return fmt.Errorf("jitter for job '%s' cannot be negative", j.Name)
+	}
+	if j.StableJitter && j.Jitter == 0 {
+		return fmt.Errorf("stable_jitter for job '%s' needs a jitter", j.Name)
+	}
+	return nil
+}
+
+// jitterDelay picks how long to hold off the run of a job that became due at
+// refTime. The delay stays below the job's next tick, which keeps runs from
+// piling up when the jitter is larger than the time between ticks.
+func (s *Schedule) jitterDelay(j *JobSpec, refTime time.Time) time.Duration {
+	if j.Jitter <= 0 {
+		return 0
+	}
+
+	s.mu.RLock()
+	untilNext := j.nextTick.Sub(refTime)
+	s.mu.RUnlock()
+
+	window := j.Jitter
+	if untilNext > 0 && untilNext < window {
+		s.log.Warn().Str("job", j.Name).Msgf("jitter of %v goes past the next run in %v, capping it", j.Jitter, untilNext)
+		window = untilNext
+	}
+
+	if j.StableJitter {
+		return stableOffset(j.Name, window)
+	}
+	return time.Duration(jitterRand(int64(window)))
+}
+
+// stableOffset derives an offset in [0, window) from the host and the job,
+// so that every host runs the job at its own but always the same time.
+func stableOffset(job string, window time.Duration) time.Duration {
+	host, _ := hostname()
+	h := fnv.New64a()
+	h.Write([]byte(host + "/" + job))
+	return time.Duration(h.Sum64() % uint64(window))
+}
+
+// execDue runs a job that became due on its cron at scheduledAt, once its
+// jitter delay has passed. The run is called off when ctx is done before.
+func (j *JobSpec) execDue(ctx context.Context, scheduledAt time.Time, delay time.Duration) {
+	if delay > 0 {
+		j.log.Debug().Str("job", j.Name).Msgf("holding off run for %v", delay)
+		if !sleepContext(ctx, delay) {
+			return
+		}
+	}
+	j.dispatch(ctx, runRequest{id: newRunID(), trigger: "cron", params: map[string]string{}, scheduledAt: scheduledAt})
+}
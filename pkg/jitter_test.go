@@ -0,0 +1,71 @@
+package cheek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitterDelay(t *testing.T) {
+	logs := new(tsBuffer)
+	s := &Schedule{loc: time.Local, log: NewLogger("debug", logs)}
+	refTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	j := &JobSpec{Name: "hourly", Jitter: 10 * time.Minute, nextTick: refTime.Add(time.Hour)}
+
+	defer func(f func(int64) int64) { jitterRand = f }(jitterRand)
+	var window int64
+	jitterRand = func(n int64) int64 {
+		window = n
+		return n / 2
+	}
+	assert.Equal(t, 5*time.Minute, s.jitterDelay(j, refTime))
+	assert.Equal(t, int64(10*time.Minute), window)
+
+	// the delay stays within the time until the next tick
+	j.nextTick = refTime.Add(4 * time.Minute)
+	assert.Equal(t, 2*time.Minute, s.jitterDelay(j, refTime))
+	assert.Equal(t, int64(4*time.Minute), window)
+	assert.Contains(t, logs.String(), "capping it")
+
+	assert.Zero(t, s.jitterDelay(&JobSpec{Name: "none"}, refTime))
+
+	// stable jitter gives the same delay on a host, but different ones on other hosts
+	defer func(f func() (string, error)) { hostname = f }(hostname)
+	j = &JobSpec{Name: "hourly", Jitter: time.Hour, StableJitter: true, nextTick: refTime.Add(24 * time.Hour)}
+	hostname = func() (string, error) { return "host-a", nil }
+	a := s.jitterDelay(j, refTime)
+	assert.Equal(t, a, s.jitterDelay(j, refTime.Add(time.Hour)))
+	assert.True(t, a >= 0 && a < time.Hour)
+	hostname = func() (string, error) { return "host-b", nil }
+	assert.NotEqual(t, a, s.jitterDelay(j, refTime))
+
+	assert.Error(t, (&JobSpec{Jitter: -time.Second}).ValidateJitter())
+	assert.Error(t, (&JobSpec{StableJitter: true}).ValidateJitter())
+}
+
+func TestExecDueRecordsScheduledAt(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	j := &JobSpec{Name: "jittered", Command: []string{"true"}, globalSchedule: s, inFlight: newRunTracker(), log: s.log, cfg: cfg}
+
+	scheduledAt := time.Now()
+	j.execDue(context.Background(), scheduledAt, 100*time.Millisecond)
+
+	jrs, _, err := s.history().runs("jittered", 0, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, jrs, 1) && assert.NotNil(t, jrs[0].ScheduledAt) {
+		assert.True(t, jrs[0].ScheduledAt.Equal(scheduledAt))
+		assert.True(t, jrs[0].TriggeredAt.Sub(scheduledAt) >= 100*time.Millisecond)
+		assert.Equal(t, "cron", jrs[0].TriggeredBy)
+	}
+
+	// runs that are held off get called off when the scheduler stops
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	j.execDue(ctx, time.Now(), time.Hour)
+	jrs, _, _ = s.history().runs("jittered", 0, 10)
+	assert.Len(t, jrs, 1)
+}
@@ -2,14 +2,18 @@ package cheek
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/adhocore/gronx"
@@ -19,100 +23,447 @@ import (
 
 // OnEvent contains specs on what needs to happen after a job event.
 type OnEvent struct {
-	TriggerJob         []string `yaml:"trigger_job,omitempty" json:"trigger_job,omitempty"`
-	NotifyWebhook      []string `yaml:"notify_webhook,omitempty" json:"notify_webhook,omitempty"`
-	NotifySlackWebhook []string `yaml:"notify_slack_webhook,omitempty" json:"notify_slack_webhook,omitempty"`
+	TriggerJob           []JobTrigger   `yaml:"trigger_job,omitempty" json:"trigger_job,omitempty"`
+	NotifyWebhook        []Webhook      `yaml:"notify_webhook,omitempty" json:"notify_webhook,omitempty"`
+	NotifySlackWebhook   []SlackWebhook `yaml:"notify_slack_webhook,omitempty" json:"notify_slack_webhook,omitempty"`
+	NotifyDiscordWebhook []string       `yaml:"notify_discord_webhook,omitempty" json:"notify_discord_webhook,omitempty"`
+	NotifyTeamsWebhook   []string       `yaml:"notify_teams_webhook,omitempty" json:"notify_teams_webhook,omitempty"`
+	NotifyEmail          []string       `yaml:"notify_email,omitempty" json:"notify_email,omitempty"`
+	NotifyTelegram       []string       `yaml:"notify_telegram,omitempty" json:"notify_telegram,omitempty"`
+	// notifiers of types registered with RegisterNotifier
+	Notify []NotifierSpec `yaml:"notify,omitempty" json:"notify,omitempty"`
+	// only notify when a job starts failing or recovers
+	NotifyOnStateChangeOnly bool `yaml:"notify_on_state_change_only,omitempty" json:"notify_on_state_change_only,omitempty"`
+	// fire the actions without waiting for them to complete
+	Async bool `yaml:"async,omitempty" json:"async,omitempty"`
+}
+
+// JobTrigger references a job to trigger on an event. The triggered job gets
+// the parameters of the run that triggered it, extended with Params which
+// are rendered as templates like the command.
+type JobTrigger struct {
+	Name   string            `yaml:"name" json:"name"`
+	Params map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+}
+
+// UnmarshalYAML accepts both the name of a job and a mapping with its name and params.
+func (t *JobTrigger) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*t = JobTrigger{Name: name}
+		return nil
+	}
+
+	type jobTrigger JobTrigger
+	var jt jobTrigger
+	if err := unmarshal(&jt); err != nil {
+		return err
+	}
+	*t = JobTrigger(jt)
+	return nil
+}
+
+// MarshalYAML writes triggers without params as just the name of the job.
+func (t JobTrigger) MarshalYAML() (interface{}, error) {
+	if len(t.Params) == 0 {
+		return t.Name, nil
+	}
+
+	type jobTrigger JobTrigger
+	return jobTrigger(t), nil
 }
 
 // JobSpec holds specifications and metadata of a job.
 type JobSpec struct {
 	Cron    string      `yaml:"cron,omitempty" json:"cron,omitempty"`
 	Command stringArray `yaml:"command" json:"command"`
+	// run the job every interval instead of on a cron, counted from the start or the end of its runs
+	Interval     time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	IntervalFrom string        `yaml:"interval_from,omitempty" json:"interval_from,omitempty"`
+	// run the job once at each of these timestamps
+	At timeArray `yaml:"at,omitempty" json:"at,omitempty"`
 
-	OnSuccess OnEvent `yaml:"on_success,omitempty" json:"on_success,omitempty"`
-	OnError   OnEvent `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	OnSuccess          OnEvent `yaml:"on_success,omitempty" json:"on_success,omitempty"`
+	OnError            OnEvent `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	OnStart            OnEvent `yaml:"on_start,omitempty" json:"on_start,omitempty"`
+	OnRetriesExhausted OnEvent `yaml:"on_retries_exhausted,omitempty" json:"on_retries_exhausted,omitempty"`
+	OnStale            OnEvent `yaml:"on_stale,omitempty" json:"on_stale,omitempty"`
+	// fire on_error after every failed attempt instead of only after the last one
+	OnErrorEveryAttempt bool `yaml:"on_error_every_attempt,omitempty" json:"on_error_every_attempt,omitempty"`
+	// run the job once when the scheduler starts, next to its cron
+	RunOnStart bool `yaml:"run_on_start,omitempty" json:"run_on_start,omitempty"`
+	// switch the job off while keeping its specs and history
+	Disable bool `yaml:"disable,omitempty" json:"disable,omitempty"`
+	// prefix each line of output with a timestamp, rfc3339 or relative to the start of the run
+	LogTimestamps string `yaml:"log_timestamps,omitempty" json:"log_timestamps,omitempty"`
+	// exit codes that mean the job succeeded, defaults to just 0
+	SuccessExitCodes []int `yaml:"success_exit_codes,omitempty" json:"success_exit_codes,omitempty"`
+	// only retry failed runs that exited with one of these codes, defaults to any failure
+	RetryOnExitCodes []int `yaml:"retry_on_exit_codes,omitempty" json:"retry_on_exit_codes,omitempty"`
+	// capture stdout and stderr separately next to the combined log
+	SplitOutput bool `yaml:"split_output,omitempty" json:"split_output,omitempty"`
+	// pick up structured output from the output of runs, last_json_line or prefixed
+	CaptureOutput string `yaml:"capture_output,omitempty" json:"capture_output,omitempty"`
+	// fire on_error when a run gets canceled via the api, defaults to true
+	NotifyOnCancel *bool `yaml:"notify_on_cancel,omitempty" json:"notify_on_cancel,omitempty"`
+	// keep the output of the job off stdout, defaults to the global setting
+	SuppressLogs *bool `yaml:"suppress_logs,omitempty" json:"suppress_logs,omitempty"`
 
-	Name             string            `json:"name"`
+	Name             string            `yaml:"name,omitempty" json:"name"`
 	Retries          int               `yaml:"retries,omitempty" json:"retries,omitempty"`
+	RetryDelay       time.Duration     `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+	RetryBackoff     string            `yaml:"retry_backoff,omitempty" json:"retry_backoff,omitempty"`
+	RetryMaxDelay    time.Duration     `yaml:"retry_max_delay,omitempty" json:"retry_max_delay,omitempty"`
 	Env              map[string]string `yaml:"env,omitempty"`
+	EnvFile          stringArray       `yaml:"env_file,omitempty" json:"env_file,omitempty"`
+	Secrets          map[string]Secret `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+	StrictTemplates  *bool             `yaml:"strict_templates,omitempty" json:"strict_templates,omitempty"`
 	WorkingDirectory string            `yaml:"working_directory,omitempty" json:"working_directory,omitempty"`
-	globalSchedule   *Schedule
-	Runs             []JobRun `yaml:"runs,omitempty"`
+	// what the command gets on stdin, either rendered from a template or read from a file
+	Stdin             string        `yaml:"stdin,omitempty" json:"stdin,omitempty"`
+	StdinFile         string        `yaml:"stdin_file,omitempty" json:"stdin_file,omitempty"`
+	Timeout           time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	AllowConcurrent   bool          `yaml:"allow_concurrent,omitempty" json:"allow_concurrent,omitempty"`
+	ConcurrencyPolicy string        `yaml:"concurrency_policy,omitempty" json:"concurrency_policy,omitempty"`
+	QueueDepth        int           `yaml:"queue_depth,omitempty" json:"queue_depth,omitempty"`
+	TZLocation        string        `yaml:"tz,omitempty" json:"tz,omitempty"`
+	MaxRunsKept       int           `yaml:"max_runs_kept,omitempty" json:"max_runs_kept,omitempty"`
+	MaxLogAge         time.Duration `yaml:"max_log_age,omitempty" json:"max_log_age,omitempty"`
+	MaxLogSize        int           `yaml:"max_log_size,omitempty" json:"max_log_size,omitempty"`
+	// write the log of each run to a file of its own with file, defaults to the schedule's setting
+	LogMode string `yaml:"log_mode,omitempty" json:"log_mode,omitempty"`
+	// run the command in a container or on another host instead of on this host
+	Container *ContainerSpec `yaml:"container,omitempty" json:"container,omitempty"`
+	SSH       *SSHSpec       `yaml:"ssh,omitempty" json:"ssh,omitempty"`
+	// resource limits of the command, only applied on linux
+	Nice        int           `yaml:"nice,omitempty" json:"nice,omitempty"`
+	MemoryLimit int64         `yaml:"memory_limit,omitempty" json:"memory_limit,omitempty"`
+	CPULimit    time.Duration `yaml:"cpu_limit,omitempty" json:"cpu_limit,omitempty"`
+	MonitorURL  string        `yaml:"monitor_url,omitempty" json:"monitor_url,omitempty"`
+	// limit the runs that can be requested via the http api
+	MaxTriggersPerMinute int           `yaml:"max_triggers_per_minute,omitempty" json:"max_triggers_per_minute,omitempty"`
+	TriggerDebounce      time.Duration `yaml:"trigger_debounce,omitempty" json:"trigger_debounce,omitempty"`
+	// run the job when a signed request comes in on /hooks/{name}
+	WebhookTrigger *WebhookTrigger `yaml:"webhook_trigger,omitempty" json:"webhook_trigger,omitempty"`
+	// run the ticks that got missed while cheek was down once it starts again
+	Catchup       bool   `yaml:"catchup,omitempty" json:"catchup,omitempty"`
+	CatchupPolicy string `yaml:"catchup_policy,omitempty" json:"catchup_policy,omitempty"`
+	// hold off runs on the cron for up to this long, always by the same amount on a host with stable_jitter
+	Jitter       time.Duration `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	StableJitter bool          `yaml:"stable_jitter,omitempty" json:"stable_jitter,omitempty"`
+	// only run on the cron within this time of day
+	Window *RunWindow `yaml:"window,omitempty" json:"window,omitempty"`
+	// report the failures in a row of the job in the health check
+	Critical bool `yaml:"critical,omitempty" json:"critical,omitempty"`
+	// alert when the job did not succeed for this long
+	MaxTimeSinceSuccess time.Duration `yaml:"max_time_since_success,omitempty" json:"max_time_since_success,omitempty"`
+	// stop running on the schedule after this many failures in a row, until resumed or auto_resume_after passed
+	MaxConsecutiveFailures int           `yaml:"max_consecutive_failures,omitempty" json:"max_consecutive_failures,omitempty"`
+	AutoResumeAfter        time.Duration `yaml:"auto_resume_after,omitempty" json:"auto_resume_after,omitempty"`
+	globalSchedule         *Schedule
+	Runs                   []JobRun `yaml:"runs,omitempty"`
+	// the schedule file the job is defined in
+	SourceFile string `yaml:"-" json:"source_file,omitempty"`
 
 	nextTick time.Time
-	log      zerolog.Logger
-	cfg      Config
+	// the opening of the window a tick got deferred to
+	deferredTo time.Time
+	loc        *time.Location
+	inFlight   *runTracker
+	health     *jobHealth
+	limiter    *triggerLimiter
+	log        zerolog.Logger
+	cfg        Config
 }
 
+// Supported strategies to space out retries.
+const (
+	RetryBackoffFixed       string = "fixed"
+	RetryBackoffExponential string = "exponential"
+)
+
+const defaultRetryDelay = 5 * time.Second
+
+// Special JobRun statuses that do not originate from a process exit code.
+const (
+	// StatusTimeout is the status of a run that got killed because it exceeded the job's timeout.
+	StatusTimeout int = -2
+	// StatusSkipped is the status of a scheduled run that did not start because
+	// a previous run of the same job was still in progress.
+	StatusSkipped int = -3
+	// StatusStale is the status of the notifications about a job that did not
+	// succeed within its max_time_since_success.
+	StatusStale int = -4
+	// StatusCanceled is the status of a run that got canceled via the api.
+	StatusCanceled int = -5
+	// StatusCircuitOpen is the status of the notifications about a job that
+	// stopped running on its schedule after max_consecutive_failures.
+	StatusCircuitOpen int = -6
+)
+
+// States a JobRun can end up in, next to its raw exit code.
+const (
+	RunStateStartFailed string = "start_failed"
+	RunStateCompleted   string = "completed"
+	RunStateTimedOut    string = "timed_out"
+	RunStateKilled      string = "killed"
+	RunStateSkipped     string = "skipped"
+	RunStateRunning     string = "running"
+	RunStateStale       string = "stale"
+	RunStateCanceled    string = "canceled"
+	RunStateCircuitOpen string = "circuit_open"
+)
+
 // JobRun holds information about a job execution.
 type JobRun struct {
-	Status      int `json:"status"`
-	logBuf      bytes.Buffer
-	Log         string        `json:"log"`
-	Name        string        `json:"name"`
-	TriggeredAt time.Time     `json:"triggered_at"`
-	TriggeredBy string        `json:"triggered_by"`
-	Triggered   []string      `json:"triggered,omitempty"`
-	Duration    time.Duration `json:"duration,omitempty"`
-	jobRef      *JobSpec
+	ID string `json:"id,omitempty"`
+	// the id of the first attempt of the run, shared by its retries
+	GroupID string `json:"group_id,omitempty"`
+	// the number of retries that came before, 0 for the first attempt
+	Attempt int `json:"attempt,omitempty"`
+	Status  int `json:"status"`
+	// whether the status is one of the job's success exit codes
+	Success bool   `json:"success"`
+	State   string `json:"state,omitempty"`
+	logBuf  bytes.Buffer
+	// caps how much output ends up in logBuf
+	logCap *cappedWriter
+	Log    string `json:"log"`
+	// where the full log is with log_mode: file, relative to the cheek home dir
+	LogFile string `json:"log_file,omitempty"`
+	// the output of the command per stream when the job splits its output, the
+	// order in which lines of the two streams got written is only kept in Log
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	stdout *capturedStream
+	stderr *capturedStream
+	// the structured output of the run, with capture_output
+	Output           map[string]interface{} `json:"output,omitempty"`
+	capture          *outputCapture
+	Name             string            `json:"name"`
+	ScheduledAt      *time.Time        `json:"scheduled_at,omitempty"`
+	TriggeredAt      time.Time         `json:"triggered_at"`
+	TriggeredBy      string            `json:"triggered_by"`
+	TriggeredByRunID string            `json:"triggered_by_run_id,omitempty"`
+	Triggered        []string          `json:"triggered,omitempty"`
+	TriggeredRunIDs  []string          `json:"triggered_run_ids,omitempty"`
+	TriggerDepth     int               `json:"trigger_depth,omitempty"`
+	PreviousFailures int               `json:"previous_failures,omitempty"`
+	Duration         time.Duration     `json:"duration,omitempty"`
+	Params           map[string]string `json:"params,omitempty"`
+	QueuedFor        time.Duration     `json:"queued_for,omitempty"`
+	jobRef           *JobSpec
+	// values that are masked in the log
+	secrets []string
+	// jobs to trigger once the run is done
+	triggers []pendingTrigger
+	// the run that triggered this one, if any
+	parent *parentRun
+	// whether another attempt follows this one
+	retrying bool
+	// the output of the run on disk while it is in progress
+	partial *partialLog
+}
+
+// runRequest describes a run that is about to start.
+type runRequest struct {
+	// the first attempt of the run goes by its id, retries share it as their group id
+	id      string
+	groupID string
+	trigger string
+	params  map[string]string
+	// the number of jobs in the chain of triggers that led to the run
+	depth int
+	// the run of the job that triggered this one, if any
+	parentID string
+	parent   *parentRun
+	// when the run became due on the cron, before its jitter
+	scheduledAt time.Time
+}
+
+// pendingTrigger is a job that is about to be triggered by a run.
+type pendingTrigger struct {
+	job *JobSpec
+	req runRequest
 }
 
 func (jr *JobRun) flushLogBuffer() {
-	jr.Log = jr.logBuf.String()
+	log := jr.logBuf.String()
+	if jr.logCap != nil && jr.logCap.dropped > 0 {
+		log += truncationNote(jr.logCap.dropped)
+	}
+	jr.Log = maskSecrets(log, jr.secrets)
+	jr.Output = jr.capture.result(jr)
+	if jr.stdout != nil {
+		jr.Stdout = maskSecrets(jr.stdout.String(), jr.secrets)
+		jr.Stderr = maskSecrets(jr.stderr.String(), jr.secrets)
+	}
+}
+
+// jobLogFile is where the runs of a job get logged.
+func jobLogFile(jobName string) string {
+	return path.Join(CheekPath(), fmt.Sprintf("%s.job.jsonl", jobName))
 }
 
 func (j *JobRun) logToDisk() {
-	logFn := path.Join(CheekPath(), fmt.Sprintf("%s.job.jsonl", j.Name))
-	f, err := os.OpenFile(logFn,
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		j.jobRef.log.Warn().Str("job", j.Name).Err(err).Msgf("Can't open job log '%v' for writing", logFn)
-		return
+	if j.jobRef.logMode() == LogModeFile {
+		// keeps the log file from being seen as orphaned before the run got recorded
+		lock := jobLogLock(runLogDir(j.Name))
+		lock.Lock()
+		full, err := j.saveLogFile()
+		if err != nil {
+			j.jobRef.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't save log of run to its own file, keeping it with the run.")
+		}
+		j.record()
+		if full != "" {
+			j.Log = full
+		}
+		lock.Unlock()
+	} else {
+		j.record()
 	}
-	defer f.Close()
+	if err := j.partial.remove(); err != nil {
+		j.jobRef.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't remove the output of the run that got written as it came in.")
+	}
+	// keep the log within the job's retention settings
+	j.jobRef.pruneRuns()
+}
 
-	if err := json.NewEncoder(f).Encode(j); err != nil {
+// record saves the run in the history and hands it to the event sink.
+func (j *JobRun) record() {
+	if err := j.jobRef.history().append(j); err != nil {
 		j.jobRef.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't save job log to disk.")
 	}
+	if s := j.jobRef.globalSchedule; s != nil {
+		s.sendEvent(j)
+	}
 }
 
-func (j *JobSpec) finalize(jr *JobRun) {
+func (j *JobSpec) finalize(ctx context.Context, jr *JobRun) {
 	// flush logbuf to string
 	jr.flushLogBuffer()
+	if !jr.retrying && jr.Status != StatusSkipped {
+		jr.PreviousFailures = j.health.record(j, jr)
+		if j.health.trip(j, jr.TriggeredAt.Add(jr.Duration)) {
+			defer j.reportCircuitOpen(ctx, jr.TriggeredAt.Add(jr.Duration))
+		}
+	}
+	// decide on the jobs to trigger first, so that they get recorded with the run
+	j.resolveTriggers(jr, j.eventFor(jr))
 	// write logs to disk
 	jr.logToDisk()
+	j.recordTick(jr)
+	j.pingMonitorDone(jr)
 	// launch on_events
-	j.OnEvent(jr)
+	j.OnEvent(ctx, jr)
+}
+
+// execCommandWithRetry runs the job with its retries, canceling ctx cancels the
+// run and any retries that are still to come.
+func (j *JobSpec) execCommandWithRetry(ctx context.Context, trigger string, parameters map[string]string) JobRun {
+	return j.dispatch(ctx, runRequest{id: newRunID(), trigger: trigger, params: parameters})
 }
 
-func (j *JobSpec) execCommandWithRetry(trigger string) JobRun {
+// retryCommand executes the job until it succeeds or runs out of retries. The first
+// attempt gets the run id, retries get their own and all of them share the run id
+// as their group id. queuedFor is how long the run had to wait before it could start.
+// release frees up what the run holds on to, e.g. its slot, and gets called once the
+// last attempt is done.
+func (j *JobSpec) retryCommand(ctx context.Context, req runRequest, queuedFor time.Duration, release func()) JobRun {
 	tries := 0
 	var jr JobRun
-	const timeOut = 5 * time.Second
+
+	ctx, span := j.startRunSpan(ctx, req.trigger)
+	defer func() { endRunSpan(span, &jr) }()
+
+	started := j.onStart(ctx, req)
+	defer started.Wait()
 
 	for tries < j.Retries+1 {
 
+		attemptCtx, attemptSpan := j.startAttemptSpan(ctx, req.trigger, tries)
 		switch {
 		case tries == 0:
-			jr = j.execCommand(trigger)
+			jr = j.execAttempt(attemptCtx, req, 0)
+			jr.QueuedFor = queuedFor
 		default:
-			jr = j.execCommand(fmt.Sprintf("%s[retry=%v]", trigger, tries))
+			retry := req
+			retry.id = newRunID()
+			retry.groupID = req.id
+			retry.trigger = fmt.Sprintf("%s[retry=%v]", req.trigger, tries)
+			jr = j.execAttempt(attemptCtx, retry, tries)
+		}
+		jr.GroupID = req.id
+		jr.Attempt = tries
+		jr.TriggerDepth = req.depth
+		jr.TriggeredByRunID = req.parentID
+		if !req.scheduledAt.IsZero() {
+			at := req.scheduledAt
+			jr.ScheduledAt = &at
+		}
+		// a canceled run is not retried
+		jr.retrying = !jr.succeeded() && tries < j.Retries && jr.State != RunStateCanceled
+		if jr.retrying && !j.retryableExitCode(jr.Status) {
+			jr.retrying = false
+			msg := fmt.Sprintf("not retrying: exit code %v not retryable", jr.Status)
+			j.log.Info().Str("job", j.Name).Str("run_id", jr.ID).Int("exitcode", jr.Status).Msg(msg)
+			jr.logBuf.WriteString("\n" + msg + "\n")
 		}
 
-		// finalise logging etc
-		j.finalize(&jr)
+		// make room before the event fires, the jobs it triggers might need it
+		if !jr.retrying {
+			release()
+		}
 
-		if jr.Status == 0 {
+		// finalise logging etc, the notifications and triggered jobs end up in the trace of the attempt
+		j.finalize(attemptCtx, &jr)
+		endRunSpan(attemptSpan, &jr)
+
+		if !jr.retrying {
 			break
 		}
-		j.log.Debug().Str("job", j.Name).Int("exitcode", jr.Status).Msgf("job exited unsuccessfully, launching retry after %v timeout.", timeOut)
 		tries++
-		time.Sleep(timeOut)
+		if tries > j.Retries {
+			break
+		}
+
+		delay := j.retryDelay(tries)
+		j.log.Info().Str("job", j.Name).Str("run_id", req.id).Int("exitcode", jr.Status).Int("retry", tries).Dur("delay", delay).Msgf("job exited unsuccessfully, launching retry %v after %v delay", tries, delay)
+		if !sleepContext(ctx, delay) {
+			j.log.Info().Str("job", j.Name).Str("run_id", req.id).Int("retry", tries).Err(ctx.Err()).Msg("retry called off")
+			break
+		}
 
 	}
 	return jr
 }
 
+// retryDelay determines how long to wait before launching the given retry (starting at 1).
+func (j *JobSpec) retryDelay(retry int) time.Duration {
+	delay := j.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	if j.RetryBackoff == RetryBackoffExponential {
+		for i := 1; i < retry; i++ {
+			if j.RetryMaxDelay > 0 && delay >= j.RetryMaxDelay {
+				break
+			}
+			if delay > math.MaxInt64/2 {
+				break
+			}
+			delay *= 2
+		}
+	}
+
+	if j.RetryMaxDelay > 0 && delay > j.RetryMaxDelay {
+		delay = j.RetryMaxDelay
+	}
+
+	return delay
+}
+
 func (j JobSpec) now() time.Time {
 	// defer for if schedule doesn't exist, allows fore easy testing
 	if j.globalSchedule != nil {
@@ -121,101 +472,576 @@ func (j JobSpec) now() time.Time {
 	return time.Now()
 }
 
-func (j *JobSpec) execCommand(trigger string) JobRun {
-	j.log.Info().Str("job", j.Name).Str("trigger", trigger).Msgf("Job triggered")
-	// init status to non-zero until execution says otherwise
-	jr := JobRun{Name: j.Name, TriggeredAt: j.now(), TriggeredBy: trigger, Status: -1, jobRef: j}
+func (j *JobSpec) execCommand(ctx context.Context, trigger string, parameters map[string]string) JobRun {
+	return j.execAttempt(ctx, runRequest{id: newRunID(), trigger: trigger, params: parameters}, 0)
+}
+
+// execAttempt runs the job's command once as the run req asks for, attempt
+// counts the retries that came before. The command gets terminated when ctx is done.
+func (j *JobSpec) execAttempt(parent context.Context, req runRequest, attempt int) (jr JobRun) {
+	id, trigger, parameters := req.id, req.trigger, req.params
+	// init status to non-zero & state to failed until execution says otherwise
+	jr = JobRun{ID: id, Name: j.Name, TriggeredAt: j.now(), TriggeredBy: trigger, Params: parameters, Status: -1, State: RunStateStartFailed, TriggeredByRunID: req.parentID, jobRef: j, parent: req.parent}
+	log := j.log.With().Str("run_id", id).Logger()
+	log.Info().Str("job", j.Name).Str("trigger", trigger).Msgf("Job triggered")
 
-	suppressLogs := j.cfg.SuppressLogs
+	j.pingMonitor("/start", "")
 
-	var cmd *exec.Cmd
-	switch len(j.Command) {
-	case 0:
-		err := errors.New("no command specified")
-		jr.Log = fmt.Sprintf("Job unable to start: %v", err.Error())
-		j.log.Warn().Str("job", j.Name).Str("trigger", trigger).Err(err).Msg(jr.Log)
-		if !suppressLogs {
-			fmt.Println(err.Error())
-		}
+	// record how long the run took, regardless of how it ended
+	runMetrics.runStarted(j.Name)
+	defer func() {
+		jr.Duration = time.Since(jr.TriggeredAt)
+		jr.Success = j.successExitCode(jr.Status)
+		runMetrics.runFinished(&jr)
+	}()
+
+	suppressLogs := j.suppressLogs()
+
+	// a zero timeout means the job can run indefinitely
+	ctx := parent
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+	// the run can be canceled via the api while its command is running
+	ctx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	proc := &runningProcess{cancel: cancelRun, started: time.Now(), output: newLogBroadcast(j.maxLogSize())}
+	// describes the run in case it gets interrupted
+	started := jr
+	started.GroupID, started.Attempt, started.TriggerDepth = req.groupID, attempt, req.depth
+	if started.GroupID == "" {
+		started.GroupID = id
+	}
+	if !req.scheduledAt.IsZero() {
+		started.ScheduledAt = &req.scheduledAt
+	}
+	defer j.startPartialLog(&jr, &started, proc.output)()
+	defer proc.output.close()
+
+	// a container can run the default command of its image
+	if len(j.Command) == 0 && j.Container == nil {
+		j.failStart(&jr, trigger, errors.New("no command specified"))
+		return jr
+	}
+
+	data := j.templateData(trigger, parameters)
+	req.parent.addTemplateData(data, req.parentID)
+	command, err := j.renderCommand(data)
+	if err != nil {
+		j.failStart(&jr, trigger, err)
 		return jr
-	case 1:
-		cmd = exec.Command(j.Command[0])
-	default:
-		cmd = exec.Command(j.Command[0], j.Command[1:]...)
 	}
 
 	// add env vars
-	cmd.Env = os.Environ()
-	for k, v := range j.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	env, secrets, err := j.environ(append(runEnv(&jr, attempt), traceEnv(parent)...))
+	if err != nil {
+		j.failStart(&jr, trigger, err)
+		return jr
 	}
+	jr.secrets = secrets
+	proc.output.mask(secrets)
 
-	cmd.Dir = j.WorkingDirectory
+	dir, err := j.workingDirectory(data)
+	if err != nil {
+		j.failStart(&jr, trigger, err)
+		return jr
+	}
 
+	stdin, err := j.stdin(data)
+	if err != nil {
+		j.failStart(&jr, trigger, err)
+		return jr
+	}
+	if stdin != nil {
+		defer stdin.Close()
+	}
+
+	// only the first max_log_size bytes are kept in the run's log, the terminal
+	// and live streams still get all output
+	jr.logCap = &cappedWriter{w: &jr.logBuf, max: j.maxLogSize()}
 	var w io.Writer
-	switch j.cfg.SuppressLogs {
+	switch suppressLogs {
 	case true:
-		w = &jr.logBuf
+		w = io.MultiWriter(jr.logCap, proc.output)
 	default:
-		w = io.MultiWriter(os.Stdout, &jr.logBuf)
+		terminal := j.terminalOutput(&jr)
+		defer terminal.Close()
+		w = io.MultiWriter(terminal, jr.logCap, proc.output)
 	}
 
-	// merge stdout and stderr to same writer
-	cmd.Stdout = w
-	cmd.Stderr = w
+	// prefix lines with a timestamp when the job asks for it, before they go anywhere
+	timestamp := j.logTimestamp(jr.TriggeredAt)
+	stamp := func(w io.Writer) io.Writer {
+		if timestamp == nil {
+			return w
+		}
+		return &timestampWriter{w: w, timestamp: timestamp}
+	}
 
-	err := cmd.Start()
+	// structured output gets picked up from stdout, or the combined output
+	// when the streams aren't split
+	jr.capture = j.newOutputCapture()
+	capture := func(w io.Writer) io.Writer {
+		if jr.capture == nil {
+			return w
+		}
+		return io.MultiWriter(w, jr.capture)
+	}
+
+	var stdout, stderr io.Writer
+	if j.SplitOutput {
+		// the streams get written concurrently now, lines of both can end up
+		// in the combined log in a different order than they got written
+		shared := &lockedWriter{w: w}
+		jr.stdout = newCapturedStream(j.maxLogSize())
+		jr.stderr = newCapturedStream(j.maxLogSize())
+		stdout = capture(stamp(io.MultiWriter(shared, jr.stdout)))
+		stderr = stamp(io.MultiWriter(shared, jr.stderr))
+		w = stamp(shared)
+	} else {
+		// merge stdout and stderr to same writer
+		w = stamp(w)
+		stdout = capture(w)
+		stderr = stdout
+	}
+
+	if j.SSH != nil {
+		remote := &sshRunner{spec: j.SSH, job: j}
+		remote.exec(ctx, parent, &jr, proc, command, env, sshIO{stdin: stdin, stdout: stdout, stderr: stderr, log: w}, log)
+		return jr
+	}
+
+	run := j.runner(&jr)
+	command = run.command(command, env)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	cmd.Dir = dir
+
+	// make sure that on termination everything spawned by the job goes down with it
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return proc.terminate(parent.Err() != nil, func() error { return terminateProcessGroup(cmd) }, func() ([]int, error) {
+			pids, err := killProcessGroup(cmd)
+			if err := run.stop(); err != nil {
+				log.Warn().Str("job", j.Name).Err(err).Msg("could not stop job")
+			}
+			return pids, err
+		})
+	}
+
+	err = cmd.Start()
 	if err != nil {
-		if !suppressLogs {
+		if !suppressLogs && j.cfg.logFormat() == LogFormatConsole {
 			fmt.Println(err.Error())
 		}
-		j.log.Warn().Str("job", j.Name).Str("trigger", trigger).Int("exitcode", jr.Status).Err(err).Msg("job unable to start")
+		log.Warn().Str("job", j.Name).Str("trigger", trigger).Int("exitcode", jr.Status).Err(err).Msg("job unable to start")
 		// also send this to terminal output
 		_, err = w.Write([]byte(fmt.Sprintf("job unable to start: %v", err.Error())))
 		if err != nil {
-			j.log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+			log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+		}
+
+		return jr
+	}
+
+	defer func() {
+		if err := run.done(); err != nil {
+			log.Debug().Str("job", j.Name).Err(err).Msg("could not clean up after job")
+		}
+	}()
+	untrack := j.globalSchedule.track(j.Name, proc)
+	err = cmd.Wait()
+	untrack()
+	canceled := proc.done()
+
+	// the run got called off, e.g. because the scheduler is shutting down
+	if err != nil && parent.Err() != nil {
+		jr.Status = StatusCanceled
+		jr.State = RunStateCanceled
+		msg := fmt.Sprintf("job canceled: %v", parent.Err())
+		log.Warn().Str("job", j.Name).Str("trigger", trigger).Msg(msg)
+		if _, err := w.Write([]byte(msg)); err != nil {
+			log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
 		}
+		return jr
+	}
 
+	if canceled {
+		jr.Status = StatusCanceled
+		jr.State = RunStateCanceled
+		msg := "job canceled via the api"
+		log.Warn().Str("job", j.Name).Str("trigger", trigger).Msg(msg)
+		if _, err := w.Write([]byte(msg)); err != nil {
+			log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+		}
 		return jr
 	}
 
-	if err := cmd.Wait(); err != nil {
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			jr.Status = StatusTimeout
+			jr.State = RunStateTimedOut
+			killedPids := proc.killed()
+			msg := fmt.Sprintf("job killed due to timeout after %v (killed pids: %v)", j.Timeout, killedPids)
+			log.Warn().Str("job", j.Name).Str("trigger", trigger).Dur("timeout", j.Timeout).Ints("pids", killedPids).Msg(msg)
+			if _, err := w.Write([]byte(msg)); err != nil {
+				log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+			}
+			return jr
+		}
+
 		if exitError, ok := err.(*exec.ExitError); ok {
 			jr.Status = exitError.ExitCode()
-			j.log.Warn().Str("job", j.Name).Msgf("Exit code %v", exitError.ExitCode())
+			log.Warn().Str("job", j.Name).Msgf("Exit code %v", exitError.ExitCode())
+		}
+
+		if run.failedToStart(jr.Status) {
+			jr.State = RunStateStartFailed
+			msg := fmt.Sprintf("job unable to start: %s exited with %v", command[0], jr.Status)
+			log.Warn().Str("job", j.Name).Str("trigger", trigger).Int("exitcode", jr.Status).Msg(msg)
+			if _, err := w.Write([]byte(msg)); err != nil {
+				log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+			}
+			return jr
+		}
+
+		if msg := j.limitExceeded(cmd); msg != "" {
+			jr.State = RunStateLimitExceeded
+			log.Warn().Str("job", j.Name).Str("trigger", trigger).Msg(msg)
+			if _, err := w.Write([]byte(msg)); err != nil {
+				log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+			}
+			return jr
+		}
+
+		// a process that got terminated by a signal did not exit by itself
+		jr.State = RunStateCompleted
+		if cmd.ProcessState != nil && !cmd.ProcessState.Exited() {
+			jr.State = RunStateKilled
 		}
 
 		return jr
 	}
 
-	jr.Duration = time.Since(jr.TriggeredAt)
 	jr.Status = 0
-	j.log.Debug().Str("job", j.Name).Int("exitcode", jr.Status).Msgf("job exited status: %v", jr.Status)
+	jr.State = RunStateCompleted
+	log.Debug().Str("job", j.Name).Int("exitcode", jr.Status).Msgf("job exited status: %v", jr.Status)
 
 	return jr
 }
 
+// failStart records why a run could not be started.
+func (j *JobSpec) failStart(jr *JobRun, trigger string, err error) {
+	jr.Log = fmt.Sprintf("Job unable to start: %v", err.Error())
+	jr.logBuf.WriteString(jr.Log)
+	j.log.Warn().Str("job", j.Name).Str("run_id", jr.ID).Str("trigger", trigger).Err(err).Msg(jr.Log)
+	// in JSON the warning above already says it all
+	if !j.suppressLogs() && j.cfg.logFormat() == LogFormatConsole {
+		fmt.Println(err.Error())
+	}
+}
+
+// missingValue is what text/template renders for keys that are not in the data.
+const missingValue = "<no value>"
+
+// templateFuncs returns the functions available in the templates of the job's command.
+func (j *JobSpec) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"env": os.Getenv,
+		"now": j.now,
+		// default returns def when the value is missing or empty
+		"default": func(def string, v interface{}) string {
+			if v == nil || v == "" {
+				return def
+			}
+			return fmt.Sprint(v)
+		},
+	}
+}
+
+// strictTemplates tells whether a command that fails to render should fail the run, the default.
+func (j *JobSpec) strictTemplates() bool {
+	return j.StrictTemplates == nil || *j.StrictTemplates
+}
+
+func (j *JobSpec) notifyOnCancel() bool {
+	return j.NotifyOnCancel == nil || *j.NotifyOnCancel
+}
+
+// suppressLogs tells whether the output of the job stays off stdout, the job's
+// own setting takes precedence over the global one.
+func (j *JobSpec) suppressLogs() bool {
+	if j.SuppressLogs != nil {
+		return *j.SuppressLogs
+	}
+	return j.cfg.SuppressLogs
+}
+
+// renderCommand renders the command as templates. Next to the run's parameters,
+// the templates can refer to the job's name as .Job, to what triggered the run
+// as .Trigger and to the run of the job that triggered it as .parent. Referring to a parameter that is not set is an error, use default
+// for optional parameters. Unless templates are strict, an argument that fails to
+// render is passed along as is.
+func (j *JobSpec) renderCommand(data map[string]interface{}) ([]string, error) {
+	command := make([]string, 0, len(j.Command))
+	for _, arg := range j.Command {
+		rendered, err := j.renderTemplate(arg, data)
+		if err != nil {
+			if j.strictTemplates() {
+				return nil, err
+			}
+			j.log.Warn().Str("job", j.Name).Err(err).Msg("passing argument along as is")
+			rendered = arg
+		}
+		command = append(command, rendered)
+	}
+	return command, nil
+}
+
+// workingDirectory renders the job's working directory like its command and
+// resolves it relative to the schedule file, it has to exist.
+func (j *JobSpec) workingDirectory(data map[string]interface{}) (string, error) {
+	if j.WorkingDirectory == "" {
+		return "", nil
+	}
+
+	dir, err := j.renderTemplate(j.WorkingDirectory, data)
+	if err != nil {
+		if j.strictTemplates() {
+			return "", err
+		}
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("using working directory as is")
+		dir = j.WorkingDirectory
+	}
+
+	dir = j.specPath(dir)
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "", fmt.Errorf("working directory does not exist: %s", dir)
+	case err != nil:
+		return "", fmt.Errorf("can't use working directory: %w", err)
+	case !info.IsDir():
+		return "", fmt.Errorf("working directory is not a directory: %s", dir)
+	}
+	return dir, nil
+}
+
+// stdin returns what to pass to the command on stdin, nil when the job sets nothing.
+// Inline stdin is rendered like the command, a relative stdin_file is resolved
+// against the schedule file.
+func (j *JobSpec) stdin(data map[string]interface{}) (io.ReadCloser, error) {
+	switch {
+	case j.StdinFile != "":
+		f, err := os.Open(j.specPath(j.StdinFile))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read stdin_file: %w", err)
+		}
+		return f, nil
+	case j.Stdin != "":
+		rendered, err := j.renderTemplate(j.Stdin, data)
+		if err != nil {
+			if j.strictTemplates() {
+				return nil, err
+			}
+			j.log.Warn().Str("job", j.Name).Err(err).Msg("passing stdin along as is")
+			rendered = j.Stdin
+		}
+		return io.NopCloser(strings.NewReader(rendered)), nil
+	}
+	return nil, nil
+}
+
+func (j *JobSpec) ValidateStdin() error {
+	if j.Stdin != "" && j.StdinFile != "" {
+		return fmt.Errorf("job '%s' can't have both stdin and stdin_file", j.Name)
+	}
+	return nil
+}
+
+// templateData is what the templates of a run can refer to.
+func (j *JobSpec) templateData(trigger string, parameters map[string]string) map[string]interface{} {
+	data := map[string]interface{}{}
+	for k, v := range parameters {
+		data[k] = v
+	}
+	data["Job"] = j.Name
+	data["Trigger"] = trigger
+	return data
+}
+
+func (j *JobSpec) renderTemplate(s string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("arg").Funcs(j.templateFuncs()).Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("can't parse argument '%s' as template: %w", s, err)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("can't render argument '%s': %w", s, err)
+	}
+	if j.strictTemplates() && strings.Contains(b.String(), missingValue) {
+		return "", fmt.Errorf("argument '%s' refers to a parameter that is not set", s)
+	}
+	return b.String(), nil
+}
+
+// triggerParams determines the parameters to trigger a job with after a run.
+func (j *JobSpec) triggerParams(jr *JobRun, t JobTrigger) (map[string]string, error) {
+	params := map[string]string{}
+	for k, v := range jr.Params {
+		params[k] = v
+	}
+	// the output the run captured comes along as well
+	for k, v := range outputParams(jr.Output) {
+		params[k] = v
+	}
+
+	data := j.templateData(jr.TriggeredBy, params)
+	for k, v := range t.Params {
+		rendered, err := j.renderTemplate(v, data)
+		if err != nil {
+			return nil, err
+		}
+		params[k] = rendered
+	}
+	return params, nil
+}
+
 func (j *JobSpec) loadRuns() {
 	const nRuns int = 10
-	logFn := path.Join(CheekPath(), fmt.Sprintf("%s.job.jsonl", j.Name))
-	jrs, err := readLastJobRuns(j.log, logFn, nRuns)
+	jrs, err := j.history().lastRuns(j.Name, nRuns)
 	if err != nil {
-		j.log.Warn().Str("job", j.Name).Err(err).Msgf("could not load job logs from '%s'", logFn)
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("could not load job logs")
+	}
+	// runs logged before success_exit_codes existed don't record whether they succeeded
+	for i := range jrs {
+		jrs[i].Success = j.successExitCode(jrs[i].Status)
 	}
 	j.Runs = jrs
 }
 
+// scheduled tells whether the job runs on a cron, an interval or at given timestamps.
+func (j *JobSpec) scheduled() bool {
+	return (j.Cron != "" || j.Interval > 0 || len(j.At) > 0) && !j.Disable
+}
+
+// errDisabled is the error for a disabled job that was asked to run.
+func (j *JobSpec) errDisabled() error {
+	return fmt.Errorf("job '%s' is disabled", j.Name)
+}
+
 func (j *JobSpec) setNextTick(refTime time.Time, includeRefTime bool) error {
-	if j.Cron != "" {
-		t, err := gronx.NextTickAfter(j.Cron, refTime, includeRefTime)
-		j.nextTick = t
-		return err
+	if !j.scheduled() {
+		return nil
 	}
-	return nil
+	if j.Interval > 0 {
+		j.nextTick = j.nextInterval(refTime)
+		return nil
+	}
+	if len(j.At) > 0 {
+		j.nextTick = j.nextAt(refTime, includeRefTime)
+		return nil
+	}
+
+	// a loop that runs a little behind keeps to the ticks of the cron, so that
+	// jobs that run every few seconds don't skip any
+	if !includeRefTime && !j.nextTick.IsZero() && !j.nextTick.After(refTime) && refTime.Sub(j.nextTick) < maxTickLag {
+		refTime = j.nextTick
+	}
+	// evaluate the cron string in the job's own timezone, if any
+	if j.loc != nil {
+		refTime = refTime.In(j.loc)
+	}
+	t, err := gronx.NextTickAfter(j.Cron, refTime, includeRefTime)
+	j.nextTick = t
+	return err
 }
 
+// maxTickLag is how far the scheduling loop can run behind before the ticks
+// it missed result in a single run.
+const maxTickLag = 5 * time.Second
+
+// nextRun returns when the job is due next, the scheduling loop moves this
+// along under the lock of the schedule.
+func (j *JobSpec) nextRun() time.Time {
+	if j.globalSchedule == nil {
+		return j.nextTick
+	}
+	j.globalSchedule.mu.RLock()
+	defer j.globalSchedule.mu.RUnlock()
+	return j.nextTick
+}
+
+// copy takes a copy of the specs and state of the job that can be changed or
+// read at leisure, e.g. to load its runs for display.
+func (j *JobSpec) copy() JobSpec {
+	if j.globalSchedule == nil {
+		return *j
+	}
+	j.globalSchedule.mu.RLock()
+	defer j.globalSchedule.mu.RUnlock()
+	return *j
+}
+
+// maxNextRuns bounds how many upcoming runs can be asked for at once.
+const maxNextRuns = 100
+
+// nextRuns lists the upcoming runs of the job after refTime, evaluated in the
+// job's timezone. Jobs that don't run on a cron or interval have none.
+func (j *JobSpec) nextRuns(refTime time.Time, count int) ([]time.Time, error) {
+	runs := []time.Time{}
+	if !j.scheduled() {
+		return runs, nil
+	}
+	if j.loc != nil {
+		refTime = refTime.In(j.loc)
+	}
+
+	if j.Interval > 0 {
+		// the runs after the next one of a job that counts from the end of its
+		// runs depend on how long those take, they are estimates
+		next := j.nextRun()
+		if next.IsZero() || !next.After(refTime) {
+			next = refTime.Add(j.Interval)
+		}
+		for len(runs) < count {
+			runs = append(runs, next)
+			next = next.Add(j.Interval)
+		}
+		return runs, nil
+	}
+	if len(j.At) > 0 {
+		for t := j.nextAt(refTime, false); !t.IsZero() && len(runs) < count; t = j.nextAt(t, false) {
+			runs = append(runs, t)
+		}
+		return runs, nil
+	}
+
+	for len(runs) < count {
+		t, err := gronx.NextTickAfter(j.Cron, refTime, false)
+		if err != nil {
+			return runs, err
+		}
+		runs = append(runs, t)
+		refTime = t
+	}
+	return runs, nil
+}
+
+// ValidateCron checks the cron string, disabled jobs are allowed to have an
+// invalid one. A cron string with 6 fields starts with the seconds, unless the
+// last one is a year.
 func (j *JobSpec) ValidateCron() error {
-	if j.Cron != "" {
+	if j.Cron != "" && !j.Disable {
 		gronx := gronx.New()
 		if !gronx.IsValid(j.Cron) {
 			return fmt.Errorf("cron string for job '%s' not valid", j.Name)
@@ -224,73 +1050,207 @@ func (j *JobSpec) ValidateCron() error {
 	return nil
 }
 
-func (j *JobSpec) OnEvent(jr *JobRun) {
-	var jobsToTrigger []string
-	var webhooksToCall []string
-	var slackWebhooksToCall []string
+// loadLocation resolves the job's timezone, jobs without one follow the schedule.
+func (j *JobSpec) loadLocation() error {
+	if j.TZLocation == "" {
+		j.loc = nil
+		return nil
+	}
+
+	loc, err := time.LoadLocation(j.TZLocation)
+	if err != nil {
+		return fmt.Errorf("tz '%s' for job '%s' not valid: %w", j.TZLocation, j.Name, err)
+	}
+	j.loc = loc
+	return nil
+}
+
+// successExitCode tells whether a run that ended with status succeeded.
+func (j *JobSpec) successExitCode(status int) bool {
+	if j == nil || len(j.SuccessExitCodes) == 0 {
+		return status == 0
+	}
+	for _, code := range j.SuccessExitCodes {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// succeeded tells whether the run ended with one of the success exit codes of its job.
+func (jr *JobRun) succeeded() bool {
+	return jr.jobRef.successExitCode(jr.Status)
+}
+
+// retryableExitCode tells whether a failed run that ended with status may be retried.
+func (j *JobSpec) retryableExitCode(status int) bool {
+	if len(j.RetryOnExitCodes) == 0 {
+		return true
+	}
+	for _, code := range j.RetryOnExitCodes {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *JobSpec) ValidateExitCodes() error {
+	if err := validateExitCodes(j.Name, "success_exit_codes", j.SuccessExitCodes); err != nil {
+		return err
+	}
+	return validateExitCodes(j.Name, "retry_on_exit_codes", j.RetryOnExitCodes)
+}
+
+func validateExitCodes(job string, key string, codes []int) error {
+	for _, code := range codes {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("%s for job '%s' should be between 0 and 255, got %v", key, job, code)
+		}
+	}
+	return nil
+}
+
+func (j *JobSpec) ValidateRetries() error {
+	switch j.RetryBackoff {
+	case "", RetryBackoffFixed, RetryBackoffExponential:
+	default:
+		return fmt.Errorf("retry_backoff for job '%s' should be one of '%s' or '%s', got '%s'", j.Name, RetryBackoffFixed, RetryBackoffExponential, j.RetryBackoff)
+	}
+
+	if j.RetryDelay < 0 || j.RetryMaxDelay < 0 {
+		return fmt.Errorf("retry delays for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
 
-	switch jr.Status == 0 {
-	case true: // after success
-		jobsToTrigger = j.OnSuccess.TriggerJob
-		webhooksToCall = j.OnSuccess.NotifyWebhook
-		slackWebhooksToCall = j.OnSuccess.NotifySlackWebhook
-		if j.globalSchedule != nil {
-			jobsToTrigger = append(jobsToTrigger, j.globalSchedule.OnSuccess.TriggerJob...)
-			webhooksToCall = append(webhooksToCall, j.globalSchedule.OnSuccess.NotifyWebhook...)
-			slackWebhooksToCall = append(slackWebhooksToCall, j.globalSchedule.OnSuccess.NotifySlackWebhook...)
+// resolveTriggers determines the jobs that an event of a run triggers and records them on the run.
+func (j *JobSpec) resolveTriggers(jr *JobRun, event OnEvent) {
+	for _, t := range event.TriggerJob {
+		tj, ok := j.globalSchedule.job(t.Name)
+		if !ok {
+			// the schedule got reloaded while this run was in flight
+			j.log.Warn().Str("job", j.Name).Str("on_event", "job_trigger").Msgf("cannot find job '%s' to trigger", t.Name)
+			continue
+		}
+		if tj.Disable {
+			j.log.Warn().Str("job", j.Name).Str("on_event", "job_trigger").Msgf("not triggering job '%s' as it is disabled", t.Name)
+			continue
+		}
+		if _, paused := j.globalSchedule.pausedSince(t.Name); paused {
+			j.log.Warn().Str("job", j.Name).Str("on_event", "job_trigger").Msgf("not triggering job '%s' as it is paused", t.Name)
+			continue
+		}
+		req := runRequest{id: newRunID(), trigger: fmt.Sprintf("job[%s]", j.Name), depth: jr.TriggerDepth + 1, parentID: jr.ID, parent: jr.asParent()}
+		if maxDepth := j.globalSchedule.maxTriggerDepth(); jr.TriggerDepth >= maxDepth {
+			tj.skipRun(req, fmt.Sprintf("skipped: max trigger depth of %v reached", maxDepth))
+			continue
+		}
+		params, err := j.triggerParams(jr, t)
+		if err != nil {
+			j.log.Warn().Str("job", j.Name).Str("on_event", "job_trigger").Err(err).Msgf("cannot determine params to trigger job '%s' with", t.Name)
+			continue
 		}
-	case false: // after error
-		jobsToTrigger = j.OnError.TriggerJob
-		webhooksToCall = j.OnError.NotifyWebhook
-		slackWebhooksToCall = j.OnError.NotifySlackWebhook
-		if j.globalSchedule != nil {
-			jobsToTrigger = append(jobsToTrigger, j.globalSchedule.OnError.TriggerJob...)
-			webhooksToCall = append(webhooksToCall, j.globalSchedule.OnError.NotifyWebhook...)
-			slackWebhooksToCall = append(slackWebhooksToCall, j.globalSchedule.OnError.NotifySlackWebhook...)
+		req.params = params
+
+		pt := pendingTrigger{job: tj, req: req}
+		jr.triggers = append(jr.triggers, pt)
+		jr.Triggered = append(jr.Triggered, t.Name)
+		jr.TriggeredRunIDs = append(jr.TriggeredRunIDs, req.id)
+	}
+}
+
+func (j *JobSpec) OnEvent(ctx context.Context, jr *JobRun) {
+	j.fireEvent(ctx, jr, j.eventFor(jr))
+}
+
+// fireEvent launches the actions of an event, jobs to trigger should already be resolved.
+// Triggered jobs go through the same checks as jobs that are due, e.g. their
+// concurrency policy. They and notifications get called off once ctx is done.
+// Unless the event is async, fireEvent waits for its actions to complete.
+func (j *JobSpec) fireEvent(ctx context.Context, jr *JobRun, event OnEvent) {
+	if event.Async {
+		if !event.empty() {
+			j.log.Debug().Str("job", j.Name).Str("run_id", jr.ID).Bool("async", true).Msg("not waiting for the actions of the event")
 		}
+		j.globalSchedule.detach(func() { j.fireActions(ctx, jr, event) })
+		return
 	}
 
+	if !event.empty() {
+		j.log.Debug().Str("job", j.Name).Str("run_id", jr.ID).Bool("async", false).Msg("waiting for the actions of the event")
+	}
+	j.fireActions(ctx, jr, event)
+}
+
+// fireActions triggers the jobs and sends the notifications of an event and
+// waits for them.
+func (j *JobSpec) fireActions(ctx context.Context, jr *JobRun, event OnEvent) {
 	var wg sync.WaitGroup
 
-	for _, tn := range jobsToTrigger {
-		tj := j.globalSchedule.Jobs[tn]
+	for _, pt := range jr.triggers {
+		if ctx.Err() != nil {
+			j.log.Warn().Str("job", j.Name).Str("on_event", "job_trigger").Err(ctx.Err()).Msgf("not triggering %s", pt.job.Name)
+			continue
+		}
 		j.log.Debug().Str("job", j.Name).Str("on_event", "job_trigger").Msg("triggered by parent job")
 		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
+		go func(wg *sync.WaitGroup, pt pendingTrigger) {
 			defer wg.Done()
-			tj.execCommandWithRetry(fmt.Sprintf("job[%s]", j.Name))
-		}(&wg)
+			pt.job.dispatch(ctx, pt.req)
+		}(&wg, pt)
 	}
 
-	// trigger webhooks
-	for _, wu := range webhooksToCall {
-		j.log.Debug().Str("job", j.Name).Str("on_event", "webhook_call").Msg("triggered by parent job")
-		wg.Add(1)
-		go func(wg *sync.WaitGroup, webhookURL string) {
-			defer wg.Done()
-			resp_body, err := JobRunWebhookCall(jr, webhookURL, "generic")
-			if err != nil {
-				j.log.Warn().Str("job", j.Name).Str("on_event", "webhook").Err(err).Msg("webhook notify failed")
-			}
-			j.log.Debug().Str("job", jr.Name).Str("webhook_call", "response").Str("webhook_url", webhookURL).Msg(string(resp_body))
-		}(&wg, wu)
+	j.notify(ctx, jr, event)
+
+	// a retry still holds on to the room of the run, which the triggered jobs might be waiting for
+	if jr.retrying {
+		return
 	}
+	wg.Wait() // this allows to wait for go routines when running just the job exec
+}
 
-	// trigger slack webhooks - this feels like a lot of duplication
-	for _, wu := range slackWebhooksToCall {
-		j.log.Debug().Str("job", j.Name).Str("on_event", "slack_webhook_call").Msg("triggered by parent job")
-		wg.Add(1)
-		go func(wg *sync.WaitGroup, webhookURL string) {
-			defer wg.Done()
-			resp_body, err := JobRunWebhookCall(jr, webhookURL, "slack")
-			if err != nil {
-				j.log.Warn().Str("job", j.Name).Str("on_event", "webhook").Err(err).Msg("webhook notify failed")
-			}
-			j.log.Debug().Str("job", jr.Name).Str("webhook_call", "response").Str("webhook_url", webhookURL).Msg(string(resp_body))
-		}(&wg, wu)
+// MarshalJSON adds the next scheduled run, since when the job is paused or its
+// circuit is open and whether a one-shot job is done to the job's JSON
+// representation.
+func (j *JobSpec) MarshalJSON() ([]byte, error) {
+	type jobSpec JobSpec // prevents recursion
+	out := struct {
+		*jobSpec
+		NextRun          *time.Time `json:"next_run,omitempty"`
+		PausedSince      *time.Time `json:"paused_since,omitempty"`
+		CircuitOpenSince *time.Time `json:"circuit_open_since,omitempty"`
+		Completed        bool       `json:"completed,omitempty"`
+	}{jobSpec: (*jobSpec)(j)}
+
+	if next := j.nextRun(); !next.IsZero() {
+		out.NextRun = &next
+	} else {
+		out.Completed = len(j.At) > 0 && !j.Disable
+	}
+	if since, ok := j.globalSchedule.pausedSince(j.Name); ok {
+		out.PausedSince = &since
+	}
+	if since, ok := j.health.circuitOpenSince(j); ok {
+		out.CircuitOpenSince = &since
 	}
 
-	wg.Wait() // this allows to wait for go routines when running just the job exec
+	return json.Marshal(out)
+}
+
+// MarshalYAML adds the next scheduled run to the job's YAML representation.
+func (j JobSpec) MarshalYAML() (interface{}, error) {
+	type jobSpec JobSpec // prevents recursion
+	out := struct {
+		jobSpec `yaml:",inline"`
+		NextRun *time.Time `yaml:"next_run,omitempty"`
+	}{jobSpec: jobSpec(j)}
+
+	if !j.nextTick.IsZero() {
+		out.NextRun = &j.nextTick
+	}
+	return out, nil
 }
 
 func (j JobSpec) ToYAML(includeRuns bool) (string, error) {
@@ -305,20 +1265,46 @@ func (j JobSpec) ToYAML(includeRuns bool) (string, error) {
 	return string(yData), nil
 }
 
-// RunJob allows to run a specific job
-func RunJob(log zerolog.Logger, cfg Config, scheduleFn string, jobName string) (JobRun, error) {
+// RunJob allows to run a specific job of the schedule in the given file, see Schedule.RunJob.
+func RunJob(log zerolog.Logger, cfg Config, scheduleFn string, jobName string, params map[string]string) (JobRun, error) {
 	s, err := loadSchedule(log, cfg, scheduleFn)
 	if err != nil {
-		fmt.Printf("error loading schedule: %s\n", err)
-		os.Exit(1)
+		return JobRun{}, fmt.Errorf("error loading schedule: %w", err)
+	}
+	stopTracing := startTracing(log)
+	defer stopTracing()
+	return s.RunJob(context.Background(), jobName, params)
+}
+
+// RunJob runs a job of the schedule like a manual trigger does, with params
+// available to its templates. The run gets retried and respects the concurrency
+// settings like any other run. A run that fails or gets skipped is returned
+// together with an error, so that its log can be inspected. Canceling ctx
+// cancels the run.
+func (s *Schedule) RunJob(ctx context.Context, jobName string, params map[string]string) (JobRun, error) {
+	if err := s.prepare(); err != nil {
+		return JobRun{}, err
 	}
-	for _, job := range s.Jobs {
-		if job.Name == jobName {
-			jr := job.execCommand("manual")
-			job.finalize(&jr)
-			return jr, nil
+	job, ok := s.job(jobName)
+	if !ok {
+		if s.fn == "" {
+			return JobRun{}, fmt.Errorf("cannot find job %s in schedule", jobName)
 		}
+		return JobRun{}, fmt.Errorf("cannot find job %s in schedule %s", jobName, s.fn)
+	}
+	if job.Disable {
+		return JobRun{}, job.errDisabled()
 	}
 
-	return JobRun{}, fmt.Errorf("cannot find job %s in schedule %s", jobName, scheduleFn)
+	if params == nil {
+		params = map[string]string{}
+	}
+	jr := job.dispatch(ctx, runRequest{id: newRunID(), trigger: "manual", params: params})
+	if jr.State == RunStateSkipped {
+		return jr, fmt.Errorf("job %s did not run, %s", jobName, jr.Log)
+	}
+	if !jr.succeeded() {
+		return jr, fmt.Errorf("job %s failed with exit code %v", jobName, jr.Status)
+	}
+	return jr, nil
 }
@@ -1,13 +1,17 @@
 package cheek
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
@@ -26,7 +30,7 @@ func TestLoadLogs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	jr := j.execCommandWithRetry("test")
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
 	jr.logToDisk()
 
 	// log loading goes on job name basis
@@ -47,7 +51,7 @@ func TestJobRun(t *testing.T) {
 		cfg:     NewConfig(),
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 	assert.Equal(t, jr.Status, 0)
 }
 
@@ -63,7 +67,7 @@ func TestSpecialCron(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 	assert.Equal(t, jr.Status, 0)
 }
 
@@ -111,7 +115,7 @@ env:
 		t.Fatal("should contain foo")
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 
 	jr.flushLogBuffer()
 
@@ -130,7 +134,7 @@ func TestStdErrOut(t *testing.T) {
 		cfg: cfg,
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 	jr.flushLogBuffer()
 	assert.Contains(t, jr.Log, "stdout")
 	assert.Contains(t, jr.Log, "stderr")
@@ -148,7 +152,7 @@ func TestFailingLog(t *testing.T) {
 		cfg: cfg,
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 	jr.flushLogBuffer()
 	assert.Contains(t, jr.Log, "this fails")
 }
@@ -160,7 +164,7 @@ func TestJobRunNoCommand(t *testing.T) {
 		cfg:  NewConfig(),
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 	assert.NotEqual(t, jr.Status, 0)
 }
 
@@ -174,7 +178,7 @@ func TestJobNonZero(t *testing.T) {
 		cfg: NewConfig(),
 	}
 
-	jr := j.execCommand("test")
+	jr := j.execCommand(context.Background(), "test", nil)
 	assert.NotEqual(t, jr.Status, 0)
 }
 
@@ -192,7 +196,7 @@ func TestJobRunInvalidSchedule(t *testing.T) {
 	assert.Error(t, s.initialize())
 	// fix cron but add invalid ref
 	s.Jobs["Bertha"].Cron = "* * * * *"
-	s.Jobs["Bertha"].OnSuccess.TriggerJob = []string{"IDontExist"}
+	s.Jobs["Bertha"].OnSuccess.TriggerJob = []JobTrigger{{Name: "IDontExist"}}
 
 	assert.Error(t, s.initialize())
 }
@@ -215,11 +219,11 @@ func TestOnEventWebhook(t *testing.T) {
 		Command: []string{"echo"},
 		cfg:     NewConfig(),
 		OnSuccess: OnEvent{
-			NotifyWebhook: []string{testServer.URL},
+			NotifyWebhook: []Webhook{{URL: testServer.URL}},
 		},
 	}
-	jr := j.execCommand("test")
-	j.OnEvent(&jr)
+	jr := j.execCommand(context.Background(), "test", nil)
+	j.OnEvent(context.Background(), &jr)
 }
 
 func TestStringArray(t *testing.T) {
@@ -248,7 +252,7 @@ func TestStringArray(t *testing.T) {
 		}
 
 		j.cfg = NewConfig()
-		jr := j.execCommand("test")
+		jr := j.execCommand(context.Background(), "test", nil)
 
 		jr.flushLogBuffer()
 		assert.Equal(t, jr.Status, scenario.expectedStatus)
@@ -261,18 +265,491 @@ func TestStandaloneJobRun(t *testing.T) {
 	log := NewLogger("debug", b, os.Stdout)
 	cfg := NewConfig()
 
-	jr, err := RunJob(log, cfg, "../testdata/jobs1.yaml", "bar")
+	jr, err := RunJob(log, cfg, "../testdata/jobs1.yaml", "bar", nil)
 	assert.NoError(t, err)
 	assert.Contains(t, b.String(), "\"job\":\"bar\",\"trigger\":\"manual\"")
 	assert.Contains(t, jr.Log, "bar_foo")
 }
 
+func TestStandaloneJobRunErrors(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	log := NewLogger("debug", new(tsBuffer))
+
+	// a schedule that can't be loaded is an error rather than an exit
+	_, err := RunJob(log, cfg, "../testdata/not-exists.yaml", "bar", nil)
+	assert.ErrorContains(t, err, "error loading schedule")
+
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	specs := "jobs:\n  greet:\n    command: [echo, \"hello {{ .name }}\"]\n  fail:\n    command: [sh, -c, \"echo oops; exit 3\"]\n"
+	if err := os.WriteFile(fn, []byte(specs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := RunJob(log, cfg, fn, "greet", map[string]string{"name": "world"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world\n", jr.Log)
+
+	// a failed run comes with its log
+	jr, err = RunJob(log, cfg, fn, "fail", nil)
+	assert.EqualError(t, err, "job fail failed with exit code 3")
+	assert.Equal(t, 3, jr.Status)
+	assert.Equal(t, "oops\n", jr.Log)
+}
+
 func TestWorkingDir(t *testing.T) {
 	b := new(tsBuffer)
 	log := NewLogger("debug", b, os.Stdout)
 	cfg := NewConfig()
 
-	jr, err := RunJob(log, cfg, "../testdata/readme_example.yaml", "other_workingdir")
+	jr, err := RunJob(log, cfg, "../testdata/readme_example.yaml", "other_workingdir", nil)
 	assert.NoError(t, err)
 	assert.Contains(t, jr.Log, "/testdata")
 }
+
+func TestWorkingDirResolution(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "jobs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// relative to the schedule file rather than the current directory
+	j := &JobSpec{
+		Name:             "test",
+		Command:          []string{"pwd"},
+		WorkingDirectory: "jobs",
+		globalSchedule:   &Schedule{fn: filepath.Join(dir, "schedule.yaml"), loc: time.Local},
+		cfg:              cfg,
+	}
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Contains(t, jr.Log, filepath.Join(dir, "jobs"))
+
+	// rendered like the command
+	t.Setenv("CHEEK_TEST_JOBS_DIR", dir)
+	j.WorkingDirectory = `{{ env "CHEEK_TEST_JOBS_DIR" }}/{{ .sub }}`
+	jr = j.execCommand(context.Background(), "test", map[string]string{"sub": "jobs"})
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Contains(t, jr.Log, filepath.Join(dir, "jobs"))
+
+	// a missing parameter fails the run
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+
+	j.WorkingDirectory = "missing"
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "working directory does not exist: "+filepath.Join(dir, "missing"))
+}
+
+func TestStdin(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	dir := t.TempDir()
+
+	j := &JobSpec{
+		Name:           "test",
+		Command:        []string{"cat"},
+		Stdin:          "SELECT * FROM {{ .table }};\n",
+		globalSchedule: &Schedule{fn: filepath.Join(dir, "schedule.yaml"), loc: time.Local},
+		cfg:            cfg,
+	}
+	assert.NoError(t, j.ValidateStdin())
+
+	jr := j.execCommand(context.Background(), "test", map[string]string{"table": "users"})
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, "SELECT * FROM users;\n", jr.Log)
+
+	// a relative stdin_file is read from next to the schedule file
+	if err := os.WriteFile(filepath.Join(dir, "query.sql"), []byte("SELECT 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	j.Stdin = ""
+	j.StdinFile = "query.sql"
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, "SELECT 1;\n", jr.Log)
+
+	// a missing file fails the run before it starts
+	j.StdinFile = "missing.sql"
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "cannot read stdin_file")
+	assert.Error(t, j.ValidateEnvFiles())
+
+	// without stdin the command gets nothing to read
+	j.StdinFile = ""
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Empty(t, jr.Log)
+
+	j.Stdin = "foo"
+	j.StdinFile = "query.sql"
+	assert.Error(t, j.ValidateStdin())
+}
+
+func TestJobTimeout(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sleep", "5"},
+		Timeout: 100 * time.Millisecond,
+		cfg:     cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, StatusTimeout, jr.Status)
+	assert.Contains(t, jr.Log, "killed due to timeout")
+
+	// timeout from yaml spec
+	jobSpec := []byte(`
+command: echo foo
+timeout: 10m
+`)
+	j = &JobSpec{}
+	if err := yaml.Unmarshal(jobSpec, j); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 10*time.Minute, j.Timeout)
+}
+
+func TestRetryDelay(t *testing.T) {
+	j := &JobSpec{Name: "test"}
+	assert.Equal(t, 5*time.Second, j.retryDelay(1))
+	assert.Equal(t, 5*time.Second, j.retryDelay(3))
+
+	j.RetryDelay = time.Second
+	j.RetryBackoff = RetryBackoffExponential
+	assert.Equal(t, 1*time.Second, j.retryDelay(1))
+	assert.Equal(t, 2*time.Second, j.retryDelay(2))
+	assert.Equal(t, 8*time.Second, j.retryDelay(4))
+
+	j.RetryMaxDelay = 3 * time.Second
+	assert.Equal(t, 3*time.Second, j.retryDelay(4))
+	assert.Equal(t, 3*time.Second, j.retryDelay(100))
+
+	j.RetryBackoff = "random"
+	assert.Error(t, j.ValidateRetries())
+}
+
+func TestParamsTemplating(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:     "test_params",
+		Command:  []string{"echo", "hello {{ .name }}"},
+		inFlight: newRunTracker(),
+		cfg:      cfg,
+	}
+
+	j.execScheduled(context.Background(), "cron", map[string]string{"name": "cheek"})
+	j.loadRuns()
+	assert.Equal(t, 0, j.Runs[0].Status)
+	assert.Equal(t, "cron", j.Runs[0].TriggeredBy)
+	assert.Equal(t, "hello cheek\n", j.Runs[0].Log)
+	assert.Equal(t, "cheek", j.Runs[0].Params["name"])
+
+	// cron runs come with an empty parameter map
+	j.Command = []string{"echo", "hello {{ default \"world\" .name }}"}
+	j.execScheduled(context.Background(), "cron", map[string]string{})
+	j.loadRuns()
+	assert.Equal(t, 0, j.Runs[0].Status)
+	assert.Equal(t, "hello world\n", j.Runs[0].Log)
+	assert.Empty(t, j.Runs[0].Params)
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("CHEEK_TEST_TEA", "green")
+	j := &JobSpec{
+		Name:           "test_funcs",
+		Command:        []string{"{{ .cmd }}", "{{ env \"CHEEK_TEST_TEA\" }}", "{{ now.Format \"2006\" }}", "{{ .Job }}/{{ .Trigger }}"},
+		globalSchedule: &Schedule{loc: time.Local},
+	}
+
+	command, err := j.renderCommand(j.templateData("cron", map[string]string{"cmd": "echo"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo", "green", time.Now().Format("2006"), "test_funcs/cron"}, command)
+
+	// a parameter that is not set fails the run
+	jr := j.execCommand(context.Background(), "cron", nil)
+	assert.Equal(t, -1, jr.Status)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "refers to a parameter that is not set")
+}
+
+func TestStrictTemplates(t *testing.T) {
+	j := &JobSpec{
+		Name:           "test_strict",
+		globalSchedule: &Schedule{loc: time.Local},
+	}
+
+	strict := false
+	for _, strictTemplates := range []*bool{nil, &strict} {
+		j.StrictTemplates = strictTemplates
+
+		// malformed template
+		j.Command = []string{"echo", "{{ .date"}
+		command, err := j.renderCommand(j.templateData("test", nil))
+		if j.strictTemplates() {
+			assert.ErrorContains(t, err, "can't parse argument '{{ .date'")
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"echo", "{{ .date"}, command)
+		}
+
+		// missing key
+		j.Command = []string{"echo", "{{ .date }}"}
+		command, err = j.renderCommand(j.templateData("test", nil))
+		if j.strictTemplates() {
+			assert.ErrorContains(t, err, "refers to a parameter that is not set")
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"echo", "<no value>"}, command)
+		}
+
+		// failing function
+		j.Command = []string{"echo", "{{ now.Format }}"}
+		command, err = j.renderCommand(j.templateData("test", nil))
+		if j.strictTemplates() {
+			assert.ErrorContains(t, err, "can't render argument")
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"echo", "{{ now.Format }}"}, command)
+		}
+	}
+
+	// the run fails with a clear message
+	j.StrictTemplates = nil
+	j.Command = []string{"rm", "-rf", "/tmp/{{ .date }"}
+	jr := j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.NotEqual(t, 0, jr.Status)
+	assert.Contains(t, jr.Log, "Job unable to start: can't parse argument '/tmp/{{ .date }'")
+}
+
+func TestDurationOnFailure(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sh", "-c", "sleep 0.1; exit 3"},
+		cfg:     cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, 3, jr.Status)
+	assert.Greater(t, jr.Duration, 100*time.Millisecond)
+
+	// unable to start
+	j.Command = []string{"this fails"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.NotEqual(t, 0, jr.Status)
+	assert.Greater(t, jr.Duration, time.Duration(0))
+}
+
+func TestRunState(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	for _, scenario := range []struct {
+		command       []string
+		timeout       time.Duration
+		expectedState string
+	}{
+		{command: []string{"echo", "foo"}, expectedState: RunStateCompleted},
+		{command: []string{"sh", "-c", "exit 1"}, expectedState: RunStateCompleted},
+		{command: []string{"this fails"}, expectedState: RunStateStartFailed},
+		{command: []string{}, expectedState: RunStateStartFailed},
+		{command: []string{"sleep", "5"}, timeout: 100 * time.Millisecond, expectedState: RunStateTimedOut},
+		{command: []string{"sh", "-c", "kill -9 $$"}, expectedState: RunStateKilled},
+	} {
+		j := &JobSpec{
+			Name:    "test",
+			Command: scenario.command,
+			Timeout: scenario.timeout,
+			cfg:     cfg,
+		}
+
+		jr := j.execCommand(context.Background(), "test", nil)
+		assert.Equal(t, scenario.expectedState, jr.State, scenario.command)
+	}
+}
+
+func TestTriggerJobParams(t *testing.T) {
+	specs := []byte(`
+jobs:
+  test_fwd_parent:
+    command: echo parent
+    on_success:
+      trigger_job:
+        - test_fwd_plain
+        - name: test_fwd_load
+          params:
+            day: "{{ .date }}-01"
+  test_fwd_plain:
+    command: [echo, "{{ .date }}"]
+  test_fwd_load:
+    command: [echo, "{{ .date }} {{ .day }}"]
+`)
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	if err := os.WriteFile(fn, specs, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(NewLogger("debug", new(tsBuffer)), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	triggers := s.Jobs["test_fwd_parent"].OnSuccess.TriggerJob
+	assert.Equal(t, []JobTrigger{{Name: "test_fwd_plain"}, {Name: "test_fwd_load", Params: map[string]string{"day": "{{ .date }}-01"}}}, triggers)
+
+	// plain triggers are written back as just the job name
+	out, err := yaml.Marshal(triggers)
+	assert.NoError(t, err)
+	assert.Equal(t, "- test_fwd_plain\n- name: test_fwd_load\n  params:\n    day: '{{ .date }}-01'\n", string(out))
+
+	s.Jobs["test_fwd_parent"].execCommandWithRetry(context.Background(), "manual", map[string]string{"date": "2023-04"})
+
+	s.Jobs["test_fwd_plain"].loadRuns()
+	assert.Equal(t, "2023-04\n", s.Jobs["test_fwd_plain"].Runs[0].Log)
+	s.Jobs["test_fwd_load"].loadRuns()
+	assert.Equal(t, "2023-04 2023-04-01\n", s.Jobs["test_fwd_load"].Runs[0].Log)
+	assert.Equal(t, "job[test_fwd_parent]", s.Jobs["test_fwd_load"].Runs[0].TriggeredBy)
+}
+
+func TestTriggeredRecorded(t *testing.T) {
+	specs := []byte(`
+jobs:
+  test_rec_parent:
+    command: echo parent
+    on_success:
+      trigger_job: [test_rec_child, test_rec_other]
+  test_rec_child:
+    command: echo child
+  test_rec_other:
+    command: echo other
+`)
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	if err := os.WriteFile(fn, specs, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(NewLogger("debug", new(tsBuffer)), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := s.Jobs["test_rec_parent"]
+	jr := parent.execCommandWithRetry(context.Background(), "manual", nil)
+	assert.Equal(t, []string{"test_rec_child", "test_rec_other"}, jr.Triggered)
+
+	// the triggered jobs and their run ids are on disk with the parent run
+	parent.loadRuns()
+	assert.Equal(t, []string{"test_rec_child", "test_rec_other"}, parent.Runs[0].Triggered)
+	for i, name := range parent.Runs[0].Triggered {
+		s.Jobs[name].loadRuns()
+		assert.Equal(t, parent.Runs[0].TriggeredRunIDs[i], s.Jobs[name].Runs[0].ID)
+	}
+}
+
+func TestDisabledJob(t *testing.T) {
+	specs := []byte(`
+jobs:
+  test_dis_parent:
+    command: echo parent
+    run_on_start: true
+    on_success:
+      trigger_job: [test_dis_off, test_dis_on]
+  test_dis_off:
+    command: echo off
+    cron: "* * *"
+    run_on_start: true
+    disable: true
+  test_dis_on:
+    command: echo on
+`)
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	if err := os.WriteFile(fn, specs, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	// a disabled job can have an invalid cron
+	s, err := loadSchedule(NewLogger("debug", new(tsBuffer)), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, s.dueJobs(time.Now().Add(time.Hour)))
+	assert.Equal(t, maxSleep, s.untilNextTick(time.Now()))
+	assert.Len(t, s.startupJobs(), 1)
+
+	// it does not get triggered by other jobs
+	jr := s.Jobs["test_dis_parent"].execCommandWithRetry(context.Background(), "manual", nil)
+	assert.Equal(t, []string{"test_dis_on"}, jr.Triggered)
+
+	// nor manually
+	_, err = RunJob(NewLogger("debug", new(tsBuffer)), cfg, fn, "test_dis_off", nil)
+	assert.ErrorContains(t, err, "job 'test_dis_off' is disabled")
+
+	handler := setupMux(s)
+	for _, p := range []string{"/trigger/test_dis_off", "/jobs/test_dis_off/trigger"} {
+		req := httptest.NewRequest("POST", p, nil)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusConflict, resp.Code, p)
+		assert.Contains(t, resp.Body.String(), "is disabled", p)
+	}
+
+	// but it is listed with the schedule
+	req := httptest.NewRequest("GET", "/schedule/", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), `"disable":true`)
+}
+
+func TestNextRuns(t *testing.T) {
+	j := &JobSpec{Name: "test_next_runs", Cron: "30 9 * * 1-5", TZLocation: "America/New_York"}
+	assert.NoError(t, j.loadLocation())
+
+	// friday evening in brussels, next runs are on weekdays in new york
+	refTime := time.Date(2023, 3, 10, 18, 0, 0, 0, time.FixedZone("CET", 3600))
+	runs, err := j.nextRuns(refTime, 3)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 3)
+	for i, day := range []int{13, 14, 15} {
+		assert.Equal(t, time.Date(2023, 3, day, 9, 30, 0, 0, j.loc), runs[i])
+	}
+
+	// the next run shows up in the job's specs
+	assert.NoError(t, j.setNextTick(refTime, false))
+	specs, err := j.ToYAML(false)
+	assert.NoError(t, err)
+	assert.Contains(t, specs, "next_run: 2023-03-13T09:30:00-04:00")
+
+	j.Disable = true
+	runs, err = j.nextRuns(refTime, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, runs)
+
+	handler := setupMux(&Schedule{Jobs: map[string]*JobSpec{j.Name: {Name: j.Name, Cron: "0 * * * *"}}, cfg: NewConfig()})
+	for query, code := range map[string]int{"": http.StatusOK, "?count=100": http.StatusOK, "?count=0": http.StatusBadRequest, "?count=x": http.StatusBadRequest} {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/test_next_runs/next"+query, nil))
+		assert.Equal(t, code, resp.Code, query)
+	}
+}
@@ -0,0 +1,37 @@
+package cheek
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// RunStateLimitExceeded is the state of a run that got killed for exceeding its resource limits.
+const RunStateLimitExceeded string = "limit_exceeded"
+
+// hasResourceLimits tells whether the job sets any resource limits.
+func (j *JobSpec) hasResourceLimits() bool {
+	return j.Nice != 0 || j.MemoryLimit != 0 || j.CPULimit != 0
+}
+
+// ValidateResourceLimits checks the resource limits of a job, they only warn on
+// platforms that don't support them as they get ignored there.
+func (j *JobSpec) ValidateResourceLimits() error {
+	if j.Nice < -20 || j.Nice > 19 {
+		return fmt.Errorf("nice for job '%s' should be between -20 and 19, got %v", j.Name, j.Nice)
+	}
+	if j.MemoryLimit < 0 {
+		return fmt.Errorf("memory_limit for job '%s' cannot be negative", j.Name)
+	}
+	if j.CPULimit < 0 {
+		return fmt.Errorf("cpu_limit for job '%s' cannot be negative", j.Name)
+	}
+	if j.CPULimit > 0 && j.CPULimit < time.Second {
+		return fmt.Errorf("cpu_limit for job '%s' should be at least 1s", j.Name)
+	}
+
+	if !resourceLimitsSupported && j.hasResourceLimits() {
+		j.log.Warn().Str("job", j.Name).Msgf("nice, memory_limit and cpu_limit are not supported on %s and get ignored", runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cheek
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const resourceLimitsSupported = true
+
+// exit codes of the shell when it cannot exec the command it got passed
+const (
+	shellCannotExecute = 126
+	shellNotFound      = 127
+)
+
+// limitCommand wraps the command of a job in a shell that applies its resource
+// limits before it execs the command, so that they hold from its first instruction
+// on and get inherited by everything it spawns.
+func (j *JobSpec) limitCommand(command []string) []string {
+	if !j.hasResourceLimits() {
+		return command
+	}
+
+	limits := []string{}
+	if j.MemoryLimit > 0 {
+		// in KiB, rounded up
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", (j.MemoryLimit+1023)/1024))
+	}
+	if j.CPULimit > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", int64((j.CPULimit+time.Second-1)/time.Second)))
+	}
+	run := `exec "$@"`
+	if j.Nice != 0 {
+		run = fmt.Sprintf(`exec nice -n %d "$@"`, j.Nice)
+	}
+	script := strings.Join(append(limits, run), " && ")
+
+	return append([]string{"/bin/sh", "-c", script, "cheek"}, command...)
+}
+
+// limitedExecFailed tells whether the shell that applies the resource limits
+// of the job exited because it could not exec the job's command.
+func (j *JobSpec) limitedExecFailed(status int) bool {
+	return j.hasResourceLimits() && (status == shellCannotExecute || status == shellNotFound)
+}
+
+// limitExceeded explains how the command of a job got killed for exceeding its
+// resource limits, it returns an empty string when that is not the case.
+func (j *JobSpec) limitExceeded(cmd *exec.Cmd) string {
+	if cmd.ProcessState == nil {
+		return ""
+	}
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+
+	switch sig := ws.Signal(); {
+	case j.CPULimit > 0 && (sig == syscall.SIGXCPU || sig == syscall.SIGKILL):
+		return fmt.Sprintf("job killed by %v after exceeding its cpu_limit of %v", sig, j.CPULimit)
+	case j.MemoryLimit > 0 && (sig == syscall.SIGKILL || sig == syscall.SIGSEGV || sig == syscall.SIGABRT || sig == syscall.SIGBUS):
+		return fmt.Sprintf("job killed by %v, most likely after running out of its memory_limit of %v bytes", sig, j.MemoryLimit)
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package cheek
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceLimits(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:        "test",
+		Command:     []string{"sh", "-c", "ulimit -v; ulimit -t; nice"},
+		Nice:        5,
+		MemoryLimit: 100 * 1024 * 1024,
+		CPULimit:    90 * time.Second,
+		cfg:         cfg,
+	}
+	assert.NoError(t, j.ValidateResourceLimits())
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, []string{"102400", "90", "5"}, strings.Fields(jr.Log))
+
+	// a command that cannot be found did not start, rather than exit with 127
+	j.Command = []string{"cheek-test-does-not-exist"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, 127, jr.Status)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+
+	// without limits the command runs as is
+	assert.Equal(t, []string{"true"}, (&JobSpec{}).limitCommand([]string{"true"}))
+}
+
+func TestCPULimitExceeded(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:     "test",
+		Command:  []string{"sh", "-c", "while :; do :; done"},
+		CPULimit: time.Second,
+		Timeout:  10 * time.Second,
+		cfg:      cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, RunStateLimitExceeded, jr.State)
+	assert.Contains(t, jr.Log, "exceeding its cpu_limit of 1s")
+}
+
+func TestMemoryLimitExceeded(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	// the kernel kills processes that can't get the memory they need, or they abort
+	j := &JobSpec{
+		Name:        "test",
+		Command:     []string{"sh", "-c", "kill -KILL $$"},
+		MemoryLimit: 100 * 1024 * 1024,
+		cfg:         cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, RunStateLimitExceeded, jr.State)
+	assert.Contains(t, jr.Log, "running out of its memory_limit")
+
+	// a signal is not blamed on limits that are not set
+	j.MemoryLimit = 0
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateKilled, jr.State)
+}
+
+func TestValidateResourceLimits(t *testing.T) {
+	for _, j := range []*JobSpec{{Nice: 20}, {Nice: -21}, {MemoryLimit: -1}, {CPULimit: -time.Second}, {CPULimit: time.Millisecond}} {
+		assert.Error(t, j.ValidateResourceLimits())
+	}
+}
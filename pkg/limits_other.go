@@ -0,0 +1,22 @@
+//go:build !linux
+
+package cheek
+
+import "os/exec"
+
+const resourceLimitsSupported = false
+
+// limitCommand leaves the command as is, resource limits are only supported on linux.
+func (j *JobSpec) limitCommand(command []string) []string {
+	return command
+}
+
+// limitedExecFailed is always false, as the command doesn't get wrapped.
+func (j *JobSpec) limitedExecFailed(status int) bool {
+	return false
+}
+
+// limitExceeded never blames the resource limits, as they don't get applied.
+func (j *JobSpec) limitExceeded(cmd *exec.Cmd) string {
+	return ""
+}
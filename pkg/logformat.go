@@ -0,0 +1,91 @@
+package cheek
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+)
+
+// Supported formats of the logs on stdout.
+const (
+	LogFormatConsole string = "console"
+	LogFormatJSON    string = "json"
+)
+
+// streamJobOutput tells the output of runs apart from cheek's own logs on stdout.
+const streamJobOutput = "job_output"
+
+// logFormat returns the format of the logs on stdout, the console by default.
+func (c Config) logFormat() string {
+	if c.LogFormat == "" {
+		return LogFormatConsole
+	}
+	return c.LogFormat
+}
+
+// StdoutLogWriter returns the writer for cheek's own logs on stdout in the
+// format of the config, its core log file is always JSON.
+func StdoutLogWriter(cfg Config) (io.Writer, error) {
+	switch cfg.logFormat() {
+	case LogFormatConsole:
+		return PrettyStdout(), nil
+	case LogFormatJSON:
+		return os.Stdout, nil
+	}
+	return nil, fmt.Errorf("log format should be one of %s|%s, got '%s'", LogFormatConsole, LogFormatJSON, cfg.LogFormat)
+}
+
+// terminalOutput returns where the output of a run goes on stdout: as is for
+// the console, one JSON line per line of output otherwise. Close writes what
+// is left of an unfinished last line.
+func (j *JobSpec) terminalOutput(jr *JobRun) io.WriteCloser {
+	if j.cfg.logFormat() == LogFormatConsole {
+		return nopWriteCloser{os.Stdout}
+	}
+	return newJobOutputWriter(os.Stdout, jr)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// jobOutputWriter logs every line written to it as a JSON line with the
+// stream set to job_output, regardless of cheek's log level.
+type jobOutputWriter struct {
+	log  zerolog.Logger
+	line []byte
+}
+
+func newJobOutputWriter(w io.Writer, jr *JobRun) *jobOutputWriter {
+	log := zerolog.New(w).With().Timestamp().Str("stream", streamJobOutput).Str("job", jr.Name).Str("run_id", jr.ID).Logger()
+	return &jobOutputWriter{log: log}
+}
+
+func (o *jobOutputWriter) Write(p []byte) (int, error) {
+	o.line = append(o.line, p...)
+	for {
+		i := bytes.IndexByte(o.line, '\n')
+		if i < 0 {
+			break
+		}
+		o.emit(bytes.TrimSuffix(o.line[:i], []byte{'\r'}))
+		o.line = o.line[i+1:]
+	}
+	return len(p), nil
+}
+
+func (o *jobOutputWriter) emit(line []byte) {
+	// an empty line keeps its message, which Msg would leave out
+	o.log.Info().Str(zerolog.MessageFieldName, string(line)).Send()
+}
+
+func (o *jobOutputWriter) Close() error {
+	if len(o.line) > 0 {
+		o.emit(o.line)
+		o.line = nil
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package cheek
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonLines decodes every line of out as a JSON object.
+func jsonLines(t *testing.T, out string) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, l := range strings.Split(strings.TrimSpace(out), "\n") {
+		m := map[string]interface{}{}
+		if assert.NoError(t, json.Unmarshal([]byte(l), &m), l) {
+			lines = append(lines, m)
+		}
+	}
+	return lines
+}
+
+func TestJobOutputWriter(t *testing.T) {
+	var b bytes.Buffer
+	o := newJobOutputWriter(&b, &JobRun{Name: "backup", ID: "r1"})
+	for _, p := range []string{"one\r\ntw", "o\n\n", `"three"`} {
+		n, err := o.Write([]byte(p))
+		assert.NoError(t, err)
+		assert.Equal(t, len(p), n)
+	}
+	assert.Equal(t, 3, strings.Count(b.String(), "\n"))
+	assert.NoError(t, o.Close())
+
+	messages := []string{}
+	for _, l := range jsonLines(t, b.String()) {
+		assert.Equal(t, "job_output", l["stream"])
+		assert.Equal(t, "backup", l["job"])
+		assert.Equal(t, "r1", l["run_id"])
+		assert.Equal(t, "info", l["level"])
+		messages = append(messages, l["message"].(string))
+	}
+	assert.Equal(t, []string{"one", "two", "", `"three"`}, messages)
+}
+
+func TestStdoutLogWriter(t *testing.T) {
+	cfg := NewConfig()
+	w, err := StdoutLogWriter(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, PrettyStdout(), w)
+
+	cfg.LogFormat = LogFormatJSON
+	w, err = StdoutLogWriter(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Stdout, w)
+
+	cfg.LogFormat = "logfmt"
+	_, err = StdoutLogWriter(cfg)
+	assert.EqualError(t, err, "log format should be one of console|json, got 'logfmt'")
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	cfg := NewConfig()
+	cfg.LogFormat = LogFormatJSON
+	sw, err := StdoutLogWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := &JobSpec{
+		Name:           "test_json_logs",
+		Command:        []string{"sh", "-c", "echo out; echo err >&2; printf last"},
+		globalSchedule: &Schedule{loc: time.Local},
+		cfg:            cfg,
+		log:            NewLogger("info", sw),
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, 0, jr.Status)
+	// even a job that can't start leaves nothing but JSON on stdout
+	j.Command = []string{"{{ .oops"}
+	j.execCommand(context.Background(), "test", nil)
+
+	w.Close()
+	out, err := io.ReadAll(r)
+	assert.NoError(t, err)
+
+	output, own := []string{}, 0
+	for _, l := range jsonLines(t, string(out)) {
+		if l["stream"] == "job_output" {
+			assert.Equal(t, jr.ID, l["run_id"])
+			output = append(output, l["message"].(string))
+			continue
+		}
+		own++
+	}
+	assert.Equal(t, []string{"out", "err", "last"}, output)
+	assert.Greater(t, own, 0)
+}
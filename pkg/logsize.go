@@ -0,0 +1,60 @@
+package cheek
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxLogSize returns how many bytes of output of a run get kept in its log,
+// zero meaning no limit. The job setting takes precedence over the schedule's.
+func (j *JobSpec) maxLogSize() int {
+	if j.MaxLogSize != 0 || j.globalSchedule == nil {
+		return j.MaxLogSize
+	}
+
+	j.globalSchedule.mu.RLock()
+	defer j.globalSchedule.mu.RUnlock()
+	return j.globalSchedule.MaxLogSize
+}
+
+func (j *JobSpec) ValidateLogSize() error {
+	if j.MaxLogSize < 0 {
+		return fmt.Errorf("max_log_size for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
+
+// cappedWriter passes on the first max bytes written to it and counts the
+// bytes beyond that it drops. A max of zero or less lets everything through.
+type cappedWriter struct {
+	w       io.Writer
+	max     int
+	written int
+	dropped int
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if c.max <= 0 {
+		return c.w.Write(p)
+	}
+
+	keep := len(p)
+	if left := c.max - c.written; keep > left {
+		keep = left
+	}
+	if keep > 0 {
+		n, err := c.w.Write(p[:keep])
+		c.written += n
+		if err != nil {
+			return n, err
+		}
+	}
+	// report everything as written, dropping output should not fail the job
+	c.dropped += len(p) - keep
+	return len(p), nil
+}
+
+// truncationNote is what gets appended to a log that got cut off at max_log_size.
+func truncationNote(dropped int) string {
+	return fmt.Sprintf("\n...output truncated (%v bytes dropped)...\n", dropped)
+}
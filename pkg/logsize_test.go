@@ -0,0 +1,72 @@
+package cheek
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCappedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	c := &cappedWriter{w: &buf, max: 5}
+
+	n, err := c.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = c.Write([]byte("defgh"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	_, err = c.Write([]byte("ij"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "abcde", buf.String())
+	assert.Equal(t, 5, c.dropped)
+
+	// no limit
+	buf.Reset()
+	c = &cappedWriter{w: &buf}
+	_, err = c.Write([]byte("abcdefghij"))
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdefghij", buf.String())
+	assert.Equal(t, 0, c.dropped)
+}
+
+func TestMaxLogSize(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{MaxLogSize: 1024, loc: time.UTC}
+
+	j := &JobSpec{
+		Name: "test",
+		// write 5MB of output over both stdout and stderr
+		Command:        []string{"sh", "-c", "head -c 3000000 /dev/zero | tr '\\0' x; head -c 2000000 /dev/zero | tr '\\0' y 1>&2"},
+		globalSchedule: s,
+		cfg:            cfg,
+	}
+	assert.Equal(t, 1024, j.maxLogSize())
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, strings.Repeat("x", 1024)+truncationNote(5000000-1024), jr.Log)
+	assert.Contains(t, jr.Log, "...output truncated (4998976 bytes dropped)...")
+
+	// the job setting overrides the schedule's
+	j.MaxLogSize = 10
+	assert.Equal(t, 10, j.maxLogSize())
+
+	// output within the limit is kept as is
+	j.MaxLogSize = 0
+	s.MaxLogSize = 0
+	j.Command = []string{"echo", "hello"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, "hello\n", jr.Log)
+
+	j.MaxLogSize = -1
+	assert.Error(t, j.ValidateLogSize())
+}
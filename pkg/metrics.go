@@ -0,0 +1,255 @@
+package cheek
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upper bounds in seconds of the run duration histogram buckets
+var durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range durationBuckets {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type webhookKey struct {
+	webhookType string
+	success     bool
+}
+
+type runKey struct {
+	job    string
+	status int
+}
+
+// metrics keeps track of job run statistics, exposed in the Prometheus text format.
+type metrics struct {
+	mu          sync.Mutex
+	runs        map[runKey]uint64
+	durations   map[string]*histogram
+	running     map[string]int
+	lastSuccess map[string]time.Time
+	webhooks    map[webhookKey]uint64
+	limited     map[string]uint64
+	debounced   map[string]uint64
+	sink        map[string]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		runs:        map[runKey]uint64{},
+		durations:   map[string]*histogram{},
+		running:     map[string]int{},
+		lastSuccess: map[string]time.Time{},
+		webhooks:    map[webhookKey]uint64{},
+		limited:     map[string]uint64{},
+		debounced:   map[string]uint64{},
+		sink:        map[string]uint64{},
+	}
+}
+
+// runMetrics collects metrics of all runs, regardless of how they got triggered.
+var runMetrics = newMetrics()
+
+func (m *metrics) runStarted(job string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running[job]++
+}
+
+func (m *metrics) runFinished(jr *JobRun) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.running[jr.Name]--
+	m.runs[runKey{job: jr.Name, status: jr.Status}]++
+
+	h, ok := m.durations[jr.Name]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[jr.Name] = h
+	}
+	h.observe(jr.Duration.Seconds())
+
+	if jr.succeeded() {
+		m.lastSuccess[jr.Name] = jr.TriggeredAt.Add(jr.Duration)
+	}
+}
+
+// webhookDelivered counts a notification that got delivered or that could not be delivered, retries included.
+func (m *metrics) webhookDelivered(webhookType string, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhooks[webhookKey{webhookType: webhookType, success: success}]++
+}
+
+// triggerRateLimited counts a trigger that got rejected for exceeding max_triggers_per_minute.
+func (m *metrics) triggerRateLimited(job string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limited[job]++
+}
+
+// triggerDebounced counts a trigger that got coalesced into an identical one.
+func (m *metrics) triggerDebounced(job string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.debounced[job]++
+}
+
+// sinkEvents counts runs that got delivered to the event sink or spooled to be sent later.
+func (m *metrics) sinkEvents(result string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sink[result] += uint64(n)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// write outputs all metrics in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer, jobsLoaded int, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP cheek_jobs_loaded Number of jobs in the loaded schedule.\n")
+	b.WriteString("# TYPE cheek_jobs_loaded gauge\n")
+	fmt.Fprintf(&b, "cheek_jobs_loaded %d\n", jobsLoaded)
+
+	b.WriteString("# HELP cheek_job_runs_total Number of finished job runs by job and exit status.\n")
+	b.WriteString("# TYPE cheek_job_runs_total counter\n")
+	keys := make([]runKey, 0, len(m.runs))
+	for k := range m.runs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].job != keys[j].job {
+			return keys[i].job < keys[j].job
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "cheek_job_runs_total{job=\"%s\",status=\"%d\"} %d\n", escapeLabel(k.job), k.status, m.runs[k])
+	}
+
+	b.WriteString("# HELP cheek_job_run_duration_seconds Duration of job runs.\n")
+	b.WriteString("# TYPE cheek_job_run_duration_seconds histogram\n")
+	jobs := []string{}
+	for job := range m.durations {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	for _, job := range jobs {
+		h := m.durations[job]
+		job = escapeLabel(job)
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "cheek_job_run_duration_seconds_bucket{job=\"%s\",le=\"%s\"} %d\n", job, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(&b, "cheek_job_run_duration_seconds_bucket{job=\"%s\",le=\"+Inf\"} %d\n", job, h.count)
+		fmt.Fprintf(&b, "cheek_job_run_duration_seconds_sum{job=\"%s\"} %s\n", job, formatFloat(h.sum))
+		fmt.Fprintf(&b, "cheek_job_run_duration_seconds_count{job=\"%s\"} %d\n", job, h.count)
+	}
+
+	b.WriteString("# HELP cheek_jobs_running Number of runs currently in progress by job.\n")
+	b.WriteString("# TYPE cheek_jobs_running gauge\n")
+	jobs = []string{}
+	for job := range m.running {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	for _, job := range jobs {
+		fmt.Fprintf(&b, "cheek_jobs_running{job=\"%s\"} %d\n", escapeLabel(job), m.running[job])
+	}
+
+	b.WriteString("# HELP cheek_job_seconds_since_last_success Seconds since the last successful run by job.\n")
+	b.WriteString("# TYPE cheek_job_seconds_since_last_success gauge\n")
+	jobs = []string{}
+	for job := range m.lastSuccess {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	for _, job := range jobs {
+		fmt.Fprintf(&b, "cheek_job_seconds_since_last_success{job=\"%s\"} %s\n", escapeLabel(job), formatFloat(now.Sub(m.lastSuccess[job]).Seconds()))
+	}
+
+	b.WriteString("# HELP cheek_webhook_deliveries_total Number of webhook notifications by type and result.\n")
+	b.WriteString("# TYPE cheek_webhook_deliveries_total counter\n")
+	wkeys := make([]webhookKey, 0, len(m.webhooks))
+	for k := range m.webhooks {
+		wkeys = append(wkeys, k)
+	}
+	sort.Slice(wkeys, func(i, j int) bool {
+		if wkeys[i].webhookType != wkeys[j].webhookType {
+			return wkeys[i].webhookType < wkeys[j].webhookType
+		}
+		// successes come before failures
+		return wkeys[i].success && !wkeys[j].success
+	})
+	for _, k := range wkeys {
+		result := "failure"
+		if k.success {
+			result = "success"
+		}
+		fmt.Fprintf(&b, "cheek_webhook_deliveries_total{type=\"%s\",result=\"%s\"} %d\n", escapeLabel(k.webhookType), result, m.webhooks[k])
+	}
+
+	b.WriteString("# HELP cheek_job_triggers_rate_limited_total Number of triggers rejected by the rate limit by job.\n")
+	b.WriteString("# TYPE cheek_job_triggers_rate_limited_total counter\n")
+	writeJobCounters(&b, "cheek_job_triggers_rate_limited_total", m.limited)
+
+	b.WriteString("# HELP cheek_job_triggers_debounced_total Number of triggers coalesced into an identical one by job.\n")
+	b.WriteString("# TYPE cheek_job_triggers_debounced_total counter\n")
+	writeJobCounters(&b, "cheek_job_triggers_debounced_total", m.debounced)
+
+	b.WriteString("# HELP cheek_event_sink_events_total Number of runs delivered to the event sink or spooled to be sent later.\n")
+	b.WriteString("# TYPE cheek_event_sink_events_total counter\n")
+	results := make([]string, 0, len(m.sink))
+	for result := range m.sink {
+		results = append(results, result)
+	}
+	sort.Strings(results)
+	for _, result := range results {
+		fmt.Fprintf(&b, "cheek_event_sink_events_total{result=\"%s\"} %d\n", result, m.sink[result])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeJobCounters(b *strings.Builder, name string, counters map[string]uint64) {
+	jobs := make([]string, 0, len(counters))
+	for job := range counters {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	for _, job := range jobs {
+		fmt.Fprintf(b, "%s{job=\"%s\"} %d\n", name, escapeLabel(job), counters[job])
+	}
+}
@@ -0,0 +1,49 @@
+package cheek
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	now := time.Now()
+
+	m.runStarted("foo")
+	m.runStarted("foo")
+	m.runFinished(&JobRun{Name: "foo", Status: 0, TriggeredAt: now.Add(-time.Minute), Duration: 2 * time.Second})
+	m.runStarted("bar")
+	m.runFinished(&JobRun{Name: "bar", Status: 1, TriggeredAt: now, Duration: 100 * time.Millisecond})
+	m.triggerRateLimited("foo")
+	m.triggerRateLimited("foo")
+	m.triggerDebounced("bar")
+	m.webhookDelivered("slack", false)
+	m.webhookDelivered("slack", true)
+	m.webhookDelivered("email", true)
+
+	b := new(strings.Builder)
+	if err := m.write(b, 2, now); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	assert.Contains(t, out, "cheek_jobs_loaded 2\n")
+	assert.Contains(t, out, "cheek_job_runs_total{job=\"foo\",status=\"0\"} 1\n")
+	assert.Contains(t, out, "cheek_job_runs_total{job=\"bar\",status=\"1\"} 1\n")
+	assert.Contains(t, out, "cheek_job_run_duration_seconds_bucket{job=\"foo\",le=\"1\"} 0\n")
+	assert.Contains(t, out, "cheek_job_run_duration_seconds_bucket{job=\"foo\",le=\"5\"} 1\n")
+	assert.Contains(t, out, "cheek_job_run_duration_seconds_count{job=\"bar\"} 1\n")
+	assert.Contains(t, out, "cheek_jobs_running{job=\"foo\"} 1\n")
+	assert.Contains(t, out, "cheek_jobs_running{job=\"bar\"} 0\n")
+	assert.Contains(t, out, "cheek_job_seconds_since_last_success{job=\"foo\"} 58\n")
+	assert.NotContains(t, out, "cheek_job_seconds_since_last_success{job=\"bar\"}")
+	assert.Contains(t, out, "cheek_job_triggers_rate_limited_total{job=\"foo\"} 2\n")
+	assert.Contains(t, out, "cheek_job_triggers_debounced_total{job=\"bar\"} 1\n")
+	assert.Contains(t, out, `cheek_webhook_deliveries_total{type="email",result="success"} 1
+cheek_webhook_deliveries_total{type="slack",result="success"} 1
+cheek_webhook_deliveries_total{type="slack",result="failure"} 1
+`)
+}
@@ -0,0 +1,106 @@
+package cheek
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// statusRecorder remembers the status code a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// withMiddleware wraps the handlers of the http server with access logging
+// and the recovery from panics.
+func withMiddleware(s *Schedule, next http.Handler) http.Handler {
+	level, err := zerolog.ParseLevel(s.cfg.AccessLogLevel)
+	if err != nil || s.cfg.AccessLogLevel == "" {
+		level = zerolog.InfoLevel
+	}
+	return accessLog(s.log, level, s.cfg.AccessLogHealth, recoverPanics(s.log, next))
+}
+
+// accessLog logs every request at the given level once it got answered,
+// requests of health and readiness checks only when logHealthChecks is set.
+func accessLog(log zerolog.Logger, level zerolog.Level, logHealthChecks bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logHealthChecks && isHealthCheck(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log.WithLevel(level).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", rec.status).
+			Dur("latency", time.Since(start)).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("http request")
+	})
+}
+
+// recoverPanics answers a request whose handler panicked with a 500, instead
+// of leaving the client without a response.
+func recoverPanics(log zerolog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := w.(*statusRecorder)
+		if !ok {
+			rec = &statusRecorder{ResponseWriter: w}
+		}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// the http server aborts the response on its own for this one
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			log.Error().Str("method", r.Method).Str("path", r.URL.Path).Str("stack", string(debug.Stack())).Msgf("http handler panicked: %v", v)
+			if rec.status == 0 {
+				http.Error(rec, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func isHealthCheck(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/healthz/" || r.URL.Path == "/readyz"
+}
@@ -0,0 +1,92 @@
+package cheek
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverPanicsKeepsSchedulerTicking(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	logs := new(tsBuffer)
+	s := &Schedule{Jobs: map[string]*JobSpec{}, loc: time.Local, log: NewLogger("debug", logs), cfg: cfg}
+	s.Jobs["tick"] = &JobSpec{Name: "tick", Cron: "* * * * *", Command: []string{"true"}, nextTick: time.Now().Add(500 * time.Millisecond), globalSchedule: s, inFlight: newRunTracker(), log: s.log, cfg: cfg}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx, nil)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	srv := httptest.NewServer(withMiddleware(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/jobs/boom")
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, "Internal Server Error\n", string(body))
+	}
+	assert.Contains(t, logs.String(), "http handler panicked: boom")
+	assert.Contains(t, logs.String(), `"status":500`)
+
+	// the scheduler did not go down with the handler
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return !s.lastTick.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := new(tsBuffer)
+	s := &Schedule{Jobs: map[string]*JobSpec{}, log: NewLogger("debug", logs), cfg: NewConfig()}
+	handler := setupMux(s)
+
+	serve := func(path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/schedule/")
+	assert.Contains(t, logs.String(), `"method":"GET","path":"/schedule/","status":200`)
+	assert.Contains(t, logs.String(), `"remote_addr":"192.0.2.1:1234"`)
+	assert.Contains(t, logs.String(), `"latency"`)
+
+	// health checks stay out of the access log by default
+	logs.Reset()
+	serve("/healthz/")
+	serve("/readyz")
+	assert.NotContains(t, logs.String(), "http request")
+
+	s.cfg.AccessLogHealth = true
+	handler = setupMux(s)
+	serve("/readyz")
+	assert.Contains(t, logs.String(), `"path":"/readyz","status":503`)
+
+	// requests get logged at the configured level
+	logs.Reset()
+	s.cfg.AccessLogLevel = "debug"
+	handler = setupMux(s)
+	serve("/schedule/")
+	assert.Contains(t, logs.String(), `"level":"debug"`)
+
+	s.cfg.AccessLogLevel = "loud"
+	_, _, err := server(s)
+	assert.EqualError(t, err, "cannot start http server: invalid access log level 'loud'")
+}
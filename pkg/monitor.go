@@ -0,0 +1,63 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// monitorTimeout bounds a ping to the monitor of a job.
+const monitorTimeout = 5 * time.Second
+
+// monitorLogLength is how much of the tail of a run's log is sent along with a ping.
+const monitorLogLength = 10000
+
+// ValidateMonitor checks that the monitor url of a job can be pinged.
+func (j *JobSpec) ValidateMonitor() error {
+	if j.MonitorURL == "" {
+		return nil
+	}
+	u, err := url.Parse(j.MonitorURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("monitor_url of job '%s' should be an http(s) url, got '%s'", j.Name, j.MonitorURL)
+	}
+	return nil
+}
+
+// pingMonitor lets the job's monitor know about a run in the background, in the
+// style of healthchecks.io: suffix /start when a run begins, no suffix when it
+// succeeded and /fail when it failed. A ping that fails only gets logged.
+func (j *JobSpec) pingMonitor(suffix string, log string) {
+	if j.MonitorURL == "" {
+		return
+	}
+
+	pingURL := strings.TrimSuffix(j.MonitorURL, "/") + suffix
+	method, body := http.MethodGet, []byte(nil)
+	if log != "" {
+		method, body = http.MethodPost, []byte(logTail(log, monitorLogLength))
+	}
+
+	go func() {
+		_, _, err := webhookAttempt(context.Background(), monitorTimeout, method, pingURL, http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}}, body)
+		runMetrics.webhookDelivered("monitor", err == nil)
+		if err != nil {
+			j.log.Warn().Str("job", j.Name).Str("monitor_url", pingURL).Err(err).Msg("monitor ping failed")
+		}
+	}()
+}
+
+// pingMonitorDone reports the outcome of a run to the job's monitor, attempts
+// that are followed by a retry are not reported.
+func (j *JobSpec) pingMonitorDone(jr *JobRun) {
+	switch {
+	case jr.Status == StatusSkipped, jr.retrying:
+	case jr.succeeded():
+		j.pingMonitor("", jr.Log)
+	default:
+		j.pingMonitor("/fail", jr.Log)
+	}
+}
@@ -0,0 +1,98 @@
+package cheek
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ping struct {
+	method string
+	path   string
+	body   string
+}
+
+func TestMonitorPings(t *testing.T) {
+	var mu sync.Mutex
+	pings := []ping{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		pings = append(pings, ping{method: r.Method, path: r.URL.Path, body: string(body)})
+	}))
+	defer ts.Close()
+
+	// pings are sent in the background
+	waitForPings := func(n int) []ping {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			if len(pings) >= n {
+				got := pings
+				pings = []ping{}
+				mu.Unlock()
+				return got
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected %v pings", n)
+		return nil
+	}
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test_monitor",
+		Command:        []string{"echo", "all good"},
+		MonitorURL:     ts.URL + "/ping/abc/",
+		globalSchedule: &Schedule{loc: time.Local},
+		cfg:            cfg,
+	}
+	assert.NoError(t, j.ValidateMonitor())
+
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	got := waitForPings(2)
+	assert.Contains(t, got, ping{method: http.MethodGet, path: "/ping/abc/start"})
+	assert.Contains(t, got, ping{method: http.MethodPost, path: "/ping/abc", body: "all good\n"})
+
+	// only the outcome of the last attempt gets reported
+	j.Command = []string{"sh", "-c", "echo broken; exit 3"}
+	j.Retries = 1
+	j.RetryDelay = time.Millisecond
+	j.execCommandWithRetry(context.Background(), "test", nil)
+	got = waitForPings(3)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Empty(t, pings)
+	mu.Unlock()
+	assert.Equal(t, 2, countPings(got, "/ping/abc/start"))
+	assert.Contains(t, got, ping{method: http.MethodPost, path: "/ping/abc/fail", body: "broken\n"})
+
+	// an unreachable monitor doesn't influence the run
+	j.MonitorURL = "http://127.0.0.1:1"
+	j.Retries = 0
+	j.Command = []string{"true"}
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 0, jr.Status)
+
+	j.MonitorURL = "hc-ping.com/abc"
+	assert.Error(t, j.ValidateMonitor())
+}
+
+func countPings(pings []ping, path string) int {
+	n := 0
+	for _, p := range pings {
+		if p.path == path {
+			n++
+		}
+	}
+	return n
+}
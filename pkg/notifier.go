@@ -0,0 +1,247 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Notifier sends a notification about a run.
+type Notifier interface {
+	Notify(ctx context.Context, jr *JobRun) error
+}
+
+// NotifierFactory builds the notifiers of one type that an event asks for.
+type NotifierFactory func(cfg Config, e OnEvent) []Notifier
+
+// NotifierSpec configures a notifier of a type that got registered with RegisterNotifier.
+type NotifierSpec struct {
+	Type   string            `yaml:"type" json:"type"`
+	Params map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+}
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   = map[string]NotifierFactory{
+		"webhook":  webhookNotifiers,
+		"slack":    slackNotifiers,
+		"discord":  chatWebhookNotifiers("discord", func(e OnEvent) []string { return e.NotifyDiscordWebhook }),
+		"teams":    chatWebhookNotifiers("teams", func(e OnEvent) []string { return e.NotifyTeamsWebhook }),
+		"telegram": telegramNotifiers,
+		"email":    emailNotifiers,
+	}
+	// the types of notifiers that have their own keys in the specs
+	builtinNotifiers = []string{"webhook", "slack", "discord", "teams", "telegram", "email"}
+)
+
+// RegisterNotifier makes a type of notifier available to the `notify` action of
+// events, the factory gets the params of the entries of its type through
+// OnEvent.NotifierParams. Registering a type again replaces its factory.
+func RegisterNotifier(kind string, factory NotifierFactory) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers[kind] = factory
+}
+
+// NotifierParams returns the params of the `notify` entries of an event of the given type.
+func (e OnEvent) NotifierParams(kind string) []map[string]string {
+	params := []map[string]string{}
+	for _, n := range e.Notify {
+		if n.Type == kind {
+			params = append(params, n.Params)
+		}
+	}
+	return params
+}
+
+// notifierKinds lists the registered types of notifiers, sorted.
+func notifierKinds() []string {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+
+	kinds := make([]string, 0, len(notifiers))
+	for k := range notifiers {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func notifierFactory(kind string) (NotifierFactory, bool) {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	f, ok := notifiers[kind]
+	return f, ok
+}
+
+// validateNotify checks that the `notify` entries of an event refer to registered types.
+func (e OnEvent) validateNotify() error {
+	for _, n := range e.Notify {
+		for _, b := range builtinNotifiers {
+			if n.Type == b {
+				return fmt.Errorf("notifier '%s' has its own key, use notify_%s instead of notify", n.Type, builtinKey(n.Type))
+			}
+		}
+		if _, ok := notifierFactory(n.Type); !ok {
+			return fmt.Errorf("notifier '%s' is not registered", n.Type)
+		}
+	}
+	return nil
+}
+
+func builtinKey(kind string) string {
+	switch kind {
+	case "slack", "discord", "teams":
+		return kind + "_webhook"
+	}
+	return kind
+}
+
+// ValidateNotifiers checks the notifiers of the job's events.
+func (j *JobSpec) ValidateNotifiers() error {
+	for _, kind := range eventKinds {
+		if err := j.event(kind).validateNotify(); err != nil {
+			return fmt.Errorf("%s of job '%s': %w", kind, j.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateNotifiers checks the notifiers of the schedule wide events.
+func (s *Schedule) ValidateNotifiers() error {
+	for _, kind := range eventKinds {
+		if err := s.event(kind).validateNotify(); err != nil {
+			return fmt.Errorf("%s: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// notify sends out all notifications of an event about a run and waits for them.
+func (j *JobSpec) notify(ctx context.Context, jr *JobRun, event OnEvent) {
+	if ctx.Err() != nil {
+		if !event.empty() {
+			j.log.Warn().Str("job", j.Name).Err(ctx.Err()).Msg("run got called off, not sending notifications")
+		}
+		return
+	}
+
+	deadline := j.cfg.notifyDeadline()
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	var notified sync.WaitGroup
+	for _, kind := range notifierKinds() {
+		factory, _ := notifierFactory(kind)
+		for _, n := range factory(j.cfg, event) {
+			j.log.Debug().Str("job", j.Name).Str("on_event", kind).Msg("triggered by parent job")
+			notified.Add(1)
+			go func(kind string, n Notifier) {
+				defer notified.Done()
+				if err := n.Notify(ctx, jr); err != nil {
+					j.log.Warn().Str("job", j.Name).Str("on_event", kind).Err(err).Msgf("%s notify failed", kind)
+				}
+			}(kind, n)
+		}
+	}
+
+	// notifications are bound by their timeouts, still don't let a misbehaving one hold up the run
+	if !waitTimeout(&notified, deadline+time.Second) {
+		j.log.Warn().Str("job", j.Name).Msg("notifications are taking too long, no longer waiting for them")
+	}
+}
+
+// webhookNotifier calls a generic webhook.
+type webhookNotifier struct {
+	webhook Webhook
+}
+
+func webhookNotifiers(cfg Config, e OnEvent) []Notifier {
+	ns := []Notifier{}
+	for _, wh := range e.NotifyWebhook {
+		ns = append(ns, webhookNotifier{webhook: wh})
+	}
+	return ns
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, jr *JobRun) error {
+	_, err := n.webhook.call(ctx, jr)
+	return err
+}
+
+// slackNotifier posts a message to a Slack webhook.
+type slackNotifier struct {
+	webhook SlackWebhook
+}
+
+func slackNotifiers(cfg Config, e OnEvent) []Notifier {
+	ns := []Notifier{}
+	for _, wh := range e.NotifySlackWebhook {
+		ns = append(ns, slackNotifier{webhook: wh})
+	}
+	return ns
+}
+
+func (n slackNotifier) Notify(ctx context.Context, jr *JobRun) error {
+	_, err := n.webhook.call(ctx, jr)
+	return err
+}
+
+// chatWebhookNotifier posts a message formatted for a chat service to its webhook.
+type chatWebhookNotifier struct {
+	kind string
+	url  string
+}
+
+func chatWebhookNotifiers(kind string, urls func(e OnEvent) []string) NotifierFactory {
+	return func(cfg Config, e OnEvent) []Notifier {
+		ns := []Notifier{}
+		for _, u := range urls(e) {
+			ns = append(ns, chatWebhookNotifier{kind: kind, url: u})
+		}
+		return ns
+	}
+}
+
+func (n chatWebhookNotifier) Notify(ctx context.Context, jr *JobRun) error {
+	_, err := JobRunWebhookCall(ctx, jr, n.url, n.kind)
+	return err
+}
+
+// telegramNotifier sends a message to a Telegram chat.
+type telegramNotifier struct {
+	botToken string
+	chatID   string
+}
+
+func telegramNotifiers(cfg Config, e OnEvent) []Notifier {
+	ns := []Notifier{}
+	for _, chatID := range e.NotifyTelegram {
+		ns = append(ns, telegramNotifier{botToken: cfg.TelegramBotToken, chatID: chatID})
+	}
+	return ns
+}
+
+func (n telegramNotifier) Notify(ctx context.Context, jr *JobRun) error {
+	_, err := JobRunTelegramCall(ctx, jr, n.botToken, n.chatID)
+	return err
+}
+
+// emailNotifier sends one email to all addresses of an event.
+type emailNotifier struct {
+	cfg Config
+	to  []string
+}
+
+func emailNotifiers(cfg Config, e OnEvent) []Notifier {
+	if len(e.NotifyEmail) == 0 {
+		return []Notifier{}
+	}
+	return []Notifier{emailNotifier{cfg: cfg, to: e.NotifyEmail}}
+}
+
+func (n emailNotifier) Notify(ctx context.Context, jr *JobRun) error {
+	return JobRunEmail(ctx, n.cfg, jr, n.to)
+}
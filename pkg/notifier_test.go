@@ -0,0 +1,87 @@
+package cheek
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingNotifier keeps the names of the runs it got notified about.
+type recordingNotifier struct {
+	mu      *sync.Mutex
+	channel string
+	got     *[]string
+}
+
+func (n recordingNotifier) Notify(ctx context.Context, jr *JobRun) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	*n.got = append(*n.got, n.channel+":"+jr.Name)
+	return nil
+}
+
+func TestRegisterNotifier(t *testing.T) {
+	var mu sync.Mutex
+	got := []string{}
+	RegisterNotifier("recorder", func(cfg Config, e OnEvent) []Notifier {
+		ns := []Notifier{}
+		for _, p := range e.NotifierParams("recorder") {
+			ns = append(ns, recordingNotifier{mu: &mu, channel: p["channel"], got: &got})
+		}
+		return ns
+	})
+
+	s, err := parseSpecs("notify.yaml", []byte(`
+jobs:
+  hello:
+    command: echo hello
+    on_success:
+      notify:
+        - type: recorder
+          params:
+            channel: ops
+        - type: recorder
+          params:
+            channel: dev
+`))
+	assert.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s.cfg = cfg
+	assert.Empty(t, s.validate())
+
+	s.Jobs["hello"].execCommandWithRetry(context.Background(), "test", nil)
+	assert.ElementsMatch(t, []string{"ops:hello", "dev:hello"}, got)
+}
+
+func TestValidateNotifiers(t *testing.T) {
+	j := &JobSpec{Name: "hello", OnError: OnEvent{Notify: []NotifierSpec{{Type: "pager"}}}}
+	assert.EqualError(t, j.ValidateNotifiers(), "on_error of job 'hello': notifier 'pager' is not registered")
+
+	j.OnError.Notify[0].Type = "slack"
+	assert.EqualError(t, j.ValidateNotifiers(), "on_error of job 'hello': notifier 'slack' has its own key, use notify_slack_webhook instead of notify")
+
+	s := &Schedule{OnSuccess: OnEvent{Notify: []NotifierSpec{{Type: "pager"}}}}
+	assert.EqualError(t, s.ValidateNotifiers(), "on_success: notifier 'pager' is not registered")
+}
+
+func TestBuiltinNotifiers(t *testing.T) {
+	rec, ts := newEventRecorder(t)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{Name: "hello", cfg: cfg, globalSchedule: &Schedule{loc: time.Local}}
+
+	// the existing keys are served by the registered notifiers
+	j.notify(context.Background(), &JobRun{Name: "hello"}, OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL + "/a"}, {URL: ts.URL + "/b"}}})
+	assert.Len(t, rec.get("/a"), 1)
+	assert.Len(t, rec.get("/b"), 1)
+
+	ns := emailNotifiers(cfg, OnEvent{NotifyEmail: []string{"a@example.com", "b@example.com"}})
+	assert.Len(t, ns, 1, "all addresses get the same email")
+}
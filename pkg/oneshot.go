@@ -0,0 +1,98 @@
+package cheek
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// timeArray holds one or more timestamps.
+type timeArray []time.Time
+
+func (a *timeArray) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var multi []time.Time
+	if err := unmarshal(&multi); err == nil {
+		*a = multi
+		return nil
+	}
+
+	var single time.Time
+	if err := unmarshal(&single); err != nil {
+		return err
+	}
+	*a = timeArray{single}
+	return nil
+}
+
+// ValidateAt checks the timestamps a job runs at once, and that the job runs
+// on one kind of schedule only.
+func (j *JobSpec) ValidateAt() error {
+	kinds := 0
+	for _, set := range []bool{j.Cron != "", j.Interval != 0, len(j.At) > 0} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return fmt.Errorf("job '%s' can have only one of cron, interval or at", j.Name)
+	}
+
+	for _, t := range j.At {
+		if t.IsZero() {
+			return fmt.Errorf("at of job '%s' should be a timestamp like 2024-07-01T03:00:00Z", j.Name)
+		}
+	}
+	sort.Slice(j.At, func(i, k int) bool { return j.At[i].Before(j.At[k]) })
+	return nil
+}
+
+// nextAt returns the first of the job's timestamps after refTime, or at
+// refTime with includeRefTime. It is zero once all of them have passed.
+func (j *JobSpec) nextAt(refTime time.Time, includeRefTime bool) time.Time {
+	for _, t := range j.At {
+		if t.After(refTime) || (includeRefTime && t.Equal(refTime)) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// completed tells whether a job that runs at given timestamps has none left.
+func (j *JobSpec) completed() bool {
+	return len(j.At) > 0 && !j.Disable && j.nextTick.IsZero()
+}
+
+// tickless tells whether the job is scheduled but has no next tick: an
+// interval job waiting for its run to finish, or a one-shot job that ran.
+func (j *JobSpec) tickless() bool {
+	return j.waitsForFinish() || j.completed()
+}
+
+// warnPastAt reports the timestamps of jobs that passed before the schedule
+// got loaded at refTime, they don't run unless the job catches up.
+func (s *Schedule) warnPastAt(refTime time.Time) {
+	for _, name := range s.jobNames() {
+		j := s.Jobs[name]
+		if j.Catchup || j.Disable {
+			continue
+		}
+		for _, t := range j.At {
+			if !t.After(refTime) {
+				s.log.Warn().Str("job", name).Msgf("at %v lies in the past, skipping it", t.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// sameTimes tells whether two lists of timestamps are the same.
+func sameTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
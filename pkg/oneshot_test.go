@@ -0,0 +1,95 @@
+package cheek
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOneShotSpecs(t *testing.T) {
+	s, err := parseSpecs("schedule.yaml", []byte(`
+jobs:
+  once:
+    command: date
+    at: 2024-07-01T03:00:00Z
+  twice:
+    command: date
+    at: ["2024-08-01T03:00:00Z", 2024-07-01T03:00:00+02:00]
+  both:
+    command: date
+    cron: "* * * * *"
+    at: 2024-07-01T03:00:00Z
+`))
+	assert.NoError(t, err)
+	s.log = NewLogger("debug", new(tsBuffer))
+	assert.Equal(t, timeArray{time.Date(2024, 7, 1, 3, 0, 0, 0, time.UTC)}, s.Jobs["once"].At)
+
+	problems := s.validate()
+	if assert.Len(t, problems, 1) {
+		assert.Equal(t, "both", problems[0].Job)
+	}
+	// timestamps get sorted
+	assert.Equal(t, 1, s.Jobs["twice"].At[0].Day())
+}
+
+func TestDueJobsOneShot(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	refTime := time.Date(2024, 7, 1, 2, 0, 0, 0, time.UTC)
+	first, second := refTime.Add(time.Hour), refTime.Add(2*time.Hour)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"once": {Command: []string{"date"}, At: timeArray{first, second}},
+	}, refTime)
+	j := s.Jobs["once"]
+	assert.Equal(t, first, j.nextTick)
+
+	runs, err := j.nextRuns(refTime, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{first, second}, runs)
+
+	due := s.dueJobs(first)
+	assert.Len(t, due, 1)
+	j.recordTick(&JobRun{ScheduledAt: &first, jobRef: j})
+	assert.Equal(t, second, j.nextTick)
+	assert.Len(t, s.dueJobs(second), 1)
+
+	// done for good, it doesn't keep the scheduler awake either
+	assert.True(t, j.completed())
+	assert.Empty(t, s.dueJobs(second.Add(time.Hour)))
+	assert.Equal(t, maxSleep, s.untilNextTick(second))
+	b, err := json.Marshal(j)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"completed":true`)
+	assert.NotContains(t, string(b), "next_run")
+
+	// the first one got recorded as run
+	ticks, err := loadTicks()
+	assert.NoError(t, err)
+	assert.True(t, ticks["once"].Equal(first))
+}
+
+func TestOneShotCatchup(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	refTime := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	logs := new(tsBuffer)
+	s := &Schedule{Jobs: map[string]*JobSpec{}, loc: time.UTC, log: NewLogger("debug", logs)}
+	past := refTime.Add(-time.Hour)
+	s.Jobs["catchup"] = &JobSpec{Name: "catchup", At: timeArray{past.Add(-time.Hour), past}, Catchup: true, CatchupPolicy: CatchupPolicyAll}
+	s.Jobs["plain"] = &JobSpec{Name: "plain", At: timeArray{past}}
+
+	// timestamps that passed are skipped with a warning, unless the job catches up
+	s.warnPastAt(refTime)
+	assert.Contains(t, logs.String(), "lies in the past")
+	assert.NotContains(t, logs.String(), `"job":"catchup"`)
+
+	catchups := s.catchups(refTime)
+	if assert.Len(t, catchups, 1) {
+		assert.Equal(t, []time.Time{past.Add(-time.Hour), past}, catchups[0].ticks)
+	}
+	// a restart runs them again until they succeeded
+	assert.Len(t, s.catchups(refTime.Add(time.Minute)), 1)
+	j := s.Jobs["catchup"]
+	j.recordTick(&JobRun{ScheduledAt: &past, jobRef: j})
+	assert.Empty(t, s.catchups(refTime.Add(time.Minute)))
+}
@@ -0,0 +1,346 @@
+package cheek
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiParam is a path or query parameter of an endpoint.
+type apiParam struct {
+	name        string
+	in          string
+	schema      string
+	description string
+}
+
+// apiResponse is a possible answer of an endpoint, body is a value of the type
+// that gets returned, a string for plain text or nil for none.
+type apiResponse struct {
+	code        int
+	description string
+	body        interface{}
+}
+
+// apiOperation describes an endpoint of the http api.
+type apiOperation struct {
+	method  string
+	path    string
+	summary string
+	params  []apiParam
+	// value of the type of the JSON body, or a string with the media type of another body
+	body      interface{}
+	responses []apiResponse
+	// reachable without the auth token
+	public bool
+}
+
+var (
+	jobParam   = apiParam{name: "name", in: "path", schema: "string", description: "name of the job"}
+	runParam   = apiParam{name: "id", in: "path", schema: "string", description: "id of the run"}
+	asyncParam = apiParam{name: "async", in: "query", schema: "boolean", description: "return right away instead of waiting for the run to complete"}
+
+	errJobNotFound    = apiResponse{http.StatusNotFound, "the job does not exist", Response{}}
+	errJobDisabled    = apiResponse{http.StatusConflict, "the job is disabled", Response{}}
+	errTooManyRuns    = apiResponse{http.StatusTooManyRequests, "the job got triggered too often, see the Retry-After header", Response{}}
+	errMethod         = apiResponse{http.StatusMethodNotAllowed, "method not allowed", ""}
+	errBadRequest     = apiResponse{http.StatusBadRequest, "invalid request", ""}
+	launchedOrMatched = apiResponse{http.StatusAccepted, "the run got launched, or the request got coalesced into the run with the returned run_id", Response{}}
+)
+
+// apiOperations lists all endpoints of the http api, the OpenAPI document is
+// generated from it.
+var apiOperations = []apiOperation{
+	{method: http.MethodGet, path: "/healthz/", summary: "Health of the scheduler", public: true, responses: []apiResponse{
+		{http.StatusOK, "the scheduler is healthy", HealthResponse{}},
+		{http.StatusServiceUnavailable, "the scheduler stopped ticking or cannot write its data", HealthResponse{}},
+	}},
+	{method: http.MethodGet, path: "/readyz", summary: "Whether the schedule got loaded and the scheduler ticked once", public: true, responses: []apiResponse{
+		{http.StatusOK, "ready", Response{}},
+		{http.StatusServiceUnavailable, "not ready yet", Response{}},
+	}},
+	{method: http.MethodGet, path: "/openapi.json", summary: "This document", responses: []apiResponse{
+		{http.StatusOK, "the OpenAPI document of the api", map[string]interface{}{}},
+	}},
+	{method: http.MethodGet, path: "/schedule/", summary: "The loaded schedule", responses: []apiResponse{
+		{http.StatusOK, "the schedule with all of its jobs", Schedule{}},
+	}},
+	{method: http.MethodGet, path: "/trigger/{name}", summary: "Run a job and wait for it, kept for the ui", params: []apiParam{jobParam}, responses: []apiResponse{
+		{http.StatusOK, "the run completed", Response{}},
+		launchedOrMatched, errJobNotFound, errJobDisabled, errTooManyRuns,
+	}},
+	{method: http.MethodPost, path: "/jobs/{name}/trigger", summary: "Run a job", params: []apiParam{jobParam, asyncParam}, body: TriggerRequest{}, responses: []apiResponse{
+		{http.StatusOK, "the run completed", JobRun{}},
+		launchedOrMatched, errBadRequest, errJobNotFound, errMethod, errJobDisabled, errTooManyRuns,
+	}},
+	{method: http.MethodGet, path: "/jobs/{name}/runs", summary: "Page through the runs of a job, newest first", params: []apiParam{jobParam,
+		{name: "limit", in: "query", schema: "integer", description: "number of runs to return, defaults to 50"},
+		{name: "offset", in: "query", schema: "integer", description: "number of runs to skip"},
+		{name: "log", in: "query", schema: "string", description: "full, truncate or none"},
+	}, responses: []apiResponse{
+		{http.StatusOK, "a page of runs", RunsResponse{}},
+		errBadRequest, errJobNotFound, errMethod,
+	}},
+	{method: http.MethodGet, path: "/jobs/{name}/runs/{id}", summary: "A run of a job with all of its attempts", params: []apiParam{jobParam, runParam}, responses: []apiResponse{
+		{http.StatusOK, "the run", RunResponse{}},
+		{http.StatusNotFound, "the job or run does not exist", Response{}},
+		{http.StatusGone, "the job is no longer in the schedule", Response{}},
+		errMethod,
+	}},
+	{method: http.MethodPost, path: "/jobs/{name}/runs/{id}/rerun", summary: "Run a job again with the params of one of its runs", params: []apiParam{jobParam, runParam, asyncParam}, responses: []apiResponse{
+		{http.StatusOK, "the run completed", JobRun{}},
+		launchedOrMatched,
+		{http.StatusNotFound, "the job or run does not exist", Response{}},
+		{http.StatusGone, "the job is no longer in the schedule", Response{}},
+		errMethod, errJobDisabled, errTooManyRuns,
+	}},
+	{method: http.MethodGet, path: "/jobs/{name}/runs/current/logs", summary: "Follow the output of the run in progress", params: []apiParam{jobParam,
+		{name: "last", in: "query", schema: "boolean", description: "return the log of the last run when the job is not running"},
+	}, responses: []apiResponse{
+		{http.StatusOK, "the output, streamed until the run is done", "text/plain"},
+		{http.StatusNotFound, "the job does not exist or is not running", Response{}},
+		errMethod,
+	}},
+	{method: http.MethodGet, path: "/jobs/{name}/next", summary: "The upcoming runs of a job", params: []apiParam{jobParam,
+		{name: "count", in: "query", schema: "integer", description: "number of runs to return, defaults to 5"},
+	}, responses: []apiResponse{
+		{http.StatusOK, "the upcoming runs", NextRunsResponse{}},
+		errBadRequest, errJobNotFound, errMethod,
+	}},
+	{method: http.MethodGet, path: "/jobs/{name}/stats", summary: "Statistics of the run history of a job", params: []apiParam{jobParam}, responses: []apiResponse{
+		{http.StatusOK, "the statistics", JobStats{}},
+		errJobNotFound, errMethod,
+	}},
+	{method: http.MethodPost, path: "/jobs/{name}/pause", summary: "Stop a job from running on its cron", params: []apiParam{jobParam}, responses: []apiResponse{
+		{http.StatusOK, "the job is paused", Response{}},
+		errJobNotFound, errMethod,
+	}},
+	{method: http.MethodPost, path: "/jobs/{name}/resume", summary: "Let a paused job, or one of which the circuit is open, run on its cron again", params: []apiParam{jobParam}, responses: []apiResponse{
+		{http.StatusOK, "the job is resumed", Response{}},
+		errJobNotFound, errMethod,
+	}},
+	{method: http.MethodPost, path: "/jobs/{name}/cancel", summary: "Cancel the runs of a job that are in progress", params: []apiParam{jobParam}, responses: []apiResponse{
+		{http.StatusAccepted, "the runs are being canceled", Response{}},
+		errJobNotFound, errMethod,
+		{http.StatusConflict, "the job is not running", Response{}},
+	}},
+	{method: http.MethodPost, path: "/hooks/{name}", summary: "Run the job of a webhook trigger", public: true, body: "application/json", params: []apiParam{
+		{name: "name", in: "path", schema: "string", description: "name of the webhook trigger"},
+	}, responses: []apiResponse{
+		launchedOrMatched, errBadRequest,
+		{http.StatusUnauthorized, "the signature of the payload is missing or wrong", Response{}},
+		{http.StatusNotFound, "the hook does not exist", Response{}},
+		errMethod, errJobDisabled,
+		{http.StatusRequestEntityTooLarge, "the payload is too large", Response{}},
+		errTooManyRuns,
+		{http.StatusInternalServerError, "the secret of the hook cannot be read", Response{}},
+	}},
+	{method: http.MethodPost, path: "/validate", summary: "Check the specs of a schedule", body: "application/yaml", responses: []apiResponse{
+		{http.StatusOK, "the specs are valid", ValidateResponse{}},
+		errMethod,
+		{http.StatusUnprocessableEntity, "the specs are not valid", ValidateResponse{}},
+	}},
+	{method: http.MethodGet, path: "/simulate", summary: "List when the jobs would run on their cron", params: []apiParam{
+		{name: "from", in: "query", schema: "string", description: "RFC 3339 start of the window, defaults to now"},
+		{name: "to", in: "query", schema: "string", description: "RFC 3339 end of the window, defaults to 24 hours after its start"},
+	}, responses: []apiResponse{
+		{http.StatusOK, "the runs within the window", Simulation{}},
+		errBadRequest, errMethod,
+	}},
+	{method: http.MethodGet, path: "/metrics", summary: "Prometheus metrics, when cheek runs with --metrics", responses: []apiResponse{
+		{http.StatusOK, "the metrics", "text/plain"},
+	}},
+}
+
+// extraProperties lists fields that types add to their JSON by implementing json.Marshaler.
+var extraProperties = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(JobSpec{}): {
+		"next_run":           map[string]interface{}{"type": "string", "format": "date-time"},
+		"paused_since":       map[string]interface{}{"type": "string", "format": "date-time"},
+		"circuit_open_since": map[string]interface{}{"type": "string", "format": "date-time"},
+	},
+}
+
+// schemaBuilder derives JSON schemas from Go types, following the rules of
+// encoding/json. Named structs become components that get referenced.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "duration in nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.components[t.Name()]; !ok {
+			// registered upfront to end recursion on types that refer to themselves
+			b.components[t.Name()] = nil
+			b.components[t.Name()] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	b.fields(t, properties, &required)
+	for name, s := range extraProperties[t] {
+		properties[name] = s
+	}
+
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		object["required"] = required
+	}
+	return object
+}
+
+// fields adds the JSON fields of a struct to properties, those of embedded
+// structs included.
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, properties, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// content describes a request or response body.
+func (b *schemaBuilder) content(body interface{}) map[string]interface{} {
+	if mediaType, ok := body.(string); ok {
+		return map[string]interface{}{mediaType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	}
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(body))}}
+}
+
+// openAPIDocument generates the OpenAPI 3 document of the http api.
+func openAPIDocument() map[string]interface{} {
+	b := &schemaBuilder{components: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+
+	for _, op := range apiOperations {
+		operation := map[string]interface{}{"summary": op.summary}
+		if op.public {
+			operation["security"] = []interface{}{}
+		}
+
+		if len(op.params) > 0 {
+			params := []interface{}{}
+			for _, p := range op.params {
+				params = append(params, map[string]interface{}{
+					"name":        p.name,
+					"in":          p.in,
+					"required":    p.in == "path",
+					"description": p.description,
+					"schema":      map[string]interface{}{"type": p.schema},
+				})
+			}
+			operation["parameters"] = params
+		}
+
+		if op.body != nil {
+			operation["requestBody"] = map[string]interface{}{"content": b.content(op.body)}
+		}
+
+		responses := map[string]interface{}{}
+		for _, r := range op.responses {
+			response := map[string]interface{}{"description": r.description}
+			if r.body != nil {
+				response["content"] = b.content(r.body)
+			}
+			responses[strconv.Itoa(r.code)] = response
+		}
+		operation["responses"] = responses
+
+		item, ok := paths[op.path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "cheek",
+			"description": "http api of the cheek job scheduler",
+			"version":     Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "the token passed to --auth-token, only required when it is set",
+				},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}},
+	}
+}
+
+// openAPI serves the OpenAPI document of the http api.
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
@@ -0,0 +1,73 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	t.Setenv("CHEEK_TEST_OPENAPI_SECRET", "secret")
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Metrics = true
+	s := &Schedule{Jobs: map[string]*JobSpec{}, loc: time.Local, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	s.Jobs["foo"] = &JobSpec{
+		Name: "foo", Cron: "* * * * *", Command: []string{"true"},
+		WebhookTrigger: &WebhookTrigger{Secret: Secret{Env: "CHEEK_TEST_OPENAPI_SECRET"}},
+		globalSchedule: s, inFlight: newRunTracker(), log: s.log, cfg: cfg,
+	}
+	handler := setupMux(s)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	doc := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	// the schemas follow the json of the types
+	raw, _ := json.Marshal(doc)
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, ref := range strings.Split(string(raw), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		assert.Contains(t, schemas, name)
+	}
+	properties := func(name string) map[string]interface{} {
+		return schemas[name].(map[string]interface{})["properties"].(map[string]interface{})
+	}
+	assert.Contains(t, properties("JobRun"), "triggered_by")
+	assert.NotContains(t, properties("JobRun"), "logBuf")
+	assert.Contains(t, properties("JobSpec"), "next_run")
+	assert.Contains(t, properties("JobSpec"), "Env")
+	assert.Contains(t, properties("RunResponse"), "attempts")
+	assert.Contains(t, properties("RunResponse"), "triggered_at")
+	assert.Contains(t, properties("HealthResponse"), "stale_jobs")
+	assert.NotContains(t, properties("Schedule"), "Defaults")
+
+	// each documented endpoint exists and answers with one of its documented codes
+	for _, op := range apiOperations {
+		path := strings.NewReplacer("{name}", "foo", "{id}", "unknown").Replace(op.path)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(op.method, path, strings.NewReader("{}")))
+
+		codes := []int{}
+		for _, r := range op.responses {
+			codes = append(codes, r.code)
+		}
+		assert.Contains(t, codes, w.Code, "%s %s answered %d", op.method, path, w.Code)
+
+		paths := doc["paths"].(map[string]interface{})
+		assert.Contains(t, paths[op.path], strings.ToLower(op.method))
+		for _, code := range codes {
+			responses := paths[op.path].(map[string]interface{})[strings.ToLower(op.method)].(map[string]interface{})["responses"]
+			assert.Contains(t, responses, strconv.Itoa(code))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package cheek
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Supported ways to prefix the lines of the output of a run with a timestamp.
+const (
+	LogTimestampsRFC3339  string = "rfc3339"
+	LogTimestampsRelative string = "relative"
+)
+
+// logTimestampLayout is RFC3339 with milliseconds.
+const logTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func (j *JobSpec) ValidateLogTimestamps() error {
+	switch j.LogTimestamps {
+	case "", LogTimestampsRFC3339, LogTimestampsRelative:
+		return nil
+	}
+	return fmt.Errorf("log_timestamps for job '%s' should be one of '%s' or '%s', got '%s'", j.Name, LogTimestampsRFC3339, LogTimestampsRelative, j.LogTimestamps)
+}
+
+// logTimestamp returns what to prefix the lines of the output of a run that
+// started at start with, nil when the job doesn't timestamp its output.
+func (j *JobSpec) logTimestamp(start time.Time) func() string {
+	switch j.LogTimestamps {
+	case LogTimestampsRFC3339:
+		return func() string { return j.now().Format(logTimestampLayout) + " " }
+	case LogTimestampsRelative:
+		return func() string { return fmt.Sprintf("+%.3fs ", j.now().Sub(start).Seconds()) }
+	}
+	return nil
+}
+
+// timestampWriter prefixes every line written to it with a timestamp. The
+// prefix gets taken when the first byte of a line comes in, so lines that
+// arrive in several writes get a single timestamp.
+type timestampWriter struct {
+	w         io.Writer
+	timestamp func() string
+	midLine   bool
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	var b bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		if !t.midLine {
+			b.WriteString(t.timestamp())
+			t.midLine = true
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			b.Write(rest)
+			break
+		}
+		// a \r before the \n is part of the line
+		b.Write(rest[:i+1])
+		rest = rest[i+1:]
+		t.midLine = false
+	}
+
+	if _, err := t.w.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// capturedStream keeps the output of one of the streams of a run, up to max_log_size.
+type capturedStream struct {
+	buf    bytes.Buffer
+	capped *cappedWriter
+}
+
+func newCapturedStream(maxSize int) *capturedStream {
+	c := &capturedStream{}
+	c.capped = &cappedWriter{w: &c.buf, max: maxSize}
+	return c
+}
+
+func (c *capturedStream) Write(p []byte) (int, error) {
+	return c.capped.Write(p)
+}
+
+// String returns the captured output, noting how much got dropped if any.
+func (c *capturedStream) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.capped.dropped > 0 {
+		return c.buf.String() + truncationNote(c.capped.dropped)
+	}
+	return c.buf.String()
+}
+
+// lockedWriter serializes writes, exec copies stdout and stderr in separate
+// goroutines when they go to different writers.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// notifyLog is the part of the log of a run that notifications show, the
+// stderr of a failed run when it got captured separately and the full log otherwise.
+func (jr *JobRun) notifyLog() string {
+	if !jr.succeeded() && jr.Stderr != "" {
+		return jr.Stderr
+	}
+	return jr.Log
+}
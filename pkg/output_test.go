@@ -0,0 +1,199 @@
+package cheek
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitOutput(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:        "test",
+		Command:     []string{"sh", "-c", "echo out1; echo err1 1>&2; echo out2; echo err2 1>&2; exit 3"},
+		SplitOutput: true,
+		cfg:         cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 3, jr.Status)
+	assert.Equal(t, "out1\nout2\n", jr.Stdout)
+	assert.Equal(t, "err1\nerr2\n", jr.Stderr)
+	// the combined log holds all lines, but the order across streams is not guaranteed
+	lines := strings.Split(strings.TrimSpace(jr.Log), "\n")
+	assert.ElementsMatch(t, []string{"out1", "out2", "err1", "err2"}, lines)
+
+	b, err := json.Marshal(jr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"stdout":"out1\nout2\n"`)
+	assert.Contains(t, string(b), `"stderr":"err1\nerr2\n"`)
+
+	// notifications about the failed run show its stderr
+	assert.Equal(t, "test (exitcode 3):\nerr1\nerr2\n", newSlackPayload(&jr).Text)
+	assert.Contains(t, newDiscordPayload(&jr).Embeds[0].Description, "err2")
+	assert.NotContains(t, newDiscordPayload(&jr).Embeds[0].Description, "out2")
+
+	// a successful run shows the full log
+	j.Command = []string{"sh", "-c", "echo out; echo err 1>&2"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, 0, jr.Status)
+	assert.Equal(t, jr.Log, jr.notifyLog())
+}
+
+func TestMergedOutput(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sh", "-c", "echo out; echo err 1>&2; exit 1"},
+		cfg:     cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, "out\nerr\n", jr.Log)
+	assert.Empty(t, jr.Stdout)
+	assert.Empty(t, jr.Stderr)
+	assert.Equal(t, jr.Log, jr.notifyLog())
+
+	b, err := json.Marshal(jr)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), `"stderr"`)
+}
+
+func TestSplitOutputMaxLogSize(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:        "test",
+		Command:     []string{"sh", "-c", "head -c 100 /dev/zero | tr '\\0' x 1>&2"},
+		SplitOutput: true,
+		MaxLogSize:  10,
+		cfg:         cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, strings.Repeat("x", 10)+truncationNote(90), jr.Stderr)
+	assert.Equal(t, jr.Stderr, jr.Log)
+	assert.Empty(t, jr.Stdout)
+}
+
+func TestTimestampWriter(t *testing.T) {
+	var buf bytes.Buffer
+	n := 0
+	w := &timestampWriter{w: &buf, timestamp: func() string {
+		n++
+		return fmt.Sprintf("[%v] ", n)
+	}}
+
+	// a line that arrives in parts gets a single timestamp
+	for _, p := range []string{"hel", "lo\nwor", "ld", "\n"} {
+		written, err := w.Write([]byte(p))
+		assert.NoError(t, err)
+		assert.Equal(t, len(p), written)
+	}
+	assert.Equal(t, "[1] hello\n[2] world\n", buf.String())
+
+	// \r\n endings, also when split over writes
+	buf.Reset()
+	_, _ = w.Write([]byte("a\r\nb\r"))
+	_, _ = w.Write([]byte("\nc"))
+	assert.Equal(t, "[3] a\r\n[4] b\r\n[5] c", buf.String())
+
+	// no timestamp until the next line actually starts
+	buf.Reset()
+	_, _ = w.Write([]byte("\n"))
+	_, _ = w.Write([]byte(""))
+	assert.Equal(t, "\n", buf.String())
+}
+
+func TestLogTimestamps(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:          "test",
+		Command:       []string{"sh", "-c", "printf 'one\\ntw'; sleep 0.1; printf 'o\\n'; echo three 1>&2"},
+		LogTimestamps: LogTimestampsRFC3339,
+		cfg:           cfg,
+	}
+	assert.NoError(t, j.ValidateLogTimestamps())
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	lines := strings.Split(strings.TrimSuffix(jr.Log, "\n"), "\n")
+	assert.Len(t, lines, 3)
+	for i, want := range []string{"one", "two", "three"} {
+		ts, line, ok := strings.Cut(lines[i], " ")
+		assert.True(t, ok)
+		assert.Equal(t, want, line)
+		_, err := time.Parse(time.RFC3339, ts)
+		assert.NoError(t, err)
+	}
+
+	j.LogTimestamps = LogTimestampsRelative
+	j.SplitOutput = true
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Regexp(t, `^\+\d+\.\d{3}s one\n\+\d+\.\d{3}s two\n$`, jr.Stdout)
+	assert.Regexp(t, `^\+\d+\.\d{3}s three\n$`, jr.Stderr)
+
+	j.LogTimestamps = "unix"
+	assert.Error(t, j.ValidateLogTimestamps())
+}
+
+func TestSuppressLogsPerJob(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	quiet, chatty := true, false
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test_suppress_logs",
+		Command:        []string{"echo", "chatty job"},
+		SuppressLogs:   &chatty,
+		globalSchedule: &Schedule{loc: time.Local},
+		cfg:            cfg,
+		log:            NewLogger("debug", new(tsBuffer)),
+	}
+
+	// the job's own setting wins over the global one, either way
+	jr := j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, 0, jr.Status)
+
+	j.cfg.SuppressLogs = false
+	j.SuppressLogs = &quiet
+	j.Command = []string{"echo", "quiet job"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, 0, jr.Status)
+
+	// including when the job can't start
+	j.Command = []string{"{{ .oops"}
+	j.execCommand(context.Background(), "test", nil)
+
+	w.Close()
+	out, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "chatty job\n", string(out))
+}
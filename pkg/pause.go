@@ -0,0 +1,55 @@
+package cheek
+
+import (
+	"time"
+)
+
+// pause stops a job from running on its cron until it gets resumed and
+// returns since when it is paused. Pausing a paused job has no effect.
+func (s *Schedule) pause(name string, refTime time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if since, ok := s.paused[name]; ok {
+		return since
+	}
+	if s.paused == nil {
+		s.paused = map[string]time.Time{}
+	}
+	s.paused[name] = refTime
+	return refTime
+}
+
+// resume lets a paused job run on its cron again, it tells whether the job was paused.
+func (s *Schedule) resume(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.paused[name]
+	delete(s.paused, name)
+	return ok
+}
+
+// pausedSince tells whether a job is paused and since when.
+func (s *Schedule) pausedSince(name string) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	since, ok := s.paused[name]
+	return since, ok
+}
+
+// pausedJobs returns the paused jobs and since when they are paused.
+func (s *Schedule) pausedJobs() map[string]time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paused := make(map[string]time.Time, len(s.paused))
+	for name, since := range s.paused {
+		paused[name] = since
+	}
+	return paused
+}
@@ -0,0 +1,76 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseResume(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 4, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Cron: "* * * * *"},
+		"bar": {Command: []string{"date"}, Cron: "* * * * *"},
+	}, refTime)
+	s.cfg = NewConfig()
+	handler := setupMux(s)
+
+	post := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("POST", path, nil))
+		return resp
+	}
+
+	resp := post("/jobs/foo/pause")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	since, ok := s.pausedSince("foo")
+	assert.True(t, ok)
+
+	// pausing again keeps the original time
+	post("/jobs/foo/pause")
+	again, _ := s.pausedSince("foo")
+	assert.Equal(t, since, again)
+
+	// paused jobs let their ticks pass
+	due := s.dueJobs(refTime.Add(30 * time.Second))
+	assert.Len(t, due, 1)
+	assert.Equal(t, "bar", due[0].Name)
+	assert.Equal(t, time.Date(2023, 1, 1, 12, 6, 0, 0, time.UTC), s.Jobs["foo"].nextTick)
+
+	// the paused jobs are listed by /healthz and /schedule
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/healthz/", nil))
+	health := Response{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	assert.Equal(t, "ok", health.Status)
+	assert.Contains(t, health.PausedJobs, "foo")
+	assert.NotContains(t, health.PausedJobs, "bar")
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/schedule/", nil))
+	assert.Contains(t, resp.Body.String(), `"paused_since"`)
+
+	// reloads keep the paused state of jobs that still exist
+	ns := &Schedule{Jobs: map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Cron: "* * * * *"},
+		"baz": {Command: []string{"date"}, Cron: "* * * * *"},
+	}, TZLocation: "UTC", log: s.log}
+	assert.NoError(t, ns.initialize())
+	s.pause("bar", refTime)
+	s.swap(ns)
+	assert.Len(t, s.pausedJobs(), 1)
+	_, ok = s.pausedSince("foo")
+	assert.True(t, ok)
+
+	assert.Equal(t, http.StatusOK, post("/jobs/foo/resume").Code)
+	assert.Empty(t, s.pausedJobs())
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/foo/pause", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	assert.Equal(t, http.StatusNotFound, post("/jobs/nope/pause").Code)
+}
@@ -0,0 +1,120 @@
+//go:build !windows
+
+package cheek
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup makes the command start in a process group of its own,
+// this allows to terminate everything the job spawned in one go.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup asks the process group of a started command to stop.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return os.ErrProcessDone
+	}
+
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// killProcessGroup kills the process group of a started command and
+// returns the pids that were part of it.
+func killProcessGroup(cmd *exec.Cmd) ([]int, error) {
+	if cmd.Process == nil {
+		return []int{}, os.ErrProcessDone
+	}
+
+	pgid := cmd.Process.Pid
+	pids := processGroupPids(pgid)
+
+	err := syscall.Kill(-pgid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		return pids, os.ErrProcessDone
+	}
+
+	return pids, err
+}
+
+// processGroupPids lists the pids belonging to a process group, falls back
+// to only the group leader when /proc is not available (e.g. on darwin).
+func processGroupPids(pgid int) []int {
+	pids := []int{pgid}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return pids
+	}
+
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == pgid {
+			continue
+		}
+
+		stat, err := os.ReadFile(path.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// format is 'pid (comm) state ppid pgrp ...', comm can contain spaces
+		i := strings.LastIndexByte(string(stat), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 3 {
+			continue
+		}
+
+		if fields[2] == strconv.Itoa(pgid) {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+// processStartID identifies a process by the boot of the machine and the time
+// it started at, which tells it apart from a later process with the same pid.
+// It is empty when /proc is not available (e.g. on darwin).
+func processStartID(pid int) string {
+	boot, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	stat, err := os.ReadFile(path.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ""
+	}
+
+	// the start time is the 22nd field, the 20th after comm
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return ""
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return ""
+	}
+	return strings.TrimSpace(string(boot)) + "/" + fields[19]
+}
+
+// processAlive tells whether a process with the given pid is around.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
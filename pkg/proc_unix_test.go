@@ -0,0 +1,49 @@
+//go:build !windows
+
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKillProcessGroup(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	// spawn a grandchild and report its pid
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sh", "-c", "sleep 30 & echo $!; wait"},
+		Timeout: 500 * time.Millisecond,
+		cfg:     cfg,
+	}
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, StatusTimeout, jr.Status)
+	assert.Contains(t, jr.Log, "killed pids")
+
+	pid, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(jr.Log, "\n", 2)[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, jr.Log, strconv.Itoa(pid))
+
+	// grandchild should be gone, or at least be a zombie waiting to be reaped
+	time.Sleep(100 * time.Millisecond)
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err == nil {
+		assert.Contains(t, string(stat), ") Z ")
+	} else {
+		assert.Error(t, syscall.Kill(pid, 0))
+	}
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package cheek
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on windows, there are no process groups
+// to kill in one go.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills the direct child on windows, as it can't be
+// asked to stop.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	_, err := killProcessGroup(cmd)
+	return err
+}
+
+// killProcessGroup falls back to killing only the direct child on windows.
+func killProcessGroup(cmd *exec.Cmd) ([]int, error) {
+	if cmd.Process == nil {
+		return []int{}, os.ErrProcessDone
+	}
+
+	return []int{cmd.Process.Pid}, cmd.Process.Kill()
+}
+
+// processStartID is empty on windows, a later process with the same pid can't
+// be told apart.
+func processStartID(pid int) string {
+	return ""
+}
+
+// processAlive tells whether a process with the given pid is around, finding
+// it fails on windows when it isn't.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -7,4 +7,15 @@ const triggerJob = (jobName) => {
     Http.onreadystatechange = (e) => {
         console.log(Http.responseText)
     }
-}
\ No newline at end of file
+}
+
+const rerunRun = (jobName, runId) => {
+    const Http = new XMLHttpRequest();
+    const url = '/jobs/' + encodeURIComponent(jobName) + '/runs/' + encodeURIComponent(runId) + '/rerun?async=true';
+    Http.open("POST", url);
+    Http.send();
+
+    Http.onreadystatechange = (e) => {
+        console.log(Http.responseText)
+    }
+}
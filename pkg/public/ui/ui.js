@@ -0,0 +1,150 @@
+// The dashboard only talks to the JSON API of cheek, so anything it shows
+// is available to other clients as well.
+
+const runsShown = 20;
+
+const api = async (path, options) => {
+    const resp = await fetch(path, options);
+    if (!resp.ok) {
+        throw new Error(`${options && options.method || "GET"} ${path}: ${resp.status} ${resp.statusText}`);
+    }
+    return resp.json();
+};
+
+const el = (tag, attrs, ...children) => {
+    const e = document.createElement(tag);
+    Object.entries(attrs || {}).forEach(([k, v]) => e.setAttribute(k, v));
+    children.forEach((c) => e.append(c));
+    return e;
+};
+
+const showError = (err) => {
+    const p = document.getElementById("error");
+    p.textContent = err ? err.message : "";
+    p.hidden = !err;
+};
+
+const seconds = (ns) => ((ns || 0) / 1e9).toFixed(1) + "s";
+
+const formatTime = (t) => (t ? new Date(t).toLocaleString() : "-");
+
+const runStatus = (run) => {
+    if (!run) {
+        return el("span", {}, "never ran");
+    }
+    const ok = run.success;
+    return el("span", { class: ok ? "status-ok" : "status-failed", title: formatTime(run.triggered_at) },
+        ok ? "succeeded" : `${run.state || "failed"} (${run.status})`);
+};
+
+// sparkline draws the durations of runs, oldest first.
+const sparkline = (runs) => {
+    const ns = "http://www.w3.org/2000/svg";
+    const svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("class", "sparkline");
+    svg.setAttribute("viewBox", "0 0 100 20");
+    svg.setAttribute("preserveAspectRatio", "none");
+
+    const durations = runs.map((r) => r.duration || 0).reverse();
+    if (durations.length > 1) {
+        const max = Math.max(...durations) || 1;
+        const points = durations.map((d, i) => `${(i * 100) / (durations.length - 1)},${19 - (d / max) * 18}`);
+        const line = document.createElementNS(ns, "polyline");
+        line.setAttribute("points", points.join(" "));
+        svg.append(line);
+    }
+    const title = document.createElementNS(ns, "title");
+    title.textContent = durations.map(seconds).join(", ");
+    svg.append(title);
+    return svg;
+};
+
+const renderOverview = async () => {
+    const schedule = await api("/schedule/");
+    const names = Object.keys(schedule.jobs).sort();
+    const runs = await Promise.all(names.map((name) =>
+        api(`/jobs/${encodeURIComponent(name)}/runs?limit=${runsShown}&log=none`)));
+
+    const rows = names.map((name, i) => {
+        const job = schedule.jobs[name];
+        let next = formatTime(job.next_run);
+        if (job.disable) {
+            next = "disabled";
+        } else if (job.paused_since) {
+            next = `paused since ${formatTime(job.paused_since)}`;
+        } else if (job.circuit_open_since) {
+            next = `circuit open since ${formatTime(job.circuit_open_since)}`;
+        } else if (job.completed) {
+            next = "completed one-shot";
+        }
+        return el("tr", {},
+            el("td", {}, el("a", { href: `#/job/${encodeURIComponent(name)}` }, name)),
+            el("td", {}, runStatus(runs[i].runs[0])),
+            el("td", {}, next),
+            el("td", {}, sparkline(runs[i].runs)));
+    });
+    document.getElementById("jobs").replaceChildren(...rows);
+};
+
+const renderDetail = async (name) => {
+    const path = `/jobs/${encodeURIComponent(name)}`;
+    const [schedule, runs, stats] = await Promise.all([
+        api("/schedule/"), api(`${path}/runs?limit=${runsShown}`), api(`${path}/stats`)]);
+    const job = schedule.jobs[name];
+    if (!job) {
+        throw new Error(`cannot find job ${name}`);
+    }
+
+    document.getElementById("job-name").textContent = name;
+    const { runs: _, ...specs } = job;
+    document.getElementById("job-spec").textContent = JSON.stringify(specs, null, 2);
+    document.getElementById("job-stats").textContent = [
+        `runs: ${stats.total_runs} (${stats.successes} succeeded, ${stats.failures} failed, ${stats.consecutive_failures} failures in a row)`,
+        `success rate: ${stats.success_rate === undefined ? "-" : (stats.success_rate * 100).toFixed(1) + "%"}`,
+        `duration: min ${seconds(stats.min_duration)} | avg ${seconds(stats.avg_duration)} | p95 ${seconds(stats.p95_duration)} | max ${seconds(stats.max_duration)}`,
+        `last success: ${formatTime(stats.last_success)}`,
+        `last failure: ${formatTime(stats.last_failure)}`,
+    ].join("\n");
+    document.getElementById("trigger").onclick = () =>
+        api(`${path}/trigger?async=true`, { method: "POST", body: "{}" })
+            .then(() => setTimeout(route, 1000))
+            .catch(showError);
+    document.getElementById("refresh").onclick = route;
+
+    const items = runs.runs.map((run) => {
+        const log = el("pre", { class: "pre-wrap" }, run.log || "");
+        const item = el("details", {},
+            el("summary", { class: "run-header" },
+                `${formatTime(run.triggered_at)} | triggered by: ${run.triggered_by} | duration: ${seconds(run.duration)} | `,
+                runStatus(run)),
+            log);
+        // runs with a log file of their own only come with the last lines of it
+        if (run.log_file) {
+            item.addEventListener("toggle", () => item.open && api(`${path}/runs/${encodeURIComponent(run.id)}`)
+                .then((detail) => { log.textContent = detail.log || ""; })
+                .catch(showError), { once: true });
+        }
+        return item;
+    });
+    document.getElementById("runs").replaceChildren(...items);
+};
+
+// route renders the view the location hash points to, #/job/{name} or the overview.
+const route = async () => {
+    const match = window.location.hash.match(/^#\/job\/(.+)$/);
+    document.getElementById("overview").hidden = !!match;
+    document.getElementById("detail").hidden = !match;
+    try {
+        if (match) {
+            await renderDetail(decodeURIComponent(match[1]));
+        } else {
+            await renderOverview();
+        }
+        showError(null);
+    } catch (err) {
+        showError(err);
+    }
+};
+
+window.addEventListener("hashchange", route);
+route();
@@ -0,0 +1,109 @@
+package cheek
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// triggerLimiter throttles the runs of a job that get requested via the http
+// api: a token bucket caps how many get through per minute and identical
+// triggers within the debounce window end up in a single run. A nil
+// triggerLimiter lets everything through.
+type triggerLimiter struct {
+	mu      sync.Mutex
+	tokens  float64
+	updated time.Time
+	// runs that identical triggers coalesce into, by trigger and params
+	pending map[string]debouncedTrigger
+}
+
+type debouncedTrigger struct {
+	runID string
+	at    time.Time
+}
+
+func newTriggerLimiter() *triggerLimiter {
+	return &triggerLimiter{pending: map[string]debouncedTrigger{}}
+}
+
+func (j *JobSpec) ValidateTriggerLimits() error {
+	if j.MaxTriggersPerMinute < 0 {
+		return fmt.Errorf("max_triggers_per_minute for job '%s' cannot be negative", j.Name)
+	}
+	if j.TriggerDebounce < 0 {
+		return fmt.Errorf("trigger_debounce for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
+
+// admitTrigger decides on a run requested via the http api at refTime. It
+// returns the id the run should get and whether that is the id of an
+// identical run triggered within the debounce window, which the request
+// coalesces into. When the job got triggered too often it returns how long
+// until the next trigger is let through instead.
+func (j *JobSpec) admitTrigger(trigger string, params map[string]string, refTime time.Time) (runID string, coalesced bool, retryAfter time.Duration) {
+	l := j.limiter
+	if l == nil {
+		return newRunID(), false, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := ""
+	if j.TriggerDebounce > 0 {
+		for k, p := range l.pending {
+			if refTime.Sub(p.at) >= j.TriggerDebounce {
+				delete(l.pending, k)
+			}
+		}
+		b, _ := json.Marshal(params)
+		key = trigger + string(b)
+		if p, ok := l.pending[key]; ok {
+			runMetrics.triggerDebounced(j.Name)
+			return p.runID, true, 0
+		}
+	}
+
+	if rate := float64(j.MaxTriggersPerMinute); rate > 0 {
+		if l.updated.IsZero() {
+			l.tokens = rate
+		} else {
+			l.tokens = math.Min(rate, l.tokens+refTime.Sub(l.updated).Minutes()*rate)
+		}
+		l.updated = refTime
+		if l.tokens < 1 {
+			runMetrics.triggerRateLimited(j.Name)
+			return "", false, time.Duration((1 - l.tokens) / rate * float64(time.Minute))
+		}
+		l.tokens--
+	}
+
+	runID = newRunID()
+	if key != "" {
+		l.pending[key] = debouncedTrigger{runID: runID, at: refTime}
+	}
+	return runID, false, 0
+}
+
+// admitRequest applies the trigger limits of a job to a request. When the
+// request is not to start a run it answers it, with 429 when the job got
+// triggered too often and with 202 and the id of the run it got coalesced into.
+func admitRequest(w http.ResponseWriter, job *JobSpec, trigger string, params map[string]string, kind string) (string, bool) {
+	runID, coalesced, retryAfter := job.admitTrigger(trigger, params, time.Now())
+	switch {
+	case coalesced:
+		writeJSON(w, http.StatusAccepted, Response{Job: job.Name, Status: "coalesced", Type: kind, RunID: runID})
+		return "", false
+	case runID == "":
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, Response{Job: job.Name, Status: "error: too many triggers", Type: kind})
+		return "", false
+	}
+	return runID, true
+}
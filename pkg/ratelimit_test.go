@@ -0,0 +1,95 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmitTrigger(t *testing.T) {
+	j := &JobSpec{Name: "limited", MaxTriggersPerMinute: 2, limiter: newTriggerLimiter()}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// the bucket starts out full
+	for i := 0; i < 2; i++ {
+		id, coalesced, _ := j.admitTrigger("manual", nil, now)
+		assert.NotEmpty(t, id)
+		assert.False(t, coalesced)
+	}
+	id, _, retryAfter := j.admitTrigger("manual", nil, now)
+	assert.Empty(t, id)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// and refills at the configured rate
+	id, _, _ = j.admitTrigger("manual", nil, now.Add(30*time.Second))
+	assert.NotEmpty(t, id)
+	id, _, _ = j.admitTrigger("manual", nil, now.Add(40*time.Second))
+	assert.Empty(t, id)
+
+	// identical triggers within the debounce window coalesce
+	j = &JobSpec{Name: "debounced", TriggerDebounce: 10 * time.Second, limiter: newTriggerLimiter()}
+	first, _, _ := j.admitTrigger("manual", map[string]string{"a": "1"}, now)
+	id, coalesced, _ := j.admitTrigger("manual", map[string]string{"a": "1"}, now.Add(5*time.Second))
+	assert.True(t, coalesced)
+	assert.Equal(t, first, id)
+
+	// other params or triggers don't
+	id, coalesced, _ = j.admitTrigger("manual", map[string]string{"a": "2"}, now.Add(5*time.Second))
+	assert.False(t, coalesced)
+	assert.NotEqual(t, first, id)
+	_, coalesced, _ = j.admitTrigger("webhook[x]", map[string]string{"a": "1"}, now.Add(5*time.Second))
+	assert.False(t, coalesced)
+
+	// nor do they once the window has passed
+	id, coalesced, _ = j.admitTrigger("manual", map[string]string{"a": "1"}, now.Add(10*time.Second))
+	assert.False(t, coalesced)
+	assert.NotEqual(t, first, id)
+
+	assert.Error(t, (&JobSpec{MaxTriggersPerMinute: -1}).ValidateTriggerLimits())
+	assert.Error(t, (&JobSpec{TriggerDebounce: -time.Second}).ValidateTriggerLimits())
+}
+
+func TestTriggerLimitsViaAPI(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{Jobs: map[string]*JobSpec{}, loc: time.Local, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	j := &JobSpec{
+		Name: "limited", Cron: "* * * * *", Command: []string{"true"},
+		MaxTriggersPerMinute: 1, TriggerDebounce: time.Minute,
+		globalSchedule: s, inFlight: newRunTracker(), limiter: newTriggerLimiter(), log: s.log, cfg: cfg,
+	}
+	s.Jobs["limited"] = j
+	handler := setupMux(s)
+
+	trigger := func(params string) (*httptest.ResponseRecorder, Response) {
+		req := httptest.NewRequest(http.MethodPost, "/jobs/limited/trigger?async=true", strings.NewReader(params))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		resp := Response{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return w, resp
+	}
+
+	// cron runs are not subject to the limits
+	j.execScheduled(context.Background(), "cron", map[string]string{})
+
+	w, first := trigger(`{"params": {"a": "1"}}`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "accepted", first.Status)
+
+	w, resp := trigger(`{"params": {"a": "1"}}`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "coalesced", resp.Status)
+	assert.Equal(t, first.RunID, resp.RunID)
+
+	w, resp = trigger(`{"params": {"a": "2"}}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "error: too many triggers", resp.Status)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
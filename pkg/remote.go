@@ -0,0 +1,166 @@
+package cheek
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// remoteTimeout bounds fetching a schedule from a url.
+const remoteTimeout = 30 * time.Second
+
+// maxRemoteSpecsSize bounds the size of a schedule fetched from a url.
+const maxRemoteSpecsSize = 10 << 20
+
+// remoteVersion identifies the version of a schedule that got fetched from a url.
+type remoteVersion struct {
+	etag         string
+	lastModified string
+	digest       string
+	fetchedAt    time.Time
+}
+
+// remoteSpecs are the specs of a schedule as fetched from a url.
+type remoteSpecs struct {
+	body    []byte
+	version remoteVersion
+}
+
+// isURL tells whether a schedule argument refers to a schedule served over http(s).
+func isURL(fn string) bool {
+	return strings.HasPrefix(fn, "http://") || strings.HasPrefix(fn, "https://")
+}
+
+// fetchSpecs downloads the specs of a schedule. When the server tells the
+// specs did not change since the given version, nil is returned.
+func fetchSpecs(cfg Config, specsURL string, since remoteVersion) (*remoteSpecs, error) {
+	req, err := http.NewRequest(http.MethodGet, specsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ScheduleToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.ScheduleToken)
+	}
+	if since.etag != "" {
+		req.Header.Set("If-None-Match", since.etag)
+	}
+	if since.lastModified != "" {
+		req.Header.Set("If-Modified-Since", since.lastModified)
+	}
+
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("fetching schedule from '%s': unexpected response status: %s", specsURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSpecsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteSpecsSize {
+		return nil, fmt.Errorf("fetching schedule from '%s': schedule is larger than %v bytes", specsURL, maxRemoteSpecsSize)
+	}
+
+	digest := sha256.Sum256(body)
+	return &remoteSpecs{
+		body: body,
+		version: remoteVersion{
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			digest:       hex.EncodeToString(digest[:]),
+			fetchedAt:    time.Now(),
+		},
+	}, nil
+}
+
+// loadRemoteSchedule parses and validates specs that got fetched from a url.
+func loadRemoteSchedule(log zerolog.Logger, cfg Config, specsURL string, specs *remoteSpecs) (*Schedule, error) {
+	s, err := parseSpecs(specsURL, specs.body)
+	if err != nil {
+		return nil, err
+	}
+	for name, j := range s.Jobs {
+		if j == nil {
+			j = &JobSpec{}
+			s.Jobs[name] = j
+		}
+		j.SourceFile = specsURL
+	}
+	s.log = log
+	s.cfg = cfg
+	s.fn = specsURL
+	s.remote = specs.version
+
+	if err := s.initialize(); err != nil {
+		return nil, err
+	}
+	s.log.Info().Msg("Scheduled loaded and validated")
+	return s, nil
+}
+
+// refetchIfDue fetches the specs of a schedule served over http(s) again once
+// its reload_interval passed, new specs are only swapped in when they changed
+// and are valid. The current schedule keeps running when fetching fails. Only
+// one fetch is in progress at a time.
+func (s *Schedule) refetchIfDue(refTime time.Time) {
+	s.mu.Lock()
+	if s.fetching || s.ReloadInterval <= 0 || refTime.Sub(s.remote.fetchedAt) < s.ReloadInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.fetching = true
+	// only try once per interval
+	s.remote.fetchedAt = refTime
+	since := s.remote
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.fetching = false
+		s.mu.Unlock()
+	}()
+
+	specs, err := fetchSpecs(s.cfg, s.fn, since)
+	switch {
+	case err != nil:
+		s.log.Warn().Err(err).Msgf("cannot fetch schedule '%s', keeping the current schedule", s.fn)
+		return
+	case specs == nil:
+		s.log.Debug().Msgf("schedule '%s' not modified", s.fn)
+		return
+	case specs.version.digest == since.digest:
+		s.mu.Lock()
+		s.remote = specs.version
+		s.remote.fetchedAt = refTime
+		s.mu.Unlock()
+		return
+	}
+
+	s.log.Info().Msgf("schedule '%s' changed, reloading", s.fn)
+	ns, err := loadRemoteSchedule(s.log, s.cfg, s.fn, specs)
+	if err != nil {
+		// don't try the same broken specs again
+		s.mu.Lock()
+		s.remote.etag, s.remote.lastModified, s.remote.digest = specs.version.etag, specs.version.lastModified, specs.version.digest
+		s.mu.Unlock()
+		s.log.Warn().Err(err).Msg("schedule reload failed, keeping the current schedule")
+		return
+	}
+	ns.remote.fetchedAt = refTime
+	s.apply(ns)
+}
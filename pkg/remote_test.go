@@ -0,0 +1,154 @@
+package cheek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// specsServer serves schedule specs with an ETag and keeps count of the requests it gets.
+type specsServer struct {
+	mu       sync.Mutex
+	specs    string
+	etag     string
+	down     bool
+	requests int
+	notMod   int
+	auth     string
+}
+
+func (ss *specsServer) set(specs string, etag string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.specs, ss.etag = specs, etag
+}
+
+func (ss *specsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.requests++
+	ss.auth = r.Header.Get("Authorization")
+	if ss.down {
+		http.Error(w, "down", http.StatusBadGateway)
+		return
+	}
+	if r.Header.Get("If-None-Match") == ss.etag {
+		ss.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", ss.etag)
+	_, _ = w.Write([]byte(ss.specs))
+}
+
+func TestRemoteSchedule(t *testing.T) {
+	ss := &specsServer{}
+	ss.set(`
+reload_interval: 1m
+jobs:
+  foo:
+    command: date
+    cron: "* * * * *"
+`, `"v1"`)
+	ts := httptest.NewServer(ss)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.ScheduleToken = "s3cret"
+	s, err := loadSchedule(NewLogger("debug", new(tsBuffer)), cfg, ts.URL+"/jobs.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, s.Jobs, "foo")
+	assert.Equal(t, ts.URL+"/jobs.yaml", s.Jobs["foo"].SourceFile)
+	assert.Equal(t, "Bearer s3cret", ss.auth)
+	fetchedAt := s.remote.fetchedAt
+
+	// nothing happens before the interval passed
+	s.reloadIfChanged()
+	assert.Equal(t, 1, ss.requests)
+
+	// unchanged specs are not reloaded
+	foo := s.Jobs["foo"]
+	s.refetchIfDue(fetchedAt.Add(time.Minute))
+	assert.Equal(t, 1, ss.notMod)
+	assert.Same(t, foo, s.Jobs["foo"])
+
+	// invalid specs keep the current schedule running
+	ss.set("jobs:\n  foo:\n    command: date\n    cron: \"* * *\"\n", `"v2"`)
+	s.refetchIfDue(fetchedAt.Add(2 * time.Minute))
+	assert.Same(t, foo, s.Jobs["foo"])
+
+	// and so do network failures
+	ss.mu.Lock()
+	ss.down = true
+	ss.mu.Unlock()
+	s.refetchIfDue(fetchedAt.Add(3 * time.Minute))
+	assert.Same(t, foo, s.Jobs["foo"])
+
+	ss.mu.Lock()
+	ss.down = false
+	ss.mu.Unlock()
+	ss.set("reload_interval: 1m\njobs:\n  foo:\n    command: date\n  bar:\n    command: date\n", `"v3"`)
+	s.refetchIfDue(fetchedAt.Add(4 * time.Minute))
+	assert.Len(t, s.Jobs, 2)
+	assert.Equal(t, `"v3"`, s.remote.etag)
+
+	ss.mu.Lock()
+	ss.down = true
+	ss.mu.Unlock()
+	_, err = loadSchedule(NewLogger("debug", new(tsBuffer)), cfg, ts.URL)
+	assert.ErrorContains(t, err, "502 Bad Gateway")
+}
+
+func TestRefetchDoesNotBlockTicks(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer ts.Close()
+
+	s := &Schedule{fn: ts.URL, ReloadInterval: time.Minute, log: NewLogger("debug", new(tsBuffer)), cfg: NewConfig()}
+	done := make(chan struct{})
+	go func() {
+		s.reloadIfChanged()
+		s.reloadIfChanged()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("checking for changes waited for the schedule to be fetched")
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&requests) == 1 }, time.Second, 10*time.Millisecond)
+
+	// a fetch in progress is not started again
+	s.refetchIfDue(time.Now().Add(time.Hour))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return !s.fetching
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFetchSpecsSizeLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("#", maxRemoteSpecsSize+1)))
+	}))
+	defer ts.Close()
+
+	_, err := fetchSpecs(NewConfig(), ts.URL, remoteVersion{})
+	assert.ErrorContains(t, err, "larger than")
+}
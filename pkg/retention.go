@@ -0,0 +1,133 @@
+package cheek
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// jobLogLocks serializes appending to and pruning of job logs, per log file.
+var jobLogLocks sync.Map
+
+func jobLogLock(fp string) *sync.Mutex {
+	l, _ := jobLogLocks.LoadOrStore(fp, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
+
+// retention returns how many runs of the job are kept in its log and for how
+// long, zero meaning no limit. Job settings take precedence over the schedule's.
+func (j *JobSpec) retention() (maxRuns int, maxAge time.Duration) {
+	maxRuns, maxAge = j.MaxRunsKept, j.MaxLogAge
+	if j.globalSchedule == nil {
+		return maxRuns, maxAge
+	}
+
+	sMaxRuns, sMaxAge := j.globalSchedule.retention()
+	if maxRuns == 0 {
+		maxRuns = sMaxRuns
+	}
+	if maxAge == 0 {
+		maxAge = sMaxAge
+	}
+	return maxRuns, maxAge
+}
+
+// retention returns the schedule wide retention settings.
+func (s *Schedule) retention() (int, time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.MaxRunsKept, s.MaxLogAge
+}
+
+func (j *JobSpec) ValidateRetention() error {
+	if j.MaxRunsKept < 0 {
+		return fmt.Errorf("max_runs_kept for job '%s' cannot be negative", j.Name)
+	}
+	if j.MaxLogAge < 0 {
+		return fmt.Errorf("max_log_age for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
+
+// pruneRuns drops the runs from the job's log that fall outside its retention settings.
+func (j *JobSpec) pruneRuns() {
+	maxRuns, maxAge := j.retention()
+	if maxRuns == 0 && maxAge == 0 {
+		return
+	}
+
+	pruned, err := j.history().prune(j.Name, maxRuns, maxAge, j.now())
+	if err != nil {
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("could not prune job log")
+		return
+	}
+	if pruned > 0 {
+		j.log.Debug().Str("job", j.Name).Msgf("pruned %v runs from job log", pruned)
+		if err := j.removeOrphanedLogFiles(); err != nil {
+			j.log.Warn().Str("job", j.Name).Err(err).Msg("could not remove log files of pruned runs")
+		}
+	}
+}
+
+// pruneJobLog rewrites a job log to only hold the newest maxRuns runs that got
+// triggered less than maxAge before refTime and returns how many runs got dropped.
+// The new log is written to a temporary file that replaces the original.
+func pruneJobLog(fp string, maxRuns int, maxAge time.Duration, refTime time.Time) (int, error) {
+	lock := jobLogLock(fp)
+	lock.Lock()
+	defer lock.Unlock()
+
+	lines, total, err := readLines(fp, 0, maxRuns)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	keep := lines
+	if maxAge > 0 {
+		cutoff := refTime.Add(-maxAge)
+		keep = []string{}
+		for _, line := range lines {
+			jr := JobRun{}
+			// lines that can't be decoded are kept, there is no telling how old they are
+			if err := json.Unmarshal([]byte(line), &jr); err == nil && jr.TriggeredAt.Before(cutoff) {
+				continue
+			}
+			keep = append(keep, line)
+		}
+	}
+
+	if len(keep) == total {
+		return 0, nil
+	}
+
+	tmp, err := os.CreateTemp(path.Dir(fp), path.Base(fp)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	// lines are newest first, the log is oldest first
+	for i := len(keep) - 1; i >= 0; i-- {
+		if _, err := tmp.WriteString(keep[i]); err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), fp); err != nil {
+		return 0, err
+	}
+
+	return total - len(keep), nil
+}
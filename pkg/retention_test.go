@@ -0,0 +1,105 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestRuns(t *testing.T, fp string, triggeredAt ...time.Time) {
+	f, err := os.Create(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for i, ts := range triggeredAt {
+		if err := json.NewEncoder(f).Encode(JobRun{Name: "test", Log: fmt.Sprint(i), TriggeredAt: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPruneJobLog(t *testing.T) {
+	fp := path.Join(t.TempDir(), "test.job.jsonl")
+	refTime := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	writeTestRuns(t, fp, refTime.Add(-5*day), refTime.Add(-3*day), refTime.Add(-2*day), refTime.Add(-day), refTime)
+
+	// nothing to prune
+	pruned, err := pruneJobLog(fp, 10, 0, refTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+
+	// by age
+	pruned, err = pruneJobLog(fp, 0, 4*day, refTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	// by number of runs, the newest are kept in their original order
+	pruned, err = pruneJobLog(fp, 2, 0, refTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+
+	lines, err := readLastLines(fp, 0)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 2)
+	jrs, err := readLastJobRuns(zerolog.Nop(), fp, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "4", jrs[0].Log)
+	assert.Equal(t, "3", jrs[1].Log)
+
+	fi, err := os.Stat(fp)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	// a missing log is not an error
+	pruned, err = pruneJobLog(path.Join(t.TempDir(), "missing.job.jsonl"), 2, 0, refTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+}
+
+func TestRetention(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	s := &Schedule{MaxRunsKept: 3, MaxLogAge: time.Hour, loc: time.Local}
+	j := &JobSpec{
+		Name:           "test_retention",
+		Command:        []string{"echo", "hi"},
+		MaxRunsKept:    2,
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+	}
+
+	maxRuns, maxAge := j.retention()
+	assert.Equal(t, 2, maxRuns)
+	assert.Equal(t, time.Hour, maxAge)
+
+	_ = os.Remove(jobLogFile(j.Name))
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.execCommandWithRetry(context.Background(), "test", nil)
+		}()
+	}
+	wg.Wait()
+
+	lines, err := readLastLines(jobLogFile(j.Name), 0)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 2)
+
+	j.MaxRunsKept = -1
+	assert.Error(t, j.ValidateRetention())
+}
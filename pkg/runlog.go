@@ -0,0 +1,130 @@
+package cheek
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Supported ways to keep the logs of runs.
+const (
+	// LogModeInline keeps the log of a run in its record in the history.
+	LogModeInline string = "inline"
+	// LogModeFile writes the log of a run to a file of its own, the record
+	// only holds the last lines of it.
+	LogModeFile string = "file"
+)
+
+// runLogTailLines is how many of the last lines of a run's log stay in its
+// record with log_mode: file.
+const runLogTailLines = 20
+
+// logMode returns how the logs of the job's runs are kept. The job setting
+// takes precedence over the schedule's.
+func (j *JobSpec) logMode() string {
+	if j.LogMode != "" || j.globalSchedule == nil {
+		return j.LogMode
+	}
+
+	j.globalSchedule.mu.RLock()
+	defer j.globalSchedule.mu.RUnlock()
+	return j.globalSchedule.LogMode
+}
+
+func validLogMode(mode string) error {
+	switch mode {
+	case "", LogModeInline, LogModeFile:
+		return nil
+	}
+	return fmt.Errorf("should be one of '%s' or '%s', got '%s'", LogModeInline, LogModeFile, mode)
+}
+
+func (j *JobSpec) ValidateLogMode() error {
+	if err := validLogMode(j.LogMode); err != nil {
+		return fmt.Errorf("log_mode for job '%s' %w", j.Name, err)
+	}
+	return nil
+}
+
+// runLogDir is where the log files of the runs of a job go.
+func runLogDir(jobName string) string {
+	return path.Join(CheekPath(), jobName)
+}
+
+// saveLogFile writes the log of the run to its own file and leaves the last
+// lines of it in the run. The full log is handed back to put it back in place
+// once the run got recorded.
+func (jr *JobRun) saveLogFile() (string, error) {
+	if err := os.MkdirAll(runLogDir(jr.Name), 0o755); err != nil {
+		return "", err
+	}
+	fn := path.Join(jr.Name, jr.ID+".log")
+	if err := os.WriteFile(path.Join(CheekPath(), fn), []byte(jr.Log), 0o644); err != nil {
+		return "", err
+	}
+
+	full := jr.Log
+	jr.LogFile = fn
+	lines := strings.SplitAfter(jr.Log, "\n")
+	if len(lines) > runLogTailLines+1 {
+		jr.Log = strings.Join(lines[len(lines)-runLogTailLines-1:], "")
+	}
+	return full, nil
+}
+
+// loadLogFile puts the log from the run's own file in place of the last lines
+// of it. When the file is gone, the last lines are all there is.
+func (jr *JobRun) loadLogFile() error {
+	if jr.LogFile == "" {
+		return nil
+	}
+	b, err := readLog(path.Join(CheekPath(), jr.LogFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	jr.Log = string(b)
+	return nil
+}
+
+// removeOrphanedLogFiles removes the log files of runs of the job that are no
+// longer in its history.
+func (j *JobSpec) removeOrphanedLogFiles() error {
+	dir := runLogDir(j.Name)
+	lock := jobLogLock(dir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	if _, err := j.history().each(j.Name, func(jr JobRun) {
+		if jr.LogFile != "" {
+			kept[filepath.Base(jr.LogFile)] = true
+		}
+	}); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		// log files might have been compressed
+		if e.IsDir() || !strings.HasSuffix(strings.TrimSuffix(e.Name(), ".gz"), ".log") || kept[strings.TrimSuffix(e.Name(), ".gz")] {
+			continue
+		}
+		if err := os.Remove(path.Join(dir, e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
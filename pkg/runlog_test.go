@@ -0,0 +1,82 @@
+package cheek
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLogMode(t *testing.T) {
+	assert.NoError(t, (&JobSpec{}).ValidateLogMode())
+	assert.NoError(t, (&JobSpec{LogMode: LogModeFile}).ValidateLogMode())
+	assert.NoError(t, (&JobSpec{LogMode: LogModeInline}).ValidateLogMode())
+	assert.EqualError(t, (&JobSpec{Name: "test", LogMode: "files"}).ValidateLogMode(), "log_mode for job 'test' should be one of 'inline' or 'file', got 'files'")
+
+	s := &Schedule{Jobs: map[string]*JobSpec{}, LogMode: "files"}
+	assert.Len(t, s.validate(), 1)
+}
+
+func TestLogModeFile(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	// the setting of the schedule applies unless the job has one
+	s := &Schedule{LogMode: LogModeFile, loc: time.Local}
+	j := &JobSpec{
+		Name:           "test",
+		Command:        []string{"sh", "-c", "seq 1 100"},
+		MaxRunsKept:    2,
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+	}
+	assert.Equal(t, LogModeFile, j.logMode())
+
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
+	full := jr.Log
+	assert.True(t, strings.HasPrefix(full, "1\n2\n"))
+	assert.Equal(t, path.Join("test", jr.ID+".log"), jr.LogFile)
+
+	b, err := os.ReadFile(path.Join(CheekPath(), jr.LogFile))
+	assert.NoError(t, err)
+	assert.Equal(t, full, string(b))
+
+	// the history only holds the last lines
+	runs, err := s.history().lastRuns("test", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, jr.LogFile, runs[0].LogFile)
+	assert.True(t, strings.HasPrefix(runs[0].Log, "81\n"))
+	assert.True(t, strings.HasSuffix(runs[0].Log, "100\n"))
+
+	// looking up the run brings back the full log
+	found, ok, err := findRun(s.history(), "test", jr.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, full, found.Log)
+
+	// pruning the history removes the log files of the runs that are gone, and
+	// those that never made it into the history
+	assert.NoError(t, os.WriteFile(path.Join(runLogDir("test"), "orphan.log"), []byte("x"), 0o644))
+	for i := 0; i < 3; i++ {
+		j.execCommandWithRetry(context.Background(), "test", nil)
+	}
+	entries, err := os.ReadDir(runLogDir("test"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	_, err = os.Stat(path.Join(CheekPath(), jr.LogFile))
+	assert.True(t, os.IsNotExist(err))
+
+	// inline keeps the log with the run
+	j.LogMode = LogModeInline
+	jr = j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Empty(t, jr.LogFile)
+	runs, err = s.history().lastRuns("test", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, jr.Log, runs[0].Log)
+}
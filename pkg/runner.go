@@ -0,0 +1,49 @@
+package cheek
+
+// runner is where the command of a job gets executed.
+type runner interface {
+	// command returns what to execute locally to run the job's command,
+	// env holds the variables the job adds to the host's environment.
+	command(command []string, env []string) []string
+	// stop takes down whatever the run started beyond its local process,
+	// which is about to be killed.
+	stop() error
+	// failedToStart tells whether the exit code of the local process means
+	// that the job's command could not be started.
+	failedToStart(status int) bool
+	// done cleans up after the local process of a run that got started,
+	// once the run is over.
+	done() error
+}
+
+// runner returns the runner for a run of the job, jobs with ssh don't start a
+// local process and run through an sshRunner instead.
+func (j *JobSpec) runner(jr *JobRun) runner {
+	if j.Container != nil {
+		return &containerRunner{spec: j.Container, job: j, name: containerName(jr)}
+	}
+	return localRunner{job: j}
+}
+
+// localRunner executes the command of a job on this host.
+type localRunner struct {
+	job *JobSpec
+}
+
+func (r localRunner) command(command []string, env []string) []string {
+	return r.job.limitCommand(command)
+}
+
+func (r localRunner) stop() error {
+	return nil
+}
+
+func (r localRunner) done() error {
+	return nil
+}
+
+// failedToStart tells whether the command could not be started by the shell
+// that applies the job's resource limits, without limits cmd.Start tells.
+func (r localRunner) failedToStart(status int) bool {
+	return r.job.limitedExecFailed(status)
+}
@@ -1,10 +1,14 @@
 package cheek
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,54 +19,453 @@ import (
 
 // Schedule defines specs of a job schedule.
 type Schedule struct {
-	Jobs       map[string]*JobSpec `yaml:"jobs" json:"jobs"`
-	OnSuccess  OnEvent             `yaml:"on_success,omitempty" json:"on_success,omitempty"`
-	OnError    OnEvent             `yaml:"on_error,omitempty" json:"on_error,omitempty"`
-	TZLocation string              `yaml:"tz_location,omitempty" json:"tz_location,omitempty"`
-	loc        *time.Location
-	log        zerolog.Logger
-	cfg        Config
+	Jobs               map[string]*JobSpec `yaml:"jobs" json:"jobs"`
+	OnSuccess          OnEvent             `yaml:"on_success,omitempty" json:"on_success,omitempty"`
+	OnError            OnEvent             `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	OnStart            OnEvent             `yaml:"on_start,omitempty" json:"on_start,omitempty"`
+	OnRetriesExhausted OnEvent             `yaml:"on_retries_exhausted,omitempty" json:"on_retries_exhausted,omitempty"`
+	OnStale            OnEvent             `yaml:"on_stale,omitempty" json:"on_stale,omitempty"`
+	Defaults           yaml.Node           `yaml:"defaults,omitempty" json:"-"`
+	TZLocation         string              `yaml:"tz_location,omitempty" json:"tz_location,omitempty"`
+	MaxConcurrentJobs  int                 `yaml:"max_concurrent_jobs,omitempty" json:"max_concurrent_jobs,omitempty"`
+	MaxRunsKept        int                 `yaml:"max_runs_kept,omitempty" json:"max_runs_kept,omitempty"`
+	MaxLogAge          time.Duration       `yaml:"max_log_age,omitempty" json:"max_log_age,omitempty"`
+	MaxLogSize         int                 `yaml:"max_log_size,omitempty" json:"max_log_size,omitempty"`
+	LogMode            string              `yaml:"log_mode,omitempty" json:"log_mode,omitempty"`
+	CompressLogsAfter  time.Duration       `yaml:"compress_logs_after,omitempty" json:"compress_logs_after,omitempty"`
+	EventSink          *EventSink          `yaml:"event_sink,omitempty" json:"event_sink,omitempty"`
+	MaxTriggerDepth    int                 `yaml:"max_trigger_depth,omitempty" json:"max_trigger_depth,omitempty"`
+	ReloadInterval     time.Duration       `yaml:"reload_interval,omitempty" json:"reload_interval,omitempty"`
+	Strict             bool                `yaml:"strict,omitempty" json:"strict,omitempty"`
+	ExpandEnv          bool                `yaml:"expand_env,omitempty" json:"expand_env,omitempty"`
+	Blackout           []Blackout          `yaml:"blackout,omitempty" json:"blackout,omitempty"`
+	slots              chan struct{}
+	loc                *time.Location
+	log                zerolog.Logger
+	cfg                Config
+	// guards swapping in a reloaded schedule
+	mu      sync.RWMutex
+	fn      string
+	modTime time.Time
+	// time of the last check for due jobs
+	lastTick time.Time
+	// when the scheduling loop started, zero when it never did
+	loopStarted time.Time
+	// schedule wide settings that are set in the specs file
+	settings []string
+	// version of specs fetched from a url and whether it is being fetched again
+	remote   remoteVersion
+	fetching bool
+	// when the logs got last checked for ones to compress and whether they are being compressed
+	compressedAt time.Time
+	compressing  bool
+	// runs on their way to the event sink, kept across reloads
+	sink *eventSink
+	// jobs paused via the http api and since when, kept across reloads
+	paused map[string]time.Time
+	// commands of the runs in progress per job
+	running map[string]map[*runningProcess]struct{}
+	// the specs got validated and the next ticks set
+	initialized bool
+	// where the runs of the jobs get saved, nil until prepare opened it
+	store runStore
+	// ends the scheduling loop started by Start and tells when it has
+	stopRun func()
+	stopped chan struct{}
+	// context of the scheduling loop, runs triggered via the api derive from it
+	runCtx context.Context
+	// wakes up the scheduling loop when a job got a next tick outside of it
+	wake chan struct{}
+	// actions of async events that are in progress
+	detached sync.WaitGroup
 }
 
-// Run a Schedule based on its specs.
+// NewSchedule creates an empty schedule, jobs can be added to it with AddJob.
+// This allows to use cheek as a library, without writing specs to a file.
+func NewSchedule(log zerolog.Logger, cfg Config) *Schedule {
+	return &Schedule{Jobs: map[string]*JobSpec{}, log: log, cfg: cfg}
+}
+
+// AddJob adds a job to the schedule under its name, which has to be unique. A
+// job that gets added once the schedule is initialized is validated right away.
+func (s *Schedule) AddJob(j *JobSpec) error {
+	if j == nil || j.Name == "" {
+		return errors.New("cannot add a job without a name")
+	}
+	if _, ok := s.job(j.Name); ok {
+		return fmt.Errorf("job '%s' is already part of the schedule", j.Name)
+	}
+
+	if s.initialized {
+		problems := []ValidationProblem{}
+		s.validateJob(j.Name, j, func(job string, err error) {
+			if err != nil {
+				problems = append(problems, ValidationProblem{Job: job, Message: err.Error()})
+			}
+		})
+		if len(problems) > 0 {
+			return problems[0]
+		}
+		if err := j.setNextTick(s.now(), true); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Jobs[j.Name]; ok {
+		return fmt.Errorf("job '%s' is already part of the schedule", j.Name)
+	}
+	if s.Jobs == nil {
+		s.Jobs = map[string]*JobSpec{}
+	}
+	s.Jobs[j.Name] = j
+	return nil
+}
+
+// prepare readies the schedule to run jobs: it gets initialized when that did
+// not happen yet and the storage of runs is opened.
+func (s *Schedule) prepare() error {
+	if !s.initialized {
+		if err := s.initialize(); err != nil {
+			return err
+		}
+	}
+	if s.store != nil {
+		return nil
+	}
+	st, err := openStore(s.log, s.cfg)
+	if err != nil {
+		return fmt.Errorf("cannot open storage: %w", err)
+	}
+	s.store = st
+	return nil
+}
+
+// Start runs the schedule along with its http server until ctx is done or Stop
+// gets called. Runs in progress at that point get canceled, Start returns once
+// they have wound down.
+func (s *Schedule) Start(ctx context.Context) error {
+	return s.start(ctx, nil)
+}
+
+// start runs the schedule, reloading its specs whenever reloads receives.
+func (s *Schedule) start(ctx context.Context, reloads <-chan struct{}) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan struct{})
+	defer close(stopped)
+	s.mu.Lock()
+	if s.stopRun != nil {
+		s.mu.Unlock()
+		return errors.New("schedule is already running")
+	}
+	s.stopRun, s.stopped = cancel, stopped
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.stopRun, s.stopped = nil, nil
+		s.mu.Unlock()
+	}()
+	s.recordInterruptedRuns()
+
+	names := s.snapshot().jobNames()
+	for i, k := range names {
+		s.log.Info().Msgf("Initializing (%v/%v) job: %s", i+1, len(names), k)
+	}
+
+	srv, failed, err := server(s)
+	if err != nil {
+		return err
+	}
+	defer shutdownServer(s, srv)
+
+	// the schedule stops along with the http server
+	var serveErr error
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case err := <-failed:
+			serveErr = fmt.Errorf("http server stopped: %w", err)
+			s.log.Error().Err(err).Msg("http server stopped, stopping the schedule")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	s.run(ctx, reloads)
+	cancel()
+	<-watched
+	return serveErr
+}
+
+// runContext returns the context that runs of the schedule get canceled with,
+// outside of the scheduling loop runs can't be canceled that way.
+func (s *Schedule) runContext() context.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.runCtx == nil {
+		return context.Background()
+	}
+	return s.runCtx
+}
+
+// Stop ends the scheduling loop started by Start and waits for it to return.
+func (s *Schedule) Stop() {
+	s.mu.RLock()
+	stopRun, stopped := s.stopRun, s.stopped
+	s.mu.RUnlock()
+	if stopRun == nil {
+		return
+	}
+	stopRun()
+	<-stopped
+}
+
+// watchSignals returns a context that is done once SIGINT or SIGTERM is
+// received, each SIGHUP is passed on to reloads.
+func (s *Schedule) watchSignals(ctx context.Context) (context.Context, <-chan struct{}, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	reloads := make(chan struct{}, 1)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigs:
+				if sig == syscall.SIGHUP {
+					s.log.Info().Msgf("%s signal received, reloading schedule '%s'", sig.String(), s.fn)
+					select {
+					case reloads <- struct{}{}:
+					default:
+					}
+					continue
+				}
+				s.log.Info().Msgf("%s signal received, exiting...", sig.String())
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return ctx, reloads, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// maxSleep bounds how long the scheduler sleeps between wake ups, which is
+// also how often the specs file is checked for changes.
+const maxSleep = 15 * time.Second
+
+// Run a Schedule based on its specs until SIGINT or SIGTERM is received,
+// SIGHUP reloads the specs.
 func (s *Schedule) Run() {
-	var currentTickTime time.Time
+	ctx, reloads, stop := s.watchSignals(context.Background())
+	defer stop()
+	s.run(ctx, reloads)
+}
+
+// run triggers the jobs of the schedule when they are due until ctx is done,
+// which cancels the runs in progress. It returns once those have wound down.
+func (s *Schedule) run(ctx context.Context, reloads <-chan struct{}) {
 	s.log.Info().Msg("Scheduler started")
-	ticker := time.NewTicker(15 * time.Second) // could be longer
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	timer := time.NewTimer(s.untilNextTick(s.now()))
+	defer timer.Stop()
+
+	wake := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.runCtx = ctx
+	s.loopStarted = time.Now()
+	s.wake = wake
+	s.mu.Unlock()
+	var runs sync.WaitGroup
+	defer func() {
+		runs.Wait()
+		s.waitDetached()
+		s.mu.Lock()
+		s.runCtx = nil
+		s.mu.Unlock()
+	}()
+
+	runs.Add(1)
+	go func() {
+		defer runs.Done()
+		s.runSink(ctx)
+	}()
+
+	for _, c := range s.catchups(s.now()) {
+		runs.Add(1)
+		go func(c catchup) {
+			defer runs.Done()
+			c.run(ctx)
+		}(c)
+	}
+
+	for _, j := range s.startupJobs() {
+		s.log.Debug().Msgf("%v runs on start", j.Name)
+		runs.Add(1)
+		go func(j *JobSpec) {
+			defer runs.Done()
+			j.execScheduled(ctx, "startup", map[string]string{})
+		}(j)
+	}
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			s.log.Debug().Msg("tick")
-			currentTickTime = s.now()
+			s.reloadIfChanged()
+			go s.checkFreshness(ctx, s.now())
+			go s.compressLogsIfDue(s.now())
 
-			for _, j := range s.Jobs {
-				if j.Cron == "" {
-					continue
+			now := s.now()
+			due := s.dueJobs(now)
+			due, at := s.holdOff(due, now)
+			for _, j := range due {
+				s.log.Debug().Msgf("%v is due", j.Name)
+				// deferred runs start right when their window opens
+				scheduledAt, delay := at[j], at[j].Sub(now)
+				if delay <= 0 {
+					scheduledAt, delay = now, s.jitterDelay(j, now)
 				}
+				runs.Add(1)
+				go func(j *JobSpec) {
+					defer runs.Done()
+					j.execDue(ctx, scheduledAt, delay)
+					s.intervalFinished(j, s.now())
+				}(j)
+			}
+			timer.Reset(s.untilNextTick(s.now()))
 
-				if j.nextTick.Before(currentTickTime) {
-					s.log.Debug().Msgf("%v is due", j.Name)
-					// first set nextTick
-					if err := j.setNextTick(currentTickTime, false); err != nil {
-						s.log.Fatal().Err(err).Msg("error determining next tick")
-					}
+		case <-wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(s.untilNextTick(s.now()))
 
-					go func(j *JobSpec) {
-						j.execCommandWithRetry("cron")
-					}(j)
-				}
+		case <-reloads:
+			if err := s.reload(); err != nil {
+				s.log.Warn().Err(err).Msg("schedule reload failed, keeping the current schedule")
+			}
+			// the reloaded specs might hold an earlier tick
+			if !timer.Stop() {
+				<-timer.C
 			}
+			timer.Reset(s.untilNextTick(s.now()))
 
-		case sig := <-sigs:
-			s.log.Info().Msgf("%s signal received, exiting...", sig.String())
+		case <-ctx.Done():
+			s.log.Info().Msg("Scheduler stopped")
 			return
 		}
 	}
 }
 
+// dueJobs returns the jobs whose next tick has been reached at refTime and
+// moves their next tick past it. Ticks missed while the scheduler was not
+// running (e.g. a suspended machine) result in a single run.
+func (s *Schedule) dueJobs(refTime time.Time) []*JobSpec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the clock went backwards, ticks computed before now lie too far ahead
+	if refTime.Before(s.lastTick) {
+		s.log.Warn().Msgf("clock went back from %v to %v, recomputing next ticks", s.lastTick, refTime)
+		for _, j := range s.Jobs {
+			if !j.tickless() {
+				s.advanceTick(j, refTime)
+			}
+		}
+	}
+	s.lastTick = refTime
+
+	due := []*JobSpec{}
+	for _, j := range s.Jobs {
+		if !j.scheduled() || j.tickless() || j.nextTick.After(refTime) {
+			continue
+		}
+		// first set nextTick
+		if !s.advanceTick(j, refTime) {
+			continue
+		}
+		// paused jobs let their ticks pass so they don't fire right away once resumed
+		if _, ok := s.paused[j.Name]; ok {
+			s.log.Debug().Msgf("%v is due but paused", j.Name)
+			continue
+		}
+		if s.circuitOpen(j, refTime) {
+			s.log.Debug().Msgf("%v is due but its circuit is open", j.Name)
+			continue
+		}
+		// the interval starts again once the run is over
+		if j.IntervalFrom == IntervalFromFinish {
+			j.nextTick = time.Time{}
+		}
+		due = append(due, j)
+	}
+
+	sort.Slice(due, func(i, k int) bool { return due[i].Name < due[k].Name })
+	return due
+}
+
+// advanceTick moves the next tick of a job past refTime. A job whose next tick
+// can't be determined is skipped and gets looked at again after maxSleep,
+// rather than taking the scheduler down with it.
+func (s *Schedule) advanceTick(j *JobSpec, refTime time.Time) bool {
+	if err := j.setNextTick(refTime, false); err != nil {
+		s.log.Error().Str("job", j.Name).Err(err).Msg("error determining next tick, skipping job")
+		j.nextTick = refTime.Add(maxSleep)
+		return false
+	}
+	return true
+}
+
+// startupJobs returns the jobs that should run once when the scheduler starts.
+func (s *Schedule) startupJobs() []*JobSpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := []*JobSpec{}
+	for _, j := range s.Jobs {
+		if _, ok := s.paused[j.Name]; j.RunOnStart && !j.Disable && !ok {
+			jobs = append(jobs, j)
+		}
+	}
+
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+	return jobs
+}
+
+// untilNextTick returns how long to sleep from refTime until the earliest
+// next tick of all jobs, at most maxSleep.
+func (s *Schedule) untilNextTick(refTime time.Time) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d := maxSleep
+	for _, j := range s.Jobs {
+		if !j.scheduled() || j.tickless() {
+			continue
+		}
+		if untilTick := j.nextTick.Sub(refTime); untilTick < d {
+			d = untilTick
+		}
+	}
+
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
 type stringArray []string
 
 func (a *stringArray) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -81,97 +484,397 @@ func (a *stringArray) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func readSpecs(fn string) (Schedule, error) {
+func readSpecs(fn string) (*Schedule, error) {
 	yfile, err := os.ReadFile(fn)
 	if err != nil {
-		return Schedule{}, err
+		return nil, err
 	}
 
-	specs := Schedule{}
+	return parseSpecs(fn, yfile)
+}
 
-	if err = yaml.Unmarshal(yfile, &specs); err != nil {
-		return Schedule{}, err
+// parseSpecs parses the specs of a schedule, fn is where they came from.
+func parseSpecs(fn string, yfile []byte) (*Schedule, error) {
+	doc := yaml.Node{}
+	if err := yaml.Unmarshal(yfile, &doc); err != nil {
+		return nil, err
+	}
+	if expandEnvEnabled(&doc) {
+		if err := expandSpecEnv(&doc, os.LookupEnv); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	if strictEnabled(&doc) {
+		if problems := unknownFields(&doc); len(problems) > 0 {
+			return nil, fmt.Errorf("%s: %s", fn, strings.Join(problems, ", "))
+		}
 	}
+	if err := applyDefaults(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	specs := &Schedule{}
+	if err := doc.Decode(specs); err != nil {
+		return nil, err
+	}
+	specs.settings = scheduleSettings(&doc)
 
 	return specs, nil
 }
 
 // initialize Schedule spec and logic.
 func (s *Schedule) initialize() error {
-	// validate tz location
-	if s.TZLocation == "" {
-		s.TZLocation = "Local"
+	if problems := s.validate(); len(problems) > 0 {
+		return problems[0]
 	}
 
-	loc, err := time.LoadLocation(s.TZLocation)
-	if err != nil {
-		return err
+	// init nextTick
+	for _, v := range s.Jobs {
+		if err := v.setNextTick(s.now(), true); err != nil {
+			return err
+		}
+	}
+	s.warnPastAt(s.now())
+	s.initialized = true
+	return nil
+}
+
+// defaultMaxTriggerDepth is how long a chain of triggered jobs can get by default.
+const defaultMaxTriggerDepth = 10
+
+// maxTriggerDepth returns how many jobs can be in a chain of triggers before the next trigger gets skipped.
+func (s *Schedule) maxTriggerDepth() int {
+	if s == nil {
+		return defaultMaxTriggerDepth
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.MaxTriggerDepth == 0 {
+		return defaultMaxTriggerDepth
+	}
+	return s.MaxTriggerDepth
+}
+
+// checkTriggerCycles makes sure that jobs cannot end up triggering themselves,
+// regardless of whether runs succeed or fail. Schedule level triggers apply to
+// every job, but don't count as a cycle for the jobs they trigger themselves,
+// e.g. an alert job on on_error, those are left to the max trigger depth.
+func (s *Schedule) checkTriggerCycles() error {
+	global := map[string]bool{}
+	for _, t := range s.triggerJobs() {
+		global[t.Name] = true
+	}
+
+	edges := map[string][]string{}
+	for name, j := range s.Jobs {
+		for _, t := range j.triggerJobs() {
+			edges[name] = append(edges[name], t.Name)
+		}
+		if !global[name] {
+			for t := range global {
+				edges[name] = append(edges[name], t)
+			}
+		}
+		sort.Strings(edges[name])
 	}
-	s.loc = loc
 
-	for k, v := range s.Jobs {
-		// check if trigger references exist
-		triggerJobs := append(v.OnSuccess.TriggerJob, v.OnError.TriggerJob...)
-		for _, t := range triggerJobs {
-			if _, ok := s.Jobs[t]; !ok {
-				return fmt.Errorf("cannot find spec of job '%s' that is referenced in job '%s'", t, k)
+	names := make([]string, 0, len(s.Jobs))
+	for name := range s.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// the cycle starts where name was first visited
+			for i, n := range path {
+				if n == name {
+					return fmt.Errorf("trigger_job cycle detected: %s", strings.Join(append(path[i:], name), " -> "))
+				}
 			}
 		}
-		// set some metadata & refs for each job
-		// for easier retrievability
-		v.Name = k
-		v.globalSchedule = s
-		v.log = s.log
-		v.cfg = s.cfg
 
-		// validate cron string
-		if err := v.ValidateCron(); err != nil {
-			return err
+		state[name] = visiting
+		path = append(path, name)
+		for _, next := range edges[name] {
+			if err := visit(next); err != nil {
+				return err
+			}
 		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
 
-		// init nextTick
-		if err := v.setNextTick(s.now(), true); err != nil {
+	for _, name := range names {
+		if err := visit(name); err != nil {
 			return err
 		}
-
 	}
-
 	return nil
 }
 
 func (s *Schedule) now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return time.Now().In(s.loc)
 }
 
-func loadSchedule(log zerolog.Logger, cfg Config, fn string) (Schedule, error) {
-	s, err := readSpecs(fn)
+func loadSchedule(log zerolog.Logger, cfg Config, fn string) (*Schedule, error) {
+	if isURL(fn) {
+		specs, err := fetchSpecs(cfg, fn, remoteVersion{})
+		if err != nil {
+			return nil, err
+		}
+		return loadRemoteSchedule(log, cfg, fn, specs)
+	}
+
+	modTime, err := specsModTime(fn)
 	if err != nil {
-		return Schedule{}, err
+		return nil, err
+	}
+
+	s, err := readSchedule(fn)
+	if err != nil {
+		return nil, err
 	}
 	s.log = log
 	s.cfg = cfg
+	s.fn = fn
+	s.modTime = modTime
 
 	// run validations
 	if err := s.initialize(); err != nil {
-		return Schedule{}, err
+		return nil, err
 	}
 	s.log.Info().Msg("Scheduled loaded and validated")
 	return s, nil
 }
 
-// RunSchedule is the main entry entrypoint of cheek.
+// RunSchedule is the main entry entrypoint of cheek, it runs the schedule in
+// the given file until SIGINT or SIGTERM is received.
 func RunSchedule(log zerolog.Logger, cfg Config, scheduleFn string) error {
 	s, err := loadSchedule(log, cfg, scheduleFn)
 	if err != nil {
+		log.Error().Err(err).Msgf("cannot load schedule '%s'", scheduleFn)
+		return err
+	}
+
+	stopTracing := startTracing(log)
+	defer stopTracing()
+
+	ctx, reloads, stop := s.watchSignals(context.Background())
+	defer stop()
+	if err := s.start(ctx, reloads); err != nil {
+		log.Error().Err(err).Msg("cannot start schedule")
 		return err
 	}
-	numberJobs := len(s.Jobs)
-	i := 1
-	for k := range s.Jobs {
-		s.log.Info().Msgf("Initializing (%v/%v) job: %s", i, numberJobs, k)
-		i++
+	return nil
+}
+
+// reloadIfChanged reloads the schedule when its specs file got modified since it was loaded.
+func (s *Schedule) reloadIfChanged() {
+	if s.fn == "" {
+		return
+	}
+	if isURL(s.fn) {
+		// a slow server should not hold up the jobs that are due
+		go s.refetchIfDue(time.Now())
+		return
+	}
+
+	modTime, err := specsModTime(s.fn)
+	if err != nil {
+		s.log.Warn().Err(err).Msgf("cannot check schedule '%s' for changes", s.fn)
+		return
+	}
+	if modTime.Equal(s.modTime) {
+		return
+	}
+	// only try once per change, a broken file would otherwise be reported on every tick
+	s.modTime = modTime
+
+	s.log.Info().Msgf("schedule '%s' changed, reloading", s.fn)
+	if err := s.reload(); err != nil {
+		s.log.Warn().Err(err).Msg("schedule reload failed, keeping the current schedule")
+	}
+}
+
+// reload re-reads and validates the specs file, the new specs are only
+// swapped in when they are valid.
+func (s *Schedule) reload() error {
+	ns, err := loadSchedule(s.log, s.cfg, s.fn)
+	if err != nil {
+		return err
 	}
-	go server(&s)
-	s.Run()
+
+	s.apply(ns)
 	return nil
 }
+
+// apply swaps in reloaded specs and logs what changed.
+func (s *Schedule) apply(ns *Schedule) {
+	s.mu.RLock()
+	added, removed, modified := diffJobs(s.Jobs, ns.Jobs)
+	s.mu.RUnlock()
+
+	s.swap(ns)
+	s.log.Info().Strs("added", added).Strs("removed", removed).Strs("modified", modified).Msgf("schedule reloaded: %v added, %v removed, %v modified", len(added), len(removed), len(modified))
+}
+
+// specsYAML renders the specs of a job without its state, e.g. its next run.
+func (j JobSpec) specsYAML() (string, error) {
+	j.nextTick = time.Time{}
+	return j.ToYAML(false)
+}
+
+// diffJobs lists the names of jobs that differ between two sets of job specs.
+func diffJobs(old, new map[string]*JobSpec) (added, removed, modified []string) {
+	added, removed, modified = []string{}, []string{}, []string{}
+
+	for name, nj := range new {
+		oj, ok := old[name]
+		if !ok {
+			added = append(added, name)
+			continue
+		}
+
+		oldSpecs, oErr := oj.specsYAML()
+		newSpecs, nErr := nj.specsYAML()
+		if oErr != nil || nErr != nil || oldSpecs != newSpecs {
+			modified = append(modified, name)
+		}
+	}
+
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
+
+// swap takes over the specs of another schedule. Runs in flight keep going
+// against their old JobSpec while unchanged jobs keep their next tick.
+func (s *Schedule) swap(ns *Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, j := range ns.Jobs {
+		j.globalSchedule = s
+		old, ok := s.Jobs[name]
+		if !ok {
+			continue
+		}
+		// keep tracking runs in flight across reloads
+		j.inFlight = old.inFlight
+		j.health = old.health
+		j.limiter = old.limiter
+		j.deferredTo = old.deferredTo
+		if old.Cron == j.Cron && old.Interval == j.Interval && old.IntervalFrom == j.IntervalFrom && sameTimes(old.At, j.At) && old.TZLocation == j.TZLocation && old.Disable == j.Disable {
+			j.nextTick = old.nextTick
+		}
+	}
+
+	for name := range s.paused {
+		if _, ok := ns.Jobs[name]; !ok {
+			delete(s.paused, name)
+		}
+	}
+
+	s.Jobs = ns.Jobs
+	s.OnSuccess = ns.OnSuccess
+	s.OnError = ns.OnError
+	s.OnStart = ns.OnStart
+	s.OnRetriesExhausted = ns.OnRetriesExhausted
+	s.OnStale = ns.OnStale
+	s.TZLocation = ns.TZLocation
+	s.loc = ns.loc
+	s.MaxRunsKept = ns.MaxRunsKept
+	s.MaxLogAge = ns.MaxLogAge
+	s.MaxLogSize = ns.MaxLogSize
+	s.LogMode = ns.LogMode
+	s.CompressLogsAfter = ns.CompressLogsAfter
+	s.EventSink = ns.EventSink
+	s.MaxTriggerDepth = ns.MaxTriggerDepth
+	s.Blackout = ns.Blackout
+	if s.MaxConcurrentJobs != ns.MaxConcurrentJobs {
+		s.MaxConcurrentJobs = ns.MaxConcurrentJobs
+		s.slots = ns.slots
+	}
+	s.ReloadInterval = ns.ReloadInterval
+	s.modTime = ns.modTime
+	s.remote = ns.remote
+}
+
+// job looks up a job by name in the currently loaded specs.
+func (s *Schedule) job(name string) (*JobSpec, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.Jobs[name]
+	return j, ok
+}
+
+// jobMap returns the jobs of the currently loaded specs by name. The map is a
+// copy, a reload swaps in other jobs instead of changing the ones it holds.
+func (s *Schedule) jobMap() map[string]*JobSpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make(map[string]*JobSpec, len(s.Jobs))
+	for name, j := range s.Jobs {
+		jobs[name] = j
+	}
+	return jobs
+}
+
+// snapshot copies the currently loaded specs, so that they can be read while
+// the schedule gets reloaded.
+func (s *Schedule) snapshot() *Schedule {
+	jobs := s.jobMap()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &Schedule{
+		Jobs:               jobs,
+		OnSuccess:          s.OnSuccess,
+		OnError:            s.OnError,
+		OnStart:            s.OnStart,
+		OnRetriesExhausted: s.OnRetriesExhausted,
+		OnStale:            s.OnStale,
+		TZLocation:         s.TZLocation,
+		MaxConcurrentJobs:  s.MaxConcurrentJobs,
+		MaxRunsKept:        s.MaxRunsKept,
+		MaxLogAge:          s.MaxLogAge,
+		MaxLogSize:         s.MaxLogSize,
+		LogMode:            s.LogMode,
+		CompressLogsAfter:  s.CompressLogsAfter,
+		EventSink:          s.EventSink,
+		MaxTriggerDepth:    s.MaxTriggerDepth,
+		ReloadInterval:     s.ReloadInterval,
+		Strict:             s.Strict,
+		ExpandEnv:          s.ExpandEnv,
+		Blackout:           s.Blackout,
+		loc:                s.loc,
+		log:                s.log,
+		cfg:                s.cfg,
+		fn:                 s.fn,
+	}
+}
@@ -1,13 +1,21 @@
 package cheek
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
 	"os"
+	"path"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestScheduleRun(t *testing.T) {
@@ -63,3 +71,548 @@ func TestTZInfo(t *testing.T) {
 	time2 := s.now()
 	assert.NotEqual(t, time1.Sub(time2).Hours(), 0.0)
 }
+
+func TestJobTZInfo(t *testing.T) {
+	s := Schedule{
+		Jobs: map[string]*JobSpec{
+			"brussels": {Cron: "0 9 * * *", Command: []string{"echo"}, TZLocation: "Europe/Brussels"},
+			"new_york": {Cron: "0 9 * * *", Command: []string{"echo"}, TZLocation: "America/New_York"},
+		},
+		TZLocation: "UTC",
+		log:        zerolog.Logger{},
+		cfg:        NewConfig(),
+	}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, j := range s.Jobs {
+		assert.Equal(t, 9, j.nextTick.Hour(), name)
+		assert.Equal(t, j.TZLocation, j.nextTick.Location().String(), name)
+	}
+	assert.NotEqual(t, s.Jobs["brussels"].nextTick.UTC().Hour(), s.Jobs["new_york"].nextTick.UTC().Hour())
+
+	// resolved next tick is exposed
+	b, err := json.Marshal(s.Jobs["new_york"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(b), "\"next_run\":")
+
+	s.Jobs["brussels"].TZLocation = "Europe/Brusselz"
+	assert.Error(t, s.initialize())
+}
+
+func TestLoadInvalidSchedule(t *testing.T) {
+	for _, fn := range []string{"../testdata/invalid_cron.yaml", "../testdata/invalid_trigger.yaml"} {
+		s, err := loadSchedule(zerolog.Logger{}, NewConfig(), fn)
+		assert.Error(t, err, fn)
+		assert.Nil(t, s, fn)
+
+		assert.Error(t, RunSchedule(zerolog.Logger{}, NewConfig(), fn), fn)
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	write := func(specs string, modTime time.Time) {
+		if err := os.WriteFile(fn, []byte(specs), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fn, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+jobs:
+  foo:
+    command: date
+    cron: "* * * * *"
+  bar:
+    command: date
+    cron: "0 * * * *"
+`, time.Now().Add(-time.Hour))
+
+	s, err := loadSchedule(zerolog.Logger{}, NewConfig(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFoo := s.Jobs["foo"]
+	oldFoo.nextTick = oldFoo.nextTick.Add(time.Minute)
+
+	// invalid specs keep the current schedule running
+	write(`
+jobs:
+  foo:
+    command: date
+    cron: "* * * *"
+`, time.Now().Add(-30*time.Minute))
+	s.reloadIfChanged()
+	assert.Len(t, s.Jobs, 2)
+	assert.Same(t, oldFoo, s.Jobs["foo"])
+
+	write(`
+jobs:
+  foo:
+    command: echo foo
+    cron: "* * * * *"
+  baz:
+    command: date
+`, time.Now())
+	s.reloadIfChanged()
+	assert.Len(t, s.Jobs, 2)
+	assert.Contains(t, s.Jobs, "baz")
+	assert.NotContains(t, s.Jobs, "bar")
+
+	// unchanged cron keeps its next tick and in flight tracking
+	assert.Equal(t, oldFoo.nextTick, s.Jobs["foo"].nextTick)
+	assert.Same(t, oldFoo.inFlight, s.Jobs["foo"].inFlight)
+	assert.Same(t, s, s.Jobs["foo"].globalSchedule)
+	assert.Equal(t, stringArray{"echo", "foo"}, s.Jobs["foo"].Command)
+}
+
+func TestDiffJobs(t *testing.T) {
+	old := map[string]*JobSpec{
+		"foo": {Command: []string{"date"}},
+		"bar": {Command: []string{"date"}},
+		"baz": {Command: []string{"date"}, Cron: "* * * * *"},
+	}
+	new := map[string]*JobSpec{
+		"foo": {Command: []string{"date"}},
+		"baz": {Command: []string{"date"}, Cron: "0 * * * *"},
+		"qux": {Command: []string{"date"}},
+	}
+
+	added, removed, modified := diffJobs(old, new)
+	assert.Equal(t, []string{"qux"}, added)
+	assert.Equal(t, []string{"bar"}, removed)
+	assert.Equal(t, []string{"baz"}, modified)
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	b := new(tsBuffer)
+	logger := NewLogger("debug", b)
+
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	if err := os.WriteFile(fn, []byte("jobs:\n  foo:\n    command: date\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSchedule(logger, NewConfig(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Run()
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(fn, []byte("jobs:\n  foo:\n    command: date\n  bar:\n    command: date\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Contains(t, b.String(), "schedule reloaded: 1 added, 0 removed, 0 modified")
+
+	if err := proc.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	_, ok := s.job("bar")
+	assert.True(t, ok)
+}
+
+func newTickSchedule(t *testing.T, jobs map[string]*JobSpec, refTime time.Time) *Schedule {
+	s := &Schedule{Jobs: jobs, TZLocation: "UTC", log: NewLogger("debug", new(tsBuffer))}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range s.Jobs {
+		if err := j.setNextTick(refTime, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestDueJobsSameInstant(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 4, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo":    {Command: []string{"date"}, Cron: "* * * * *"},
+		"bar":    {Command: []string{"date"}, Cron: "*/5 * * * *"},
+		"hourly": {Command: []string{"date"}, Cron: "0 * * * *"},
+		"manual": {Command: []string{"date"}},
+	}, refTime)
+
+	// sleeps until the next minute
+	assert.Equal(t, 15*time.Second, s.untilNextTick(refTime))
+	assert.Equal(t, 5*time.Second, s.untilNextTick(refTime.Add(25*time.Second)))
+	assert.Empty(t, s.dueJobs(refTime.Add(29*time.Second)))
+
+	due := s.dueJobs(refTime.Add(30 * time.Second))
+	names := []string{}
+	for _, j := range due {
+		names = append(names, j.Name)
+	}
+	assert.Equal(t, []string{"bar", "foo"}, names)
+
+	// fired jobs move on to their next tick, nothing is due twice
+	assert.Empty(t, s.dueJobs(refTime.Add(31*time.Second)))
+	assert.Equal(t, time.Date(2023, 1, 1, 12, 6, 0, 0, time.UTC), s.Jobs["foo"].nextTick)
+	assert.Equal(t, time.Date(2023, 1, 1, 12, 10, 0, 0, time.UTC), s.Jobs["bar"].nextTick)
+}
+
+func TestStartupJobs(t *testing.T) {
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"warm_cache": {Command: []string{"date"}, Cron: "0 * * * *", RunOnStart: true},
+		"sync":       {Command: []string{"date"}, RunOnStart: true},
+		"manual":     {Command: []string{"date"}},
+	}, time.Now())
+
+	names := []string{}
+	for _, j := range s.startupJobs() {
+		names = append(names, j.Name)
+	}
+	assert.Equal(t, []string{"sync", "warm_cache"}, names)
+}
+
+func TestDueJobsAddedOnReload(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"hourly": {Command: []string{"date"}, Cron: "0 * * * *"},
+	}, refTime)
+	assert.Equal(t, maxSleep, s.untilNextTick(refTime))
+
+	ns := newTickSchedule(t, map[string]*JobSpec{
+		"hourly": {Command: []string{"date"}, Cron: "0 * * * *"},
+		"foo":    {Command: []string{"date"}, Cron: "* * * * *"},
+	}, refTime)
+	s.swap(ns)
+
+	assert.Equal(t, 10*time.Second, s.untilNextTick(refTime.Add(20*time.Second)))
+	due := s.dueJobs(refTime.Add(30 * time.Second))
+	if assert.Len(t, due, 1) {
+		assert.Equal(t, "foo", due[0].Name)
+	}
+}
+
+func TestDueJobsClockJump(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Cron: "* * * * *"},
+	}, refTime)
+	assert.Empty(t, s.dueJobs(refTime))
+
+	// jumping ahead fires missed ticks only once
+	jumped := refTime.Add(time.Hour)
+	assert.Len(t, s.dueJobs(jumped), 1)
+	assert.Empty(t, s.dueJobs(jumped))
+	assert.Equal(t, time.Date(2023, 1, 1, 13, 1, 0, 0, time.UTC), s.Jobs["foo"].nextTick)
+
+	// jumping back does not leave the job waiting for an hour
+	back := refTime.Add(20 * time.Second)
+	assert.Empty(t, s.dueJobs(back))
+	assert.Equal(t, time.Date(2023, 1, 1, 12, 1, 0, 0, time.UTC), s.Jobs["foo"].nextTick)
+	assert.Equal(t, 10*time.Second, s.untilNextTick(back))
+	assert.Len(t, s.dueJobs(back.Add(10*time.Second)), 1)
+}
+
+func TestDueJobsNoNextTick(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 30, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Cron: "* * * * *"},
+		"bar": {Command: []string{"date"}, Cron: "* * * * *"},
+	}, refTime)
+	// a valid expression that never comes around
+	s.Jobs["bar"].Cron = "0 0 30 2 *"
+
+	// the job is skipped instead of exiting, the others keep running
+	due := s.dueJobs(refTime.Add(30 * time.Second))
+	if assert.Len(t, due, 1) {
+		assert.Equal(t, "foo", due[0].Name)
+	}
+	assert.Equal(t, refTime.Add(30*time.Second+maxSleep), s.Jobs["bar"].nextTick)
+
+	// same when the clock goes back
+	assert.NotPanics(t, func() { s.dueJobs(refTime) })
+	assert.Equal(t, refTime.Add(maxSleep), s.Jobs["bar"].nextTick)
+}
+
+func TestTriggerCycles(t *testing.T) {
+	cases := map[string]string{
+		"direct": `
+jobs:
+  a:
+    command: date
+    on_success:
+      trigger_job: [b]
+  b:
+    command: date
+    on_error:
+      trigger_job: [a]
+`,
+		"self": `
+jobs:
+  a:
+    command: date
+    on_error:
+      trigger_job: [a]
+`,
+		"schedule level": `
+on_error:
+  trigger_job: [alert]
+jobs:
+  a:
+    command: date
+  alert:
+    command: date
+    on_success:
+      trigger_job: [a]
+`,
+	}
+	expected := map[string]string{
+		"direct":         "trigger_job cycle detected: a -> b -> a",
+		"self":           "trigger_job cycle detected: a -> a",
+		"schedule level": "trigger_job cycle detected: a -> alert -> a",
+	}
+
+	for name, specs := range cases {
+		s := &Schedule{log: NewLogger("debug", new(tsBuffer))}
+		if err := yaml.Unmarshal([]byte(specs), s); err != nil {
+			t.Fatal(err)
+		}
+		assert.EqualError(t, s.initialize(), expected[name], name)
+	}
+
+	// a chain without cycles is fine
+	s := &Schedule{log: NewLogger("debug", new(tsBuffer))}
+	err := yaml.Unmarshal([]byte(`
+jobs:
+  a:
+    command: date
+    on_success:
+      trigger_job: [b, c]
+  b:
+    command: date
+    on_success:
+      trigger_job: [c]
+  c:
+    command: date
+`), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.initialize())
+
+	// jobs triggered by schedule level events don't trigger themselves or each other
+	s = &Schedule{log: NewLogger("debug", new(tsBuffer))}
+	err = yaml.Unmarshal([]byte(`
+on_error:
+  trigger_job: [alert, page]
+jobs:
+  a:
+    command: date
+  alert:
+    command: date
+  page:
+    command: date
+`), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.initialize())
+}
+
+func TestMaxTriggerDepth(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{MaxTriggerDepth: 1, cfg: cfg, log: NewLogger("debug", new(tsBuffer))}
+	err := yaml.Unmarshal([]byte(`
+jobs:
+  test_depth_a:
+    command: date
+    on_success:
+      trigger_job: [test_depth_b]
+  test_depth_b:
+    command: date
+    on_success:
+      trigger_job: [test_depth_c]
+  test_depth_c:
+    command: date
+`), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.initialize())
+
+	s.Jobs["test_depth_a"].execCommandWithRetry(context.Background(), "manual", nil)
+
+	b := s.Jobs["test_depth_b"]
+	b.loadRuns()
+	assert.Equal(t, 0, b.Runs[0].Status)
+	assert.Equal(t, 1, b.Runs[0].TriggerDepth)
+
+	c := s.Jobs["test_depth_c"]
+	c.loadRuns()
+	assert.Equal(t, StatusSkipped, c.Runs[0].Status)
+	assert.Equal(t, "skipped: max trigger depth of 1 reached", c.Runs[0].Log)
+}
+
+func TestProgrammaticSchedule(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Port = "0"
+	s := NewSchedule(zerolog.Nop(), cfg)
+
+	fn := path.Join(t.TempDir(), "started")
+	assert.NoError(t, s.AddJob(&JobSpec{Name: "hello", Command: []string{"echo", "hello"}}))
+	assert.NoError(t, s.AddJob(&JobSpec{Name: "touch", Command: []string{"touch", fn}, RunOnStart: true}))
+	assert.EqualError(t, s.AddJob(&JobSpec{Name: "hello"}), "job 'hello' is already part of the schedule")
+	assert.Error(t, s.AddJob(&JobSpec{Command: []string{"date"}}))
+
+	jr, err := s.RunJob(context.Background(), "hello", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", jr.Log)
+	_, err = s.RunJob(context.Background(), "missing", nil)
+	assert.EqualError(t, err, "cannot find job missing in schedule")
+
+	// jobs added to an initialized schedule are validated right away
+	assert.Error(t, s.AddJob(&JobSpec{Name: "bad", Cron: "not a cron"}))
+	_, ok := s.job("bad")
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(fn)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.Stop()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("schedule did not stop")
+	}
+
+	// the schedule can be started again and stops with its context
+	go func() { done <- s.Start(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("schedule did not stop")
+	}
+}
+
+func TestConcurrentJobAccess(t *testing.T) {
+	specs := []byte("jobs:\n  foo:\n    command: date\n    cron: '* * * * *'\n  bar:\n    command: date\n    on_success:\n      trigger_job: [foo]\n")
+	fn := path.Join(t.TempDir(), "schedule.yaml")
+	if err := os.WriteFile(fn, specs, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(zerolog.Nop(), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := setupMux(s)
+
+	// reloads, api requests and the scheduling loop all get at the jobs at once
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				f(i)
+			}
+		}()
+	}
+	run(func(int) {
+		ns, err := loadSchedule(zerolog.Nop(), cfg, fn)
+		if assert.NoError(t, err) {
+			s.apply(ns)
+		}
+	})
+	run(func(int) {
+		for _, p := range []string{"/schedule", "/", "/jobs/foo/next"} {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+		}
+	})
+	run(func(int) {
+		s.dueJobs(time.Now().Add(time.Hour))
+		s.untilNextTick(time.Now())
+	})
+	run(func(i int) {
+		assert.NoError(t, s.AddJob(&JobSpec{Name: fmt.Sprintf("added_%v", i), Command: []string{"date"}}))
+		if j, ok := s.job("bar"); ok {
+			j.resolveTriggers(&JobRun{Name: "bar"}, j.OnSuccess)
+		}
+	})
+	wg.Wait()
+}
+
+func TestDueJobsSeconds(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Cron: "*/5 * * * * *"},
+	}, refTime)
+	j := s.Jobs["foo"]
+	assert.NoError(t, j.ValidateCron())
+	assert.Equal(t, refTime.Add(5*time.Second), j.nextTick)
+
+	// step through a minute the way the scheduling loop does
+	fires := 0
+	for now := refTime; now.Before(refTime.Add(time.Minute)); {
+		now = now.Add(s.untilNextTick(now))
+		fires += len(s.dueJobs(now))
+	}
+	assert.Equal(t, 12, fires)
+}
+
+func TestDueJobsSecondsUnderLoad(t *testing.T) {
+	refTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTickSchedule(t, map[string]*JobSpec{
+		"foo": {Command: []string{"date"}, Cron: "* * * * * *"},
+	}, refTime)
+	j := s.Jobs["foo"]
+
+	// the loop wakes up 2.5s late, the ticks it missed still run one by one
+	late := refTime.Add(3500 * time.Millisecond)
+	for i := 1; i <= 3; i++ {
+		assert.Len(t, s.dueJobs(late), 1)
+		assert.Equal(t, refTime.Add(time.Duration(i+1)*time.Second), j.nextTick)
+	}
+	// but the same second doesn't fire twice
+	assert.Empty(t, s.dueJobs(late))
+	assert.Len(t, s.dueJobs(refTime.Add(4*time.Second)), 1)
+	assert.Empty(t, s.dueJobs(refTime.Add(4*time.Second+500*time.Millisecond)))
+
+	// a loop that fell far behind runs once and picks up from there
+	behind := refTime.Add(time.Hour)
+	assert.Len(t, s.dueJobs(behind), 1)
+	assert.Equal(t, behind.Add(time.Second), j.nextTick)
+}
+
+func TestValidateCronSeconds(t *testing.T) {
+	assert.NoError(t, (&JobSpec{Name: "foo", Cron: "*/5 * * * * *"}).ValidateCron())
+	assert.NoError(t, (&JobSpec{Name: "foo", Cron: "30 0 12 * * *"}).ValidateCron())
+	assert.Error(t, (&JobSpec{Name: "foo", Cron: "61 * * * * *"}).ValidateCron())
+}
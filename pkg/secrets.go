@@ -0,0 +1,71 @@
+package cheek
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// secretMask replaces the values of secrets in the output of jobs.
+const secretMask = "***"
+
+// Secret specifies where to get the value of a secret from, either from an
+// environment variable of the host or from a file.
+type Secret struct {
+	Env  string `yaml:"env,omitempty" json:"env,omitempty"`
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+func (j *JobSpec) ValidateSecrets() error {
+	for k, s := range j.Secrets {
+		if (s.Env == "") == (s.File == "") {
+			return fmt.Errorf("secret '%s' of job '%s' should either set env or file", k, j.Name)
+		}
+	}
+	return nil
+}
+
+// loadSecrets resolves the values of the job's secrets, keyed by the name of
+// the environment variable they are exposed as.
+func (j *JobSpec) loadSecrets() (map[string]string, error) {
+	secrets := map[string]string{}
+	for k, s := range j.Secrets {
+		v, err := s.load(j, k)
+		if err != nil {
+			return nil, err
+		}
+		secrets[k] = v
+	}
+	return secrets, nil
+}
+
+// load resolves the value of a secret of a job, name is used in errors.
+func (s Secret) load(j *JobSpec, name string) (string, error) {
+	if s.Env != "" {
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("cannot find env var '%s' for secret '%s'", s.Env, name)
+		}
+		return v, nil
+	}
+
+	b, err := os.ReadFile(j.specPath(s.File))
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret '%s': %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// maskSecrets replaces all occurrences of the secret values in s.
+func maskSecrets(s string, secrets []string) string {
+	// longest first so that a secret containing another one gets fully masked
+	sort.Slice(secrets, func(i, k int) bool { return len(secrets[i]) > len(secrets[k]) })
+	for _, v := range secrets {
+		if v == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, v, secretMask)
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecretsMasked(t *testing.T) {
+	t.Setenv("CHEEK_TEST_TOKEN", "s3cr3t-t0ken")
+	fn := path.Join(t.TempDir(), "password")
+	if err := os.WriteFile(fn, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jobSpec := []byte(`
+command:
+  - sh
+  - -c
+  - echo "token $TOKEN password $PASSWORD"
+secrets:
+  TOKEN:
+    env: CHEEK_TEST_TOKEN
+  PASSWORD:
+    file: ` + fn + `
+`)
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{}
+	if err := yaml.Unmarshal(jobSpec, j); err != nil {
+		t.Fatal(err)
+	}
+	j.Name = "test_secrets"
+	j.cfg = cfg
+	j.inFlight = newRunTracker()
+	j.globalSchedule = &Schedule{loc: time.Local}
+	assert.NoError(t, j.ValidateSecrets())
+	_ = os.Remove(jobLogFile(j.Name))
+
+	jr := j.execCommandWithRetry(context.Background(), "test", nil)
+	assert.Equal(t, 0, jr.Status)
+	assert.Contains(t, jr.Log, "token *** password ***")
+
+	// the secret values never reach disk
+	b, err := os.ReadFile(jobLogFile(j.Name))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "s3cr3t-t0ken")
+	assert.NotContains(t, string(b), "hunter2")
+
+	// nor the spec output
+	specs, err := json.Marshal(j)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(specs), "s3cr3t-t0ken")
+
+	// unresolvable secrets fail the run
+	j.Secrets["TOKEN"] = Secret{Env: "CHEEK_TEST_MISSING"}
+	jr = j.execCommand(context.Background(), "test", nil)
+	assert.Equal(t, RunStateStartFailed, jr.State)
+
+	j.Secrets["TOKEN"] = Secret{Env: "CHEEK_TEST_TOKEN", File: fn}
+	assert.Error(t, j.ValidateSecrets())
+}
+
+func TestMaskSecrets(t *testing.T) {
+	assert.Equal(t, "a *** b ***", maskSecrets("a foo b foobar", []string{"foo", "foobar", ""}))
+}
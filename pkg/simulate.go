@@ -0,0 +1,85 @@
+package cheek
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adhocore/gronx"
+)
+
+// maxFirings bounds how many runs a simulation can list.
+const maxFirings = 10000
+
+// Firing is a run of a job on its cron.
+type Firing struct {
+	At  time.Time `json:"at"`
+	Job string    `json:"job"`
+}
+
+// Simulation lists the runs of a schedule within a window of time.
+type Simulation struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Firings []Firing  `json:"firings"`
+	// jobs that don't run on their cron within the window
+	NeverFire []string `json:"never_fire"`
+}
+
+// Simulate lists when the jobs of the schedule would run on their cron between
+// from and to, both included, without running anything. Cron strings get
+// evaluated in the timezone of their job, intervals get counted from the start
+// of the window.
+func (s *Schedule) Simulate(from, to time.Time) (Simulation, error) {
+	if to.Before(from) {
+		return Simulation{}, fmt.Errorf("end of the window %v lies before its start %v", to, from)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sim := Simulation{From: from, To: to, Firings: []Firing{}, NeverFire: []string{}}
+	for _, name := range s.jobNames() {
+		j := s.Jobs[name]
+		fired := false
+
+		refTime := from
+		if j.loc != nil {
+			refTime = refTime.In(j.loc)
+		}
+		for j.scheduled() {
+			t, err := j.simulatedTick(refTime, !fired)
+			if err != nil {
+				return Simulation{}, fmt.Errorf("cannot evaluate cron of job '%s': %w", name, err)
+			}
+			if t.IsZero() || t.After(to) {
+				break
+			}
+			if len(sim.Firings) == maxFirings {
+				return Simulation{}, fmt.Errorf("more than %v runs within the window, try a smaller one", maxFirings)
+			}
+			sim.Firings = append(sim.Firings, Firing{At: t, Job: name})
+			fired = true
+			refTime = t
+		}
+
+		if !fired {
+			sim.NeverFire = append(sim.NeverFire, name)
+		}
+	}
+
+	sort.SliceStable(sim.Firings, func(i, k int) bool { return sim.Firings[i].At.Before(sim.Firings[k].At) })
+	return sim, nil
+}
+
+// simulatedTick returns the tick of the job after refTime, or at refTime when
+// includeRefTime is set and the job ticks then. It is zero when there is none.
+func (j *JobSpec) simulatedTick(refTime time.Time, includeRefTime bool) (time.Time, error) {
+	if j.Interval > 0 {
+		return refTime.Add(j.Interval), nil
+	}
+	if len(j.At) > 0 {
+		return j.nextAt(refTime, includeRefTime), nil
+	}
+	return gronx.NextTickAfter(j.Cron, refTime, includeRefTime)
+}
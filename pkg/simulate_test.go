@@ -0,0 +1,51 @@
+package cheek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulate(t *testing.T) {
+	s := &Schedule{Jobs: map[string]*JobSpec{
+		"hourly":   {Command: []string{"date"}, Cron: "0 * * * *"},
+		"new_york": {Command: []string{"date"}, Cron: "0 9 * * *", TZLocation: "America/New_York"},
+		"yearly":   {Command: []string{"date"}, Cron: "0 0 1 1 *"},
+		"manual":   {Command: []string{"date"}},
+		"off":      {Command: []string{"date"}, Cron: "* * * * *", Disable: true},
+	}, TZLocation: "UTC", log: NewLogger("debug", new(tsBuffer)), cfg: NewConfig()}
+	assert.NoError(t, s.initialize())
+
+	from := time.Date(2023, 6, 1, 11, 0, 0, 0, time.UTC)
+	sim, err := s.Simulate(from, from.Add(3*time.Hour))
+	assert.NoError(t, err)
+
+	got := []string{}
+	for _, f := range sim.Firings {
+		got = append(got, f.At.UTC().Format("15:04")+" "+f.Job)
+	}
+	// both ends of the window are included, 9:00 in new york is 13:00 utc
+	assert.Equal(t, []string{"11:00 hourly", "12:00 hourly", "13:00 hourly", "13:00 new_york", "14:00 hourly"}, got)
+	assert.Equal(t, []string{"manual", "off", "yearly"}, sim.NeverFire)
+
+	_, err = s.Simulate(from, from.Add(-time.Hour))
+	assert.Error(t, err)
+	_, err = s.Simulate(from, from.Add(2*365*24*time.Hour))
+	assert.ErrorContains(t, err, "try a smaller one")
+
+	handler := setupMux(s)
+	for query, code := range map[string]int{
+		"":                                 http.StatusOK,
+		"?from=2023-06-01T11:00:00Z":       http.StatusOK,
+		"?from=yesterday":                  http.StatusBadRequest,
+		"?from=2023-06-01T11:00:00Z&to=11": http.StatusBadRequest,
+		"?from=2023-06-01T11:00:00Z&to=2023-06-01T10:00:00Z": http.StatusBadRequest,
+	} {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("GET", "/simulate"+query, nil))
+		assert.Equal(t, code, resp.Code, query)
+	}
+}
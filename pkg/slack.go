@@ -0,0 +1,197 @@
+package cheek
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SlackWebhook is a Slack incoming webhook to notify. Template replaces the
+// layout of the message, it gets rendered with a slackMessage.
+type SlackWebhook struct {
+	URL      string `yaml:"url" json:"url"`
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+}
+
+// UnmarshalYAML accepts both a url and a mapping with a url and a template.
+func (w *SlackWebhook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var u string
+	if err := unmarshal(&u); err == nil {
+		*w = SlackWebhook{URL: u}
+		return nil
+	}
+
+	type slackWebhook SlackWebhook
+	var wh slackWebhook
+	if err := unmarshal(&wh); err != nil {
+		return err
+	}
+	*w = SlackWebhook(wh)
+	return nil
+}
+
+// MarshalYAML writes webhooks without a template as just their url.
+func (w SlackWebhook) MarshalYAML() (interface{}, error) {
+	if w.Template == "" {
+		return w.URL, nil
+	}
+
+	type slackWebhook SlackWebhook
+	return slackWebhook(w), nil
+}
+
+func (w SlackWebhook) validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("slack webhook without url")
+	}
+	if _, err := slackTemplate(w.Template, nil); err != nil {
+		return fmt.Errorf("can't parse template of slack webhook '%s': %w", w.URL, err)
+	}
+	return nil
+}
+
+// Limits of Slack on the parts of a message.
+const (
+	slackMaxHeaderLength  = 150
+	slackMaxSectionLength = 3000
+	slackMaxTextLength    = 4000
+)
+
+// slackLogLines is how many of the last lines of a run's log are included in a Slack message.
+const slackLogLines = 30
+
+// slackMessage is what the template of a Slack message can refer to.
+type slackMessage struct {
+	Run *JobRun
+	// e.g. "backup failed"
+	Title string
+	// the plain text version of the message, shown in notifications
+	Text      string
+	Color     string
+	Duration  string
+	Succeeded bool
+	// the last lines of the log, cut to fit in a section of a message
+	LogTail string
+}
+
+func newSlackMessage(jr *JobRun) slackMessage {
+	m := slackMessage{
+		Run:       jr,
+		Title:     fmt.Sprintf("%s failed", jr.Name),
+		Text:      fmt.Sprintf("%s (exitcode %v):\n%s", jr.Name, jr.Status, jr.notifyLog()),
+		Color:     fmt.Sprintf("#%06x", colorFailure),
+		Duration:  jr.Duration.Truncate(time.Millisecond).String(),
+		Succeeded: jr.succeeded(),
+	}
+	if m.Succeeded {
+		m.Title = fmt.Sprintf("%s succeeded", jr.Name)
+		m.Color = fmt.Sprintf("#%06x", colorSuccess)
+	}
+	if m.Succeeded && jr.PreviousFailures > 0 {
+		m.Title = fmt.Sprintf("%s recovered after %v failed runs", jr.Name, jr.PreviousFailures)
+		m.Text = fmt.Sprintf("%s recovered after %v failed runs (exitcode %v):\n%s", jr.Name, jr.PreviousFailures, jr.Status, jr.Log)
+	}
+	m.Title = truncate(m.Title, slackMaxHeaderLength)
+	m.Text = logTail(m.Text, slackMaxTextLength)
+
+	lines := strings.Split(strings.TrimRight(jr.notifyLog(), "\n"), "\n")
+	if len(lines) > slackLogLines {
+		lines = lines[len(lines)-slackLogLines:]
+	}
+	// the code block markers count towards the limit as well
+	m.LogTail = logTail(strings.Join(lines, "\n"), slackMaxSectionLength-8)
+	return m
+}
+
+// defaultSlackTemplate lays out a failure with its details and the tail of
+// its log, and a success in a single line.
+const defaultSlackTemplate = `{
+  "text": {{ json .Text }},
+  "blocks": [{"type": "header", "text": {"type": "plain_text", "text": {{ json .Title }}}}],
+  "attachments": [{
+    "color": {{ json .Color }},
+    "blocks": [
+{{- if .Succeeded }}
+      {"type": "context", "elements": [{"type": "mrkdwn", "text": {{ json (printf "triggered by %s, took %s" .Run.TriggeredBy .Duration) }}}]}
+{{- else }}
+      {"type": "section", "fields": [
+        {"type": "mrkdwn", "text": {{ json (printf "*Triggered by*\n%s" .Run.TriggeredBy) }}},
+        {"type": "mrkdwn", "text": {{ json (printf "*Duration*\n%s" .Duration) }}},
+        {"type": "mrkdwn", "text": {{ json (printf "*Exit code*\n%v" .Run.Status) }}}
+      ]}
+{{- if .LogTail }},
+      {"type": "section", "text": {"type": "mrkdwn", "text": {{ json (printf "` + "```\\n%s\\n```" + `" .LogTail) }}}}
+{{- end }}
+{{- end }}
+    ]
+  }]
+}`
+
+// slackTemplate parses the template of a Slack message, the built-in one
+// when text is empty. Next to the functions of commands, it has json to
+// quote values.
+func slackTemplate(text string, jr *JobRun) (*template.Template, error) {
+	if text == "" {
+		text = defaultSlackTemplate
+	}
+	funcs := webhookTemplateFuncs(jr)
+	funcs["json"] = func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	return template.New("slack").Funcs(funcs).Parse(text)
+}
+
+// renderSlackMessage renders the message about a run with the given template,
+// the built-in one when it is empty.
+func renderSlackMessage(text string, jr *JobRun) ([]byte, error) {
+	tmpl, err := slackTemplate(text, jr)
+	if err != nil {
+		return nil, err
+	}
+	b := bytes.Buffer{}
+	if err := tmpl.Execute(&b, newSlackMessage(jr)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+type slackPayload struct {
+	Text        string          `json:"text"`
+	Blocks      json.RawMessage `json:"blocks,omitempty"`
+	Attachments json.RawMessage `json:"attachments,omitempty"`
+}
+
+// newSlackPayload lays out the message about a run with the built-in template.
+func newSlackPayload(jr *JobRun) slackPayload {
+	d := slackPayload{}
+	b, err := renderSlackMessage("", jr)
+	if err == nil {
+		err = json.Unmarshal(b, &d)
+	}
+	if err != nil {
+		// not expected to happen, fall back to just the text
+		return slackPayload{Text: newSlackMessage(jr).Text}
+	}
+	return d
+}
+
+// call notifies the webhook about a run with its own template.
+func (w SlackWebhook) call(ctx context.Context, jr *JobRun) ([]byte, error) {
+	if w.Template == "" {
+		return JobRunWebhookCall(ctx, jr, w.URL, "slack")
+	}
+
+	payload, err := renderSlackMessage(w.Template, jr)
+	if err != nil {
+		return []byte{}, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return deliverWebhook(ctx, notifyConfig(jr), "slack", http.MethodPost, w.URL, header, payload)
+}
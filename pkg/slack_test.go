@@ -0,0 +1,142 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// slackBlocks decodes the blocks of a Slack message, those of its first
+// attachment and the color of the latter.
+func slackBlocks(t *testing.T, p slackPayload) ([]map[string]interface{}, []map[string]interface{}, string) {
+	var blocks []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(p.Blocks, &blocks))
+	var attachments []struct {
+		Color  string                   `json:"color"`
+		Blocks []map[string]interface{} `json:"blocks"`
+	}
+	assert.NoError(t, json.Unmarshal(p.Attachments, &attachments))
+	if !assert.Len(t, attachments, 1) {
+		t.FailNow()
+	}
+	return blocks, attachments[0].Blocks, attachments[0].Color
+}
+
+func TestSlackPayload(t *testing.T) {
+	lines := []string{}
+	for i := 1; i <= 50; i++ {
+		lines = append(lines, fmt.Sprintf("line %v", i))
+	}
+	jr := JobRun{
+		Status:      2,
+		Name:        "backup",
+		TriggeredBy: "cron",
+		Duration:    1500 * time.Millisecond,
+		Log:         strings.Join(lines, "\n") + "\n",
+	}
+
+	p := newSlackPayload(&jr)
+	assert.True(t, strings.HasPrefix(p.Text, "backup (exitcode 2):\nline 1\n"))
+	blocks, details, color := slackBlocks(t, p)
+	assert.Equal(t, "#d00000", color)
+	assert.Equal(t, "backup failed", blocks[0]["text"].(map[string]interface{})["text"])
+	if assert.Len(t, details, 2) {
+		fields := details[0]["fields"].([]interface{})
+		assert.Equal(t, "*Triggered by*\ncron", fields[0].(map[string]interface{})["text"])
+		assert.Equal(t, "*Duration*\n1.5s", fields[1].(map[string]interface{})["text"])
+		assert.Equal(t, "*Exit code*\n2", fields[2].(map[string]interface{})["text"])
+		// only the last lines of the log
+		log := details[1]["text"].(map[string]interface{})["text"].(string)
+		assert.True(t, strings.HasPrefix(log, "```\nline 21\n"))
+		assert.True(t, strings.HasSuffix(log, "line 50\n```"))
+	}
+
+	// a success is green and compact
+	jr.Status = 0
+	jr.PreviousFailures = 3
+	p = newSlackPayload(&jr)
+	assert.True(t, strings.HasPrefix(p.Text, "backup recovered after 3 failed runs (exitcode 0):\n"))
+	blocks, details, color = slackBlocks(t, p)
+	assert.Equal(t, "#2eb886", color)
+	assert.Equal(t, "backup recovered after 3 failed runs", blocks[0]["text"].(map[string]interface{})["text"])
+	if assert.Len(t, details, 1) {
+		assert.Equal(t, "context", details[0]["type"])
+		assert.Equal(t, "triggered by cron, took 1.5s", details[0]["elements"].([]interface{})[0].(map[string]interface{})["text"])
+	}
+}
+
+func TestSlackPayloadLimits(t *testing.T) {
+	jr := JobRun{
+		Status:      1,
+		Name:        strings.Repeat("n", 500),
+		TriggeredBy: "cron",
+		Log:         strings.Repeat(strings.Repeat("é", 10000)+"\n", 100) + "the \"end\"",
+	}
+
+	p := newSlackPayload(&jr)
+	assert.Equal(t, slackMaxTextLength, utf8.RuneCountInString(p.Text))
+	assert.True(t, strings.HasSuffix(p.Text, `the "end"`))
+	blocks, details, _ := slackBlocks(t, p)
+	assert.Equal(t, slackMaxHeaderLength, utf8.RuneCountInString(blocks[0]["text"].(map[string]interface{})["text"].(string)))
+	log := details[1]["text"].(map[string]interface{})["text"].(string)
+	assert.Equal(t, slackMaxSectionLength, utf8.RuneCountInString(log))
+	assert.True(t, strings.HasSuffix(log, "the \"end\"\n```"))
+
+	b, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.Less(t, len(b), 40000)
+}
+
+func TestSlackWebhookTemplate(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.URL.Path] = string(b)
+	}))
+	defer ts.Close()
+
+	e := OnEvent{}
+	assert.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+notify_slack_webhook:
+  - %[1]s/default
+  - url: %[1]s/custom
+    template: '{"text": {{ json (printf "%%s is done, %%s" .Run.Name .Title) }}}'
+`, ts.URL)), &e))
+	assert.Equal(t, SlackWebhook{URL: ts.URL + "/default"}, e.NotifySlackWebhook[0])
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{Name: "backup", Command: []string{"true"}, OnSuccess: e, cfg: cfg}
+	assert.NoError(t, j.ValidateWebhooks())
+	j.execCommandWithRetry(context.Background(), "test", nil)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, `{"text": "backup is done, backup succeeded"}`, received["/custom"])
+	assert.Contains(t, received["/default"], `"attachments"`)
+
+	// the template of a webhook that doesn't parse is refused, as is one without url
+	j.OnSuccess.NotifySlackWebhook = []SlackWebhook{{URL: ts.URL, Template: "{{ .Title"}}
+	assert.ErrorContains(t, j.ValidateWebhooks(), "can't parse template of slack webhook")
+	j.OnSuccess.NotifySlackWebhook = []SlackWebhook{{Template: "{}"}}
+	assert.Error(t, j.ValidateWebhooks())
+
+	// webhooks without a template are written as just their url
+	b, err := yaml.Marshal(OnEvent{NotifySlackWebhook: []SlackWebhook{{URL: "https://hooks.slack.com/x"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "notify_slack_webhook:\n    - https://hooks.slack.com/x\n", string(b))
+}
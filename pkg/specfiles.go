@@ -0,0 +1,131 @@
+package cheek
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isGlob tells whether a schedule argument is a pattern rather than a path.
+func isGlob(fn string) bool {
+	return strings.ContainsAny(fn, "*?[")
+}
+
+// specFiles lists the schedule files fn refers to: fn itself, the yaml files
+// in the directory fn or the files that match the glob fn.
+func specFiles(fn string) ([]string, error) {
+	var files []string
+
+	if isGlob(fn) {
+		matches, err := filepath.Glob(fn)
+		if err != nil {
+			return nil, err
+		}
+		files = matches
+	} else {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return []string{fn}, nil
+		}
+
+		entries, err := os.ReadDir(fn)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			files = append(files, filepath.Join(fn, e.Name()))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no schedule files found in '%s'", fn)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// specsModTime returns when the schedule files fn refers to last changed. The
+// directories holding them are included to pick up on files being added or removed.
+func specsModTime(fn string) (time.Time, error) {
+	paths := []string{}
+	if isGlob(fn) {
+		paths = append(paths, filepath.Dir(fn))
+	}
+	files, err := specFiles(fn)
+	if err != nil {
+		return time.Time{}, err
+	}
+	paths = append(paths, files...)
+	if len(files) > 1 || files[0] != fn {
+		paths = append(paths, fn)
+	}
+
+	var latest time.Time
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			if isGlob(p) {
+				continue
+			}
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// readSchedule reads the specs of all schedule files fn refers to and merges
+// their jobs. Schedule wide settings can only be set in one of the files.
+func readSchedule(fn string) (*Schedule, error) {
+	files, err := specFiles(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *Schedule
+	jobs := map[string]*JobSpec{}
+	for _, file := range files {
+		specs, err := readSpecs(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, j := range specs.Jobs {
+			if other, ok := jobs[name]; ok {
+				return nil, fmt.Errorf("job '%s' is defined in both '%s' and '%s'", name, other.SourceFile, file)
+			}
+			if j == nil {
+				j = &JobSpec{}
+			}
+			j.SourceFile = file
+			jobs[name] = j
+		}
+
+		if len(specs.settings) == 0 {
+			continue
+		}
+		if base != nil && len(base.settings) > 0 {
+			return nil, fmt.Errorf("schedule wide settings can only be set in one file, found them in both '%s' and '%s'", base.fn, file)
+		}
+		base = specs
+		base.fn = file
+	}
+
+	if base == nil {
+		base = &Schedule{}
+	}
+	base.Jobs = jobs
+	return base, nil
+}
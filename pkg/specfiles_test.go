@@ -0,0 +1,84 @@
+package cheek
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadScheduleDir(t *testing.T) {
+	for _, fn := range []string{"../testdata/jobs.d", "../testdata/jobs.d/*.yaml"} {
+		s, err := loadSchedule(zerolog.Logger{}, NewConfig(), fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, s.Jobs, 2, fn)
+		assert.Equal(t, "UTC", s.TZLocation, fn)
+		assert.Equal(t, "../testdata/jobs.d/etl.yaml", s.Jobs["extract"].SourceFile, fn)
+		assert.Equal(t, "../testdata/jobs.d/backups.yaml", s.Jobs["backup"].SourceFile, fn)
+
+		out, err := json.Marshal(s)
+		assert.NoError(t, err)
+		assert.Contains(t, string(out), `"source_file":"../testdata/jobs.d/backups.yaml"`)
+	}
+
+	_, err := loadSchedule(zerolog.Logger{}, NewConfig(), "../testdata/jobs.d/*.yml")
+	assert.ErrorContains(t, err, "no schedule files found")
+}
+
+func TestLoadScheduleDirConflicts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, specs string) {
+		if err := os.WriteFile(path.Join(dir, name), []byte(specs), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a.yaml", "max_concurrent_jobs: 2\njobs:\n  foo:\n    command: date\n")
+	write("b.yaml", "jobs:\n  bar:\n    command: date\n    on_success:\n      trigger_job: [missing]\n")
+
+	// references are checked across all files
+	_, err := loadSchedule(zerolog.Logger{}, NewConfig(), dir)
+	assert.ErrorContains(t, err, "cannot find spec of job 'missing'")
+
+	write("b.yaml", "jobs:\n  foo:\n    command: date\n")
+	_, err = loadSchedule(zerolog.Logger{}, NewConfig(), dir)
+	assert.EqualError(t, err, "job 'foo' is defined in both '"+path.Join(dir, "a.yaml")+"' and '"+path.Join(dir, "b.yaml")+"'")
+
+	write("b.yaml", "tz_location: UTC\njobs:\n  bar:\n    command: date\n")
+	_, err = loadSchedule(zerolog.Logger{}, NewConfig(), dir)
+	assert.ErrorContains(t, err, "schedule wide settings can only be set in one file")
+}
+
+func TestReloadDirOnNewFile(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	fn := path.Join(dir, "a.yaml")
+	if err := os.WriteFile(fn, []byte("jobs:\n  foo:\n    command: date\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{fn, dir} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := loadSchedule(zerolog.Logger{}, NewConfig(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, s.Jobs, 1)
+
+	if err := os.WriteFile(path.Join(dir, "b.yml"), []byte("jobs:\n  bar:\n    command: date\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.reloadIfChanged()
+	assert.Len(t, s.Jobs, 2)
+	assert.Equal(t, path.Join(dir, "b.yml"), s.Jobs["bar"].SourceFile)
+}
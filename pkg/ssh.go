@@ -0,0 +1,308 @@
+package cheek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshDialTimeout is how long connecting and authenticating to a host may take.
+var sshDialTimeout = 30 * time.Second
+
+// sshDefaultKeys are the keys in ~/.ssh that get tried when a job has no key file.
+var sshDefaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// SSHSpec describes the host a job runs its command on.
+type SSHSpec struct {
+	Host string `yaml:"host" json:"host"`
+	User string `yaml:"user,omitempty" json:"user,omitempty"`
+	Port int    `yaml:"port,omitempty" json:"port,omitempty"`
+	// without a key file, the keys of the ssh agent and the default keys get tried
+	KeyFile string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	// where to check the key of the host, defaults to the known_hosts of the user
+	KnownHosts string `yaml:"known_hosts,omitempty" json:"known_hosts,omitempty"`
+	// skip checking the key of the host
+	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+func (j *JobSpec) ValidateSSH() error {
+	if j.SSH == nil {
+		return nil
+	}
+	if j.SSH.Host == "" {
+		return fmt.Errorf("ssh of job '%s' needs a host", j.Name)
+	}
+	if j.SSH.Port < 0 || j.SSH.Port > 65535 {
+		return fmt.Errorf("ssh port of job '%s' should be between 1 and 65535, got %v", j.Name, j.SSH.Port)
+	}
+	if j.Container != nil {
+		return fmt.Errorf("job '%s' can't have both ssh and container", j.Name)
+	}
+	return nil
+}
+
+// sshRunner executes the command of a job on another host over ssh. Unlike the
+// other runners it doesn't start a local process.
+type sshRunner struct {
+	spec *SSHSpec
+	job  *JobSpec
+	// the connection to the ssh agent, only needed while authenticating
+	agent net.Conn
+}
+
+// sshIO is where the input and output of a remote command go, log gets the
+// messages about how the run ended.
+type sshIO struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	log            io.Writer
+}
+
+// exec runs the command on the host and records how it went in jr, like
+// execAttempt does for local commands. The command gets signaled when ctx is
+// done and its session closed once it doesn't stop in time.
+func (r *sshRunner) exec(ctx, parent context.Context, jr *JobRun, proc *runningProcess, command, env []string, stdio sshIO, log zerolog.Logger) {
+	j := r.job
+	trigger := jr.TriggeredBy
+
+	client, err := r.dial(ctx)
+	if err != nil {
+		j.failStart(jr, trigger, err)
+		return
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		j.failStart(jr, trigger, err)
+		return
+	}
+	defer session.Close()
+
+	// the host only sets the variables its sshd accepts (see AcceptEnv)
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		if err := session.Setenv(k, v); err != nil {
+			log.Debug().Str("job", j.Name).Str("var", k).Err(err).Msg("host did not accept env var")
+		}
+	}
+
+	session.Stdin = stdio.stdin
+	session.Stdout = stdio.stdout
+	session.Stderr = stdio.stderr
+
+	// the remote shell parses the command again
+	quoted := make([]string, 0, len(command))
+	for _, arg := range command {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	if err := session.Start(strings.Join(quoted, " ")); err != nil {
+		j.failStart(jr, trigger, err)
+		return
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- session.Wait() }()
+
+	untrack := j.globalSchedule.track(j.Name, proc)
+	select {
+	case err = <-waited:
+	case <-ctx.Done():
+		termErr := proc.terminate(parent.Err() != nil, func() error {
+			return session.Signal(ssh.SIGTERM)
+		}, func() ([]int, error) {
+			// not every sshd passes on signals, closing the connection ends the
+			// session either way
+			_ = session.Signal(ssh.SIGKILL)
+			return nil, client.Close()
+		})
+		if termErr != nil {
+			log.Debug().Str("job", j.Name).Err(termErr).Msg("could not signal remote command")
+		}
+		err = <-waited
+	}
+	untrack()
+	canceled := proc.done()
+
+	end := func(state string, status int, msg string) {
+		jr.State = state
+		jr.Status = status
+		log.Warn().Str("job", j.Name).Str("trigger", trigger).Msg(msg)
+		if _, err := stdio.log.Write([]byte(msg)); err != nil {
+			log.Debug().Str("job", j.Name).Err(err).Msg("can't write to log buffer")
+		}
+	}
+
+	switch {
+	case err != nil && parent.Err() != nil:
+		end(RunStateCanceled, StatusCanceled, fmt.Sprintf("job canceled: %v", parent.Err()))
+		return
+	case canceled:
+		end(RunStateCanceled, StatusCanceled, "job canceled via the api")
+		return
+	case err != nil && ctx.Err() == context.DeadlineExceeded:
+		end(RunStateTimedOut, StatusTimeout, fmt.Sprintf("job killed due to timeout after %v", j.Timeout))
+		return
+	}
+
+	var exitError *ssh.ExitError
+	switch {
+	case err == nil:
+		jr.Status = 0
+		jr.State = RunStateCompleted
+		log.Debug().Str("job", j.Name).Int("exitcode", jr.Status).Msgf("job exited status: %v", jr.Status)
+	case errors.As(err, &exitError):
+		jr.Status = exitError.ExitStatus()
+		jr.State = RunStateCompleted
+		// a command that got terminated by a signal did not exit by itself
+		if exitError.Signal() != "" {
+			jr.State = RunStateKilled
+		}
+		log.Warn().Str("job", j.Name).Msgf("Exit code %v", jr.Status)
+	default:
+		// the session ended without telling how the command did
+		end(RunStateCompleted, jr.Status, fmt.Sprintf("lost connection to %s: %v", r.spec.Host, err))
+	}
+}
+
+// dial connects and authenticates to the host of the job.
+func (r *sshRunner) dial(ctx context.Context) (*ssh.Client, error) {
+	config, err := r.clientConfig()
+	if r.agent != nil {
+		defer r.agent.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	port := r.spec.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(r.spec.Host, strconv.Itoa(port))
+
+	d := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// the handshake should not hang on a host that accepts but never answers
+	if err := conn.SetDeadline(time.Now().Add(sshDialTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (r *sshRunner) clientConfig() (*ssh.ClientConfig, error) {
+	name := r.spec.User
+	if name == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("no ssh user: %w", err)
+		}
+		name = u.Username
+	}
+
+	auth, err := r.auth()
+	if err != nil {
+		return nil, err
+	}
+
+	hostKey, err := r.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{User: name, Auth: auth, HostKeyCallback: hostKey}, nil
+}
+
+// auth uses the key file of the job, or else the keys of the ssh agent and the
+// default keys of the user that aren't protected by a passphrase.
+func (r *sshRunner) auth() ([]ssh.AuthMethod, error) {
+	if r.spec.KeyFile != "" {
+		signer, err := readSigner(r.job.specPath(r.spec.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			r.agent = conn
+			if s, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, s...)
+			}
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, key := range sshDefaultKeys {
+			if s, err := readSigner(filepath.Join(home, ".ssh", key)); err == nil {
+				signers = append(signers, s)
+			}
+		}
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no ssh keys found, set a key_file")
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+func (r *sshRunner) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if r.spec.Insecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	fn := r.spec.KnownHosts
+	if fn == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("no known_hosts: %w", err)
+		}
+		fn = filepath.Join(home, ".ssh", "known_hosts")
+	} else {
+		fn = r.job.specPath(fn)
+	}
+	return knownhosts.New(fn)
+}
+
+func readSigner(fn string) (ssh.Signer, error) {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("can't use ssh key %s: %w", fn, err)
+	}
+	return signer, nil
+}
+
+// shellQuote quotes s for a posix shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,311 @@
+//go:build !windows
+
+package cheek
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an sshd that runs exec requests with sh, it only lets in
+// the client key it got created with.
+type testSSHServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+
+	mu sync.Mutex
+	// the user of the last session, and the env vars it accepted
+	user    string
+	env     map[string]string
+	signals []string
+}
+
+func newTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &testSSHServer{addr: l.Addr().String(), hostKey: hostSigner.PublicKey()}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+
+	s.mu.Lock()
+	s.user = sc.User()
+	s.env = map[string]string{}
+	s.mu.Unlock()
+
+	for nc := range chans {
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(ch, requests)
+	}
+}
+
+func (s *testSSHServer) session(ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	var env []string
+	var cmd *exec.Cmd
+	exited := make(chan int, 1)
+
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				// the client hung up, like sshd the command goes down with it
+				if cmd != nil && cmd.Process != nil {
+					_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				}
+				return
+			}
+			switch req.Type {
+			case "env":
+				var kv struct{ Name, Value string }
+				_ = ssh.Unmarshal(req.Payload, &kv)
+				// like an sshd with AcceptEnv CHEEK_* TEA
+				accept := kv.Name == "TEA" || len(kv.Name) > 6 && kv.Name[:6] == "CHEEK_"
+				if accept {
+					env = append(env, kv.Name+"="+kv.Value)
+					s.mu.Lock()
+					s.env[kv.Name] = kv.Value
+					s.mu.Unlock()
+				}
+				_ = req.Reply(accept, nil)
+			case "exec":
+				var payload struct{ Command string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				cmd = exec.Command("sh", "-c", payload.Command)
+				cmd.Env = append(os.Environ(), env...)
+				cmd.Stdin = ch
+				cmd.Stdout = ch
+				cmd.Stderr = ch.Stderr()
+				cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+				if err := cmd.Start(); err != nil {
+					_ = req.Reply(false, nil)
+					return
+				}
+				_ = req.Reply(true, nil)
+				go func() {
+					_ = cmd.Wait()
+					exited <- cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+				}()
+			case "signal":
+				var payload struct{ Signal string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				s.mu.Lock()
+				s.signals = append(s.signals, payload.Signal)
+				s.mu.Unlock()
+				if payload.Signal == string(ssh.SIGTERM) && cmd != nil {
+					_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+				}
+				_ = req.Reply(true, nil)
+			default:
+				_ = req.Reply(false, nil)
+			}
+		case status := <-exited:
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], uint32(status))
+			_, _ = ch.SendRequest("exit-status", false, b[:])
+			return
+		}
+	}
+}
+
+func (s *testSSHServer) port() int {
+	_, p, _ := net.SplitHostPort(s.addr)
+	port, _ := strconv.Atoi(p)
+	return port
+}
+
+// sshTestJob writes the client key and the known hosts for the server next to
+// the schedule of the job.
+func sshTestJob(t *testing.T) (*JobSpec, *testSSHServer) {
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestSSHServer(t, signer.PublicKey())
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, srv.hostKey)
+	if err := os.WriteFile(filepath.Join(dir, "known_hosts"), []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	j := &JobSpec{
+		Name:           "test",
+		SSH:            &SSHSpec{Host: "127.0.0.1", User: "cheek", Port: srv.port(), KeyFile: "id_ed25519", KnownHosts: "known_hosts"},
+		globalSchedule: &Schedule{fn: filepath.Join(dir, "schedule.yaml"), loc: time.Local},
+		cfg:            cfg,
+		log:            NewLogger("debug", new(tsBuffer)),
+	}
+	return j, srv
+}
+
+func TestSSHRunner(t *testing.T) {
+	j, srv := sshTestJob(t)
+	j.Command = []string{"sh", "-c", "echo \"it's $1 $TEA\"; exit 255", "sh", "remote"}
+	j.Env = map[string]string{"TEA": "green", "COFFEE": "black"}
+	assert.NoError(t, j.ValidateSSH())
+
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	// the remote exit status becomes the status of the run, 255 included
+	assert.Equal(t, 255, jr.Status)
+	assert.Equal(t, RunStateCompleted, jr.State)
+	assert.Equal(t, "it's remote green\n", jr.Log)
+
+	srv.mu.Lock()
+	assert.Equal(t, "cheek", srv.user)
+	assert.Equal(t, "green", srv.env["TEA"])
+	assert.Equal(t, "test", srv.env["CHEEK_JOB_NAME"])
+	assert.NotContains(t, srv.env, "COFFEE")
+	srv.mu.Unlock()
+}
+
+func TestSSHRunnerStartFailed(t *testing.T) {
+	j, _ := sshTestJob(t)
+	j.Command = []string{"true"}
+
+	// a host that is not in known_hosts
+	other, _ := sshTestJob(t)
+	j.SSH.Port = other.SSH.Port
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "Job unable to start")
+	assert.Contains(t, jr.Log, "key is unknown")
+
+	// nothing listens here
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	j.SSH.Port = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	j.SSH.Insecure = true
+	jr = j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, RunStateStartFailed, jr.State)
+	assert.Contains(t, jr.Log, "connection refused")
+}
+
+func TestSSHRunnerTimeout(t *testing.T) {
+	j, _ := sshTestJob(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	j.Command = []string{"sh", "-c", "echo $$ > " + pidFile + "; exec sleep 30"}
+	j.Timeout = 500 * time.Millisecond
+
+	start := time.Now()
+	jr := j.execCommand(context.Background(), "test", nil)
+	jr.flushLogBuffer()
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, RunStateTimedOut, jr.State)
+	assert.Equal(t, StatusTimeout, jr.Status)
+	assert.Contains(t, jr.Log, "job killed due to timeout")
+
+	// closing the session took the remote command down
+	b, err := os.ReadFile(pidFile)
+	assert.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) != nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestSSHRunnerCancel(t *testing.T) {
+	j, srv := sshTestJob(t)
+	j.Command = []string{"sh", "-c", "trap 'echo bye; exit 3' TERM; sleep 30 >/dev/null & wait"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	jr := j.execCommand(ctx, "test", nil)
+	jr.flushLogBuffer()
+	assert.Equal(t, RunStateCanceled, jr.State)
+	assert.Contains(t, jr.Log, "bye")
+
+	// asked to stop first, the command did so within the grace period
+	srv.mu.Lock()
+	assert.Equal(t, []string{string(ssh.SIGTERM)}, srv.signals)
+	srv.mu.Unlock()
+}
+
+func TestValidateSSH(t *testing.T) {
+	assert.Error(t, (&JobSpec{SSH: &SSHSpec{}}).ValidateSSH())
+	assert.Error(t, (&JobSpec{SSH: &SSHSpec{Host: "h", Port: 70000}}).ValidateSSH())
+	assert.Error(t, (&JobSpec{SSH: &SSHSpec{Host: "h"}, Container: &ContainerSpec{Image: "alpine"}}).ValidateSSH())
+	assert.NoError(t, (&JobSpec{}).ValidateSSH())
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'plain'`, shellQuote("plain"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
@@ -0,0 +1,77 @@
+package cheek
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// JobStats sums up the run history of a job. Skipped runs don't count and
+// durations only cover runs that have one recorded.
+type JobStats struct {
+	Job                 string        `json:"job"`
+	TotalRuns           int           `json:"total_runs"`
+	Successes           int           `json:"successes"`
+	Failures            int           `json:"failures"`
+	SuccessRate         *float64      `json:"success_rate,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	MinDuration         time.Duration `json:"min_duration"`
+	AvgDuration         time.Duration `json:"avg_duration"`
+	P95Duration         time.Duration `json:"p95_duration"`
+	MaxDuration         time.Duration `json:"max_duration"`
+	LastSuccess         *time.Time    `json:"last_success,omitempty"`
+	LastFailure         *time.Time    `json:"last_failure,omitempty"`
+	// runs in the history that could not be read
+	CorruptRuns int `json:"corrupt_runs"`
+}
+
+// stats computes the statistics of the job's run history.
+func (j *JobSpec) stats() (JobStats, error) {
+	st := JobStats{Job: j.Name}
+	durations := []time.Duration{}
+
+	corrupt, err := j.history().each(j.Name, func(jr JobRun) {
+		if jr.Status == StatusSkipped {
+			return
+		}
+
+		st.TotalRuns++
+		triggeredAt := jr.TriggeredAt
+		if j.successExitCode(jr.Status) {
+			st.Successes++
+			st.ConsecutiveFailures = 0
+			st.LastSuccess = &triggeredAt
+		} else {
+			st.Failures++
+			st.ConsecutiveFailures++
+			st.LastFailure = &triggeredAt
+		}
+		if jr.Duration > 0 {
+			durations = append(durations, jr.Duration)
+		}
+	})
+	if err != nil {
+		return st, err
+	}
+	st.CorruptRuns = corrupt
+
+	if st.TotalRuns > 0 {
+		rate := float64(st.Successes) / float64(st.TotalRuns)
+		st.SuccessRate = &rate
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, k int) bool { return durations[i] < durations[k] })
+		var sum time.Duration
+		for _, d := range durations {
+			sum += d
+		}
+		st.MinDuration = durations[0]
+		st.MaxDuration = durations[len(durations)-1]
+		st.AvgDuration = sum / time.Duration(len(durations))
+		// nearest rank
+		st.P95Duration = durations[int(math.Ceil(0.95*float64(len(durations))))-1]
+	}
+
+	return st, nil
+}
@@ -0,0 +1,72 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStats(t *testing.T) {
+	j := &JobSpec{Name: "test_job_stats"}
+	_ = os.Remove(jobLogFile(j.Name))
+
+	// no history yet
+	st, err := j.stats()
+	assert.NoError(t, err)
+	assert.Equal(t, JobStats{Job: j.Name}, st)
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	runs := []JobRun{
+		{Status: 0, Duration: 2 * time.Second},
+		{Status: 1, Duration: 4 * time.Second},
+		{Status: StatusSkipped, State: RunStateSkipped},
+		{Status: 0},
+		{Status: 0, Duration: 6 * time.Second},
+		{Status: 1, Duration: 8 * time.Second},
+		{Status: StatusTimeout, Duration: 10 * time.Second},
+	}
+	for i := range runs {
+		runs[i].Name = j.Name
+		runs[i].TriggeredAt = start.Add(time.Duration(i) * time.Hour)
+		assert.NoError(t, j.history().append(&runs[i]))
+	}
+	f, err := os.OpenFile(jobLogFile(j.Name), os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("{not json\n")
+	assert.NoError(t, err)
+	f.Close()
+
+	st, err = j.stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, st.TotalRuns)
+	assert.Equal(t, 3, st.Successes)
+	assert.Equal(t, 3, st.Failures)
+	assert.Equal(t, 0.5, *st.SuccessRate)
+	assert.Equal(t, 2, st.ConsecutiveFailures)
+	// runs without a duration are left out
+	assert.Equal(t, 2*time.Second, st.MinDuration)
+	assert.Equal(t, 6*time.Second, st.AvgDuration)
+	assert.Equal(t, 10*time.Second, st.P95Duration)
+	assert.Equal(t, 10*time.Second, st.MaxDuration)
+	assert.Equal(t, start.Add(4*time.Hour), st.LastSuccess.UTC())
+	assert.Equal(t, start.Add(6*time.Hour), st.LastFailure.UTC())
+	assert.Equal(t, 1, st.CorruptRuns)
+
+	handler := setupMux(&Schedule{Jobs: map[string]*JobSpec{j.Name: j}, cfg: NewConfig()})
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/jobs/test_job_stats/stats", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	got := JobStats{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, 6, got.TotalRuns)
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/job/test_job_stats", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "runs: 6 (3 succeeded, 3 failed), 2 failures in a row")
+}
@@ -0,0 +1,171 @@
+package cheek
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Supported storage backends for the run history.
+const (
+	StorageJSONL  string = "jsonl"
+	StorageSQLite string = "sqlite"
+)
+
+// runStore persists the runs of all jobs.
+type runStore interface {
+	// append adds a run to the history of its job.
+	append(jr *JobRun) error
+	// runs returns a window of runs of a job, newest first, and the total number of runs.
+	runs(jobName string, offset int, limit int) ([]JobRun, int, error)
+	// lastRuns returns the newest n runs of a job, newest first, without counting all of them.
+	lastRuns(jobName string, n int) ([]JobRun, error)
+	// prune drops the runs of a job that are not among the newest maxRuns or got
+	// triggered maxAge or longer before refTime, it returns how many got dropped.
+	prune(jobName string, maxRuns int, maxAge time.Duration, refTime time.Time) (int, error)
+	// each calls fn for every run of a job, oldest first, and returns how many
+	// runs could not be decoded. The logs of the runs are left out.
+	each(jobName string, fn func(jr JobRun)) (int, error)
+	// find returns the runs of a job that match, oldest first, logs included.
+	find(jobName string, match func(jr *JobRun) bool) ([]JobRun, error)
+}
+
+// openStore sets up the storage backend the config asks for.
+func openStore(log zerolog.Logger, cfg Config) (runStore, error) {
+	if _, err := ensureDataDir(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Storage {
+	case "", StorageJSONL:
+		return jsonlStore{log: log}, nil
+	case StorageSQLite:
+		if !sqliteSupported {
+			return nil, fmt.Errorf("storage '%s' is not available, cheek needs to be built with the sqlite build tag for it", StorageSQLite)
+		}
+		return openSQLiteStore(log, sqliteFile())
+	default:
+		return nil, fmt.Errorf("storage should be one of '%s' or '%s', got '%s'", StorageJSONL, StorageSQLite, cfg.Storage)
+	}
+}
+
+// history is where the runs of the jobs of the schedule get saved, a jsonl
+// file per job until prepare opened the storage the config asks for.
+func (s *Schedule) history() runStore {
+	if s == nil {
+		return jsonlStore{log: zerolog.Nop()}
+	}
+	if s.store == nil {
+		return jsonlStore{log: s.log}
+	}
+	return s.store
+}
+
+// history is where the runs of the job get saved.
+func (j *JobSpec) history() runStore {
+	return j.globalSchedule.history()
+}
+
+// findRun looks up a run of a job in the history by its id.
+func findRun(st runStore, jobName string, id string) (JobRun, bool, error) {
+	runs, err := st.find(jobName, func(jr *JobRun) bool { return jr.ID == id })
+	if err != nil || len(runs) == 0 {
+		return JobRun{}, false, err
+	}
+	// before retries got their own id, all attempts of a run shared it
+	jr := runs[len(runs)-1]
+	return jr, true, jr.loadLogFile()
+}
+
+// jsonlStore appends the runs of a job as JSON lines to a file in the cheek home dir.
+type jsonlStore struct {
+	log zerolog.Logger
+}
+
+func (s jsonlStore) append(jr *JobRun) error {
+	logFn := jobLogFile(jr.Name)
+	lock := jobLogLock(logFn)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := restoreLog(logFn); err != nil {
+		return fmt.Errorf("can't restore compressed job log '%v': %w", logFn, err)
+	}
+	f, err := os.OpenFile(logFn,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("can't open job log '%v' for writing: %w", logFn, err)
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(jr)
+}
+
+func (s jsonlStore) runs(jobName string, offset int, limit int) ([]JobRun, int, error) {
+	return readJobRuns(s.log, jobLogFile(jobName), offset, limit)
+}
+
+func (s jsonlStore) lastRuns(jobName string, n int) ([]JobRun, error) {
+	return readLastJobRuns(s.log, jobLogFile(jobName), n)
+}
+
+func (s jsonlStore) each(jobName string, fn func(jr JobRun)) (int, error) {
+	return s.scan(jobName, func(jr JobRun) {
+		jr.Log = ""
+		fn(jr)
+	})
+}
+
+func (s jsonlStore) find(jobName string, match func(jr *JobRun) bool) ([]JobRun, error) {
+	jrs := []JobRun{}
+	_, err := s.scan(jobName, func(jr JobRun) {
+		if match(&jr) {
+			jrs = append(jrs, jr)
+		}
+	})
+	return jrs, err
+}
+
+// scan calls fn for every run in the log of a job, oldest first, and returns
+// how many runs could not be decoded.
+func (s jsonlStore) scan(jobName string, fn func(jr JobRun)) (int, error) {
+	f, err := openLog(jobLogFile(jobName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	corrupt := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			jr := JobRun{}
+			if jsonErr := json.Unmarshal(line, &jr); jsonErr != nil {
+				corrupt++
+			} else {
+				fn(jr)
+			}
+		}
+		if err == io.EOF {
+			return corrupt, nil
+		}
+		if err != nil {
+			return corrupt, err
+		}
+	}
+}
+
+func (s jsonlStore) prune(jobName string, maxRuns int, maxAge time.Duration, refTime time.Time) (int, error) {
+	return pruneJobLog(jobLogFile(jobName), maxRuns, maxAge, refTime)
+}
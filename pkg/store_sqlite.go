@@ -0,0 +1,259 @@
+package cheek
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// sqliteDriver is the database/sql driver used for the sqlite store, it only
+// gets registered when cheek is built with the sqlite build tag.
+const sqliteDriver = "sqlite3"
+
+// sqliteTimeFormat is how timestamps are saved, it sorts and is understood by sqlite's date functions.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS job_runs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	job          TEXT NOT NULL,
+	run_id       TEXT,
+	status       INTEGER NOT NULL,
+	state        TEXT,
+	triggered_at TEXT NOT NULL,
+	triggered_by TEXT,
+	duration     INTEGER,
+	run          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS job_runs_job ON job_runs (job, id);
+CREATE INDEX IF NOT EXISTS job_runs_triggered_at ON job_runs (triggered_at);
+`
+
+func sqliteFile() string {
+	return path.Join(CheekPath(), "cheek.db")
+}
+
+// sqliteStore saves runs as rows in a sqlite database. Next to the full run as
+// JSON, the most relevant fields get their own column to allow for querying
+// across jobs.
+type sqliteStore struct {
+	db  *sql.DB
+	log zerolog.Logger
+}
+
+func openSQLiteStore(log zerolog.Logger, fn string) (*sqliteStore, error) {
+	db, err := sql.Open(sqliteDriver, fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open sqlite database '%s', is cheek built with the sqlite build tag? %w", fn, err)
+	}
+	// sqlite does not handle concurrent writers well
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot initialize sqlite database '%s': %w", fn, err)
+	}
+
+	s := &sqliteStore{db: db, log: log}
+	if err := s.importJSONL(CheekPath()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteStore) append(jr *JobRun) error {
+	return s.insert(s.db, jr)
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+const insertRunSQL = `INSERT INTO job_runs (job, run_id, status, state, triggered_at, triggered_by, duration, run) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)`
+
+// importRunSQL inserts a run unless the job already has one triggered at the
+// same time, which keeps importing a job log twice from duplicating its runs.
+const importRunSQL = `INSERT INTO job_runs (job, run_id, status, state, triggered_at, triggered_by, duration, run)
+SELECT ?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8
+WHERE NOT EXISTS (SELECT 1 FROM job_runs WHERE job = ?1 AND triggered_at = ?5)`
+
+func (s *sqliteStore) insert(db sqlExecer, jr *JobRun) error {
+	return s.exec(db, insertRunSQL, jr)
+}
+
+func (s *sqliteStore) exec(db sqlExecer, query string, jr *JobRun) error {
+	b, err := json.Marshal(jr)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		query,
+		jr.Name, jr.ID, jr.Status, jr.State, jr.TriggeredAt.UTC().Format(sqliteTimeFormat), jr.TriggeredBy, int64(jr.Duration), string(b),
+	)
+	return err
+}
+
+func (s *sqliteStore) runs(jobName string, offset int, limit int) ([]JobRun, int, error) {
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM job_runs WHERE job = ?`, jobName).Scan(&total); err != nil {
+		return []JobRun{}, 0, err
+	}
+
+	// a negative limit means no limit to sqlite
+	if limit < 1 {
+		limit = -1
+	}
+	rows, err := s.db.Query(`SELECT run FROM job_runs WHERE job = ? ORDER BY id DESC LIMIT ? OFFSET ?`, jobName, limit, offset)
+	if err != nil {
+		return []JobRun{}, 0, err
+	}
+	defer rows.Close()
+
+	jrs := []JobRun{}
+	for rows.Next() {
+		var run string
+		if err := rows.Scan(&run); err != nil {
+			return []JobRun{}, 0, err
+		}
+		jr := JobRun{}
+		if err := json.Unmarshal([]byte(run), &jr); err != nil {
+			s.log.Debug().Str("job", jobName).Err(err).Msgf("can't decode run: %s", run)
+			continue
+		}
+		jrs = append(jrs, jr)
+	}
+
+	return jrs, total, rows.Err()
+}
+
+func (s *sqliteStore) lastRuns(jobName string, n int) ([]JobRun, error) {
+	jrs, _, err := s.runs(jobName, 0, n)
+	return jrs, err
+}
+
+func (s *sqliteStore) each(jobName string, fn func(jr JobRun)) (int, error) {
+	rows, err := s.db.Query(`SELECT status, state, triggered_at, triggered_by, duration FROM job_runs WHERE job = ? ORDER BY id`, jobName)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	corrupt := 0
+	for rows.Next() {
+		var state, triggeredAt, triggeredBy sql.NullString
+		var duration sql.NullInt64
+		jr := JobRun{Name: jobName}
+		if err := rows.Scan(&jr.Status, &state, &triggeredAt, &triggeredBy, &duration); err != nil {
+			return corrupt, err
+		}
+		if jr.TriggeredAt, err = time.Parse(sqliteTimeFormat, triggeredAt.String); err != nil {
+			corrupt++
+			continue
+		}
+		jr.State = state.String
+		jr.TriggeredBy = triggeredBy.String
+		jr.Duration = time.Duration(duration.Int64)
+		fn(jr)
+	}
+	return corrupt, rows.Err()
+}
+
+func (s *sqliteStore) find(jobName string, match func(jr *JobRun) bool) ([]JobRun, error) {
+	rows, err := s.db.Query(`SELECT run FROM job_runs WHERE job = ? ORDER BY id`, jobName)
+	if err != nil {
+		return []JobRun{}, err
+	}
+	defer rows.Close()
+
+	jrs := []JobRun{}
+	for rows.Next() {
+		var run string
+		if err := rows.Scan(&run); err != nil {
+			return []JobRun{}, err
+		}
+		jr := JobRun{}
+		if err := json.Unmarshal([]byte(run), &jr); err != nil {
+			s.log.Debug().Str("job", jobName).Err(err).Msgf("can't decode run: %s", run)
+			continue
+		}
+		if match(&jr) {
+			jrs = append(jrs, jr)
+		}
+	}
+	return jrs, rows.Err()
+}
+
+func (s *sqliteStore) prune(jobName string, maxRuns int, maxAge time.Duration, refTime time.Time) (int, error) {
+	var pruned int64
+
+	if maxRuns > 0 {
+		res, err := s.db.Exec(
+			`DELETE FROM job_runs WHERE job = ? AND id NOT IN (SELECT id FROM job_runs WHERE job = ? ORDER BY id DESC LIMIT ?)`,
+			jobName, jobName, maxRuns,
+		)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		pruned += n
+	}
+
+	if maxAge > 0 {
+		cutoff := refTime.Add(-maxAge).UTC().Format(sqliteTimeFormat)
+		res, err := s.db.Exec(`DELETE FROM job_runs WHERE job = ? AND triggered_at < ?`, jobName, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		pruned += n
+	}
+
+	return int(pruned), nil
+}
+
+// importJSONL is a one-shot migration of the jsonl job logs in dir into the
+// database. Imported logs get renamed so that they are not imported again,
+// should that fail the runs that are already in the database get skipped.
+func (s *sqliteStore) importJSONL(dir string) error {
+	fns, err := filepath.Glob(path.Join(dir, "*.job.jsonl"))
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range fns {
+		jrs, _, err := readJobRuns(s.log, fn, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		// runs are read newest first
+		for i := len(jrs) - 1; i >= 0; i-- {
+			if err := s.exec(tx, importRunSQL, &jrs[i]); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("cannot import job log '%s': %w", fn, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("cannot import job log '%s': %w", fn, err)
+		}
+
+		if err := os.Rename(fn, fn+".imported"); err != nil {
+			return err
+		}
+		s.log.Info().Msgf("imported %v runs from job log '%s'", len(jrs), fn)
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build sqlite
+
+package cheek
+
+// registers the sqlite driver, build with `-tags sqlite` to include it
+import _ "github.com/mattn/go-sqlite3"
+
+const sqliteSupported = true
@@ -0,0 +1,5 @@
+//go:build !sqlite
+
+package cheek
+
+const sqliteSupported = false
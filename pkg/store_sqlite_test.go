@@ -0,0 +1,75 @@
+//go:build sqlite
+
+package cheek
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("homedir", dir)
+	defer viper.Set("homedir", nil)
+
+	// existing jsonl logs get imported once
+	writeTestRuns(t, path.Join(dir, "test.job.jsonl"), time.Now().Add(-time.Hour), time.Now())
+
+	st, err := openSQLiteStore(zerolog.Nop(), path.Join(dir, "cheek.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(path.Join(dir, "test.job.jsonl.imported"))
+	assert.NoError(t, err)
+
+	runs, total, err := st.runs("test", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "1", runs[0].Log)
+
+	// a log that did not get renamed after its import is not imported twice
+	assert.NoError(t, os.Rename(path.Join(dir, "test.job.jsonl.imported"), path.Join(dir, "test.job.jsonl")))
+	assert.NoError(t, st.importJSONL(dir))
+	_, total, err = st.runs("test", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	assert.NoError(t, st.append(&JobRun{Name: "test", Log: "2", TriggeredAt: time.Now()}))
+	assert.NoError(t, st.append(&JobRun{Name: "bar", Log: "bar", TriggeredAt: time.Now()}))
+
+	runs, total, err = st.runs("test", 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, "1", runs[0].Log)
+
+	// by age, then by number of runs
+	pruned, err := st.prune("test", 0, 30*time.Minute, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	pruned, err = st.prune("test", 1, 0, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	runs, total, err = st.runs("test", 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "2", runs[0].Log)
+
+	// other jobs are left alone
+	_, total, err = st.runs("bar", 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	seen := []JobRun{}
+	corrupt, err := st.each("test", func(jr JobRun) { seen = append(seen, jr) })
+	assert.NoError(t, err)
+	assert.Equal(t, 0, corrupt)
+	assert.Len(t, seen, 1)
+	assert.Equal(t, "test", seen[0].Name)
+}
@@ -0,0 +1,81 @@
+package cheek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenStore(t *testing.T) {
+	st, err := openStore(zerolog.Nop(), NewConfig())
+	assert.NoError(t, err)
+	assert.IsType(t, jsonlStore{}, st)
+
+	_, err = openStore(zerolog.Nop(), Config{Storage: "whatever"})
+	assert.Error(t, err)
+
+	// a build without the sqlite driver refuses to use it
+	if !sqliteSupported {
+		_, err = openStore(zerolog.Nop(), Config{Storage: StorageSQLite})
+		assert.ErrorContains(t, err, "sqlite build tag")
+	}
+}
+
+// countingStore counts the runs that get appended to it.
+type countingStore struct {
+	jsonlStore
+	appended int
+}
+
+func (s *countingStore) append(jr *JobRun) error {
+	s.appended++
+	return s.jsonlStore.append(jr)
+}
+
+func TestScheduleStore(t *testing.T) {
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	// every schedule saves the runs of its jobs in a store of its own
+	a, b := NewSchedule(zerolog.Nop(), cfg), NewSchedule(zerolog.Nop(), cfg)
+	storeA, storeB := &countingStore{}, &countingStore{}
+	a.store, b.store = storeA, storeB
+	assert.NoError(t, a.AddJob(&JobSpec{Name: "a", Command: []string{"true"}}))
+	assert.NoError(t, b.AddJob(&JobSpec{Name: "b", Command: []string{"true"}}))
+
+	_, err := a.RunJob(context.Background(), "a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, storeA.appended)
+	assert.Equal(t, 0, storeB.appended)
+
+	// a schedule that can't open its storage doesn't touch the one of another
+	c := NewSchedule(zerolog.Nop(), Config{Storage: "whatever"})
+	assert.Error(t, c.prepare())
+	assert.Equal(t, storeA, a.history())
+}
+
+func TestJSONLStore(t *testing.T) {
+	st := jsonlStore{log: zerolog.Nop()}
+	name := "test_jsonl_store"
+	_, _ = st.prune(name, 1, 0, time.Now())
+	_, _ = st.prune(name, 0, time.Nanosecond, time.Now())
+
+	for _, status := range []int{0, 1, 2} {
+		assert.NoError(t, st.append(&JobRun{Name: name, Status: status, TriggeredAt: time.Now()}))
+	}
+
+	runs, total, err := st.runs(name, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, 1, runs[0].Status)
+	}
+
+	pruned, err := st.prune(name, 2, 0, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+}
@@ -0,0 +1,226 @@
+package cheek
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// streamBuffer is how many chunks of output a subscriber can lag behind
+// before it gets dropped, so that a slow client can't hold up the job.
+const streamBuffer = 256
+
+// logSubscriber receives the output of a run as it gets written.
+type logSubscriber struct {
+	chunks chan []byte
+	// set when the subscriber got dropped for not keeping up
+	lagged bool
+}
+
+// logBroadcast hands out the output of a run to any number of subscribers,
+// including the output written before they subscribed. Like the run's log, the
+// output gets its secrets masked and only its first maxHistory bytes are kept
+// for late subscribers.
+type logBroadcast struct {
+	mu          sync.Mutex
+	history     []byte
+	maxHistory  int
+	dropped     int
+	secrets     []string
+	pending     []byte
+	subscribers map[*logSubscriber]struct{}
+	closed      bool
+	// gets the output that is kept as well, if set. Writing to it happens
+	// outside of mu under checkpointMu, so that a slow disk doesn't hold up
+	// subscribers, while the output still gets there in order.
+	checkpointMu sync.Mutex
+	checkpoint   io.Writer
+}
+
+// newLogBroadcast returns a broadcast that keeps up to maxHistory bytes of
+// output for late subscribers, zero meaning no limit.
+func newLogBroadcast(maxHistory int) *logBroadcast {
+	return &logBroadcast{maxHistory: maxHistory, subscribers: map[*logSubscriber]struct{}{}}
+}
+
+// mask has the given secrets masked in the output that gets written from now on.
+func (b *logBroadcast) mask(secrets []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.secrets = append([]string{}, secrets...)
+}
+
+// checkpointTo has the output that is kept for late subscribers written to w as well.
+func (b *logBroadcast) checkpointTo(w io.Writer) {
+	b.checkpointMu.Lock()
+	defer b.checkpointMu.Unlock()
+	b.checkpoint = w
+}
+
+// Write never blocks on subscribers, the ones that fall behind get dropped.
+func (b *logBroadcast) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	kept := b.send(b.masked(p))
+	b.writeCheckpoint(kept)
+	return len(p), nil
+}
+
+// writeCheckpoint unlocks mu, which the caller holds, and writes the output that
+// got kept to the checkpoint. The checkpoint gets locked before mu is released,
+// so that concurrent writes reach it in the order they got sent.
+func (b *logBroadcast) writeCheckpoint(kept []byte) {
+	b.checkpointMu.Lock()
+	b.mu.Unlock()
+	defer b.checkpointMu.Unlock()
+
+	if b.checkpoint == nil || len(kept) == 0 {
+		return
+	}
+	// the output still gets to the log of the run, just not to disk early
+	if _, err := b.checkpoint.Write(kept); err != nil {
+		b.checkpoint = nil
+	}
+}
+
+// masked returns the output that can be passed on with its secrets masked. The
+// end of the output that could be the start of a secret is held back until
+// more output comes in.
+func (b *logBroadcast) masked(p []byte) []byte {
+	if len(b.secrets) == 0 {
+		return p
+	}
+
+	data := string(b.pending) + string(p)
+	longest := 0
+	for _, v := range b.secrets {
+		if len(v) > longest {
+			longest = len(v)
+		}
+	}
+	cut := len(data) - longest + 1
+	if cut <= 0 {
+		b.pending = []byte(data)
+		return nil
+	}
+	// don't cut through a secret
+	for moved := true; moved; {
+		moved = false
+		for _, v := range b.secrets {
+			if v == "" {
+				continue
+			}
+			for i := strings.Index(data, v); i >= 0 && i < cut; {
+				if i+len(v) > cut {
+					cut, moved = i, true
+					break
+				}
+				next := strings.Index(data[i+1:], v)
+				if next < 0 {
+					break
+				}
+				i += 1 + next
+			}
+		}
+	}
+
+	b.pending = []byte(data[cut:])
+	return []byte(maskSecrets(data[:cut], b.secrets))
+}
+
+// send keeps output for late subscribers and passes it on to the current ones,
+// it returns the part of the output that got kept.
+func (b *logBroadcast) send(p []byte) []byte {
+	if len(p) == 0 {
+		return nil
+	}
+
+	keep := len(p)
+	if left := b.maxHistory - len(b.history); b.maxHistory > 0 && keep > left {
+		keep = left
+	}
+	b.history = append(b.history, p[:keep]...)
+	b.dropped += len(p) - keep
+
+	for sub := range b.subscribers {
+		select {
+		case sub.chunks <- append([]byte{}, p...):
+		default:
+			sub.lagged = true
+			close(sub.chunks)
+			delete(b.subscribers, sub)
+		}
+	}
+	return p[:keep]
+}
+
+// subscribe returns the output so far and a subscriber for what follows,
+// its channel gets closed once the run is done.
+func (b *logBroadcast) subscribe() ([]byte, *logSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &logSubscriber{chunks: make(chan []byte, streamBuffer)}
+	if b.closed {
+		close(sub.chunks)
+	} else {
+		b.subscribers[sub] = struct{}{}
+	}
+	history := append([]byte{}, b.history...)
+	if b.dropped > 0 {
+		history = append(history, truncationNote(b.dropped)...)
+	}
+	return history, sub
+}
+
+// unsubscribe stops sending output to a subscriber.
+func (b *logBroadcast) unsubscribe(sub *logSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		close(sub.chunks)
+		delete(b.subscribers, sub)
+	}
+}
+
+// hasLagged tells whether a subscriber got dropped for not keeping up.
+func (b *logBroadcast) hasLagged(sub *logSubscriber) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sub.lagged
+}
+
+// close ends the streams of all subscribers.
+func (b *logBroadcast) close() {
+	b.mu.Lock()
+
+	var kept []byte
+	if !b.closed {
+		kept = b.send([]byte(maskSecrets(string(b.pending), b.secrets)))
+		b.pending = nil
+	}
+	b.closed = true
+	for sub := range b.subscribers {
+		close(sub.chunks)
+		delete(b.subscribers, sub)
+	}
+	b.writeCheckpoint(kept)
+}
+
+// currentOutput returns the output of the run of a job that started last
+// among the ones in progress.
+func (s *Schedule) currentOutput(job string) (*logBroadcast, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var current *runningProcess
+	for p := range s.running[job] {
+		if current == nil || p.started.After(current.started) {
+			current = p
+		}
+	}
+	if current == nil {
+		return nil, false
+	}
+	return current.output, true
+}
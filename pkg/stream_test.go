@@ -0,0 +1,128 @@
+package cheek
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogBroadcast(t *testing.T) {
+	b := newLogBroadcast(0)
+	_, _ = b.Write([]byte("foo "))
+
+	// late subscribers get the output so far
+	history, sub := b.subscribe()
+	assert.Equal(t, "foo ", string(history))
+	_, _ = b.Write([]byte("bar"))
+	assert.Equal(t, "bar", string(<-sub.chunks))
+
+	// a subscriber that doesn't keep up gets dropped instead of blocking the writer
+	for i := 0; i < streamBuffer+1; i++ {
+		_, _ = b.Write([]byte("."))
+	}
+	assert.True(t, b.hasLagged(sub))
+	assert.Len(t, sub.chunks, streamBuffer)
+
+	_, other := b.subscribe()
+	b.close()
+	_, ok := <-other.chunks
+	assert.False(t, ok)
+
+	// subscribing to a closed broadcast returns all output
+	history, sub = b.subscribe()
+	assert.Len(t, history, len("foo bar")+streamBuffer+1)
+	_, ok = <-sub.chunks
+	assert.False(t, ok)
+}
+
+func TestLogBroadcastMasksSecrets(t *testing.T) {
+	b := newLogBroadcast(0)
+	b.mask([]string{"s3cret"})
+	history, sub := b.subscribe()
+	assert.Empty(t, history)
+
+	// a secret that gets written in parts is masked too
+	_, _ = b.Write([]byte("token s3"))
+	_, _ = b.Write([]byte("cret and more s"))
+	_, _ = b.Write([]byte("3cret!"))
+	b.close()
+
+	out := string(history)
+	for chunk := range sub.chunks {
+		out += string(chunk)
+	}
+	assert.Equal(t, "token *** and more ***!", out)
+}
+
+func TestLogBroadcastCapsHistory(t *testing.T) {
+	b := newLogBroadcast(5)
+	_, sub := b.subscribe()
+	_, _ = b.Write([]byte("abc"))
+	_, _ = b.Write([]byte("defgh"))
+
+	// live subscribers still get all output
+	assert.Equal(t, "abc", string(<-sub.chunks))
+	assert.Equal(t, "defgh", string(<-sub.chunks))
+
+	history, _ := b.subscribe()
+	assert.Equal(t, "abcde"+truncationNote(3), string(history))
+}
+
+func TestStreamLogs(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{loc: time.Local, log: NewLogger("debug", new(tsBuffer)), cfg: cfg}
+	j := &JobSpec{
+		Name:           "test_stream_logs",
+		Command:        []string{"sh", "-c", "echo first; sleep 0.3; echo second"},
+		globalSchedule: s,
+		inFlight:       newRunTracker(),
+		cfg:            cfg,
+		log:            s.log,
+	}
+	s.Jobs = map[string]*JobSpec{j.Name: j}
+	_ = os.Remove(jobLogFile(j.Name))
+
+	ts := httptest.NewServer(setupMux(s))
+	defer ts.Close()
+	logsURL := ts.URL + "/jobs/test_stream_logs/runs/current/logs"
+
+	get := func(url string) (int, string) {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get(logsURL)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get(logsURL + "?last=true")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	done := make(chan JobRun)
+	go func() { done <- j.execCommandWithRetry(context.Background(), "test", nil) }()
+	assert.Eventually(t, func() bool {
+		_, ok := s.currentOutput(j.Name)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the stream lasts until the run is done
+	code, body := get(logsURL)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "first\nsecond\n", body)
+	<-done
+
+	code, body = get(logsURL + "?last=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "first\nsecond\n", body)
+}
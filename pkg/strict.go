@@ -0,0 +1,98 @@
+package cheek
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlNodeType = reflect.TypeOf(yaml.Node{})
+
+// strictEnabled tells whether a schedule document asks for strict parsing.
+func strictEnabled(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false
+	}
+	v := mappingValue(doc.Content[0], "strict")
+	return v != nil && v.Kind == yaml.ScalarNode && v.Value == "true"
+}
+
+// unknownFields lists the keys of a schedule document that do not correspond
+// to any of its specs, with their line number and the job they belong to.
+func unknownFields(doc *yaml.Node) []string {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil
+	}
+	problems := []string{}
+	checkFields(doc.Content[0], reflect.TypeOf(Schedule{}), "", &problems)
+	return problems
+}
+
+// yamlFields maps the yaml keys of a struct to the types of their fields.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func checkFields(node *yaml.Node, t reflect.Type, job string, problems *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == yamlNodeType:
+		return
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				where := ""
+				if job != "" {
+					where = fmt.Sprintf(" in job '%s'", job)
+				}
+				*problems = append(*problems, fmt.Sprintf("line %v: unknown field '%s'%s", key.Line, key.Value, where))
+				continue
+			}
+
+			// the defaults block holds the specs of a job
+			if t == reflect.TypeOf(Schedule{}) && key.Value == "defaults" {
+				checkFields(value, reflect.TypeOf(JobSpec{}), "defaults", problems)
+				continue
+			}
+			// the keys of the jobs mapping are the names of the jobs
+			if t == reflect.TypeOf(Schedule{}) && key.Value == "jobs" && value.Kind == yaml.MappingNode {
+				for k := 0; k+1 < len(value.Content); k += 2 {
+					checkFields(value.Content[k+1], reflect.TypeOf(JobSpec{}), value.Content[k].Value, problems)
+				}
+				continue
+			}
+			checkFields(value, ft, job, problems)
+		}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && node.Kind == yaml.SequenceNode:
+		for _, n := range node.Content {
+			checkFields(n, t.Elem(), job, problems)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			checkFields(node.Content[i], t.Elem(), job, problems)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cheek
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStrict(t *testing.T) {
+	specs := `strict: true
+tz_locaton: Europe/Brussels
+defaults:
+  retires: 2
+jobs:
+  foo:
+    command: date
+    on_sucess:
+      notify_webhook:
+        - https://example.com/hook
+    on_error:
+      notify_webhook:
+        - url: https://example.com/hook
+          headerz:
+            X-Foo: bar
+      trigger_job:
+        - name: bar
+          paramz:
+            foo: bar
+  bar:
+    command: date
+    on_success:
+      trigger_job:
+        - foo
+`
+	_, err := parseSpecs("strict.yaml", []byte(specs))
+	assert.ErrorContains(t, err, "line 2: unknown field 'tz_locaton'")
+	assert.ErrorContains(t, err, "line 4: unknown field 'retires' in job 'defaults'")
+	assert.ErrorContains(t, err, "line 8: unknown field 'on_sucess' in job 'foo'")
+	assert.ErrorContains(t, err, "line 14: unknown field 'headerz' in job 'foo'")
+	assert.ErrorContains(t, err, "line 18: unknown field 'paramz' in job 'foo'")
+	assert.NotContains(t, err.Error(), "job 'bar'")
+
+	// unknown fields are ignored unless asked for
+	_, err = parseSpecs("lenient.yaml", []byte(specs[len("strict: true\n"):]))
+	assert.NoError(t, err)
+
+	// the examples of the repo only use known fields
+	for _, fn := range []string{"../testdata/jobs1.yaml", "../testdata/defaults.yaml", "../testdata/readme_example.yaml", "../testdata/webhook.yaml"} {
+		yfile, err := os.ReadFile(fn)
+		assert.NoError(t, err)
+		doc := yaml.Node{}
+		assert.NoError(t, yaml.Unmarshal(yfile, &doc))
+		assert.Empty(t, unknownFields(&doc), fn)
+	}
+}
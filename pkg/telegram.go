@@ -0,0 +1,93 @@
+package cheek
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// telegramAPI is the base URL of the Telegram Bot API, tests point it elsewhere.
+var telegramAPI = "https://api.telegram.org"
+
+// telegramMaxLength is the maximum length of a Telegram message.
+const telegramMaxLength = 4096
+
+type telegramPayload struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// telegramEscaper escapes the characters that have a meaning in Telegram's Markdown.
+var telegramEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// newTelegramText formats a run as a Markdown message that fits in a single Telegram message.
+func newTelegramText(jr *JobRun) string {
+	outcome := "succeeded"
+	if !jr.succeeded() {
+		outcome = "failed"
+	}
+	if jr.succeeded() && jr.PreviousFailures > 0 {
+		outcome = fmt.Sprintf("recovered after %v failed runs", jr.PreviousFailures)
+	}
+
+	text := fmt.Sprintf("*%s* %s\nStatus: `%v`\nDuration: `%s`\nTriggered by: %s",
+		telegramEscaper.Replace(jr.Name), outcome, jr.Status,
+		jr.Duration.Truncate(time.Millisecond), telegramEscaper.Replace(jr.TriggeredBy))
+
+	if log := strings.TrimRight(jr.notifyLog(), "\n"); log != "" {
+		// backticks can't be escaped within a code block
+		log = strings.ReplaceAll(log, "`", "'")
+		room := telegramMaxLength - utf8.RuneCountInString(text) - len("\n```\n\n```")
+		if room > 0 {
+			text += fmt.Sprintf("\n```\n%s\n```", logTail(log, room))
+		}
+	}
+
+	return truncate(text, telegramMaxLength)
+}
+
+// JobRunTelegramCall sends a message about a run to a Telegram chat through the bot with the given token.
+func JobRunTelegramCall(ctx context.Context, jr *JobRun, botToken string, chatID string) ([]byte, error) {
+	if botToken == "" {
+		return []byte{}, errors.New("no telegram bot token configured")
+	}
+
+	payload := bytes.Buffer{}
+	d := telegramPayload{ChatID: chatID, Text: newTelegramText(jr), ParseMode: "Markdown"}
+	if err := json.NewEncoder(&payload).Encode(d); err != nil {
+		return []byte{}, err
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, url.PathEscape(botToken))
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	resp_body, err := deliverWebhook(ctx, notifyConfig(jr), "telegram", http.MethodPost, endpoint, header, payload.Bytes())
+
+	r := telegramResponse{}
+	if jsonErr := json.Unmarshal(resp_body, &r); jsonErr == nil && !r.OK && r.Description != "" {
+		return resp_body, fmt.Errorf("telegram api: %s", r.Description)
+	}
+	if err != nil {
+		// the error holds the url, keep the token out of the logs
+		return resp_body, errors.New(strings.ReplaceAll(err.Error(), url.PathEscape(botToken), "***"))
+	}
+	if !r.OK {
+		return resp_body, errors.New("telegram api: unexpected response")
+	}
+
+	return resp_body, nil
+}
@@ -0,0 +1,71 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRunTelegramCall(t *testing.T) {
+	var got telegramPayload
+	var gotPath string
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if got.ChatID == "unknown" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer testServer.Close()
+
+	defer func(api string) { telegramAPI = api }(telegramAPI)
+	telegramAPI = testServer.URL
+
+	jr := JobRun{
+		Name:        "nightly_backup",
+		TriggeredBy: "cron",
+		Status:      1,
+		Duration:    2 * time.Second,
+		Log:         "disk `full`\n",
+	}
+
+	_, err := JobRunTelegramCall(context.Background(), &jr, "123:abc", "-1001")
+	assert.NoError(t, err)
+	assert.Equal(t, "/bot123:abc/sendMessage", gotPath)
+	assert.Equal(t, "-1001", got.ChatID)
+	assert.Equal(t, "Markdown", got.ParseMode)
+	assert.Contains(t, got.Text, "*nightly\\_backup* failed")
+	assert.Contains(t, got.Text, "Status: `1`")
+	assert.Contains(t, got.Text, "Duration: `2s`")
+	assert.Contains(t, got.Text, "```\ndisk 'full'\n```")
+
+	// api errors are surfaced
+	_, err = JobRunTelegramCall(context.Background(), &jr, "123:abc", "unknown")
+	assert.EqualError(t, err, "telegram api: Bad Request: chat not found")
+
+	_, err = JobRunTelegramCall(context.Background(), &jr, "", "-1001")
+	assert.Error(t, err)
+}
+
+func TestTelegramTextTruncation(t *testing.T) {
+	jr := JobRun{Name: "test", Log: strings.Repeat("x", 10000) + "the end"}
+
+	text := newTelegramText(&jr)
+	assert.Equal(t, telegramMaxLength, utf8.RuneCountInString(text))
+	assert.True(t, strings.HasSuffix(text, "the end\n```"))
+}
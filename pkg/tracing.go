@@ -0,0 +1,171 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of cheek.
+const tracerName = "github.com/datarootsio/cheek"
+
+// tracingShutdownTimeout is how long the spans that are still buffered get to be exported on exit.
+const tracingShutdownTimeout = 5 * time.Second
+
+// tracer returns the tracer of the global provider, which doesn't record
+// anything unless tracing got started or cheek is embedded in a traced program.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// tracingConfigured tells whether the OTEL_* environment variables ask for traces to be exported.
+func tracingConfigured() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// otlpProtocol returns the protocol the traces are to be exported with.
+func otlpProtocol() string {
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"); p != "" {
+		return p
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+}
+
+// startTracing exports the spans of runs to the OTLP endpoint set via the
+// standard OTEL_* environment variables. Without an endpoint it leaves the
+// global tracer provider alone. The returned func exports what is left.
+func startTracing(log zerolog.Logger) func() {
+	if !tracingConfigured() {
+		return func() {}
+	}
+
+	ctx := context.Background()
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch otlpProtocol() {
+	case "grpc":
+		exporter, err = otlptracegrpc.New(ctx)
+	case "", "http/protobuf":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		err = fmt.Errorf("unsupported protocol '%s', use grpc or http/protobuf", otlpProtocol())
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot export traces, runs won't be traced")
+		return func() {}
+	}
+
+	// the environment has the last say, e.g. via OTEL_SERVICE_NAME
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("cheek")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot determine all resource attributes of the traces")
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Debug().Str("protocol", otlpProtocol()).Msg("exporting traces of runs")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Warn().Err(err).Msg("cannot export the last traces")
+		}
+	}
+}
+
+// startRunSpan starts the span of a run, the spans of its attempts become its children.
+func (j *JobSpec) startRunSpan(ctx context.Context, trigger string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "run "+j.Name, trace.WithAttributes(
+		attribute.String("cheek.job.name", j.Name),
+		attribute.String("cheek.run.trigger", trigger),
+	))
+}
+
+// startAttemptSpan starts the span of an attempt of a run, the notifications
+// it sends and the jobs it triggers become its children.
+func (j *JobSpec) startAttemptSpan(ctx context.Context, trigger string, attempt int) (context.Context, trace.Span) {
+	return tracer().Start(ctx, fmt.Sprintf("attempt %v", attempt), trace.WithAttributes(
+		attribute.String("cheek.job.name", j.Name),
+		attribute.String("cheek.run.trigger", trigger),
+		attribute.Int("cheek.run.attempt", attempt),
+	))
+}
+
+// endRunSpan records the outcome of jr on the span of its run or attempt and ends it.
+func endRunSpan(span trace.Span, jr *JobRun) {
+	span.SetAttributes(
+		attribute.String("cheek.run.id", jr.ID),
+		attribute.String("cheek.run.group_id", jr.GroupID),
+		attribute.String("cheek.run.state", jr.State),
+		attribute.Int("cheek.run.exit_code", jr.Status),
+		attribute.Int("cheek.run.attempt", jr.Attempt),
+	)
+	if !jr.succeeded() {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s with exit code %v", jr.State, jr.Status))
+	}
+	span.End()
+}
+
+// traceWebhook starts the span of a webhook call made on behalf of a traced
+// run, the returned func ends it. Calls outside of a trace, e.g. those of the
+// event sink, aren't traced.
+func traceWebhook(ctx context.Context, webhookType string, method string, webhookURL string) (context.Context, func(error)) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, func(error) {}
+	}
+	// the url itself often holds a secret, e.g. that of a Slack webhook
+	host := ""
+	if u, err := url.Parse(webhookURL); err == nil {
+		host = u.Hostname()
+	}
+	ctx, span := tracer().Start(ctx, "notify "+webhookType, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("cheek.webhook.type", webhookType),
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.ServerAddress(host),
+	))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// traceEnv passes the trace context of ctx on to the command of a run as
+// TRACEPARENT and TRACESTATE, so that it can add its own spans to the trace.
+func traceEnv(ctx context.Context) []string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	env := []string{}
+	for _, k := range []string{"traceparent", "tracestate"} {
+		if v := carrier.Get(k); v != "" {
+			env = append(env, strings.ToUpper(k)+"="+v)
+		}
+	}
+	return env
+}
@@ -0,0 +1,161 @@
+package cheek
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// resetTracing leaves the global tracer provider as it is when tracing isn't configured.
+func resetTracing() {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+}
+
+// recordSpans has the global tracer provider record the spans that end during the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(resetTracing)
+	return sr
+}
+
+func spanAttr(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceTriggerChain(t *testing.T) {
+	sr := recordSpans(t)
+	var mu sync.Mutex
+	traceparents := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+	}))
+	defer ts.Close()
+
+	t.Setenv("CHEEK_HOME", t.TempDir())
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s := &Schedule{Jobs: map[string]*JobSpec{
+		"flaky": {
+			Command:    []string{"sh", "-c", "echo $TRACEPARENT; exit 1"},
+			Retries:    1,
+			RetryDelay: time.Millisecond,
+			OnError:    OnEvent{NotifyWebhook: []Webhook{{URL: ts.URL}}, TriggerJob: []JobTrigger{{Name: "cleanup"}}},
+		},
+		"cleanup": {Command: []string{"sh", "-c", "echo $TRACEPARENT"}},
+	}, TZLocation: "UTC", cfg: cfg}
+	assert.NoError(t, s.initialize())
+	jr := s.Jobs["flaky"].execCommandWithRetry(context.Background(), "cron", nil)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range sr.Ended() {
+		spans[spanAttr(span, "cheek.job.name").AsString()+"/"+span.Name()] = span
+	}
+	run, first, retry := spans["flaky/run flaky"], spans["flaky/attempt 0"], spans["flaky/attempt 1"]
+	downstream, notify := spans["cleanup/run cleanup"], spans["/notify generic"]
+	if !assert.Len(t, spans, 6) || !assert.NotNil(t, run) || !assert.NotNil(t, downstream) || !assert.NotNil(t, notify) {
+		t.FailNow()
+	}
+
+	// a fan-out chain ends up in one trace
+	traceID := run.SpanContext().TraceID()
+	for name, span := range spans {
+		assert.Equal(t, traceID, span.SpanContext().TraceID(), name)
+	}
+	assert.Equal(t, run.SpanContext().SpanID(), first.Parent().SpanID())
+	assert.Equal(t, run.SpanContext().SpanID(), retry.Parent().SpanID())
+	// on_error only fires after the last attempt
+	assert.Equal(t, retry.SpanContext().SpanID(), downstream.Parent().SpanID())
+	assert.Equal(t, retry.SpanContext().SpanID(), notify.Parent().SpanID())
+	assert.Equal(t, downstream.SpanContext().SpanID(), spans["cleanup/attempt 0"].Parent().SpanID())
+
+	assert.Equal(t, "cron", spanAttr(run, "cheek.run.trigger").AsString())
+	assert.Equal(t, int64(1), spanAttr(run, "cheek.run.exit_code").AsInt64())
+	assert.Equal(t, int64(1), spanAttr(run, "cheek.run.attempt").AsInt64())
+	assert.Equal(t, codes.Error, run.Status().Code)
+	assert.Equal(t, int64(0), spanAttr(first, "cheek.run.attempt").AsInt64())
+	assert.Equal(t, "job[flaky]", spanAttr(downstream, "cheek.run.trigger").AsString())
+	assert.Equal(t, codes.Unset, downstream.Status().Code)
+
+	// the trace context gets passed on to the commands and webhooks
+	traceparent := func(span sdktrace.ReadOnlySpan) string {
+		return "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+	}
+	assert.Equal(t, traceparent(retry), strings.TrimSpace(jr.Log))
+	s.Jobs["cleanup"].loadRuns()
+	if assert.Len(t, s.Jobs["cleanup"].Runs, 1) {
+		assert.Equal(t, traceparent(spans["cleanup/attempt 0"]), strings.TrimSpace(s.Jobs["cleanup"].Runs[0].Log))
+	}
+	mu.Lock()
+	assert.Equal(t, []string{traceparent(notify)}, traceparents)
+	mu.Unlock()
+}
+
+func TestTracingDisabled(t *testing.T) {
+	for _, env := range []map[string]string{
+		{},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318", "OTEL_SDK_DISABLED": "true"},
+		{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://localhost:4318/v1/traces", "OTEL_TRACES_EXPORTER": "none"},
+	} {
+		for _, k := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER"} {
+			t.Setenv(k, env[k])
+		}
+		assert.False(t, tracingConfigured(), env)
+	}
+
+	// without an endpoint runs are not traced and their commands get no trace context
+	tp := otel.GetTracerProvider()
+	startTracing(zerolog.Nop())()
+	assert.Equal(t, tp, otel.GetTracerProvider())
+	_, span := (&JobSpec{Name: "quiet"}).startRunSpan(context.Background(), "cron")
+	assert.False(t, span.IsRecording())
+	assert.Empty(t, traceEnv(context.Background()))
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	assert.True(t, tracingConfigured())
+}
+
+func TestTracingExport(t *testing.T) {
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer ts.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", ts.URL)
+	defer resetTracing()
+
+	stop := startTracing(zerolog.Nop())
+	_, span := (&JobSpec{Name: "exported"}).startRunSpan(context.Background(), "cron")
+	endRunSpan(span, &JobRun{})
+	stop()
+	select {
+	case path := <-received:
+		assert.Equal(t, "/v1/traces", path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no traces exported")
+	}
+}
@@ -1,15 +1,19 @@
 package cheek
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/user"
 	"path"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
@@ -18,49 +22,114 @@ import (
 const coreLogFile string = "core.cheek.jsonl"
 
 type Config struct {
-	Pretty       bool   `yaml:"pretty"`
-	SuppressLogs bool   `yaml:"suppressLogs"`
-	LogLevel     string `yaml:"logLevel"`
-	HomeDir      string `yaml:"homedir"`
-	Port         string `yaml:"port"`
+	Pretty           bool          `yaml:"pretty"`
+	SuppressLogs     bool          `yaml:"suppressLogs"`
+	LogLevel         string        `yaml:"logLevel"`
+	LogFormat        string        `yaml:"logFormat"`
+	HomeDir          string        `yaml:"homedir"`
+	Port             string        `yaml:"port"`
+	BindAddress      string        `yaml:"bindAddress"`
+	TLSCert          string        `yaml:"tlsCert"`
+	TLSKey           string        `yaml:"tlsKey"`
+	AccessLogLevel   string        `yaml:"accessLogLevel"`
+	AccessLogHealth  bool          `yaml:"accessLogHealth"`
+	Metrics          bool          `yaml:"metrics"`
+	AuthToken        string        `yaml:"authToken"`
+	Storage          string        `yaml:"storage"`
+	PublicURL        string        `yaml:"publicURL"`
+	SMTPHost         string        `yaml:"smtpHost"`
+	SMTPPort         string        `yaml:"smtpPort"`
+	SMTPUsername     string        `yaml:"smtpUsername"`
+	SMTPPassword     string        `yaml:"smtpPassword"`
+	SMTPFrom         string        `yaml:"smtpFrom"`
+	SMTPTLS          string        `yaml:"smtpTLS"`
+	TelegramBotToken string        `yaml:"telegramBotToken"`
+	WebhookTimeout   time.Duration `yaml:"webhookTimeout"`
+	WebhookRetries   int           `yaml:"webhookRetries"`
+	ScheduleToken    string        `yaml:"scheduleToken"`
 }
 
 func NewConfig() Config {
 	return Config{
-		Pretty:       true,
-		SuppressLogs: false,
-		LogLevel:     "info",
-		HomeDir:      CheekPath(),
-		Port:         "8081",
+		Pretty:         true,
+		SuppressLogs:   false,
+		LogLevel:       "info",
+		LogFormat:      LogFormatConsole,
+		HomeDir:        CheekPath(),
+		Port:           "8081",
+		BindAddress:    "0.0.0.0",
+		AccessLogLevel: "info",
+		Metrics:        false,
+		Storage:        StorageJSONL,
+		WebhookTimeout: defaultWebhookTimeout,
+		WebhookRetries: defaultWebhookRetries,
 	}
 }
 
+// CheekPath returns the directory in which cheek keeps its logs and state. It
+// is the homedir setting (--homedir or CHEEK_HOMEDIR) when given, otherwise
+// CHEEK_HOME and it defaults to ~/.cheek.
 func CheekPath() string {
-	var p string
-	switch viper.IsSet("homedir") {
-	case true:
-		p = viper.GetString("homedir")
-	default:
-		usr, _ := user.Current()
-		dir := usr.HomeDir
-		p = path.Join(dir, ".cheek")
+	if viper.IsSet("homedir") {
+		return viper.GetString("homedir")
 	}
+	if p := os.Getenv("CHEEK_HOME"); p != "" {
+		return p
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return ".cheek"
+	}
+	return path.Join(usr.HomeDir, ".cheek")
+}
+
+// dataDirPerm is what the data directory gets created with, logs of runs can
+// contain sensitive output.
+const dataDirPerm os.FileMode = 0o700
 
-	_ = os.MkdirAll(p, os.ModePerm)
+// ensureDataDir creates the data directory when it doesn't exist yet and checks
+// that cheek can write to it.
+func ensureDataDir() (string, error) {
+	p := CheekPath()
+	if err := os.MkdirAll(p, dataDirPerm); err != nil {
+		return p, fmt.Errorf("cannot create data directory '%s': %w", p, err)
+	}
 
-	return p
+	f, err := os.CreateTemp(p, ".cheek-write-check-*")
+	if err != nil {
+		return p, fmt.Errorf("data directory '%s' is not writable: %w", p, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return p, nil
 }
 
+// readLastJobRuns reads the newest nRuns job runs from a job's log, newest
+// first, without going through the rest of the log.
 func readLastJobRuns(log zerolog.Logger, filepath string, nRuns int) ([]JobRun, error) {
-	lines, err := readLastLines(filepath, nRuns)
+	lines, err := tailLines(filepath, 0, nRuns)
 	if err != nil {
 		return []JobRun{}, nil
 	}
+	return decodeJobRuns(log, filepath, lines), nil
+}
 
-	var jrs []JobRun
+// readJobRuns reads a window of job runs, newest first, from a job's log
+// and returns them together with the total number of runs in the log.
+func readJobRuns(log zerolog.Logger, filepath string, offset int, limit int) ([]JobRun, int, error) {
+	lines, total, err := readLines(filepath, offset, limit)
+	if err != nil {
+		return []JobRun{}, 0, nil
+	}
+	return decodeJobRuns(log, filepath, lines), total, nil
+}
+
+func decodeJobRuns(log zerolog.Logger, filepath string, lines []string) []JobRun {
+	jrs := []JobRun{}
 	for _, line := range lines {
 		jr := JobRun{}
-		err = json.Unmarshal([]byte(line), &jr)
+		err := json.Unmarshal([]byte(line), &jr)
 		if err != nil {
 			log.Debug().Str("logfile", filepath).Err(err).Msgf("can't decode log line: %s", line)
 			// try to still fetch other log entries by skipping this log line
@@ -68,39 +137,166 @@ func readLastJobRuns(log zerolog.Logger, filepath string, nRuns int) ([]JobRun,
 		}
 		jrs = append(jrs, jr)
 	}
-
-	return jrs, nil
+	return jrs
 }
 
 func readLastLines(filepath string, nLines int) ([]string, error) {
-	fileHandle, err := os.Open(filepath)
+	return tailLines(filepath, 0, nLines)
+}
+
+// readLines returns lines of a file newest first, skipping the offset most recent ones
+// and returning at most limit lines (all when limit < 1). Next to the lines it returns
+// the total number of lines in the file. Only offset+limit lines are kept in memory.
+func readLines(filepath string, offset int, limit int) ([]string, int, error) {
+	lines, err := tailLines(filepath, offset, limit)
 	if err != nil {
-		return []string{}, err
+		return []string{}, 0, err
 	}
-	defer fileHandle.Close()
 
-	var lines []string
-	reader := bufio.NewReader(fileHandle)
+	total, err := countLines(filepath)
+	if err != nil {
+		return []string{}, 0, err
+	}
+	return lines, total, nil
+}
 
-	for {
-		s, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
+// tailBlockSize is how much of a file gets read at once when reading it backwards.
+const tailBlockSize = 64 * 1024
+
+// tailLines returns lines of a file newest first, skipping the offset most recent
+// ones and returning at most limit lines (all when limit < 1). The file is read
+// backwards in blocks, so only the lines asked for get read. A last line that
+// lacks its newline, e.g. because of a crash mid-write, is skipped.
+func tailLines(filepath string, offset int, limit int) ([]string, error) {
+	f, err := openLog(filepath)
+	if err != nil {
+		return []string{}, err
+	}
+	defer f.Close()
+
+	pos := f.size
+	// buf holds the part of the file from pos up until the end of the newest line that is left
+	var buf []byte
+	// extend reads blocks in front of buf up to and including the first one
+	// with a newline, which then get joined with buf at once
+	extend := func() error {
+		blocks := [][]byte{buf}
+		size := len(buf)
+		for pos > 0 {
+			n := int64(tailBlockSize)
+			if n > pos {
+				n = pos
+			}
+			pos -= n
+			block := make([]byte, n)
+			if _, err := f.ReadAt(block, pos); err != nil {
+				return err
+			}
+			blocks = append(blocks, block)
+			size += len(block)
+			if bytes.IndexByte(block, '\n') >= 0 {
 				break
 			}
-			return []string{}, err
 		}
 
-		lines = append([]string{s}, lines...)
+		joined := make([]byte, 0, size)
+		for i := len(blocks) - 1; i >= 0; i-- {
+			joined = append(joined, blocks[i]...)
+		}
+		buf = joined
+		return nil
+	}
+
+	// drop what comes after the last newline
+	if err := extend(); err != nil {
+		return []string{}, err
+	}
+	if bytes.IndexByte(buf, '\n') < 0 {
+		return []string{}, nil
+	}
+	buf = buf[:bytes.LastIndexByte(buf, '\n')+1]
+
+	lines := []string{}
+	skipped := 0
+	for len(buf) > 0 && (limit < 1 || len(lines) < limit) {
+		start := bytes.LastIndexByte(buf[:len(buf)-1], '\n') + 1
+		if start == 0 && pos > 0 {
+			// the line starts in an earlier block
+			if err := extend(); err != nil {
+				return []string{}, err
+			}
+			continue
+		}
 
-		if nLines > 0 && len(lines) > nLines {
-			lines = lines[:nLines]
+		if skipped < offset {
+			skipped++
+		} else {
+			lines = append(lines, string(buf[start:]))
 		}
+		buf = buf[:start]
 	}
 
 	return lines, nil
 }
 
+// countLines counts the newline terminated lines of a file.
+func countLines(filepath string) (int, error) {
+	f, err := openLog(filepath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	total := 0
+	block := make([]byte, tailBlockSize)
+	for {
+		n, err := f.Read(block)
+		total += bytes.Count(block[:n], []byte{'\n'})
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// newRunID generates an identifier for a job run, ids sort by creation time.
+func newRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + hex.EncodeToString(b)
+}
+
+// waitTimeout waits for wg for at most d, it tells whether wg got done in time.
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// sleepContext waits for d to pass, it returns false when ctx is done before that.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func hardWrap(in string, width int) string {
 	if width < 1 {
 		return in
@@ -151,12 +347,17 @@ func PrettyStdout() io.Writer {
 }
 
 func CoreJsonLogger() io.Writer {
-	logFn := path.Join(CheekPath(), coreLogFile)
+	dir, err := ensureDataDir()
+	if err != nil {
+		fmt.Printf("Exiting, %v, set another one with --homedir or CHEEK_HOME\n", err)
+		os.Exit(1)
+	}
+	logFn := path.Join(dir, coreLogFile)
 
 	f, err := os.OpenFile(logFn,
 		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
-		fmt.Printf("Can't open log file '%s' for writing.", coreLogFile)
+		fmt.Printf("Can't open log file '%s' for writing.", logFn)
 		os.Exit(1)
 	}
 	return f
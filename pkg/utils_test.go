@@ -1,14 +1,34 @@
 package cheek
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	// keep the logs of the tests out of the real home directory
+	dir, err := os.MkdirTemp("", "cheek-test-")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Setenv("CHEEK_HOME", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestLastLineReader(t *testing.T) {
 	l, err := readLastLines("../testdata/test.jsonl", 2)
 	assert.Nil(t, err)
@@ -28,6 +48,104 @@ func TestLastLineReader(t *testing.T) {
 	assert.Equal(t, "{\"a\":4}\n", l[0], "incorrect line in first place")
 }
 
+func TestLinesWindow(t *testing.T) {
+	l, total, err := readLines("../testdata/test.jsonl", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []string{"{\"a\":3}\n", "{\"a\":2}\n"}, l)
+
+	// offset beyond the number of lines
+	l, total, err = readLines("../testdata/test.jsonl", 10, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, total)
+	assert.Empty(t, l)
+}
+
+func TestTailLines(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		fn := filepath.Join(dir, "log.jsonl")
+		assert.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+		return fn
+	}
+
+	// a line cut off by a crash mid-write gets skipped
+	l, err := tailLines(write("{\"a\":1}\n{\"a\":2}\n{\"a\""), 0, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"{\"a\":2}\n", "{\"a\":1}\n"}, l)
+
+	l, err = tailLines(write("{\"a\""), 0, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, l)
+
+	l, err = tailLines(write(""), 0, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, l)
+
+	// lines spanning several blocks
+	long := strings.Repeat("x", 3*tailBlockSize)
+	l, err = tailLines(write("short\n"+long+"\nlast\n"+long[:10]), 1, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{long + "\n", "short\n"}, l)
+
+	// and a long first line after a long line that lacks its newline
+	l, err = tailLines(write(long+"\nlast\n"+long), 0, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"last\n", long + "\n"}, l)
+
+	total, err := countLines(write("short\n" + long + "\nlast\n" + long[:10]))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+
+	_, err = tailLines(filepath.Join(dir, "missing.jsonl"), 0, 5)
+	assert.Error(t, err)
+}
+
+func TestReadLastJobRunsCorrupt(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "log.jsonl")
+	content := `{"name":"a","status":0}` + "\n" + "not json\n" + `{"name":"a","status":1}` + "\n" + `{"name":"a","sta`
+	assert.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+
+	jrs, err := readLastJobRuns(NewLogger("debug", new(tsBuffer)), fn, 5)
+	assert.NoError(t, err)
+	assert.Len(t, jrs, 2)
+	assert.Equal(t, 1, jrs[0].Status)
+	assert.Equal(t, 0, jrs[1].Status)
+}
+
+// BenchmarkReadLastJobRuns shows that reading the last runs of a job takes about
+// the same time and memory however large its log grows, run with -benchtime=1x
+// to not spend too long on writing the 1GB log.
+func BenchmarkReadLastJobRuns(b *testing.B) {
+	line := []byte(`{"name":"bench","status":0,"log":"` + strings.Repeat("x", 200) + `","triggered_at":"2024-01-01T00:00:00Z","triggered_by":"cron"}` + "\n")
+	block := bytes.Repeat(line, 1<<20/len(line))
+	log := zerolog.Nop()
+
+	for _, mb := range []int{1, 64, 1024} {
+		fn := filepath.Join(b.TempDir(), "bench.jsonl")
+		f, err := os.Create(fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < mb; i++ {
+			if _, err := f.Write(block); err != nil {
+				b.Fatal(err)
+			}
+		}
+		f.Close()
+
+		b.Run(fmt.Sprintf("%dMB", mb), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				jrs, err := readLastJobRuns(log, fn, 10)
+				if err != nil || len(jrs) != 10 {
+					b.Fatalf("expected 10 runs, got %v (%v)", len(jrs), err)
+				}
+			}
+		})
+	}
+}
+
 func TestHardWrap(t *testing.T) {
 	test := "12345678"
 	assert.Equal(t, hardWrap(test, 5), "12345\n678")
@@ -35,13 +153,46 @@ func TestHardWrap(t *testing.T) {
 }
 
 func TestCheekPath(t *testing.T) {
-	assert.True(t, strings.Contains(CheekPath(), ".cheek"))
+	defer os.Setenv("CHEEK_HOME", os.Getenv("CHEEK_HOME"))
+	os.Unsetenv("CHEEK_HOME")
+	assert.True(t, strings.HasSuffix(CheekPath(), ".cheek"))
 
-	const dirName = "moo_i_am_sheep"
+	home := filepath.Join(t.TempDir(), "moo_i_am_sheep")
+	os.Setenv("CHEEK_HOME", home)
+	assert.Equal(t, home, CheekPath())
 
+	// the homedir setting takes precedence
+	dirName := filepath.Join(t.TempDir(), "baa")
 	viper.Set("homedir", dirName)
-	assert.True(t, strings.Contains(CheekPath(), "sheep"))
+	defer viper.Set("homedir", nil)
+	assert.Equal(t, dirName, CheekPath())
+
+	// the directory only gets created once needed
+	_, err := os.Stat(dirName)
+	assert.True(t, os.IsNotExist(err))
+	dir, err := ensureDataDir()
+	assert.NoError(t, err)
+	fi, err := os.Stat(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, dataDirPerm, fi.Mode().Perm())
+	}
+
+	// and has to be writable
+	notADir := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(notADir, nil, 0o644))
+	viper.Set("homedir", filepath.Join(notADir, "cheek"))
+	_, err = ensureDataDir()
+	assert.ErrorContains(t, err, "cannot create data directory")
+	_, err = openStore(zerolog.Nop(), Config{})
+	assert.Error(t, err)
+}
+
+func TestWaitTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+	assert.True(t, waitTimeout(&wg, time.Second))
 
-	// cleanup
-	os.RemoveAll(dirName)
+	wg.Add(1)
+	assert.False(t, waitTimeout(&wg, 10*time.Millisecond))
+	wg.Done()
+	assert.True(t, waitTimeout(&wg, time.Second))
 }
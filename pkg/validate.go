@@ -0,0 +1,212 @@
+package cheek
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ValidationProblem is an issue with the specs of a schedule, Job is empty for
+// issues with the schedule as a whole.
+type ValidationProblem struct {
+	Job     string `json:"job,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p ValidationProblem) Error() string {
+	return p.Message
+}
+
+// validate prepares the schedule and its jobs for use while checking their
+// specs. It carries on after a problem so that all of them get reported.
+func (s *Schedule) validate() []ValidationProblem {
+	problems := []ValidationProblem{}
+	report := func(job string, err error) {
+		if err != nil {
+			problems = append(problems, ValidationProblem{Job: job, Message: err.Error()})
+		}
+	}
+
+	// validate tz location
+	if s.TZLocation == "" {
+		s.TZLocation = "Local"
+	}
+
+	loc, err := time.LoadLocation(s.TZLocation)
+	if err != nil {
+		report("", fmt.Errorf("tz '%s' not valid: %w", s.TZLocation, err))
+		loc = time.Local
+	}
+	s.loc = loc
+
+	switch {
+	case s.MaxConcurrentJobs < 0:
+		report("", fmt.Errorf("max_concurrent_jobs cannot be negative"))
+	case s.MaxConcurrentJobs > 0:
+		s.slots = make(chan struct{}, s.MaxConcurrentJobs)
+	}
+
+	if s.MaxRunsKept < 0 {
+		report("", fmt.Errorf("max_runs_kept cannot be negative"))
+	}
+	if s.MaxLogAge < 0 {
+		report("", fmt.Errorf("max_log_age cannot be negative"))
+	}
+	if s.MaxLogSize < 0 {
+		report("", fmt.Errorf("max_log_size cannot be negative"))
+	}
+	report("", s.EventSink.validate())
+	if s.CompressLogsAfter < 0 {
+		report("", fmt.Errorf("compress_logs_after cannot be negative"))
+	}
+	if err := validLogMode(s.LogMode); err != nil {
+		report("", fmt.Errorf("log_mode %w", err))
+	}
+	if s.MaxTriggerDepth < 0 {
+		report("", fmt.Errorf("max_trigger_depth cannot be negative"))
+	}
+	if s.ReloadInterval < 0 {
+		report("", fmt.Errorf("reload_interval cannot be negative"))
+	}
+	report("", s.ValidateBlackouts())
+	report("", s.ValidateWebhooks())
+	report("", s.ValidateNotifiers())
+
+	for _, k := range s.jobNames() {
+		v := s.Jobs[k]
+		if v == nil {
+			v = &JobSpec{}
+			s.Jobs[k] = v
+		}
+		s.validateJob(k, v, report)
+	}
+
+	report("", s.checkTriggerCycles())
+	return problems
+}
+
+// validateJob ties a job to the schedule under the given name and checks its specs.
+func (s *Schedule) validateJob(k string, v *JobSpec, report func(job string, err error)) {
+	// check if trigger references exist
+	for _, t := range v.triggerJobs() {
+		if _, ok := s.job(t.Name); !ok {
+			report(k, fmt.Errorf("cannot find spec of job '%s' that is referenced in job '%s'", t.Name, k))
+		}
+	}
+	// set some metadata & refs for each job
+	// for easier retrievability
+	v.Name = k
+	v.globalSchedule = s
+	v.log = s.log
+	v.cfg = s.cfg
+	v.inFlight = newRunTracker()
+	v.health = newJobHealth()
+	v.limiter = newTriggerLimiter()
+
+	report(k, v.ValidateCron())
+	report(k, v.ValidateInterval())
+	report(k, v.ValidateAt())
+	// validate job specific timezone
+	report(k, v.loadLocation())
+	report(k, v.ValidateRetries())
+	report(k, v.ValidateExitCodes())
+	report(k, v.ValidateConcurrencyPolicy())
+	report(k, v.ValidateRetention())
+	report(k, v.ValidateLogSize())
+	report(k, v.ValidateLogMode())
+	report(k, v.ValidateLogTimestamps())
+	report(k, v.ValidateCaptureOutput())
+	report(k, v.ValidateResourceLimits())
+	report(k, v.ValidateStdin())
+	report(k, v.ValidateContainer())
+	report(k, v.ValidateSSH())
+	report(k, v.ValidateSecrets())
+	report(k, v.ValidateWebhooks())
+	report(k, v.ValidateWebhookTrigger())
+	report(k, v.ValidateTriggerLimits())
+	report(k, v.ValidateJitter())
+	report(k, v.ValidateWindow())
+	report(k, v.ValidateCatchup())
+	if v.WebhookTrigger != nil {
+		for name, other := range s.jobMap() {
+			if name == k || other.WebhookTrigger == nil {
+				continue
+			}
+			if other.WebhookTrigger.Name == v.hookName() || (other.WebhookTrigger.Name == "" && name == v.hookName()) {
+				report(k, fmt.Errorf("webhook_trigger name '%s' of job '%s' is already used by job '%s'", v.hookName(), k, name))
+			}
+		}
+	}
+	report(k, v.ValidateNotifiers())
+	report(k, v.ValidateMonitor())
+	report(k, v.ValidateFreshness())
+	report(k, v.ValidateCircuit())
+}
+
+// jobNames lists the names of the jobs in alphabetical order, the caller holds
+// s.mu unless the schedule is not in use yet.
+func (s *Schedule) jobNames() []string {
+	names := make([]string, 0, len(s.Jobs))
+	for k := range s.Jobs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateEnvFiles checks that the env files and the stdin_file of a job exist. This
+// is not required to load a schedule, as these files can be written by another job.
+func (j *JobSpec) ValidateEnvFiles() error {
+	for _, fn := range j.EnvFile {
+		if _, err := os.Stat(j.specPath(fn)); err != nil {
+			return fmt.Errorf("env_file '%s' of job '%s' cannot be read: %w", fn, j.Name, err)
+		}
+	}
+	if j.StdinFile != "" {
+		if _, err := os.Stat(j.specPath(j.StdinFile)); err != nil {
+			return fmt.Errorf("stdin_file '%s' of job '%s' cannot be read: %w", j.StdinFile, j.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateFile checks the specs of a schedule without running it and reports
+// all of the problems with them at once. fn can be anything that can be run.
+func ValidateFile(cfg Config, fn string) []ValidationProblem {
+	var s *Schedule
+	var err error
+	if isURL(fn) {
+		var specs *remoteSpecs
+		if specs, err = fetchSpecs(cfg, fn, remoteVersion{}); err == nil {
+			s, err = parseSpecs(fn, specs.body)
+		}
+	} else {
+		s, err = readSchedule(fn)
+	}
+	if err != nil {
+		return []ValidationProblem{{Message: err.Error()}}
+	}
+	if s.fn == "" {
+		s.fn = fn
+	}
+
+	return validateSchedule(cfg, s)
+}
+
+// validateSchedule runs the checks that loading a schedule does plus the ones
+// that only make sense ahead of running it.
+func validateSchedule(cfg Config, s *Schedule) []ValidationProblem {
+	s.log = zerolog.Nop()
+	s.cfg = cfg
+
+	problems := s.validate()
+	for _, k := range s.jobNames() {
+		if err := s.Jobs[k].ValidateEnvFiles(); err != nil {
+			problems = append(problems, ValidationProblem{Job: k, Message: err.Error()})
+		}
+	}
+	return problems
+}
@@ -0,0 +1,34 @@
+package cheek
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFile(t *testing.T) {
+	problems := ValidateFile(NewConfig(), "../testdata/invalid_many.yaml")
+	assert.Len(t, problems, 6)
+
+	messages := map[string][]string{}
+	for _, p := range problems {
+		messages[p.Job] = append(messages[p.Job], p.Message)
+	}
+	assert.Len(t, messages[""], 2)
+	assert.Contains(t, messages[""][0], "tz 'Europe/Nowhere' not valid")
+	assert.Equal(t, "trigger_job cycle detected: bar -> baz -> bar", messages[""][1])
+	assert.Len(t, messages["bar"], 1)
+	assert.Contains(t, messages["bar"][0], "tz 'Europe/Atlantis' for job 'bar' not valid")
+	assert.Equal(t, []string{
+		"cannot find spec of job 'i_do_not_exist' that is referenced in job 'foo'",
+		"cron string for job 'foo' not valid",
+	}, messages["foo"][:2])
+	assert.Contains(t, messages["foo"][2], "env_file 'does_not_exist.env' of job 'foo' cannot be read")
+
+	assert.Empty(t, ValidateFile(NewConfig(), "../testdata/jobs1.yaml"))
+	assert.Empty(t, ValidateFile(NewConfig(), "../testdata/jobs.d"))
+
+	problems = ValidateFile(NewConfig(), "../testdata/not-exists.yaml")
+	assert.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Message, "no such file or directory")
+}
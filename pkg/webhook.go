@@ -2,44 +2,438 @@ package cheek
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
-type slackPayload struct {
-	Text string `json:"text"`
+// Webhook is a generic webhook to notify. Header values can refer to
+// environment variables as $VAR or ${VAR}. Body is a template that gets
+// rendered with the JobRun, when it is empty the JobRun is posted as JSON.
+type Webhook struct {
+	URL     string            `yaml:"url" json:"url"`
+	Method  string            `yaml:"method,omitempty" json:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty" json:"body,omitempty"`
 }
 
-func JobRunWebhookCall(jr *JobRun, webhookURL string, webhookType string) ([]byte, error) {
-	payload := bytes.Buffer{}
+// UnmarshalYAML accepts both a url and a mapping with the details of the call.
+func (w *Webhook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var u string
+	if err := unmarshal(&u); err == nil {
+		*w = Webhook{URL: u}
+		return nil
+	}
 
-	if webhookType == "slack" {
-		d := slackPayload{
-			Text: fmt.Sprintf("%s (exitcode %v):\n%s", jr.Name, jr.Status, jr.Log),
+	type webhook Webhook
+	var wh webhook
+	if err := unmarshal(&wh); err != nil {
+		return err
+	}
+	*w = Webhook(wh)
+	return nil
+}
+
+// MarshalYAML writes webhooks without any details as just their url.
+func (w Webhook) MarshalYAML() (interface{}, error) {
+	if w.Method == "" && len(w.Headers) == 0 && w.Body == "" {
+		return w.URL, nil
+	}
+
+	type webhook Webhook
+	return webhook(w), nil
+}
+
+func (w Webhook) method() string {
+	if w.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(w.Method)
+}
+
+func (w Webhook) validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("webhook without url")
+	}
+	switch w.method() {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Errorf("method of webhook '%s' should be one of GET, POST, PUT, PATCH or DELETE, got '%s'", w.URL, w.Method)
+	}
+	if _, err := template.New("body").Funcs(webhookTemplateFuncs(nil)).Parse(w.Body); err != nil {
+		return fmt.Errorf("can't parse body of webhook '%s' as template: %w", w.URL, err)
+	}
+	return nil
+}
+
+// ValidateWebhooks checks the details of the generic and Slack webhooks of the job's events.
+func (j *JobSpec) ValidateWebhooks() error {
+	for _, kind := range eventKinds {
+		for _, w := range j.event(kind).NotifyWebhook {
+			if err := w.validate(); err != nil {
+				return fmt.Errorf("%s of job '%s': %w", kind, j.Name, err)
+			}
+		}
+		for _, w := range j.event(kind).NotifySlackWebhook {
+			if err := w.validate(); err != nil {
+				return fmt.Errorf("%s of job '%s': %w", kind, j.Name, err)
+			}
 		}
+	}
+	return nil
+}
 
-		if err := json.NewEncoder(&payload).Encode(d); err != nil {
-			return []byte{}, err
+// ValidateWebhooks checks the details of the generic and Slack webhooks of the schedule wide events.
+func (s *Schedule) ValidateWebhooks() error {
+	for _, kind := range eventKinds {
+		for _, w := range s.event(kind).NotifyWebhook {
+			if err := w.validate(); err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
+		}
+		for _, w := range s.event(kind).NotifySlackWebhook {
+			if err := w.validate(); err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
 		}
+	}
+	return nil
+}
 
-	} else {
+// webhookTemplateFuncs are the functions available in the body of a webhook, same as in commands.
+func webhookTemplateFuncs(jr *JobRun) template.FuncMap {
+	if jr != nil && jr.jobRef != nil {
+		return jr.jobRef.templateFuncs()
+	}
+	return (&JobSpec{}).templateFuncs()
+}
+
+// call notifies the webhook about a run.
+func (w Webhook) call(ctx context.Context, jr *JobRun) ([]byte, error) {
+	payload := bytes.Buffer{}
+	if w.Body == "" {
 		if err := json.NewEncoder(&payload).Encode(jr); err != nil {
 			return []byte{}, err
 		}
+	} else {
+		tmpl, err := template.New("body").Funcs(webhookTemplateFuncs(jr)).Parse(w.Body)
+		if err != nil {
+			return []byte{}, err
+		}
+		if err := tmpl.Execute(&payload, jr); err != nil {
+			return []byte{}, err
+		}
 	}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(payload.Bytes()))
-	if err != nil {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		header.Set(k, os.ExpandEnv(v))
+	}
+
+	return deliverWebhook(ctx, notifyConfig(jr), "generic", w.method(), w.URL, header, payload.Bytes())
+}
+
+// discordMaxLength is the maximum length of the content of a Discord message.
+const discordMaxLength = 2000
+
+type discordPayload struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// webhookClient is the HTTP client all notifications get sent with.
+var webhookClient = http.DefaultClient
+
+// Colors of notifications for successful and failed runs.
+const (
+	colorSuccess = 0x2eb886
+	colorFailure = 0xd00000
+)
+
+// JobRunWebhookCall posts a run to a webhook in the format of the given type
+// of webhook, the call gets called off once ctx is done.
+func JobRunWebhookCall(ctx context.Context, jr *JobRun, webhookURL string, webhookType string) ([]byte, error) {
+	payload := bytes.Buffer{}
+
+	var d interface{}
+	switch webhookType {
+	case "slack":
+		d = newSlackPayload(jr)
+	case "discord":
+		d = newDiscordPayload(jr)
+	case "teams":
+		var publicURL string
+		if jr.jobRef != nil {
+			publicURL = jr.jobRef.cfg.PublicURL
+		}
+		d = newTeamsPayload(jr, publicURL)
+	default:
+		d = jr
+	}
+
+	if err := json.NewEncoder(&payload).Encode(d); err != nil {
 		return []byte{}, err
 	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	return deliverWebhook(ctx, notifyConfig(jr), webhookType, http.MethodPost, webhookURL, header, payload.Bytes())
+}
+
+// notifyConfig returns the config to send the notifications of a run with.
+func notifyConfig(jr *JobRun) Config {
+	if jr.jobRef != nil {
+		return jr.jobRef.cfg
+	}
+	return NewConfig()
+}
+
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	defaultWebhookRetries = 2
+)
+
+// webhookRetryDelay is the delay before the first retry of a webhook call, it doubles with every retry.
+var webhookRetryDelay = time.Second
+
+func (c Config) webhookTimeout() time.Duration {
+	if c.WebhookTimeout <= 0 {
+		return defaultWebhookTimeout
+	}
+	return c.WebhookTimeout
+}
+
+func (c Config) webhookRetries() int {
+	if c.WebhookRetries < 0 {
+		return 0
+	}
+	return c.WebhookRetries
+}
+
+// notifyDeadline is how long it takes at most to send a notification, retries included.
+func (c Config) notifyDeadline() time.Duration {
+	d := time.Duration(c.webhookRetries()+1) * c.webhookTimeout()
+	d += webhookRetryDelay * (1<<c.webhookRetries() - 1)
+	// email gets a timeout to connect and one for the conversation
+	if email := 2 * smtpTimeout; email > d {
+		d = email
+	}
+	return d
+}
+
+// retryableStatus tells whether a response points at a problem that might go away.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// deliverWebhook makes a webhook call, retrying with backoff when the endpoint
+// can't be reached or has a temporary problem. Every attempt is bound by the
+// configured timeout. A response outside of the 2xx range is an error, its
+// body is returned nonetheless. No more attempts are made once ctx is done.
+func deliverWebhook(ctx context.Context, cfg Config, webhookType string, method string, webhookURL string, header http.Header, body []byte) ([]byte, error) {
+	var resp_body []byte
+	var err error
+	var retry bool
+
+	ctx, end := traceWebhook(ctx, webhookType, method, webhookURL)
+	defer func() { end(err) }()
+
+	retries := cfg.webhookRetries()
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 && !sleepContext(ctx, webhookRetryDelay<<(attempt-1)) {
+			err = fmt.Errorf("%w, last attempt: %v", ctx.Err(), err)
+			retry = false
+			break
+		}
+
+		resp_body, retry, err = webhookAttempt(ctx, cfg.webhookTimeout(), method, webhookURL, header, body)
+		if err == nil || !retry {
+			break
+		}
+	}
+
+	runMetrics.webhookDelivered(webhookType, err == nil)
+	if err != nil && retry && retries > 0 {
+		err = fmt.Errorf("giving up after %v attempts: %w", retries+1, err)
+	}
+	return resp_body, err
+}
+
+// webhookAttempt makes a single webhook call and tells whether it is worth retrying when it failed.
+func webhookAttempt(ctx context.Context, timeout time.Duration, method string, webhookURL string, header http.Header, body []byte) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return []byte{}, false, err
+	}
+	req.Header = header.Clone()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return []byte{}, true, err
+	}
 	defer resp.Body.Close()
 
 	resp_body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, true, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp_body, retryableStatus(resp.StatusCode), fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return resp_body, false, nil
+}
+
+func newDiscordPayload(jr *JobRun) discordPayload {
+	content := fmt.Sprintf("%s (exitcode %v)", jr.Name, jr.Status)
+	if jr.succeeded() && jr.PreviousFailures > 0 {
+		content = fmt.Sprintf("%s recovered after %v failed runs (exitcode %v)", jr.Name, jr.PreviousFailures, jr.Status)
 	}
 
-	return resp_body, nil
+	color := colorSuccess
+	if !jr.succeeded() {
+		color = colorFailure
+	}
+
+	embed := discordEmbed{
+		Title: jr.Name,
+		Color: color,
+		Fields: []discordField{
+			{Name: "Status", Value: fmt.Sprint(jr.Status), Inline: true},
+			{Name: "Duration", Value: jr.Duration.Truncate(time.Millisecond).String(), Inline: true},
+			{Name: "Triggered by", Value: jr.TriggeredBy, Inline: true},
+		},
+	}
+	if log := jr.notifyLog(); log != "" {
+		// the code block markers count towards the limit as well
+		embed.Description = fmt.Sprintf("```\n%s\n```", logTail(log, discordMaxLength-8))
+	}
+
+	return discordPayload{
+		Content: truncate(content, discordMaxLength),
+		Embeds:  []discordEmbed{embed},
+	}
+}
+
+// teamsPayload is a Microsoft Teams MessageCard.
+type teamsPayload struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Sections        []teamsSection `json:"sections"`
+	PotentialAction []teamsAction  `json:"potentialAction,omitempty"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+	Text  string      `json:"text,omitempty"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+// teamsMaxLogLength is how much of the log is included in a Teams message.
+const teamsMaxLogLength = 2000
+
+// newTeamsPayload builds a MessageCard for a run, it links to the job in the
+// UI when publicURL is set.
+func newTeamsPayload(jr *JobRun, publicURL string) teamsPayload {
+	color := colorSuccess
+	title := fmt.Sprintf("%s succeeded", jr.Name)
+	if !jr.succeeded() {
+		color = colorFailure
+		title = fmt.Sprintf("%s failed", jr.Name)
+	}
+
+	section := teamsSection{
+		Facts: []teamsFact{
+			{Name: "Triggered by", Value: jr.TriggeredBy},
+			{Name: "Exit status", Value: fmt.Sprint(jr.Status)},
+			{Name: "Duration", Value: jr.Duration.Truncate(time.Millisecond).String()},
+		},
+	}
+	if log := jr.notifyLog(); log != "" {
+		section.Text = fmt.Sprintf("<pre>%s</pre>", html.EscapeString(logTail(log, teamsMaxLogLength)))
+	}
+
+	p := teamsPayload{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: fmt.Sprintf("%06x", color),
+		Summary:    title,
+		Title:      title,
+		Sections:   []teamsSection{section},
+	}
+	if publicURL != "" {
+		p.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "View in cheek",
+			Targets: []teamsTarget{{OS: "default", URI: fmt.Sprintf("%s/job/%s", strings.TrimSuffix(publicURL, "/"), url.PathEscape(jr.Name))}},
+		}}
+	}
+	return p
+}
+
+// logTail returns at most the last n characters of a log, a log that got cut starts with an ellipsis.
+func logTail(log string, n int) string {
+	if utf8.RuneCountInString(log) <= n {
+		return log
+	}
+	runes := []rune(log)
+	return "…" + string(runes[len(runes)-n+1:])
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
 }
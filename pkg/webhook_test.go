@@ -2,14 +2,19 @@ package cheek
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestJobRunWebhookCall(t *testing.T) {
@@ -38,7 +43,7 @@ func TestJobRunWebhookCall(t *testing.T) {
 		Log:         "this is a random log statement\nwith multiple lines\nand stuff",
 	}
 
-	resp_body, err = JobRunWebhookCall(&jr, testServer.URL, "generic")
+	resp_body, err = JobRunWebhookCall(context.Background(), &jr, testServer.URL, "generic")
 	assert.NoError(t, err)
 
 	jr2 := JobRun{}
@@ -48,7 +53,7 @@ func TestJobRunWebhookCall(t *testing.T) {
 	assert.Equal(t, jr, jr2)
 
 	// test slack webhook
-	resp_body, err = JobRunWebhookCall(&jr, testServer.URL, "slack")
+	resp_body, err = JobRunWebhookCall(context.Background(), &jr, testServer.URL, "slack")
 	assert.NoError(t, err)
 	assert.Contains(t, string(resp_body), "text\":\"test (exitcode 0)")
 
@@ -58,3 +63,196 @@ func TestJobRunWebhookCall(t *testing.T) {
 	assert.NotEmpty(t, sl.Text)
 
 }
+
+func TestDiscordWebhookCall(t *testing.T) {
+	var received discordPayload
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer testServer.Close()
+
+	jr := JobRun{
+		Status:      1,
+		Name:        "test",
+		TriggeredBy: "cron",
+		Duration:    1500 * time.Millisecond,
+		Log:         strings.Repeat("x", 3000) + "the end",
+	}
+
+	_, err := JobRunWebhookCall(context.Background(), &jr, testServer.URL, "discord")
+	assert.NoError(t, err)
+	assert.Equal(t, "test (exitcode 1)", received.Content)
+	if assert.Len(t, received.Embeds, 1) {
+		embed := received.Embeds[0]
+		assert.Equal(t, colorFailure, embed.Color)
+		assert.Equal(t, discordMaxLength, utf8.RuneCountInString(embed.Description))
+		assert.True(t, strings.HasSuffix(embed.Description, "the end\n```"))
+		assert.Equal(t, discordField{Name: "Duration", Value: "1.5s", Inline: true}, embed.Fields[1])
+	}
+
+	jr.Status = 0
+	jr.PreviousFailures = 3
+	jr.Log = ""
+	p := newDiscordPayload(&jr)
+	assert.Equal(t, "test recovered after 3 failed runs (exitcode 0)", p.Content)
+	assert.Equal(t, colorSuccess, p.Embeds[0].Color)
+	assert.Empty(t, p.Embeds[0].Description)
+}
+
+func TestTeamsPayload(t *testing.T) {
+	jr := JobRun{
+		Status:      2,
+		Name:        "my job",
+		TriggeredBy: "cron",
+		Duration:    2 * time.Second,
+		Log:         "<oops>",
+	}
+
+	p := newTeamsPayload(&jr, "https://cheek.example.com/")
+	assert.Equal(t, "MessageCard", p.Type)
+	assert.Equal(t, "d00000", p.ThemeColor)
+	assert.Equal(t, "my job failed", p.Title)
+	assert.Equal(t, []teamsFact{{"Triggered by", "cron"}, {"Exit status", "2"}, {"Duration", "2s"}}, p.Sections[0].Facts)
+	assert.Equal(t, "<pre>&lt;oops&gt;</pre>", p.Sections[0].Text)
+	assert.Equal(t, "https://cheek.example.com/job/my%20job", p.PotentialAction[0].Targets[0].URI)
+
+	jr.Status = 0
+	p = newTeamsPayload(&jr, "")
+	assert.Equal(t, "2eb886", p.ThemeColor)
+	assert.Equal(t, "my job succeeded", p.Title)
+	assert.Empty(t, p.PotentialAction)
+}
+
+func TestCustomWebhook(t *testing.T) {
+	var gotMethod, gotAuth, gotBody string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotAuth, gotBody = r.Method, r.Header.Get("Authorization"), string(body)
+	}))
+	defer testServer.Close()
+
+	t.Setenv("CHEEK_TEST_TOKEN", "s3cret")
+
+	specs := []byte(`
+- ` + testServer.URL + `
+- url: ` + testServer.URL + `
+  method: put
+  headers:
+    Authorization: Bearer ${CHEEK_TEST_TOKEN}
+  body: '{"job": "{{ .Name }}", "status": {{ .Status }}}'
+`)
+	var webhooks []Webhook
+	assert.NoError(t, yaml.Unmarshal(specs, &webhooks))
+	assert.Equal(t, Webhook{URL: testServer.URL}, webhooks[0])
+	for _, w := range webhooks {
+		assert.NoError(t, w.validate())
+	}
+
+	jr := JobRun{Name: "test", Status: 3, Log: "foo"}
+
+	// plain urls get the JobRun posted
+	_, err := webhooks[0].call(context.Background(), &jr)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, gotMethod)
+	assert.Empty(t, gotAuth)
+	assert.Contains(t, gotBody, `"log":"foo"`)
+
+	_, err = webhooks[1].call(context.Background(), &jr)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPut, gotMethod)
+	assert.Equal(t, "Bearer s3cret", gotAuth)
+	assert.Equal(t, `{"job": "test", "status": 3}`, gotBody)
+
+	// details survive a round trip, plain urls stay plain
+	out, err := yaml.Marshal(webhooks)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "- "+testServer.URL+"\n")
+	assert.Contains(t, string(out), "method: put")
+
+	assert.Error(t, Webhook{URL: testServer.URL, Method: "CONNECT"}.validate())
+	assert.Error(t, Webhook{URL: testServer.URL, Body: "{{ .Name "}.validate())
+	assert.Error(t, Webhook{}.validate())
+}
+
+func TestWebhookRetries(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	var calls int
+	failures := 2
+	code := http.StatusServiceUnavailable
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "payload", string(body))
+		if calls <= failures {
+			w.WriteHeader(code)
+		}
+	}))
+	defer testServer.Close()
+
+	cfg := Config{WebhookTimeout: time.Second, WebhookRetries: 2}
+
+	// temporary problems get retried
+	_, err := deliverWebhook(context.Background(), cfg, "retry_test", http.MethodPost, testServer.URL, http.Header{}, []byte("payload"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// until retries run out
+	calls, failures = 0, 5
+	_, err = deliverWebhook(context.Background(), cfg, "retry_test", http.MethodPost, testServer.URL, http.Header{}, []byte("payload"))
+	assert.EqualError(t, err, "giving up after 3 attempts: unexpected response status: 503 Service Unavailable")
+	assert.Equal(t, 3, calls)
+
+	// others don't
+	calls, code = 0, http.StatusBadRequest
+	_, err = deliverWebhook(context.Background(), cfg, "retry_test", http.MethodPost, testServer.URL, http.Header{}, []byte("payload"))
+	assert.EqualError(t, err, "unexpected response status: 400 Bad Request")
+	assert.Equal(t, 1, calls)
+
+	b := new(strings.Builder)
+	assert.NoError(t, runMetrics.write(b, 0, time.Now()))
+	assert.Contains(t, b.String(), "cheek_webhook_deliveries_total{type=\"retry_test\",result=\"success\"} 1\n")
+	assert.Contains(t, b.String(), "cheek_webhook_deliveries_total{type=\"retry_test\",result=\"failure\"} 2\n")
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer testServer.Close()
+	defer close(release)
+
+	cfg := Config{WebhookTimeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	_, err := deliverWebhook(context.Background(), cfg, "timeout_test", http.MethodPost, testServer.URL, http.Header{}, nil)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWebhookRetriesCalledOff(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Hour
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer testServer.Close()
+
+	cfg := Config{WebhookTimeout: time.Second, WebhookRetries: 2}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the wait for a retry ends with the context
+	start := time.Now()
+	_, err := deliverWebhook(ctx, cfg, "called_off_test", http.MethodPost, testServer.URL, http.Header{}, nil)
+	assert.EqualError(t, err, "context deadline exceeded, last attempt: unexpected response status: 503 Service Unavailable")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
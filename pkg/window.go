@@ -0,0 +1,224 @@
+package cheek
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+)
+
+// RunWindow limits the ticks of a job to a time of day, optionally on some
+// days of the week only. A window that ends before it starts runs overnight
+// and belongs to the day it starts on.
+type RunWindow struct {
+	Start string   `yaml:"start" json:"start"`
+	End   string   `yaml:"end" json:"end"`
+	Days  []string `yaml:"days,omitempty" json:"days,omitempty"`
+	// run ticks outside of the window once it opens instead of skipping them
+	Defer bool `yaml:"defer,omitempty" json:"defer,omitempty"`
+
+	start, end time.Duration
+	days       map[time.Weekday]bool
+}
+
+// Blackout is a period in which none of the jobs of a schedule run on their cron.
+type Blackout struct {
+	Start time.Time `yaml:"start" json:"start"`
+	End   time.Time `yaml:"end" json:"end"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseTimeOfDay parses a time of day like 22:00 into the time since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time of day like 22:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (j *JobSpec) ValidateWindow() error {
+	w := j.Window
+	if w == nil {
+		return nil
+	}
+	if j.Cron == "" && j.Interval == 0 && len(j.At) == 0 {
+		return fmt.Errorf("window for job '%s' needs a cron, interval or at", j.Name)
+	}
+
+	var err error
+	if w.start, err = parseTimeOfDay(w.Start); err != nil {
+		return fmt.Errorf("window start for job '%s': %w", j.Name, err)
+	}
+	if w.end, err = parseTimeOfDay(w.End); err != nil {
+		return fmt.Errorf("window end for job '%s': %w", j.Name, err)
+	}
+	if w.start == w.end {
+		return fmt.Errorf("window for job '%s' starts and ends at %s, it would never be open", j.Name, w.Start)
+	}
+
+	w.days = map[time.Weekday]bool{}
+	for _, d := range w.Days {
+		day, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return fmt.Errorf("window day '%s' for job '%s' should be one of mon, tue, wed, thu, fri, sat or sun", d, j.Name)
+		}
+		if w.days[day] {
+			return fmt.Errorf("window day '%s' for job '%s' is listed more than once", d, j.Name)
+		}
+		w.days[day] = true
+	}
+	return nil
+}
+
+// ValidateBlackouts checks that the blackout periods of the schedule end after
+// they start and don't overlap.
+func (s *Schedule) ValidateBlackouts() error {
+	for i, b := range s.Blackout {
+		if b.Start.IsZero() || b.End.IsZero() {
+			return fmt.Errorf("blackout %v needs a start and an end", i+1)
+		}
+		if !b.End.After(b.Start) {
+			return fmt.Errorf("blackout %v ends at %v, before it starts at %v", i+1, b.End.Format(time.RFC3339), b.Start.Format(time.RFC3339))
+		}
+		for k, other := range s.Blackout[:i] {
+			if b.Start.Before(other.End) && other.Start.Before(b.End) {
+				return fmt.Errorf("blackout %v overlaps with blackout %v, merge them into one", i+1, k+1)
+			}
+		}
+	}
+	return nil
+}
+
+// open tells whether t falls within the window, in the location of t.
+func (w *RunWindow) open(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	tod := t.Sub(midnight)
+	day := t.Weekday()
+
+	switch {
+	case w.start < w.end:
+		if tod < w.start || tod >= w.end {
+			return false
+		}
+	case tod >= w.start:
+	case tod < w.end:
+		// still in the window that opened the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return len(w.days) == 0 || w.days[day]
+}
+
+// next returns when the window opens next after t.
+func (w *RunWindow) next(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		d := t.AddDate(0, 0, i)
+		opens := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, t.Location()).Add(w.start)
+		if opens.After(t) && (len(w.days) == 0 || w.days[opens.Weekday()]) {
+			return opens
+		}
+	}
+	return time.Time{}
+}
+
+// blackout returns the blackout period refTime falls in, if any.
+func (s *Schedule) blackout(refTime time.Time) (Blackout, bool) {
+	for _, b := range s.Blackout {
+		if !refTime.Before(b.Start) && refTime.Before(b.End) {
+			return b, true
+		}
+	}
+	return Blackout{}, false
+}
+
+// maxWindowLookahead bounds how far a tick can get deferred.
+const maxWindowLookahead = 100
+
+// allowedAt tells when a job that is due at refTime can run: at refTime, later
+// once its window opens and no blackout holds it off, or not at all. The
+// caller holds s.mu.
+func (s *Schedule) allowedAt(j *JobSpec, refTime time.Time) (time.Time, bool) {
+	loc := s.loc
+	if j.loc != nil {
+		loc = j.loc
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	t := refTime.In(loc)
+	for i := 0; ; i++ {
+		if i == maxWindowLookahead {
+			s.log.Warn().Str("job", j.Name).Msgf("skipping tick at %v, its window does not open outside of the blackouts", refTime)
+			return time.Time{}, false
+		}
+		if b, ok := s.blackout(t); ok {
+			if j.Window == nil || !j.Window.Defer {
+				s.log.Debug().Str("job", j.Name).Msgf("skipping tick at %v, blackout until %v", refTime, b.End)
+				return time.Time{}, false
+			}
+			t = b.End.In(loc)
+			continue
+		}
+		if j.Window != nil && !j.Window.open(t) {
+			if !j.Window.Defer {
+				s.log.Debug().Str("job", j.Name).Msgf("skipping tick at %v, outside of its window", refTime)
+				return time.Time{}, false
+			}
+			if t = j.Window.next(t); t.IsZero() {
+				return time.Time{}, false
+			}
+			continue
+		}
+		break
+	}
+
+	if t.Equal(refTime) {
+		return refTime, true
+	}
+	if j.Cron != "" {
+		gronx := gronx.New()
+		if due, _ := gronx.IsDue(j.Cron, t); due {
+			s.log.Debug().Str("job", j.Name).Msgf("skipping tick at %v, the job is due at %v anyway", refTime, t)
+			return time.Time{}, false
+		}
+	}
+	// ticks that keep coming in while the window is closed run only once
+	if j.deferredTo.Equal(t) {
+		s.log.Debug().Str("job", j.Name).Msgf("skipping tick at %v, already deferred to %v", refTime, t)
+		return time.Time{}, false
+	}
+	j.deferredTo = t
+	s.log.Debug().Str("job", j.Name).Msgf("deferring tick at %v to %v", refTime, t)
+	return t, true
+}
+
+// holdOff determines when the jobs that became due at refTime can run, jobs
+// that are held off by a window or blackout are left out.
+func (s *Schedule) holdOff(due []*JobSpec, refTime time.Time) ([]*JobSpec, map[*JobSpec]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	allowed := []*JobSpec{}
+	at := map[*JobSpec]time.Time{}
+	for _, j := range due {
+		t, ok := s.allowedAt(j, refTime)
+		if !ok {
+			// there won't be a run to count the interval from
+			if j.waitsForFinish() {
+				j.nextTick = refTime.Add(j.Interval)
+			}
+			continue
+		}
+		allowed = append(allowed, j)
+		at[j] = t
+	}
+	return allowed, at
+}
@@ -0,0 +1,118 @@
+package cheek
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWindow(t *testing.T) {
+	ok := &JobSpec{Cron: "*/15 * * * *", Window: &RunWindow{Start: "22:00", End: "06:00", Days: []string{"Mon", "fri"}}}
+	assert.NoError(t, ok.ValidateWindow())
+	assert.Equal(t, 22*time.Hour, ok.Window.start)
+	assert.Equal(t, map[time.Weekday]bool{time.Monday: true, time.Friday: true}, ok.Window.days)
+
+	for _, w := range []*RunWindow{
+		{Start: "22:00"},
+		{Start: "25:00", End: "06:00"},
+		{Start: "06:00", End: "06:00"},
+		{Start: "22:00", End: "06:00", Days: []string{"monday"}},
+		{Start: "22:00", End: "06:00", Days: []string{"mon", "mon"}},
+	} {
+		assert.Error(t, (&JobSpec{Cron: "* * * * *", Window: w}).ValidateWindow(), w)
+	}
+	assert.Error(t, (&JobSpec{Window: &RunWindow{Start: "22:00", End: "06:00"}}).ValidateWindow())
+	assert.NoError(t, (&JobSpec{}).ValidateWindow())
+}
+
+func TestValidateBlackouts(t *testing.T) {
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := &Schedule{Blackout: []Blackout{{Start: day, End: day.Add(4 * time.Hour)}, {Start: day.Add(24 * time.Hour), End: day.Add(26 * time.Hour)}}}
+	assert.NoError(t, s.ValidateBlackouts())
+
+	s.Blackout = []Blackout{{Start: day, End: day.Add(-time.Hour)}}
+	assert.ErrorContains(t, s.ValidateBlackouts(), "before it starts")
+	s.Blackout = []Blackout{{Start: day}}
+	assert.Error(t, s.ValidateBlackouts())
+	s.Blackout = []Blackout{{Start: day, End: day.Add(4 * time.Hour)}, {Start: day.Add(3 * time.Hour), End: day.Add(5 * time.Hour)}}
+	assert.ErrorContains(t, s.ValidateBlackouts(), "overlaps")
+}
+
+func TestRunWindowOpen(t *testing.T) {
+	w := &RunWindow{Start: "22:00", End: "06:00", Days: []string{"mon"}}
+	assert.NoError(t, (&JobSpec{Cron: "* * * * *", Window: w}).ValidateWindow())
+
+	// 2024-07-01 is a monday, the window opened on it lasts into tuesday
+	monday := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	assert.False(t, w.open(monday.Add(2*time.Hour)))
+	assert.False(t, w.open(monday.Add(12*time.Hour)))
+	assert.True(t, w.open(monday.Add(22*time.Hour)))
+	assert.True(t, w.open(monday.Add(29*time.Hour)))
+	assert.False(t, w.open(monday.Add(30*time.Hour)))
+	assert.False(t, w.open(monday.Add(46*time.Hour)))
+
+	assert.Equal(t, monday.Add(22*time.Hour), w.next(monday.Add(12*time.Hour)))
+	assert.Equal(t, monday.Add(7*24*time.Hour+22*time.Hour), w.next(monday.Add(22*time.Hour)))
+
+	day := &RunWindow{Start: "09:00", End: "17:00"}
+	assert.NoError(t, (&JobSpec{Cron: "* * * * *", Window: day}).ValidateWindow())
+	assert.True(t, day.open(monday.Add(9*time.Hour)))
+	assert.False(t, day.open(monday.Add(17*time.Hour)))
+}
+
+func TestAllowedAt(t *testing.T) {
+	s := &Schedule{loc: time.UTC, log: NewLogger("debug", new(tsBuffer))}
+	j := &JobSpec{Name: "nightly", Cron: "*/15 * * * *", Window: &RunWindow{Start: "22:00", End: "06:00"}}
+	assert.NoError(t, j.ValidateWindow())
+	monday := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	at, ok := s.allowedAt(j, monday.Add(23*time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, monday.Add(23*time.Hour), at)
+	_, ok = s.allowedAt(j, monday.Add(12*time.Hour))
+	assert.False(t, ok)
+
+	// deferred ticks run once when the window opens, at a time the cron doesn't tick
+	j.Cron = "7 * * * *"
+	j.Window.Defer = true
+	at, ok = s.allowedAt(j, monday.Add(12*time.Hour+7*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, monday.Add(22*time.Hour), at)
+	_, ok = s.allowedAt(j, monday.Add(13*time.Hour+7*time.Minute))
+	assert.False(t, ok)
+
+	// nothing runs during a blackout, deferred ticks run once it is over
+	s.Blackout = []Blackout{{Start: monday.Add(21 * time.Hour), End: monday.Add(23*time.Hour + 30*time.Minute)}}
+	at, ok = s.allowedAt(j, monday.Add(14*time.Hour+7*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, monday.Add(23*time.Hour+30*time.Minute), at)
+
+	other := &JobSpec{Name: "other", Cron: "* * * * *"}
+	_, ok = s.allowedAt(other, monday.Add(22*time.Hour))
+	assert.False(t, ok)
+	_, ok = s.allowedAt(other, monday.Add(23*time.Hour+30*time.Minute))
+	assert.True(t, ok)
+}
+
+func TestBlackoutSpecs(t *testing.T) {
+	s, err := parseSpecs("schedule.yaml", []byte(`
+blackout:
+  - start: 2024-07-01T00:00:00Z
+    end: "2024-07-01T04:00:00Z"
+jobs:
+  nightly:
+    command: date
+    cron: "*/15 * * * *"
+    window:
+      start: "22:00"
+      end: "06:00"
+      days: [mon, tue]
+`))
+	assert.NoError(t, err)
+	if assert.Len(t, s.Blackout, 1) {
+		assert.Equal(t, 4*time.Hour, s.Blackout[0].End.Sub(s.Blackout[0].Start))
+	}
+	s.log = NewLogger("debug", new(tsBuffer))
+	assert.Empty(t, s.validate())
+}